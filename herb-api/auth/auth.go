@@ -0,0 +1,178 @@
+// Package auth authenticates API callers by their bearer JSON Web Token and maps
+// each of them to the Fabric identity that signs their transactions.
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Authentication modes
+const (
+	ModeNone  = "none"  // no authentication; every request acts as the server identity
+	ModeHS256 = "hs256" // tokens signed with a shared secret, for local testing
+	ModeJWKS  = "jwks"  // tokens signed with a key from a local JWKS file
+	ModeOIDC  = "oidc"  // tokens of an OpenID Connect provider, keys discovered from the issuer
+)
+
+// ErrInvalidToken is returned for a bearer token that is malformed, expired, or not
+// signed by a trusted key
+var ErrInvalidToken = errors.New("invalid bearer token")
+
+// Options configures an Authenticator
+type Options struct {
+	Mode        string
+	HS256Secret string
+	JWKSFile    string
+	Issuer      string // required for oidc; checked against the iss claim when set
+	Audience    string // checked against the aud claim when set
+	RolesClaim  string // claim holding the user's roles; a dotted path such as realm_access.roles reaches nested claims
+}
+
+// Roles checked by the API
+const (
+	RoleAdmin       = "admin"       // manages the identity wallet
+	RoleFarmer      = "farmer"      // registers harvests
+	RoleTransporter = "transporter" // picks up harvested batches
+	RoleLab         = "lab"         // receives, tests and certifies batches
+)
+
+// User is an authenticated API caller
+type User struct {
+	Subject string
+	Name    string
+	Roles   []string
+}
+
+// HasRole reports whether the user holds any of the given roles
+func (u *User) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		for _, held := range u.Roles {
+			if held == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Authenticator verifies bearer tokens
+type Authenticator struct {
+	keyfunc    jwt.Keyfunc
+	parser     *jwt.Parser
+	rolesClaim string
+}
+
+// New creates the Authenticator of the configured mode. It returns nil for ModeNone.
+// In oidc mode the signing keys are fetched from the issuer before New returns.
+func New(options Options) (*Authenticator, error) {
+	parserOptions := []jwt.ParserOption{
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(30 * time.Second),
+	}
+	if options.Issuer != "" {
+		parserOptions = append(parserOptions, jwt.WithIssuer(options.Issuer))
+	}
+	if options.Audience != "" {
+		parserOptions = append(parserOptions, jwt.WithAudience(options.Audience))
+	}
+
+	var keyfunc jwt.Keyfunc
+	switch options.Mode {
+	case ModeNone:
+		return nil, nil
+	case ModeHS256:
+		secret := []byte(options.HS256Secret)
+		keyfunc = func(*jwt.Token) (interface{}, error) {
+			return secret, nil
+		}
+		parserOptions = append(parserOptions, jwt.WithValidMethods([]string{"HS256"}))
+	case ModeJWKS:
+		keys, err := loadKeySetFile(options.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+		keyfunc = keys.keyfunc
+		parserOptions = append(parserOptions, jwt.WithValidMethods(asymmetricMethods))
+	case ModeOIDC:
+		keys, err := discoverKeySet(options.Issuer)
+		if err != nil {
+			return nil, err
+		}
+		keyfunc = keys.keyfunc
+		parserOptions = append(parserOptions, jwt.WithValidMethods(asymmetricMethods))
+	default:
+		return nil, fmt.Errorf("unknown authentication mode %q", options.Mode)
+	}
+
+	rolesClaim := options.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+
+	return &Authenticator{
+		keyfunc:    keyfunc,
+		parser:     jwt.NewParser(parserOptions...),
+		rolesClaim: rolesClaim,
+	}, nil
+}
+
+// Authenticate verifies a bearer token and returns the user it was issued to
+func (a *Authenticator) Authenticate(token string) (*User, error) {
+	claims := jwt.MapClaims{}
+	_, err := a.parser.ParseWithClaims(token, claims, a.keyfunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	subject, err := claims.GetSubject()
+	if err != nil || subject == "" {
+		return nil, fmt.Errorf("%w: the token has no subject", ErrInvalidToken)
+	}
+
+	user := &User{Subject: subject, Name: subject}
+	for _, claim := range []string{"preferred_username", "name"} {
+		if name, ok := claims[claim].(string); ok && name != "" {
+			user.Name = name
+			break
+		}
+	}
+	user.Roles = stringList(lookupClaim(claims, a.rolesClaim))
+
+	return user, nil
+}
+
+// lookupClaim follows a dotted path through nested claim objects
+func lookupClaim(claims map[string]interface{}, path string) interface{} {
+	var value interface{} = claims
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// stringList accepts a claim holding a list of strings or a single space separated string
+func stringList(value interface{}) []string {
+	switch value := value.(type) {
+	case []interface{}:
+		var items []string
+		for _, item := range value {
+			if s, ok := item.(string); ok {
+				items = append(items, s)
+			}
+		}
+		return items
+	case string:
+		return strings.Fields(value)
+	default:
+		return nil
+	}
+}
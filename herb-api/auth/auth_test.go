@@ -0,0 +1,244 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func signHS256(t *testing.T, secret string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+	require.NoError(t, err)
+	return token
+}
+
+func validClaims() jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": "farmer-ravi",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+}
+
+func TestNewModeNone(t *testing.T) {
+	authenticator, err := New(Options{Mode: ModeNone})
+	require.NoError(t, err)
+	require.Nil(t, authenticator)
+
+	_, err = New(Options{Mode: "basic"})
+	require.Error(t, err)
+}
+
+func TestAuthenticateHS256(t *testing.T) {
+	authenticator, err := New(Options{Mode: ModeHS256, HS256Secret: testSecret})
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["preferred_username"] = "Ravi Sharma"
+	claims["roles"] = []string{"farmer", "lab"}
+	user, err := authenticator.Authenticate(signHS256(t, testSecret, claims))
+	require.NoError(t, err)
+	require.Equal(t, "farmer-ravi", user.Subject)
+	require.Equal(t, "Ravi Sharma", user.Name)
+	require.True(t, user.HasRole(RoleFarmer))
+	require.True(t, user.HasRole(RoleAdmin, RoleLab))
+	require.False(t, user.HasRole(RoleAdmin))
+
+	user, err = authenticator.Authenticate(signHS256(t, testSecret, validClaims()))
+	require.NoError(t, err)
+	require.Equal(t, "farmer-ravi", user.Name, "the name defaults to the subject")
+	require.Empty(t, user.Roles)
+}
+
+func TestAuthenticateRejectsInvalidTokens(t *testing.T) {
+	authenticator, err := New(Options{Mode: ModeHS256, HS256Secret: testSecret, Issuer: "https://id.example.com", Audience: "herb-api"})
+	require.NoError(t, err)
+
+	valid := func() jwt.MapClaims {
+		claims := validClaims()
+		claims["iss"] = "https://id.example.com"
+		claims["aud"] = "herb-api"
+		return claims
+	}
+	_, err = authenticator.Authenticate(signHS256(t, testSecret, valid()))
+	require.NoError(t, err)
+
+	expired := valid()
+	expired["exp"] = time.Now().Add(-time.Hour).Unix()
+	noExpiry := valid()
+	delete(noExpiry, "exp")
+	noSubject := valid()
+	delete(noSubject, "sub")
+	wrongIssuer := valid()
+	wrongIssuer["iss"] = "https://evil.example.com"
+	wrongAudience := valid()
+	wrongAudience["aud"] = "other-api"
+
+	tokens := map[string]string{
+		"malformed":      "not-a-token",
+		"wrong secret":   signHS256(t, "fedcba9876543210fedcba9876543210", valid()),
+		"expired":        signHS256(t, testSecret, expired),
+		"no expiry":      signHS256(t, testSecret, noExpiry),
+		"no subject":     signHS256(t, testSecret, noSubject),
+		"wrong issuer":   signHS256(t, testSecret, wrongIssuer),
+		"wrong audience": signHS256(t, testSecret, wrongAudience),
+	}
+	for name, token := range tokens {
+		_, err := authenticator.Authenticate(token)
+		require.ErrorIs(t, err, ErrInvalidToken, name)
+	}
+}
+
+func TestAuthenticateNestedRolesClaim(t *testing.T) {
+	authenticator, err := New(Options{Mode: ModeHS256, HS256Secret: testSecret, RolesClaim: "realm_access.roles"})
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["realm_access"] = map[string]interface{}{"roles": []string{"transporter"}}
+	user, err := authenticator.Authenticate(signHS256(t, testSecret, claims))
+	require.NoError(t, err)
+	require.Equal(t, []string{RoleTransporter}, user.Roles)
+
+	authenticator, err = New(Options{Mode: ModeHS256, HS256Secret: testSecret, RolesClaim: "scope"})
+	require.NoError(t, err)
+	claims = validClaims()
+	claims["scope"] = "farmer lab"
+	user, err = authenticator.Authenticate(signHS256(t, testSecret, claims))
+	require.NoError(t, err)
+	require.Equal(t, []string{RoleFarmer, RoleLab}, user.Roles)
+}
+
+// keySetJSON returns a key set holding the public key of privateKey under kid
+func keySetJSON(t *testing.T, kid string, privateKey *ecdsa.PrivateKey) []byte {
+	t.Helper()
+
+	encode := base64.RawURLEncoding.EncodeToString
+	set := map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "EC",
+			"kid": kid,
+			"use": "sig",
+			"crv": "P-256",
+			"x":   encode(privateKey.X.FillBytes(make([]byte, 32))),
+			"y":   encode(privateKey.Y.FillBytes(make([]byte, 32))),
+		}},
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	return data
+}
+
+// writeJWKS writes a key set holding the public key of privateKey under kid
+func writeJWKS(t *testing.T, kid string, privateKey *ecdsa.PrivateKey) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, keySetJSON(t, kid, privateKey), 0600))
+	return path
+}
+
+func signES256(t *testing.T, kid string, key *ecdsa.PrivateKey, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestAuthenticateJWKS(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	authenticator, err := New(Options{Mode: ModeJWKS, JWKSFile: writeJWKS(t, "key-1", privateKey)})
+	require.NoError(t, err)
+
+	sign := func(kid string, key *ecdsa.PrivateKey) string {
+		return signES256(t, kid, key, validClaims())
+	}
+
+	user, err := authenticator.Authenticate(sign("key-1", privateKey))
+	require.NoError(t, err)
+	require.Equal(t, "farmer-ravi", user.Subject)
+
+	_, err = authenticator.Authenticate(sign("", privateKey))
+	require.NoError(t, err, "a single key also verifies tokens without a kid")
+
+	_, err = authenticator.Authenticate(sign("key-2", privateKey))
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	_, err = authenticator.Authenticate(sign("key-1", otherKey))
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	// a token signed with HMAC over the public key must not pass as an asymmetric one
+	_, err = authenticator.Authenticate(signHS256(t, testSecret, validClaims()))
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestLoadKeySetFileRejectsInvalidKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jwks.json")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[]}`), 0600))
+	_, err := loadKeySetFile(path)
+	require.Error(t, err)
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[{"kty":"EC","kid":"k","crv":"P-256","x":"AQ","y":"AQ"}]}`), 0600))
+	_, err = loadKeySetFile(path)
+	require.ErrorContains(t, err, "not on curve")
+
+	require.NoError(t, os.WriteFile(path, []byte(`{"keys":[{"kty":"oct","kid":"k"}]}`), 0600))
+	_, err = loadKeySetFile(path)
+	require.ErrorContains(t, err, "unsupported key type")
+}
+
+func TestAuthenticateOIDC(t *testing.T) {
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	var issuer string
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/.well-known/openid-configuration":
+			json.NewEncoder(w).Encode(map[string]string{"issuer": issuer, "jwks_uri": issuer + "/certs"})
+		case "/certs":
+			w.Write(keySetJSON(t, "key-1", privateKey))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer provider.Close()
+	issuer = provider.URL
+
+	authenticator, err := New(Options{Mode: ModeOIDC, Issuer: issuer})
+	require.NoError(t, err)
+
+	claims := validClaims()
+	claims["iss"] = issuer
+	_, err = authenticator.Authenticate(signES256(t, "key-1", privateKey, claims))
+	require.NoError(t, err)
+
+	claims["iss"] = "https://evil.example.com"
+	_, err = authenticator.Authenticate(signES256(t, "key-1", privateKey, claims))
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	_, err = New(Options{Mode: ModeOIDC, Issuer: issuer + "/realms/other"})
+	require.Error(t, err, "the discovery document must name the configured issuer")
+}
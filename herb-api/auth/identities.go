@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"herb-api/services"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrNoIdentity is returned for an authenticated user without a Fabric identity
+var ErrNoIdentity = errors.New("no Fabric identity is enrolled for the user")
+
+// IdentityStore finds the Fabric identity that signs the transactions of a user
+type IdentityStore interface {
+	Identity(subject string) (*services.Identity, error)
+}
+
+// FileIdentityStore maps users to identities listed in a YAML file, e.g.
+//
+//	identities:
+//	  - subject: farmer-ravi
+//	    mspId: Org1MSP
+//	    certPath: /etc/herb-api/msp/ravi/signcerts
+//	    keyPath: /etc/herb-api/msp/ravi/keystore
+//
+// The certificates and keys are read once, when the file is loaded.
+type FileIdentityStore struct {
+	identities map[string]*services.Identity
+}
+
+// LoadIdentityFile reads an identity mapping file
+func LoadIdentityFile(path string) (*FileIdentityStore, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read identity file: %v", err)
+	}
+
+	var file struct {
+		Identities []struct {
+			Subject  string `yaml:"subject"`
+			MSPID    string `yaml:"mspId"`
+			CertPath string `yaml:"certPath"`
+			KeyPath  string `yaml:"keyPath"`
+		} `yaml:"identities"`
+	}
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse identity file %s: %v", path, err)
+	}
+
+	store := &FileIdentityStore{identities: map[string]*services.Identity{}}
+	for i, entry := range file.Identities {
+		if entry.Subject == "" || entry.MSPID == "" {
+			return nil, fmt.Errorf("identity %d in %s: a subject and mspId are required", i+1, path)
+		}
+		if _, exists := store.identities[entry.Subject]; exists {
+			return nil, fmt.Errorf("identity %d in %s: the subject %s is listed twice", i+1, path, entry.Subject)
+		}
+
+		identity, err := services.LoadIdentity(entry.MSPID, entry.CertPath, entry.KeyPath)
+		if err != nil {
+			return nil, fmt.Errorf("identity of %s in %s: %v", entry.Subject, path, err)
+		}
+		store.identities[entry.Subject] = identity
+	}
+
+	return store, nil
+}
+
+// Identity returns the identity of the user with the given subject
+func (s *FileIdentityStore) Identity(subject string) (*services.Identity, error) {
+	identity, ok := s.identities[subject]
+	if !ok {
+		return nil, ErrNoIdentity
+	}
+	return identity, nil
+}
+
+// IdentityStores looks a user up in each store in turn, so that identities can be
+// listed in a file and enrolled into the wallet side by side
+type IdentityStores []IdentityStore
+
+// Identity returns the identity from the first store that knows the subject. Only a
+// bare ErrNoIdentity moves on to the next store: a wrapped one, such as a revoked
+// wallet identity, is final.
+func (stores IdentityStores) Identity(subject string) (*services.Identity, error) {
+	for _, store := range stores {
+		identity, err := store.Identity(subject)
+		if err == ErrNoIdentity {
+			continue
+		}
+		return identity, err
+	}
+	return nil, ErrNoIdentity
+}
@@ -0,0 +1,140 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"herb-api/services"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeTestIdentity writes a self-signed certificate for name and its private key to
+// dir and returns their paths
+func writeTestIdentity(t *testing.T, dir string, name string) (string, string) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, name+"-cert.pem")
+	keyPath := filepath.Join(dir, name+"-key.pem")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0600))
+	return certPath, keyPath
+}
+
+func writeIdentityFile(t *testing.T, dir string, content string) string {
+	t.Helper()
+
+	path := filepath.Join(dir, "identities.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadIdentityFile(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestIdentity(t, dir, "ravi")
+
+	store, err := LoadIdentityFile(writeIdentityFile(t, dir, fmt.Sprintf(`
+identities:
+  - subject: farmer-ravi
+    mspId: Org1MSP
+    certPath: %s
+    keyPath: %s
+`, certPath, keyPath)))
+	require.NoError(t, err)
+
+	identity, err := store.Identity("farmer-ravi")
+	require.NoError(t, err)
+	require.Equal(t, "Org1MSP", identity.MSPID)
+	require.Equal(t, "ravi", identity.Certificate.Subject.CommonName)
+
+	_, err = store.Identity("lab-priya")
+	require.Equal(t, ErrNoIdentity, err)
+}
+
+func TestLoadIdentityFileRejectsInvalidEntries(t *testing.T) {
+	dir := t.TempDir()
+	certPath, keyPath := writeTestIdentity(t, dir, "ravi")
+	_, otherKeyPath := writeTestIdentity(t, dir, "priya")
+
+	files := map[string]string{
+		"no msp": fmt.Sprintf(`
+identities:
+  - subject: farmer-ravi
+    certPath: %s
+    keyPath: %s
+`, certPath, keyPath),
+		"duplicate subject": fmt.Sprintf(`
+identities:
+  - {subject: farmer-ravi, mspId: Org1MSP, certPath: %[1]s, keyPath: %[2]s}
+  - {subject: farmer-ravi, mspId: Org1MSP, certPath: %[1]s, keyPath: %[2]s}
+`, certPath, keyPath),
+		"mismatched key": fmt.Sprintf(`
+identities:
+  - {subject: farmer-ravi, mspId: Org1MSP, certPath: %s, keyPath: %s}
+`, certPath, otherKeyPath),
+	}
+	for name, content := range files {
+		_, err := LoadIdentityFile(writeIdentityFile(t, dir, content))
+		require.Error(t, err, name)
+	}
+}
+
+// identityMap is an IdentityStore whose subjects map to the error their lookup
+// returns, or nil for an identity of their own
+type identityMap map[string]error
+
+func (m identityMap) Identity(subject string) (*services.Identity, error) {
+	err, ok := m[subject]
+	if !ok {
+		return nil, ErrNoIdentity
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &services.Identity{MSPID: subject}, nil
+}
+
+func TestIdentityStores(t *testing.T) {
+	revoked := fmt.Errorf("%w: the identity was revoked", ErrNoIdentity)
+	stores := IdentityStores{
+		identityMap{"farmer-ravi": nil, "lab-priya": revoked},
+		identityMap{"lab-priya": nil, "transporter-suresh": nil},
+	}
+
+	identity, err := stores.Identity("farmer-ravi")
+	require.NoError(t, err)
+	require.Equal(t, "farmer-ravi", identity.MSPID)
+
+	identity, err = stores.Identity("transporter-suresh")
+	require.NoError(t, err)
+	require.Equal(t, "transporter-suresh", identity.MSPID)
+
+	_, err = stores.Identity("lab-priya")
+	require.Equal(t, revoked, err, "a wrapped ErrNoIdentity is final")
+
+	_, err = stores.Identity("unknown")
+	require.Equal(t, ErrNoIdentity, err)
+}
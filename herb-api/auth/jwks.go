@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// asymmetricMethods are the signing algorithms accepted for keys of a key set
+var asymmetricMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512", "EdDSA"}
+
+// minRefreshInterval limits how often a remote key set is fetched again when a token
+// names an unknown key
+const minRefreshInterval = time.Minute
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// jsonWebKey is a public key of a JSON Web Key Set (RFC 7517)
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// keySet holds the verification keys by key ID. A remote key set is fetched again
+// from its URL when a token names a key it does not hold, as after a key rotation.
+type keySet struct {
+	mu          sync.Mutex
+	keys        map[string]interface{}
+	url         string
+	lastFetched time.Time
+}
+
+func loadKeySetFile(path string) (*keySet, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read JWKS file: %v", err)
+	}
+
+	keys, err := parseKeySet(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JWKS file %s: %v", path, err)
+	}
+
+	return &keySet{keys: keys}, nil
+}
+
+// discoverKeySet fetches the key set named by the OpenID Connect discovery document of issuer
+func discoverKeySet(issuer string) (*keySet, error) {
+	var discovery struct {
+		Issuer  string `json:"issuer"`
+		JWKSURI string `json:"jwks_uri"`
+	}
+	discoveryURL := strings.TrimSuffix(issuer, "/") + "/.well-known/openid-configuration"
+	err := fetchJSON(discoveryURL, &discovery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover OpenID provider %s: %v", issuer, err)
+	}
+	if discovery.Issuer != issuer {
+		return nil, fmt.Errorf("the OpenID provider identifies as %q, not %q", discovery.Issuer, issuer)
+	}
+	if discovery.JWKSURI == "" {
+		return nil, fmt.Errorf("the OpenID provider %s publishes no jwks_uri", issuer)
+	}
+
+	keys := &keySet{url: discovery.JWKSURI}
+	err = keys.refresh()
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (ks *keySet) refresh() error {
+	var raw json.RawMessage
+	err := fetchJSON(ks.url, &raw)
+	if err != nil {
+		return fmt.Errorf("failed to fetch JWKS: %v", err)
+	}
+	keys, err := parseKeySet(raw)
+	if err != nil {
+		return fmt.Errorf("invalid JWKS at %s: %v", ks.url, err)
+	}
+
+	ks.keys = keys
+	ks.lastFetched = time.Now()
+	return nil
+}
+
+// keyfunc returns the key a token was signed with, selected by its kid header. A key
+// set holding a single key also verifies tokens without a kid.
+func (ks *keySet) keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key, ok := ks.lookup(kid); ok {
+		return key, nil
+	}
+	if ks.url != "" && time.Since(ks.lastFetched) >= minRefreshInterval {
+		if err := ks.refresh(); err != nil {
+			return nil, err
+		}
+		if key, ok := ks.lookup(kid); ok {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (ks *keySet) lookup(kid string) (interface{}, bool) {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key, true
+		}
+	}
+	key, ok := ks.keys[kid]
+	return key, ok
+}
+
+func parseKeySet(data []byte) (map[string]interface{}, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]interface{}{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q: %v", jwk.Kid, err)
+		}
+		keys[jwk.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no signing keys found")
+	}
+
+	return keys, nil
+}
+
+func (jwk jsonWebKey) publicKey() (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := decodeBigInt(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch jwk.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := decodeBigInt(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(jwk.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("the point is not on curve %s", jwk.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid Ed25519 public key")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+func decodeBigInt(value string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil || len(data) == 0 {
+		return nil, fmt.Errorf("invalid key parameter %q", value)
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func fetchJSON(url string, v interface{}) error {
+	response, err := httpClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %s", url, response.Status)
+	}
+	return json.NewDecoder(response.Body).Decode(v)
+}
@@ -0,0 +1,578 @@
+// Package config loads the herb-api server configuration from an optional YAML file
+// and environment variable overrides, so the same binary runs on a developer's
+// machine, on staging and on each organisation's production servers.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"herb-api/auth"
+	"herb-api/services"
+	"herb-api/wallet"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Ledger backends
+const (
+	BackendFabric = "fabric"
+	BackendMemory = "memory"
+)
+
+// Config is the complete server configuration
+type Config struct {
+	Server ServerConfig `yaml:"server"`
+	Ledger LedgerConfig `yaml:"ledger"`
+	Fabric FabricConfig `yaml:"fabric"`
+	Auth   AuthConfig   `yaml:"auth"`
+	Wallet WalletConfig `yaml:"wallet"`
+	CA     CAConfig     `yaml:"ca"`
+	Labels LabelsConfig `yaml:"labels"`
+	Verify VerifyConfig `yaml:"verify"`
+}
+
+// ServerConfig configures the HTTP listener
+type ServerConfig struct {
+	ListenAddress  string        `yaml:"listenAddress"`
+	PublicURL      string        `yaml:"publicURL"` // base URL encoded in batch QR codes; QR codes and labels are disabled without it
+	TLS            TLSConfig     `yaml:"tls"`
+	CORSOrigins    []string      `yaml:"corsOrigins"`    // allowed browser origins, or "*" for any; none by default
+	TrustedProxies []string      `yaml:"trustedProxies"` // IPs or CIDRs of reverse proxies whose X-Forwarded-For gives the client address
+	ReadTimeout    time.Duration `yaml:"readTimeout"`
+	WriteTimeout   time.Duration `yaml:"writeTimeout"`
+}
+
+// TLSConfig enables HTTPS when both files are set
+type TLSConfig struct {
+	CertFile string `yaml:"certFile"`
+	KeyFile  string `yaml:"keyFile"`
+}
+
+// Enabled reports whether the server should serve HTTPS
+func (t TLSConfig) Enabled() bool {
+	return t.CertFile != "" || t.KeyFile != ""
+}
+
+// LedgerConfig selects the ledger backend
+type LedgerConfig struct {
+	Backend string `yaml:"backend"` // "fabric", or "memory" for local development in builds with -tags dev
+}
+
+// FabricConfig locates the gateway peer, the client identity and the chaincode
+type FabricConfig struct {
+	PeerEndpoint  string         `yaml:"peerEndpoint"`  // host:port of the gateway peer
+	PeerHostAlias string         `yaml:"peerHostAlias"` // TLS server name of the gateway peer
+	TLSCertPath   string         `yaml:"tlsCertPath"`   // PEM CA certificate of the peer's TLS certificate
+	MSPID         string         `yaml:"mspId"`
+	CertPath      string         `yaml:"certPath"` // PEM client certificate, or its MSP signcerts directory
+	KeyPath       string         `yaml:"keyPath"`  // PEM PKCS#8 client private key, or its MSP keystore directory
+	Channel       string         `yaml:"channel"`
+	Chaincode     string         `yaml:"chaincode"`
+	Timeouts      FabricTimeouts `yaml:"timeouts"`
+}
+
+// FabricTimeouts are the deadlines of the calls to the gateway peer
+type FabricTimeouts struct {
+	Evaluate     time.Duration `yaml:"evaluate"`
+	Endorse      time.Duration `yaml:"endorse"`
+	Submit       time.Duration `yaml:"submit"`
+	CommitStatus time.Duration `yaml:"commitStatus"`
+}
+
+// AuthConfig configures bearer token authentication and the mapping of users to
+// their Fabric identities
+type AuthConfig struct {
+	Mode           string `yaml:"mode"`           // none, hs256, jwks or oidc
+	AllowAnonymous bool   `yaml:"allowAnonymous"` // confirms mode none with the fabric backend, where every caller acts as the server identity
+	HS256Secret    string `yaml:"hs256Secret"`    // shared secret of hs256 tokens, at least 32 bytes
+	JWKSFile       string `yaml:"jwksFile"`       // verification keys of jwks mode
+	Issuer         string `yaml:"issuer"`         // OpenID provider of oidc mode; checked against the iss claim when set
+	Audience       string `yaml:"audience"`       // checked against the aud claim when set
+	RolesClaim     string `yaml:"rolesClaim"`     // claim holding the user's roles, e.g. realm_access.roles
+	IdentitiesFile string `yaml:"identitiesFile"` // YAML mapping of token subjects to Fabric identities
+}
+
+// WalletConfig enables the encrypted identity wallet when a directory is set
+type WalletConfig struct {
+	Directory     string `yaml:"directory"`     // where the encrypted identities are kept
+	MasterKey     string `yaml:"masterKey"`     // base64 AES-256 key; prefer masterKeyFile or the environment
+	MasterKeyFile string `yaml:"masterKeyFile"` // file holding the raw or base64 master key
+}
+
+// Enabled reports whether the server keeps a wallet
+func (w WalletConfig) Enabled() bool {
+	return w.Directory != ""
+}
+
+// CAConfig enables enrollment of wallet identities against a Fabric CA when a URL is set
+type CAConfig struct {
+	URL             string        `yaml:"url"`             // e.g. https://localhost:7054
+	Name            string        `yaml:"name"`            // CA name, for a server hosting several CAs
+	TLSCertPath     string        `yaml:"tlsCertPath"`     // PEM CA certificate of the CA server's TLS certificate
+	MSPID           string        `yaml:"mspId"`           // MSP of the identities the CA issues; defaults to fabric.mspId
+	RegistrarID     string        `yaml:"registrarId"`     // CA identity allowed to register users
+	RegistrarSecret string        `yaml:"registrarSecret"` // its enrollment secret
+	Timeout         time.Duration `yaml:"timeout"`
+}
+
+// Enabled reports whether identities can be enrolled against a Fabric CA
+func (c CAConfig) Enabled() bool {
+	return c.URL != ""
+}
+
+// LabelsConfig configures printable batch labels
+type LabelsConfig struct {
+	FontFile string `yaml:"fontFile"` // TrueType font for label text outside Windows-1252, e.g. Noto Sans
+}
+
+// VerifyConfig limits the public batch verification endpoint, which needs no
+// authentication, per client IP address
+type VerifyConfig struct {
+	RequestsPerMinute int `yaml:"requestsPerMinute"`
+	Burst             int `yaml:"burst"`
+}
+
+// Default returns the configuration used when nothing is overridden: plain HTTP on
+// :8080 and User1 of Org1 in ../test-network
+func Default() *Config {
+	org1 := "../test-network/organizations/peerOrganizations/org1.example.com"
+	return &Config{
+		Server: ServerConfig{
+			ListenAddress: ":8080",
+			ReadTimeout:   15 * time.Second,
+			WriteTimeout:  2 * time.Minute,
+		},
+		Ledger: LedgerConfig{
+			Backend: BackendFabric,
+		},
+		Fabric: FabricConfig{
+			PeerEndpoint:  "localhost:7051",
+			PeerHostAlias: "peer0.org1.example.com",
+			TLSCertPath:   org1 + "/peers/peer0.org1.example.com/tls/ca.crt",
+			MSPID:         "Org1MSP",
+			CertPath:      org1 + "/users/User1@org1.example.com/msp/signcerts",
+			KeyPath:       org1 + "/users/User1@org1.example.com/msp/keystore",
+			Channel:       "herbtrace-temp",
+			Chaincode:     "herbbatch",
+			Timeouts: FabricTimeouts{
+				Evaluate:     services.DefaultGatewayTimeouts.Evaluate,
+				Endorse:      services.DefaultGatewayTimeouts.Endorse,
+				Submit:       services.DefaultGatewayTimeouts.Submit,
+				CommitStatus: services.DefaultGatewayTimeouts.CommitStatus,
+			},
+		},
+		Auth: AuthConfig{
+			Mode:       auth.ModeNone,
+			RolesClaim: "roles",
+		},
+		CA: CAConfig{
+			Timeout: 30 * time.Second,
+		},
+		Verify: VerifyConfig{
+			RequestsPerMinute: 30,
+			Burst:             10,
+		},
+	}
+}
+
+// Load builds the configuration from the defaults, the YAML file at path when path
+// is not empty, and the environment variables listed in envOverrides, in that
+// order, and validates the result
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	if path != "" {
+		err := config.loadFile(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	err := config.applyEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	err = config.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	return config, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %v", err)
+	}
+	defer file.Close()
+
+	decoder := yaml.NewDecoder(file)
+	decoder.KnownFields(true)
+	err = decoder.Decode(c)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+
+	return nil
+}
+
+// envOverride names the environment variable that overrides a setting
+type envOverride struct {
+	name    string
+	setting interface{} // *string, *[]string, *int, *bool or *time.Duration
+}
+
+func (c *Config) envOverrides() []envOverride {
+	return []envOverride{
+		{"HERB_API_LISTEN_ADDRESS", &c.Server.ListenAddress},
+		{"HERB_API_PUBLIC_URL", &c.Server.PublicURL},
+		{"HERB_API_TLS_CERT_FILE", &c.Server.TLS.CertFile},
+		{"HERB_API_TLS_KEY_FILE", &c.Server.TLS.KeyFile},
+		{"HERB_API_CORS_ORIGINS", &c.Server.CORSOrigins},
+		{"HERB_API_TRUSTED_PROXIES", &c.Server.TrustedProxies},
+		{"HERB_API_READ_TIMEOUT", &c.Server.ReadTimeout},
+		{"HERB_API_WRITE_TIMEOUT", &c.Server.WriteTimeout},
+		{"HERB_LEDGER_BACKEND", &c.Ledger.Backend},
+		{"FABRIC_PEER_ENDPOINT", &c.Fabric.PeerEndpoint},
+		{"FABRIC_PEER_HOST_ALIAS", &c.Fabric.PeerHostAlias},
+		{"FABRIC_TLS_CERT_PATH", &c.Fabric.TLSCertPath},
+		{"FABRIC_MSP_ID", &c.Fabric.MSPID},
+		{"FABRIC_CERT_PATH", &c.Fabric.CertPath},
+		{"FABRIC_KEY_PATH", &c.Fabric.KeyPath},
+		{"FABRIC_CHANNEL", &c.Fabric.Channel},
+		{"FABRIC_CHAINCODE", &c.Fabric.Chaincode},
+		{"FABRIC_EVALUATE_TIMEOUT", &c.Fabric.Timeouts.Evaluate},
+		{"FABRIC_ENDORSE_TIMEOUT", &c.Fabric.Timeouts.Endorse},
+		{"FABRIC_SUBMIT_TIMEOUT", &c.Fabric.Timeouts.Submit},
+		{"FABRIC_COMMIT_STATUS_TIMEOUT", &c.Fabric.Timeouts.CommitStatus},
+		{"HERB_API_AUTH_MODE", &c.Auth.Mode},
+		{"HERB_API_AUTH_ALLOW_ANONYMOUS", &c.Auth.AllowAnonymous},
+		{"HERB_API_AUTH_HS256_SECRET", &c.Auth.HS256Secret},
+		{"HERB_API_AUTH_JWKS_FILE", &c.Auth.JWKSFile},
+		{"HERB_API_AUTH_ISSUER", &c.Auth.Issuer},
+		{"HERB_API_AUTH_AUDIENCE", &c.Auth.Audience},
+		{"HERB_API_AUTH_ROLES_CLAIM", &c.Auth.RolesClaim},
+		{"HERB_API_AUTH_IDENTITIES_FILE", &c.Auth.IdentitiesFile},
+		{"HERB_API_WALLET_DIRECTORY", &c.Wallet.Directory},
+		{"HERB_API_WALLET_MASTER_KEY", &c.Wallet.MasterKey},
+		{"HERB_API_WALLET_MASTER_KEY_FILE", &c.Wallet.MasterKeyFile},
+		{"HERB_API_CA_URL", &c.CA.URL},
+		{"HERB_API_CA_NAME", &c.CA.Name},
+		{"HERB_API_CA_TLS_CERT_PATH", &c.CA.TLSCertPath},
+		{"HERB_API_CA_MSP_ID", &c.CA.MSPID},
+		{"HERB_API_CA_REGISTRAR_ID", &c.CA.RegistrarID},
+		{"HERB_API_CA_REGISTRAR_SECRET", &c.CA.RegistrarSecret},
+		{"HERB_API_CA_TIMEOUT", &c.CA.Timeout},
+		{"HERB_API_LABEL_FONT_FILE", &c.Labels.FontFile},
+		{"HERB_API_VERIFY_REQUESTS_PER_MINUTE", &c.Verify.RequestsPerMinute},
+		{"HERB_API_VERIFY_BURST", &c.Verify.Burst},
+	}
+}
+
+// applyEnv overrides the settings whose environment variable is set. Lists are
+// comma separated and durations use Go syntax, e.g. 30s or 2m.
+func (c *Config) applyEnv() error {
+	for _, override := range c.envOverrides() {
+		value := os.Getenv(override.name)
+		if value == "" {
+			continue
+		}
+
+		switch setting := override.setting.(type) {
+		case *string:
+			*setting = value
+		case *[]string:
+			*setting = splitList(value)
+		case *int:
+			number, err := strconv.Atoi(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %q is not a whole number", override.name, value)
+			}
+			*setting = number
+		case *bool:
+			flag, err := strconv.ParseBool(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %q is not true or false", override.name, value)
+			}
+			*setting = flag
+		case *time.Duration:
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return fmt.Errorf("invalid %s: %v", override.name, err)
+			}
+			*setting = duration
+		}
+	}
+
+	return nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Validate checks the configuration and reports every problem found, naming each
+// setting by its YAML path
+func (c *Config) Validate() error {
+	var problems []string
+	problem := func(setting string, format string, args ...interface{}) {
+		problems = append(problems, setting+": "+fmt.Sprintf(format, args...))
+	}
+
+	if _, _, err := net.SplitHostPort(c.Server.ListenAddress); err != nil {
+		problem("server.listenAddress", "%q is not a host:port address", c.Server.ListenAddress)
+	}
+	if c.Server.PublicURL != "" {
+		parsed, err := url.Parse(c.Server.PublicURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.RawQuery != "" || parsed.Fragment != "" {
+			problem("server.publicURL", "%q is not a base URL such as https://herbtrace.example.com", c.Server.PublicURL)
+		}
+	}
+	if c.Server.TLS.Enabled() {
+		if c.Server.TLS.CertFile == "" || c.Server.TLS.KeyFile == "" {
+			problem("server.tls", "certFile and keyFile must be set together")
+		} else {
+			checkFile(problem, "server.tls.certFile", c.Server.TLS.CertFile)
+			checkFile(problem, "server.tls.keyFile", c.Server.TLS.KeyFile)
+		}
+	}
+	for _, origin := range c.Server.CORSOrigins {
+		if origin == "*" {
+			continue
+		}
+		parsed, err := url.Parse(origin)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" || (parsed.Path != "" && parsed.Path != "/") {
+			problem("server.corsOrigins", "%q is not an origin such as https://herbtrace.example.com", origin)
+		}
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				problem("server.trustedProxies", "%q is not an IP address or CIDR range", proxy)
+			}
+		}
+	}
+	if c.Server.ReadTimeout <= 0 {
+		problem("server.readTimeout", "must be greater than zero")
+	}
+	if c.Server.WriteTimeout <= 0 {
+		problem("server.writeTimeout", "must be greater than zero")
+	}
+
+	switch c.Ledger.Backend {
+	case BackendFabric:
+		c.validateFabric(problem)
+	case BackendMemory:
+		if c.Fabric.MSPID == "" {
+			problem("fabric.mspId", "is required")
+		}
+	default:
+		problem("ledger.backend", "%q is not one of %s or %s (%s needs a build with -tags dev)", c.Ledger.Backend, BackendFabric, BackendMemory, BackendMemory)
+	}
+
+	c.validateAuth(problem)
+	c.validateWallet(problem)
+	if c.Labels.FontFile != "" {
+		checkFile(problem, "labels.fontFile", c.Labels.FontFile)
+	}
+	if c.Verify.RequestsPerMinute <= 0 {
+		problem("verify.requestsPerMinute", "must be greater than zero")
+	}
+	if c.Verify.Burst <= 0 {
+		problem("verify.burst", "must be greater than zero")
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+func (c *Config) validateFabric(problem func(setting string, format string, args ...interface{})) {
+	if _, _, err := net.SplitHostPort(c.Fabric.PeerEndpoint); err != nil {
+		problem("fabric.peerEndpoint", "%q is not a host:port address", c.Fabric.PeerEndpoint)
+	}
+	if c.Fabric.PeerHostAlias == "" {
+		problem("fabric.peerHostAlias", "is required")
+	}
+	if c.Fabric.MSPID == "" {
+		problem("fabric.mspId", "is required")
+	}
+	if c.Fabric.Channel == "" {
+		problem("fabric.channel", "is required")
+	}
+	if c.Fabric.Chaincode == "" {
+		problem("fabric.chaincode", "is required")
+	}
+	checkFile(problem, "fabric.tlsCertPath", c.Fabric.TLSCertPath)
+	checkFile(problem, "fabric.certPath", c.Fabric.CertPath)
+	checkFile(problem, "fabric.keyPath", c.Fabric.KeyPath)
+
+	timeouts := []struct {
+		setting string
+		timeout time.Duration
+	}{
+		{"fabric.timeouts.evaluate", c.Fabric.Timeouts.Evaluate},
+		{"fabric.timeouts.endorse", c.Fabric.Timeouts.Endorse},
+		{"fabric.timeouts.submit", c.Fabric.Timeouts.Submit},
+		{"fabric.timeouts.commitStatus", c.Fabric.Timeouts.CommitStatus},
+	}
+	for _, t := range timeouts {
+		if t.timeout <= 0 {
+			problem(t.setting, "must be greater than zero")
+		}
+	}
+
+	// a request that submits a transaction waits for endorsement, ordering and commit
+	submitTime := c.Fabric.Timeouts.Endorse + c.Fabric.Timeouts.Submit + c.Fabric.Timeouts.CommitStatus
+	if c.Server.WriteTimeout > 0 && c.Server.WriteTimeout <= submitTime {
+		problem("server.writeTimeout", "%s must exceed the %s a submitted transaction may take", c.Server.WriteTimeout, submitTime)
+	}
+}
+
+func (c *Config) validateAuth(problem func(setting string, format string, args ...interface{})) {
+	switch c.Auth.Mode {
+	case auth.ModeNone:
+		// without authentication every caller submits transactions as the server
+		// identity, which must never happen on a real network by accident
+		if c.Ledger.Backend == BackendFabric && !c.Auth.AllowAnonymous {
+			problem("auth.mode", "authentication is required with the %s backend; set auth.allowAnonymous to run without it", BackendFabric)
+		}
+		return
+	case auth.ModeHS256:
+		if len(c.Auth.HS256Secret) < 32 {
+			problem("auth.hs256Secret", "must be at least 32 bytes long")
+		}
+	case auth.ModeJWKS:
+		checkFile(problem, "auth.jwksFile", c.Auth.JWKSFile)
+	case auth.ModeOIDC:
+		parsed, err := url.Parse(c.Auth.Issuer)
+		if err != nil || parsed.Scheme == "" || parsed.Host == "" {
+			problem("auth.issuer", "%q is not the URL of an OpenID provider", c.Auth.Issuer)
+		}
+	default:
+		problem("auth.mode", "%q is not one of %s, %s, %s or %s", c.Auth.Mode, auth.ModeNone, auth.ModeHS256, auth.ModeJWKS, auth.ModeOIDC)
+		return
+	}
+
+	if c.Auth.RolesClaim == "" {
+		problem("auth.rolesClaim", "is required")
+	}
+	// users get their identities from the identity file, the wallet or both
+	if c.Auth.IdentitiesFile != "" || !c.Wallet.Enabled() {
+		checkFile(problem, "auth.identitiesFile", c.Auth.IdentitiesFile)
+	}
+}
+
+func (c *Config) validateWallet(problem func(setting string, format string, args ...interface{})) {
+	if c.Wallet.Enabled() {
+		if c.Auth.Mode == auth.ModeNone {
+			problem("wallet.directory", "the wallet requires authentication, set auth.mode")
+		}
+		switch {
+		case c.Wallet.MasterKey != "" && c.Wallet.MasterKeyFile != "":
+			problem("wallet.masterKey", "set masterKey or masterKeyFile, not both")
+		case c.Wallet.MasterKey == "" && c.Wallet.MasterKeyFile == "":
+			problem("wallet.masterKeyFile", "a master key is required to encrypt the wallet")
+		case c.Wallet.MasterKeyFile != "":
+			checkFile(problem, "wallet.masterKeyFile", c.Wallet.MasterKeyFile)
+		}
+	}
+
+	if !c.CA.Enabled() {
+		return
+	}
+	if !c.Wallet.Enabled() {
+		problem("ca.url", "enrolling identities requires the wallet, set wallet.directory")
+	}
+	parsed, err := url.Parse(c.CA.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		problem("ca.url", "%q is not the URL of a Fabric CA such as https://localhost:7054", c.CA.URL)
+	}
+	if c.CA.TLSCertPath != "" {
+		checkFile(problem, "ca.tlsCertPath", c.CA.TLSCertPath)
+	}
+	if c.CA.RegistrarID == "" || c.CA.RegistrarSecret == "" {
+		problem("ca.registrarId", "a registrar ID and secret are required")
+	}
+	if c.CA.Timeout <= 0 {
+		problem("ca.timeout", "must be greater than zero")
+	}
+}
+
+// checkFile reports a path that is empty or does not exist. Certificate and key
+// paths may also name a directory holding a single file.
+func checkFile(problem func(setting string, format string, args ...interface{}), setting string, path string) {
+	if path == "" {
+		problem(setting, "is required")
+		return
+	}
+	if _, err := os.Stat(path); err != nil {
+		problem(setting, "%v", err)
+	}
+}
+
+// AuthOptions returns the settings of bearer token authentication
+func (c *Config) AuthOptions() auth.Options {
+	return auth.Options{
+		Mode:        c.Auth.Mode,
+		HS256Secret: c.Auth.HS256Secret,
+		JWKSFile:    c.Auth.JWKSFile,
+		Issuer:      c.Auth.Issuer,
+		Audience:    c.Auth.Audience,
+		RolesClaim:  c.Auth.RolesClaim,
+	}
+}
+
+// CAClientConfig returns the settings of the Fabric CA client
+func (c *Config) CAClientConfig() wallet.CAConfig {
+	mspID := c.CA.MSPID
+	if mspID == "" {
+		mspID = c.Fabric.MSPID
+	}
+	return wallet.CAConfig{
+		URL:             c.CA.URL,
+		CAName:          c.CA.Name,
+		TLSCertPath:     c.CA.TLSCertPath,
+		MSPID:           mspID,
+		RegistrarID:     c.CA.RegistrarID,
+		RegistrarSecret: c.CA.RegistrarSecret,
+		Timeout:         c.CA.Timeout,
+	}
+}
+
+// FabricServiceConfig returns the settings of the Fabric Gateway connection
+func (c *Config) FabricServiceConfig() services.FabricConfig {
+	return services.FabricConfig{
+		PeerEndpoint:  c.Fabric.PeerEndpoint,
+		PeerHostAlias: c.Fabric.PeerHostAlias,
+		TLSCertPath:   c.Fabric.TLSCertPath,
+		MSPID:         c.Fabric.MSPID,
+		CertPath:      c.Fabric.CertPath,
+		KeyPath:       c.Fabric.KeyPath,
+		ChannelName:   c.Fabric.Channel,
+		ChaincodeName: c.Fabric.Chaincode,
+		Timeouts: services.GatewayTimeouts{
+			Evaluate:     c.Fabric.Timeouts.Evaluate,
+			Endorse:      c.Fabric.Timeouts.Endorse,
+			Submit:       c.Fabric.Timeouts.Submit,
+			CommitStatus: c.Fabric.Timeouts.CommitStatus,
+		},
+	}
+}
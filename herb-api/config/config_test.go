@@ -0,0 +1,177 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"herb-api/auth"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryConfig returns a valid configuration of the memory backend, which needs no
+// Fabric files
+func memoryConfig() *Config {
+	config := Default()
+	config.Ledger.Backend = BackendMemory
+	return config
+}
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+func TestLoadFileAndEnvironment(t *testing.T) {
+	path := writeConfigFile(t, `
+server:
+  listenAddress: ":9090"
+  corsOrigins: ["https://herbtrace.example.com"]
+ledger:
+  backend: memory
+verify:
+  burst: 20
+`)
+	t.Setenv("HERB_API_LISTEN_ADDRESS", "127.0.0.1:8443")
+	t.Setenv("HERB_API_TRUSTED_PROXIES", "10.0.0.1, 192.168.0.0/16")
+	t.Setenv("HERB_API_READ_TIMEOUT", "30s")
+	t.Setenv("HERB_API_VERIFY_REQUESTS_PER_MINUTE", "60")
+
+	config, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:8443", config.Server.ListenAddress, "the environment overrides the file")
+	require.Equal(t, []string{"https://herbtrace.example.com"}, config.Server.CORSOrigins)
+	require.Equal(t, []string{"10.0.0.1", "192.168.0.0/16"}, config.Server.TrustedProxies)
+	require.Equal(t, 30*time.Second, config.Server.ReadTimeout)
+	require.Equal(t, BackendMemory, config.Ledger.Backend)
+	require.Equal(t, 60, config.Verify.RequestsPerMinute)
+	require.Equal(t, 20, config.Verify.Burst)
+	require.Equal(t, "Org1MSP", config.Fabric.MSPID, "unset settings keep their defaults")
+}
+
+func TestLoadRejectsInvalidInput(t *testing.T) {
+	_, err := Load(writeConfigFile(t, "server:\n  listenAdress: \":9090\"\n"))
+	require.ErrorContains(t, err, "listenAdress", "unknown settings are rejected")
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorContains(t, err, "failed to open config file")
+
+	path := writeConfigFile(t, "ledger:\n  backend: memory\n")
+	t.Setenv("HERB_API_VERIFY_BURST", "ten")
+	_, err = Load(path)
+	require.ErrorContains(t, err, "HERB_API_VERIFY_BURST")
+
+	t.Setenv("HERB_API_VERIFY_BURST", "")
+	t.Setenv("HERB_API_WRITE_TIMEOUT", "2")
+	_, err = Load(path)
+	require.ErrorContains(t, err, "HERB_API_WRITE_TIMEOUT")
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	require.NoError(t, memoryConfig().Validate())
+
+	config := memoryConfig()
+	config.Server.ListenAddress = "8080"
+	config.Server.PublicURL = "herbtrace.example.com"
+	config.Server.CORSOrigins = []string{"herbtrace.example.com"}
+	config.Server.TrustedProxies = []string{"proxy.local"}
+	config.Server.ReadTimeout = 0
+	config.Verify.Burst = 0
+
+	err := config.Validate()
+	require.Error(t, err)
+	for _, setting := range []string{"server.listenAddress", "server.publicURL", "server.corsOrigins", "server.trustedProxies", "server.readTimeout", "verify.burst"} {
+		require.ErrorContains(t, err, setting+":")
+	}
+
+	config = memoryConfig()
+	config.Ledger.Backend = "postgres"
+	require.ErrorContains(t, config.Validate(), "ledger.backend:")
+	require.ErrorContains(t, config.Validate(), "-tags dev", "the error names the build tag of the memory backend")
+}
+
+func TestValidateFabric(t *testing.T) {
+	config := memoryConfig()
+	config.Ledger.Backend = BackendFabric
+	config.Fabric.CertPath = filepath.Join(t.TempDir(), "missing.pem")
+	config.Fabric.Timeouts.Evaluate = 0
+
+	err := config.Validate()
+	require.ErrorContains(t, err, "fabric.certPath:")
+	require.ErrorContains(t, err, "fabric.timeouts.evaluate:")
+
+	config.Server.WriteTimeout = time.Minute
+	require.ErrorContains(t, config.Validate(), "server.writeTimeout:", "the write timeout must cover a submitted transaction")
+}
+
+func TestValidateAnonymousFabric(t *testing.T) {
+	config := Default()
+	config.Fabric.TLSCertPath = writeConfigFile(t, "")
+	config.Fabric.CertPath = config.Fabric.TLSCertPath
+	config.Fabric.KeyPath = config.Fabric.TLSCertPath
+	require.ErrorContains(t, config.Validate(), "auth.mode: authentication is required")
+
+	t.Setenv("HERB_API_AUTH_ALLOW_ANONYMOUS", "true")
+	require.NoError(t, config.applyEnv())
+	require.True(t, config.Auth.AllowAnonymous)
+	require.NoError(t, config.Validate())
+
+	require.NoError(t, memoryConfig().Validate(), "the memory backend needs no confirmation")
+
+	t.Setenv("HERB_API_AUTH_ALLOW_ANONYMOUS", "yes please")
+	require.ErrorContains(t, config.applyEnv(), "HERB_API_AUTH_ALLOW_ANONYMOUS")
+}
+
+func TestDefaultAllowsNoCORSOrigins(t *testing.T) {
+	config := memoryConfig()
+	require.Empty(t, config.Server.CORSOrigins)
+	require.NoError(t, config.Validate())
+}
+
+func TestValidateAuth(t *testing.T) {
+	config := memoryConfig()
+	config.Auth.Mode = auth.ModeHS256
+	config.Auth.HS256Secret = "too short"
+	err := config.Validate()
+	require.ErrorContains(t, err, "auth.hs256Secret:")
+	require.ErrorContains(t, err, "auth.identitiesFile:", "users need an identity file or the wallet")
+
+	config.Auth.HS256Secret = "0123456789abcdef0123456789abcdef"
+	config.Auth.IdentitiesFile = writeConfigFile(t, "identities: []\n")
+	require.NoError(t, config.Validate())
+
+	config.Auth.Mode = auth.ModeOIDC
+	require.ErrorContains(t, config.Validate(), "auth.issuer:")
+
+	config.Auth.Mode = "basic"
+	require.ErrorContains(t, config.Validate(), "auth.mode:")
+}
+
+func TestValidateWallet(t *testing.T) {
+	config := memoryConfig()
+	config.Wallet.Directory = t.TempDir()
+	err := config.Validate()
+	require.ErrorContains(t, err, "wallet.directory:", "the wallet requires authentication")
+	require.ErrorContains(t, err, "wallet.masterKeyFile:")
+
+	config.Auth.Mode = auth.ModeHS256
+	config.Auth.HS256Secret = "0123456789abcdef0123456789abcdef"
+	config.Wallet.MasterKey = "a2V5"
+	require.NoError(t, config.Validate(), "wallet users need no identity file")
+
+	config.CA.URL = "localhost:7054"
+	err = config.Validate()
+	require.ErrorContains(t, err, "ca.url:")
+	require.ErrorContains(t, err, "ca.registrarId:")
+
+	config.CA.URL = "https://localhost:7054"
+	config.CA.RegistrarID = "admin"
+	config.CA.RegistrarSecret = "adminpw"
+	require.NoError(t, config.Validate())
+	require.Equal(t, "Org1MSP", config.CAClientConfig().MSPID, "the CA's MSP defaults to fabric.mspId")
+}
@@ -1,8 +1,12 @@
 package controllers
 
 import (
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
+	"herb-api/middleware"
 	"herb-api/models"
 	"herb-api/services"
 
@@ -10,13 +14,13 @@ import (
 )
 
 type HerbController struct {
-	fabricService *services.FabricService
+	ledger services.HerbLedger
 }
 
-// NewHerbController creates a new instance of HerbController
-func NewHerbController() *HerbController {
+// NewHerbController creates a new instance of HerbController backed by the given ledger
+func NewHerbController(ledger services.HerbLedger) *HerbController {
 	return &HerbController{
-		fabricService: services.NewFabricService(),
+		ledger: ledger,
 	}
 }
 
@@ -34,9 +38,9 @@ func (hc *HerbController) CreateHerbBatch(c *gin.Context) {
 	}
 
 	// Check if herb batch already exists
-	exists, err := hc.fabricService.HerbBatchExists(req.ID)
+	exists, err := hc.ledgerFor(c).HerbBatchExists(req.ID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
 			Success: false,
 			Message: "Failed to check if herb batch exists",
 			Error:   err.Error(),
@@ -53,8 +57,8 @@ func (hc *HerbController) CreateHerbBatch(c *gin.Context) {
 	}
 
 	// Create herb batch on blockchain
-	if err := hc.fabricService.CreateHerbBatch(req); err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+	if err := hc.ledgerFor(c).CreateHerbBatch(req); err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
 			Success: false,
 			Message: "Failed to create herb batch on blockchain",
 			Error:   err.Error(),
@@ -84,9 +88,9 @@ func (hc *HerbController) GetHerbBatch(c *gin.Context) {
 		return
 	}
 
-	herbBatch, err := hc.fabricService.ReadHerbBatch(batchID)
+	herbBatch, err := hc.ledgerFor(c).ReadHerbBatch(batchID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.APIResponse{
+		c.JSON(errorStatus(err, http.StatusNotFound), models.APIResponse{
 			Success: false,
 			Message: "Herb batch not found",
 			Error:   err.Error(),
@@ -103,9 +107,18 @@ func (hc *HerbController) GetHerbBatch(c *gin.Context) {
 
 // GetAllHerbBatches handles GET /api/herbs
 func (hc *HerbController) GetAllHerbBatches(c *gin.Context) {
-	herbBatches, err := hc.fabricService.GetAllHerbBatches()
+	if c.Query("harvestedFrom") != "" || c.Query("harvestedTo") != "" {
+		hc.GetHerbBatchesByHarvestDate(c)
+		return
+	}
+	if c.Query("expiringWithinDays") != "" {
+		hc.GetExpiringHerbBatches(c)
+		return
+	}
+
+	herbBatches, err := hc.ledgerFor(c).GetAllHerbBatches()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
 			Success: false,
 			Message: "Failed to retrieve herb batches",
 			Error:   err.Error(),
@@ -123,6 +136,135 @@ func (hc *HerbController) GetAllHerbBatches(c *gin.Context) {
 	})
 }
 
+// GetExpiringHerbBatches handles GET /api/herbs?expiringWithinDays=
+func (hc *HerbController) GetExpiringHerbBatches(c *gin.Context) {
+	days, err := strconv.Atoi(c.Query("expiringWithinDays"))
+	if err != nil || days < 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "expiringWithinDays must be a non-negative integer",
+		})
+		return
+	}
+
+	herbBatches, err := hc.ledgerFor(c).GetHerbBatchesExpiringWithin(days)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Failed to retrieve expiring herb batches",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Expiring herb batches retrieved successfully",
+		Data: map[string]interface{}{
+			"batches": herbBatches,
+			"count":   len(herbBatches),
+		},
+	})
+}
+
+// GetHerbBatchesByHarvestDate handles GET /api/herbs?harvestedFrom=&harvestedTo=&pageSize=&bookmark=
+func (hc *HerbController) GetHerbBatchesByHarvestDate(c *gin.Context) {
+	from := c.Query("harvestedFrom")
+	to := c.Query("harvestedTo")
+	if from == "" || to == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Both harvestedFrom and harvestedTo are required (YYYY-MM-DD)",
+		})
+		return
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if err != nil || pageSize <= 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "pageSize must be a positive integer",
+		})
+		return
+	}
+
+	page, err := hc.ledgerFor(c).GetHerbBatchesByHarvestDateRange(from, to, pageSize, c.Query("bookmark"))
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Failed to retrieve herb batches by harvest date",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Herb batches retrieved successfully",
+		Data: map[string]interface{}{
+			"batches":  page.Records,
+			"count":    page.FetchedRecordsCount,
+			"bookmark": page.Bookmark,
+		},
+	})
+}
+
+// epcisContentType is the media type of EPCIS 2.0 JSON-LD documents
+const epcisContentType = "application/ld+json"
+
+// GetHerbBatchEPCIS handles GET /api/herbs/:id/epcis
+func (hc *HerbController) GetHerbBatchEPCIS(c *gin.Context) {
+	batchID := c.Param("id")
+
+	document, err := hc.ledgerFor(c).GetHerbBatchEPCIS(batchID)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusNotFound), models.APIResponse{
+			Success: false,
+			Message: "Failed to retrieve EPCIS events",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.Data(http.StatusOK, epcisContentType, document)
+}
+
+// GetEPCISByHarvestDate handles GET /api/epcis?harvestedFrom=&harvestedTo=&pageSize=&bookmark=
+// The bookmark of the next page is returned in the X-Bookmark header.
+func (hc *HerbController) GetEPCISByHarvestDate(c *gin.Context) {
+	from := c.Query("harvestedFrom")
+	to := c.Query("harvestedTo")
+	if from == "" || to == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Both harvestedFrom and harvestedTo are required (YYYY-MM-DD)",
+		})
+		return
+	}
+
+	pageSize, err := strconv.Atoi(c.DefaultQuery("pageSize", "50"))
+	if err != nil || pageSize <= 0 {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "pageSize must be a positive integer",
+		})
+		return
+	}
+
+	page, err := hc.ledgerFor(c).GetEPCISByHarvestDateRange(from, to, pageSize, c.Query("bookmark"))
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Failed to retrieve EPCIS events by harvest date",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.Header("X-Bookmark", page.Bookmark)
+	c.Data(http.StatusOK, epcisContentType, page.Document)
+}
+
 // UpdateHerbBatchStatus handles PUT /api/herbs/:id/status
 func (hc *HerbController) UpdateHerbBatchStatus(c *gin.Context) {
 	batchID := c.Param("id")
@@ -137,12 +279,10 @@ func (hc *HerbController) UpdateHerbBatchStatus(c *gin.Context) {
 		return
 	}
 
-	// Validate status
+	// Validate status; the workflow statuses are set through the supply chain
+	// endpoints, which check the role of the caller
 	validStatuses := []string{
 		models.StatusHarvested,
-		models.StatusInTransit,
-		models.StatusLabTesting,
-		models.StatusCertified,
 		models.StatusProcessing,
 		models.StatusPackaged,
 		models.StatusDistributed,
@@ -160,14 +300,14 @@ func (hc *HerbController) UpdateHerbBatchStatus(c *gin.Context) {
 	if !isValidStatus {
 		c.JSON(http.StatusBadRequest, models.APIResponse{
 			Success: false,
-			Message: "Invalid status. Valid statuses are: Harvested, In-Transit, Lab-Testing, Certified, Processing, Packaged, Distributed, Delivered",
+			Message: "Invalid status. Valid statuses are: Harvested, Processing, Packaged, Distributed, Delivered; In-Transit, Lab-Testing and Certified are set through /api/supply-chain",
 		})
 		return
 	}
 
 	// Update status on blockchain
-	if err := hc.fabricService.UpdateHerbBatchStatus(batchID, req.NewStatus); err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+	if err := hc.ledgerFor(c).UpdateHerbBatchStatus(batchID, req.NewStatus); err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
 			Success: false,
 			Message: "Failed to update herb batch status",
 			Error:   err.Error(),
@@ -199,9 +339,9 @@ func (hc *HerbController) TransferHerbBatch(c *gin.Context) {
 		return
 	}
 
-	oldOwner, err := hc.fabricService.TransferHerbBatch(batchID, req.NewOwner)
+	oldOwner, err := hc.ledgerFor(c).TransferHerbBatch(batchID, req.NewOwner, req.NewOwnerOrg)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
 			Success: false,
 			Message: "Failed to transfer herb batch",
 			Error:   err.Error(),
@@ -224,9 +364,10 @@ func (hc *HerbController) TransferHerbBatch(c *gin.Context) {
 func (hc *HerbController) GetSupplyChainStatus(c *gin.Context) {
 	batchID := c.Param("id")
 
-	herbBatch, err := hc.fabricService.ReadHerbBatch(batchID)
+	ledger := hc.ledgerFor(c)
+	herbBatch, err := ledger.ReadHerbBatch(batchID)
 	if err != nil {
-		c.JSON(http.StatusNotFound, models.APIResponse{
+		c.JSON(errorStatus(err, http.StatusNotFound), models.APIResponse{
 			Success: false,
 			Message: "Herb batch not found",
 			Error:   err.Error(),
@@ -234,8 +375,17 @@ func (hc *HerbController) GetSupplyChainStatus(c *gin.Context) {
 		return
 	}
 
-	// Create a supply chain timeline based on current status
-	timeline := createSupplyChainTimeline(herbBatch)
+	events, err := ledger.GetSupplyChainEvents(batchID)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Failed to get supply chain events",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	timeline := createSupplyChainTimeline(herbBatch, events)
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -247,6 +397,240 @@ func (hc *HerbController) GetSupplyChainStatus(c *gin.Context) {
 	})
 }
 
+// harvestIDAttempts bounds the retries when a generated batch ID already exists
+const harvestIDAttempts = 3
+
+// RegisterHarvest handles POST /api/supply-chain/harvest
+func (hc *HerbController) RegisterHarvest(c *gin.Context) {
+	var req models.HarvestRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request payload",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	// the authenticated user owns the harvest; the request may only name an owner
+	// when authentication is disabled
+	owner := req.Owner
+	if user := middleware.CurrentUser(c); user != nil {
+		if owner != "" && owner != user.Name {
+			c.JSON(http.StatusForbidden, models.APIResponse{
+				Success: false,
+				Message: "Permission denied",
+				Error:   "a harvest is owned by the authenticated user",
+			})
+			return
+		}
+		owner = user.Name
+	}
+	if owner == "" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request payload",
+			Error:   "owner is required when authentication is disabled",
+		})
+		return
+	}
+
+	// a signed harvest names the ID its device generated, which must be a lot
+	// number like those generated here
+	if req.Signature != "" && !services.IsLotNumber(req.ID) {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request payload",
+			Error:   fmt.Sprintf("id must be a %d character Crockford base32 lot number", services.LotNumberLength),
+		})
+		return
+	}
+
+	herb := models.CreateHerbBatchRequest{
+		BotanicalName: req.BotanicalName,
+		Farm:          req.Farm,
+		HarvestDate:   req.HarvestDate,
+		Owner:         owner,
+		Quantity:      req.Quantity,
+		Region:        req.Region,
+		Status:        models.StatusHarvested,
+		DeviceKeyID:   req.DeviceKeyID,
+		Signature:     req.Signature,
+	}
+
+	ledger := hc.ledgerFor(c)
+	var err error
+	if req.Signature != "" {
+		// the device signed the ID it generated, so it cannot be replaced
+		herb.ID = req.ID
+		err = ledger.CreateHerbBatch(herb)
+	} else {
+		for attempt := 0; attempt < harvestIDAttempts; attempt++ {
+			herb.ID, err = services.NewLotNumber(time.Now())
+			if err != nil {
+				break
+			}
+			err = ledger.CreateHerbBatch(herb)
+			if chaincodeError, ok := services.AsChaincodeError(err); !ok || chaincodeError.Code != services.CodeAlreadyExists {
+				break
+			}
+		}
+	}
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Failed to register harvest on blockchain",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	herbBatch, err := ledger.ReadHerbBatch(herb.ID)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Harvest registered, but the herb batch could not be read back",
+			Error:   err.Error(),
+			Data:    map[string]string{"batchId": herb.ID},
+		})
+		return
+	}
+
+	c.Header("Location", "/api/herbs/"+herb.ID)
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Harvest registered successfully",
+		Data:    herbBatch,
+	})
+}
+
+// TransportHerbBatch handles PUT /api/supply-chain/transport/:id
+func (hc *HerbController) TransportHerbBatch(c *gin.Context) {
+	hc.recordSupplyChainAction(c, models.ActionTransport, "Herb batch picked up for transport")
+}
+
+// ReceiveHerbBatchAtLab handles PUT /api/supply-chain/lab-receive/:id
+func (hc *HerbController) ReceiveHerbBatchAtLab(c *gin.Context) {
+	hc.recordSupplyChainAction(c, models.ActionLabReceive, "Herb batch received at lab")
+}
+
+// CertifyHerbBatch handles PUT /api/supply-chain/certify/:id
+func (hc *HerbController) CertifyHerbBatch(c *gin.Context) {
+	hc.recordSupplyChainAction(c, models.ActionCertify, "Herb batch certified")
+}
+
+// recordSupplyChainAction performs a workflow action on the batch named in the path
+// and responds with the updated batch, the recorded event and its transaction ID
+func (hc *HerbController) recordSupplyChainAction(c *gin.Context, action string, message string) {
+	batchID := c.Param("id")
+	var req models.SupplyChainActionRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request payload",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	ledger := hc.ledgerFor(c)
+	event, err := ledger.RecordSupplyChainEvent(batchID, action, req.Location, req.Notes)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Failed to record supply chain action",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	herbBatch, err := ledger.ReadHerbBatch(batchID)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Supply chain action recorded, but the herb batch could not be read back",
+			Error:   err.Error(),
+			Data:    map[string]string{"transactionId": event.ID},
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data: map[string]interface{}{
+			"transactionId": event.ID,
+			"batch":         herbBatch,
+			"event":         event,
+		},
+	})
+}
+
+// RecallHerbBatch handles POST /api/herbs/:id/recall. The caller's Fabric identity
+// must be an organisation admin.
+func (hc *HerbController) RecallHerbBatch(c *gin.Context) {
+	var req models.RecallHerbBatchRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request payload",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	recall, err := hc.ledgerFor(c).RecallHerbBatch(c.Param("id"), req.Reason)
+	if err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Failed to recall herb batch",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Herb batch recalled successfully",
+		Data:    recall,
+	})
+}
+
+// RegisterDeviceKey handles POST /api/devices
+func (hc *HerbController) RegisterDeviceKey(c *gin.Context) {
+	var req models.RegisterDeviceKeyRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request payload",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	if err := hc.ledgerFor(c).RegisterDeviceKey(req); err != nil {
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Failed to register device key",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Device key registered successfully",
+		Data: map[string]string{
+			"keyId":  req.KeyID,
+			"farmer": req.Farmer,
+		},
+	})
+}
+
 // HealthCheck handles GET /health
 func (hc *HerbController) HealthCheck(c *gin.Context) {
 	c.JSON(http.StatusOK, models.APIResponse{
@@ -262,9 +646,9 @@ func (hc *HerbController) HealthCheck(c *gin.Context) {
 
 // GetStats handles GET /api/stats
 func (hc *HerbController) GetStats(c *gin.Context) {
-	herbBatches, err := hc.fabricService.GetAllHerbBatches()
+	ledgerStats, err := hc.ledgerFor(c).GetLedgerStats()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, models.APIResponse{
+		c.JSON(errorStatus(err, http.StatusInternalServerError), models.APIResponse{
 			Success: false,
 			Message: "Failed to retrieve statistics",
 			Error:   err.Error(),
@@ -272,7 +656,7 @@ func (hc *HerbController) GetStats(c *gin.Context) {
 		return
 	}
 
-	stats := calculateStats(herbBatches)
+	stats := calculateStats(ledgerStats)
 
 	c.JSON(http.StatusOK, models.APIResponse{
 		Success: true,
@@ -281,8 +665,16 @@ func (hc *HerbController) GetStats(c *gin.Context) {
 	})
 }
 
-// Helper function to create supply chain timeline
-func createSupplyChainTimeline(herb *models.HerbBatch) []map[string]interface{} {
+// supplyChainStages names the timeline stage of each workflow action
+var supplyChainStages = map[string]string{
+	models.ActionTransport:  "Transportation",
+	models.ActionLabReceive: "Lab Receipt",
+	models.ActionCertify:    "Certification",
+}
+
+// createSupplyChainTimeline lists the harvest of a herb batch followed by the
+// workflow events recorded on the ledger
+func createSupplyChainTimeline(herb *models.HerbBatch, events []models.SupplyChainEvent) []map[string]interface{} {
 	timeline := []map[string]interface{}{
 		{
 			"stage":       "Farming",
@@ -294,28 +686,16 @@ func createSupplyChainTimeline(herb *models.HerbBatch) []map[string]interface{}
 		},
 	}
 
-	// Add stages based on current status
-	switch herb.Status {
-	case models.StatusInTransit:
+	for _, event := range events {
 		timeline = append(timeline, map[string]interface{}{
-			"stage":       "Transportation",
-			"status":      "In Progress",
-			"actor":       herb.Owner,
-			"description": "Herbs in transit to next stage",
-		})
-	case models.StatusLabTesting:
-		timeline = append(timeline, map[string]interface{}{
-			"stage":       "Quality Testing",
-			"status":      "In Progress",
-			"actor":       herb.Owner,
-			"description": "Quality testing and certification in progress",
-		})
-	case models.StatusCertified:
-		timeline = append(timeline, map[string]interface{}{
-			"stage":       "Certification",
-			"status":      "Completed",
-			"actor":       herb.Owner,
-			"description": "Quality certification completed",
+			"stage":         supplyChainStages[event.Action],
+			"status":        event.ToStatus,
+			"actor":         event.Actor,
+			"actorOrg":      event.ActorOrg,
+			"location":      event.Location,
+			"date":          event.Timestamp,
+			"description":   event.Notes,
+			"transactionId": event.ID,
 		})
 	}
 
@@ -323,21 +703,32 @@ func createSupplyChainTimeline(herb *models.HerbBatch) []map[string]interface{}
 }
 
 // Helper function to calculate statistics
-func calculateStats(herbs []models.HerbBatch) map[string]interface{} {
-	statusCount := make(map[string]int)
-	farmCount := make(map[string]int)
-
-	for _, herb := range herbs {
-		statusCount[herb.Status]++
-		farmCount[herb.Farm]++
-	}
+func calculateStats(ledgerStats *models.LedgerStats) map[string]interface{} {
+	statusCount := ledgerStats.ByStatus
 
 	return map[string]interface{}{
-		"totalBatches":    len(herbs),
-		"statusBreakdown": statusCount,
-		"farmBreakdown":   farmCount,
+		"totalBatches":     ledgerStats.TotalBatches,
+		"statusBreakdown":  statusCount,
+		"farmBreakdown":    ledgerStats.ByFarm,
+		"speciesBreakdown": ledgerStats.BySpecies,
+		"monthBreakdown":   ledgerStats.ByMonth,
 		"activeSupplyChain": statusCount[models.StatusInTransit] +
 			statusCount[models.StatusLabTesting] +
 			statusCount[models.StatusProcessing],
 	}
 }
+
+// ledgerFor returns the ledger the request acts on, bound to the caller's identity
+// when authentication is enabled
+func (hc *HerbController) ledgerFor(c *gin.Context) services.HerbLedger {
+	return middleware.Ledger(c, hc.ledger)
+}
+
+// errorStatus returns the HTTP status matching the chaincode error code carried by
+// err, or fallback when the failure did not come from the chaincode
+func errorStatus(err error, fallback int) int {
+	if chaincodeError, ok := services.AsChaincodeError(err); ok {
+		return chaincodeError.HTTPStatus()
+	}
+	return fallback
+}
@@ -0,0 +1,447 @@
+package controllers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"herb-api/auth"
+	"herb-api/middleware"
+	"herb-api/models"
+	"herb-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// fakeLedger keeps herb batches in a map and records the supply chain events
+// submitted to it. Methods the tests do not use are not implemented.
+type fakeLedger struct {
+	services.HerbLedger
+
+	batches    map[string]*models.HerbBatch
+	created    []models.CreateHerbBatchRequest // successful CreateHerbBatch calls
+	events     []models.SupplyChainEvent
+	provenance map[string]*models.PublicProvenance
+	createErrs []error // returned by successive CreateHerbBatch calls before they succeed
+	failure    error   // returned by every call when set
+}
+
+func newFakeLedger() *fakeLedger {
+	return &fakeLedger{
+		batches:    map[string]*models.HerbBatch{},
+		provenance: map[string]*models.PublicProvenance{},
+	}
+}
+
+// fakeActor is the Fabric ID the fake ledger records as the actor of every event
+const fakeActor = "x509::CN=suresh::CN=ca.org2.example.com"
+
+func notFound(batchID string) error {
+	return fmt.Errorf("failed to evaluate transaction: %w", &services.ChaincodeError{
+		Code:    services.CodeNotFound,
+		Message: "the herb batch " + batchID + " does not exist",
+	})
+}
+
+func (l *fakeLedger) HerbBatchExists(batchID string) (bool, error) {
+	if l.failure != nil {
+		return false, l.failure
+	}
+	_, ok := l.batches[batchID]
+	return ok, nil
+}
+
+func (l *fakeLedger) CreateHerbBatch(herb models.CreateHerbBatchRequest) error {
+	if l.failure != nil {
+		return l.failure
+	}
+	if len(l.createErrs) > 0 {
+		err := l.createErrs[0]
+		l.createErrs = l.createErrs[1:]
+		return err
+	}
+	l.batches[herb.ID] = &models.HerbBatch{
+		ID:                herb.ID,
+		BotanicalName:     herb.BotanicalName,
+		Farm:              herb.Farm,
+		HarvestDate:       herb.HarvestDate,
+		Owner:             herb.Owner,
+		OwnerOrg:          "Org1MSP",
+		Quantity:          herb.Quantity,
+		Region:            herb.Region,
+		RemainingQuantity: herb.Quantity,
+		Status:            herb.Status,
+	}
+	l.created = append(l.created, herb)
+	return nil
+}
+
+func (l *fakeLedger) ReadHerbBatch(batchID string) (*models.HerbBatch, error) {
+	if l.failure != nil {
+		return nil, l.failure
+	}
+	herb, ok := l.batches[batchID]
+	if !ok {
+		return nil, notFound(batchID)
+	}
+	return herb, nil
+}
+
+func (l *fakeLedger) UpdateHerbBatchStatus(batchID, newStatus string) error {
+	herb, err := l.ReadHerbBatch(batchID)
+	if err != nil {
+		return err
+	}
+	herb.Status = newStatus
+	return nil
+}
+
+func (l *fakeLedger) RecordSupplyChainEvent(batchID, action, location, notes string) (*models.SupplyChainEvent, error) {
+	herb, err := l.ReadHerbBatch(batchID)
+	if err != nil {
+		return nil, err
+	}
+	event := models.SupplyChainEvent{
+		ID:         fmt.Sprintf("tx%d", len(l.events)+1),
+		BatchID:    batchID,
+		Action:     action,
+		Actor:      fakeActor,
+		ActorOrg:   "Org2MSP",
+		Location:   location,
+		Notes:      notes,
+		FromStatus: herb.Status,
+		ToStatus:   models.StatusInTransit,
+		Timestamp:  time.Date(2024, time.August, 16, 9, 0, 0, 0, time.UTC),
+	}
+	herb.Status = event.ToStatus
+	l.events = append(l.events, event)
+	return &event, nil
+}
+
+func (l *fakeLedger) GetSupplyChainEvents(batchID string) ([]models.SupplyChainEvent, error) {
+	if l.failure != nil {
+		return nil, l.failure
+	}
+	events := []models.SupplyChainEvent{}
+	for _, event := range l.events {
+		if event.BatchID == batchID {
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (l *fakeLedger) GetLedgerStats() (*models.LedgerStats, error) {
+	if l.failure != nil {
+		return nil, l.failure
+	}
+	stats := &models.LedgerStats{ByStatus: map[string]int{}}
+	for _, herb := range l.batches {
+		stats.TotalBatches++
+		stats.ByStatus[herb.Status]++
+	}
+	return stats, nil
+}
+
+func (l *fakeLedger) GetPublicProvenance(batchID string) (*models.PublicProvenance, error) {
+	if l.failure != nil {
+		return nil, l.failure
+	}
+	provenance, ok := l.provenance[batchID]
+	if !ok {
+		return nil, notFound(batchID)
+	}
+	return provenance, nil
+}
+
+// request sends a request with an optional JSON body to handler, registered at
+// pattern, and decodes the APIResponse
+func request(t *testing.T, handler gin.HandlerFunc, pattern string, method string, path string, body interface{}) (*httptest.ResponseRecorder, models.APIResponse) {
+	t.Helper()
+
+	var data []byte
+	if body != nil {
+		var err error
+		data, err = json.Marshal(body)
+		require.NoError(t, err)
+	}
+
+	router := gin.New()
+	router.Handle(method, pattern, handler)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(method, path, bytes.NewReader(data)))
+
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response), recorder.Body.String())
+	return recorder, response
+}
+
+func harvestBody() map[string]interface{} {
+	return map[string]interface{}{
+		"botanicalName": "Withania somnifera",
+		"farm":          "Green Valley Farm",
+		"harvestDate":   "2024-08-15",
+		"owner":         "Ravi Sharma",
+		"quantity":      120,
+		"region":        "Kerala",
+	}
+}
+
+func TestCreateHerbBatch(t *testing.T) {
+	ledger := newFakeLedger()
+	hc := NewHerbController(ledger)
+	body := harvestBody()
+	body["id"] = "batch1"
+	body["status"] = models.StatusHarvested
+
+	recorder, response := request(t, hc.CreateHerbBatch, "/api/herbs", http.MethodPost, "/api/herbs", body)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.True(t, response.Success)
+	require.Equal(t, "Ravi Sharma", ledger.batches["batch1"].Owner)
+
+	recorder, _ = request(t, hc.CreateHerbBatch, "/api/herbs", http.MethodPost, "/api/herbs", body)
+	require.Equal(t, http.StatusConflict, recorder.Code)
+
+	delete(body, "farm")
+	recorder, _ = request(t, hc.CreateHerbBatch, "/api/herbs", http.MethodPost, "/api/herbs", body)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+}
+
+func TestGetHerbBatch(t *testing.T) {
+	ledger := newFakeLedger()
+	ledger.batches["batch1"] = &models.HerbBatch{ID: "batch1", Status: models.StatusHarvested}
+	hc := NewHerbController(ledger)
+
+	recorder, response := request(t, hc.GetHerbBatch, "/api/herbs/:id", http.MethodGet, "/api/herbs/batch1", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "batch1", response.Data.(map[string]interface{})["id"])
+
+	recorder, response = request(t, hc.GetHerbBatch, "/api/herbs/:id", http.MethodGet, "/api/herbs/batch2", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+	require.Contains(t, response.Error, services.CodeNotFound)
+
+	ledger.failure = errors.New("failed to evaluate transaction: connection refused")
+	recorder, _ = request(t, hc.GetHerbBatch, "/api/herbs/:id", http.MethodGet, "/api/herbs/batch1", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code, "reads fall back to 404")
+}
+
+func TestUpdateHerbBatchStatus(t *testing.T) {
+	ledger := newFakeLedger()
+	ledger.batches["batch1"] = &models.HerbBatch{ID: "batch1", Status: models.StatusHarvested}
+	hc := NewHerbController(ledger)
+
+	recorder, _ := request(t, hc.UpdateHerbBatchStatus, "/api/herbs/:id/status", http.MethodPut, "/api/herbs/batch1/status", models.UpdateStatusRequest{NewStatus: models.StatusPackaged})
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, models.StatusPackaged, ledger.batches["batch1"].Status)
+
+	for _, status := range []string{"Lost", models.StatusInTransit, models.StatusLabTesting, models.StatusCertified} {
+		recorder, _ = request(t, hc.UpdateHerbBatchStatus, "/api/herbs/:id/status", http.MethodPut, "/api/herbs/batch1/status", models.UpdateStatusRequest{NewStatus: status})
+		require.Equal(t, http.StatusBadRequest, recorder.Code, status)
+	}
+	require.Equal(t, models.StatusPackaged, ledger.batches["batch1"].Status)
+
+	recorder, _ = request(t, hc.UpdateHerbBatchStatus, "/api/herbs/:id/status", http.MethodPut, "/api/herbs/batch2/status", models.UpdateStatusRequest{NewStatus: models.StatusPackaged})
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestRegisterHarvest(t *testing.T) {
+	ledger := newFakeLedger()
+	hc := NewHerbController(ledger)
+
+	recorder, response := request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", harvestBody())
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	batchID := response.Data.(map[string]interface{})["id"].(string)
+	require.Len(t, batchID, services.LotNumberLength)
+	require.Equal(t, "/api/herbs/"+batchID, recorder.Header().Get("Location"))
+	require.Equal(t, models.StatusHarvested, ledger.batches[batchID].Status)
+
+	body := harvestBody()
+	delete(body, "owner")
+	recorder, response = request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", body)
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+	require.Contains(t, response.Error, "owner is required")
+}
+
+// authenticated wraps handler with authentication of a bearer token for name
+func authenticated(t *testing.T, name string, handler gin.HandlerFunc) gin.HandlerFunc {
+	t.Helper()
+
+	const secret = "0123456789abcdef0123456789abcdef"
+	authenticator, err := auth.New(auth.Options{Mode: auth.ModeHS256, HS256Secret: secret})
+	require.NoError(t, err)
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":  "user-1",
+		"name": name,
+		"exp":  time.Now().Add(time.Hour).Unix(),
+	}).SignedString([]byte(secret))
+	require.NoError(t, err)
+
+	authenticate := middleware.Authenticate(authenticator)
+	return func(c *gin.Context) {
+		c.Request.Header.Set("Authorization", "Bearer "+token)
+		authenticate(c)
+		if !c.IsAborted() {
+			handler(c)
+		}
+	}
+}
+
+func TestRegisterHarvestOwnedByTheAuthenticatedUser(t *testing.T) {
+	ledger := newFakeLedger()
+	hc := NewHerbController(ledger)
+	handler := authenticated(t, "Ravi Sharma", hc.RegisterHarvest)
+
+	body := harvestBody()
+	delete(body, "owner")
+	recorder, response := request(t, handler, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", body)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.Equal(t, "Ravi Sharma", response.Data.(map[string]interface{})["owner"])
+
+	recorder, _ = request(t, handler, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", harvestBody())
+	require.Equal(t, http.StatusCreated, recorder.Code, "the user may name themselves")
+
+	body["owner"] = "Someone Else"
+	recorder, _ = request(t, handler, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", body)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	require.Len(t, ledger.batches, 2)
+}
+
+func TestRegisterSignedHarvest(t *testing.T) {
+	ledger := newFakeLedger()
+	hc := NewHerbController(ledger)
+	body := harvestBody()
+	body["id"] = "01M58QP9T4CDNSEHEE38"
+	body["deviceKeyId"] = "ravi-phone-1"
+	body["signature"] = "MEUCIQ..."
+
+	recorder, response := request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", body)
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.Equal(t, "01M58QP9T4CDNSEHEE38", response.Data.(map[string]interface{})["id"], "the signed ID is kept")
+	require.Equal(t, "ravi-phone-1", ledger.created[0].DeviceKeyID)
+	require.Equal(t, "MEUCIQ...", ledger.created[0].Signature)
+
+	for _, id := range []string{"batch1", "01M58QP9T4CDNSEHEE3", "01m58qp9t4cdnsehee39", "01M58QP9T4CDNSEHEE39/../x"} {
+		body["id"] = id
+		recorder, _ = request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", body)
+		require.Equal(t, http.StatusBadRequest, recorder.Code, "%q is not a lot number", id)
+	}
+
+	delete(body, "id")
+	recorder, _ = request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", body)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, "a signature covers the batch ID")
+
+	body["id"] = "01M58QP9T4CDNSEHEE39"
+	delete(body, "deviceKeyId")
+	recorder, _ = request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", body)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, "a signature needs its device key")
+
+	delete(body, "signature")
+	recorder, _ = request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", body)
+	require.Equal(t, http.StatusBadRequest, recorder.Code, "only signed harvests name their ID")
+
+	ledger.createErrs = []error{&services.ChaincodeError{Code: services.CodeAlreadyExists, Message: "the herb batch already exists"}}
+	body["deviceKeyId"] = "ravi-phone-1"
+	body["signature"] = "MEUCIQ..."
+	recorder, _ = request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", body)
+	require.Equal(t, http.StatusConflict, recorder.Code, "a signed ID is not replaced")
+	require.Len(t, ledger.created, 1)
+}
+
+func TestRegisterHarvestRetriesTakenLotNumbers(t *testing.T) {
+	taken := &services.ChaincodeError{Code: services.CodeAlreadyExists, Message: "the herb batch already exists"}
+	ledger := newFakeLedger()
+	ledger.createErrs = []error{taken, taken}
+	hc := NewHerbController(ledger)
+
+	recorder, _ := request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", harvestBody())
+	require.Equal(t, http.StatusCreated, recorder.Code)
+	require.Len(t, ledger.batches, 1)
+
+	ledger.createErrs = []error{taken, taken, taken}
+	recorder, _ = request(t, hc.RegisterHarvest, "/api/supply-chain/harvest", http.MethodPost, "/api/supply-chain/harvest", harvestBody())
+	require.Equal(t, http.StatusConflict, recorder.Code, "the retries are bounded")
+	require.Len(t, ledger.batches, 1)
+}
+
+func TestTransportHerbBatch(t *testing.T) {
+	ledger := newFakeLedger()
+	ledger.batches["batch1"] = &models.HerbBatch{ID: "batch1", Status: models.StatusHarvested}
+	hc := NewHerbController(ledger)
+	action := models.SupplyChainActionRequest{Location: "Kochi"}
+
+	recorder, response := request(t, hc.TransportHerbBatch, "/api/supply-chain/transport/:id", http.MethodPut, "/api/supply-chain/transport/batch1", action)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "tx1", response.Data.(map[string]interface{})["transactionId"])
+	require.Equal(t, models.ActionTransport, ledger.events[0].Action)
+
+	recorder, _ = request(t, hc.TransportHerbBatch, "/api/supply-chain/transport/:id", http.MethodPut, "/api/supply-chain/transport/batch1", map[string]string{"actor": "Suresh Kumar"})
+	require.Equal(t, http.StatusBadRequest, recorder.Code, "the location is required")
+
+	recorder, _ = request(t, hc.TransportHerbBatch, "/api/supply-chain/transport/:id", http.MethodPut, "/api/supply-chain/transport/batch2", action)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestGetSupplyChainStatus(t *testing.T) {
+	ledger := newFakeLedger()
+	ledger.batches["batch1"] = &models.HerbBatch{ID: "batch1", Owner: "Ravi Kumar", Farm: "Green Valley", Status: models.StatusHarvested}
+	hc := NewHerbController(ledger)
+	_, err := ledger.RecordSupplyChainEvent("batch1", models.ActionTransport, "Kochi Depot", "Sealed in crates")
+	require.NoError(t, err)
+
+	recorder, response := request(t, hc.GetSupplyChainStatus, "/api/herbs/:id/supply-chain", http.MethodGet, "/api/herbs/batch1/supply-chain", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	timeline := response.Data.(map[string]interface{})["timeline"].([]interface{})
+	require.Len(t, timeline, 2)
+	require.Equal(t, "Ravi Kumar", timeline[0].(map[string]interface{})["actor"])
+	transport := timeline[1].(map[string]interface{})
+	require.Equal(t, "Transportation", transport["stage"])
+	require.Equal(t, fakeActor, transport["actor"], "the actor is the identity the ledger recorded")
+	require.Equal(t, "Org2MSP", transport["actorOrg"])
+	require.Equal(t, "Kochi Depot", transport["location"])
+	require.Equal(t, "tx1", transport["transactionId"])
+
+	recorder, _ = request(t, hc.GetSupplyChainStatus, "/api/herbs/:id/supply-chain", http.MethodGet, "/api/herbs/batch2/supply-chain", nil)
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestGetStats(t *testing.T) {
+	ledger := newFakeLedger()
+	ledger.batches["batch1"] = &models.HerbBatch{ID: "batch1", Status: models.StatusInTransit}
+	ledger.batches["batch2"] = &models.HerbBatch{ID: "batch2", Status: models.StatusLabTesting}
+	ledger.batches["batch3"] = &models.HerbBatch{ID: "batch3", Status: models.StatusDelivered}
+	hc := NewHerbController(ledger)
+
+	recorder, response := request(t, hc.GetStats, "/api/stats", http.MethodGet, "/api/stats", nil)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	stats := response.Data.(map[string]interface{})
+	require.EqualValues(t, 3, stats["totalBatches"])
+	require.EqualValues(t, 2, stats["activeSupplyChain"])
+}
+
+func TestErrorStatus(t *testing.T) {
+	statuses := map[string]int{
+		services.CodeNotFound:          http.StatusNotFound,
+		services.CodeAlreadyExists:     http.StatusConflict,
+		services.CodeInvalidTransition: http.StatusConflict,
+		services.CodeForbidden:         http.StatusForbidden,
+		services.CodeValidation:        http.StatusBadRequest,
+		services.CodeInternal:          http.StatusInternalServerError,
+	}
+	for code, status := range statuses {
+		err := fmt.Errorf("failed to submit transaction: %w", &services.ChaincodeError{Code: code})
+		require.Equal(t, status, errorStatus(err, http.StatusTeapot), code)
+	}
+
+	require.Equal(t, http.StatusTeapot, errorStatus(errors.New("connection refused"), http.StatusTeapot))
+}
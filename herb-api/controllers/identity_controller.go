@@ -0,0 +1,243 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+
+	"herb-api/models"
+	"herb-api/wallet"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdentityController manages the Fabric identities in the wallet
+type IdentityController struct {
+	wallet   *wallet.Wallet
+	enroller *wallet.Enroller // nil when no Fabric CA is configured
+}
+
+// NewIdentityController creates a new instance of IdentityController. enroller may be
+// nil, in which case identities can only be imported.
+func NewIdentityController(w *wallet.Wallet, enroller *wallet.Enroller) *IdentityController {
+	return &IdentityController{
+		wallet:   w,
+		enroller: enroller,
+	}
+}
+
+// ListIdentities handles GET /api/admin/identities
+func (ic *IdentityController) ListIdentities(c *gin.Context) {
+	entries, err := ic.wallet.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to list identities",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Identities retrieved successfully",
+		Data:    entries,
+	})
+}
+
+// ImportIdentity handles POST /api/admin/identities
+func (ic *IdentityController) ImportIdentity(c *gin.Context) {
+	var req models.ImportIdentityRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request payload",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	entry, err := ic.wallet.Import(req.Subject, req.MSPID, []byte(req.Certificate), []byte(req.PrivateKey))
+	if err != nil {
+		c.JSON(walletErrorStatus(err, http.StatusBadRequest), models.APIResponse{
+			Success: false,
+			Message: "Failed to import identity",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Identity imported successfully",
+		Data:    entry,
+	})
+}
+
+// EnrollIdentity handles POST /api/admin/identities/enroll
+func (ic *IdentityController) EnrollIdentity(c *gin.Context) {
+	if ic.enroller == nil {
+		c.JSON(http.StatusNotImplemented, models.APIResponse{
+			Success: false,
+			Message: "No Fabric CA is configured",
+		})
+		return
+	}
+
+	var req models.EnrollIdentityRequest
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid request payload",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	entry, err := ic.enroller.RegisterAndEnroll(req.Subject, wallet.RegistrationRequest{
+		EnrollmentID: req.EnrollmentID,
+		Type:         req.Type,
+		Affiliation:  req.Affiliation,
+		Attributes:   req.Attributes,
+	})
+	if err != nil {
+		c.JSON(walletErrorStatus(err, http.StatusBadGateway), models.APIResponse{
+			Success: false,
+			Message: "Failed to enroll identity",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, models.APIResponse{
+		Success: true,
+		Message: "Identity enrolled successfully",
+		Data:    entry,
+	})
+}
+
+// RotateIdentity handles POST /api/admin/identities/:subject/rotate. Enrolled
+// identities are reenrolled with the CA; imported ones take a new certificate and key.
+func (ic *IdentityController) RotateIdentity(c *gin.Context) {
+	subject := c.Param("subject")
+
+	existing, err := ic.wallet.Get(subject)
+	if err != nil {
+		c.JSON(walletErrorStatus(err, http.StatusInternalServerError), models.APIResponse{
+			Success: false,
+			Message: "Identity not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	var entry *wallet.Entry
+	if existing.Source == wallet.SourceEnrolled && ic.enroller != nil {
+		entry, err = ic.enroller.Reenroll(subject)
+		if errors.Is(err, wallet.ErrPreviousCertificateValid) {
+			c.JSON(http.StatusBadGateway, models.APIResponse{
+				Success: false,
+				Message: "Identity rotated, but its previous certificate is still valid at the CA; revoke it there",
+				Error:   err.Error(),
+				Data:    entry,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(walletErrorStatus(err, http.StatusBadGateway), models.APIResponse{
+				Success: false,
+				Message: "Failed to reenroll identity",
+				Error:   err.Error(),
+			})
+			return
+		}
+	} else {
+		var req models.RotateIdentityRequest
+
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request payload",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		entry, err = ic.wallet.Rotate(subject, []byte(req.Certificate), []byte(req.PrivateKey))
+		if err != nil {
+			c.JSON(walletErrorStatus(err, http.StatusBadRequest), models.APIResponse{
+				Success: false,
+				Message: "Failed to rotate identity",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: "Identity rotated successfully",
+		Data:    entry,
+	})
+}
+
+// RevokeIdentity handles POST /api/admin/identities/:subject/revoke. The body,
+// giving the reason, is optional. Enrolled identities are revoked at the CA as well;
+// imported ones, and any identity when no CA is configured, only in the wallet, and
+// the response says so.
+func (ic *IdentityController) RevokeIdentity(c *gin.Context) {
+	var req models.RevokeIdentityRequest
+
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, models.APIResponse{
+				Success: false,
+				Message: "Invalid request payload",
+				Error:   err.Error(),
+			})
+			return
+		}
+	}
+
+	var entry *wallet.Entry
+	var err error
+	if ic.enroller != nil {
+		entry, err = ic.enroller.Revoke(c.Param("subject"), req.Reason)
+	} else {
+		entry, err = ic.wallet.Revoke(c.Param("subject"), req.Reason)
+	}
+	if err != nil {
+		c.JSON(walletErrorStatus(err, http.StatusBadGateway), models.APIResponse{
+			Success: false,
+			Message: "Failed to revoke identity",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	message := "Identity revoked successfully"
+	if entry.Source != wallet.SourceEnrolled || ic.enroller == nil {
+		// the API cannot revoke a certificate it did not enroll: whoever holds the
+		// key can still sign transactions until the issuing CA revokes it
+		message = "Identity revoked in the wallet only; its certificate stays valid on the network until the issuing CA revokes it"
+	}
+
+	c.JSON(http.StatusOK, models.APIResponse{
+		Success: true,
+		Message: message,
+		Data:    entry,
+	})
+}
+
+// walletErrorStatus maps wallet errors to HTTP status codes, using fallback for
+// any other error
+func walletErrorStatus(err error, fallback int) int {
+	switch {
+	case errors.Is(err, wallet.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, wallet.ErrExists), errors.Is(err, wallet.ErrRevoked):
+		return http.StatusConflict
+	}
+	return fallback
+}
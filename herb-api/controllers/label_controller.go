@@ -0,0 +1,155 @@
+package controllers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"herb-api/labels"
+	"herb-api/middleware"
+	"herb-api/models"
+	"herb-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxLabelsPerSheet bounds the batches of one label sheet request: five pages
+const maxLabelsPerSheet = 5 * labels.LabelsPerPage
+
+// LabelController renders QR codes and printable labels for herb batches
+type LabelController struct {
+	ledger    services.HerbLedger
+	printer   *labels.Printer
+	publicURL string // base of verification URLs, as consumers reach the server
+}
+
+// NewLabelController creates a new instance of LabelController. publicURL is
+// required, as printed labels must not depend on the host name of a request.
+func NewLabelController(ledger services.HerbLedger, printer *labels.Printer, publicURL string) *LabelController {
+	return &LabelController{
+		ledger:    ledger,
+		printer:   printer,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+	}
+}
+
+// GetHerbBatchQRCode handles GET /api/herbs/:id/qr?format=png|svg&size=256
+func (lc *LabelController) GetHerbBatchQRCode(c *gin.Context) {
+	batchID := c.Param("id")
+
+	format := c.DefaultQuery("format", "png")
+	if format != "png" && format != "svg" {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid format",
+			Error:   "format must be png or svg",
+		})
+		return
+	}
+
+	size, err := strconv.Atoi(c.DefaultQuery("size", strconv.Itoa(labels.DefaultQRSize)))
+	if err != nil || size < labels.MinQRSize || size > labels.MaxQRSize {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid size",
+			Error:   fmt.Sprintf("size must be a number of pixels between %d and %d", labels.MinQRSize, labels.MaxQRSize),
+		})
+		return
+	}
+
+	// only codes for batches on the ledger are printed
+	if _, err := lc.ledgerFor(c).ReadHerbBatch(batchID); err != nil {
+		c.JSON(errorStatus(err, http.StatusServiceUnavailable), models.APIResponse{
+			Success: false,
+			Message: "Herb batch not found",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	verifyURL := lc.verifyURL(batchID)
+	var image []byte
+	var contentType string
+	if format == "svg" {
+		image, err = labels.QRCodeSVG(verifyURL, size)
+		contentType = "image/svg+xml"
+	} else {
+		image, err = labels.QRCodePNG(verifyURL, size)
+		contentType = "image/png"
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to render QR code",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.Header("X-Verify-URL", verifyURL)
+	c.Data(http.StatusOK, contentType, image)
+}
+
+// GetLabelSheet handles GET /api/labels?ids=batch1,batch2
+func (lc *LabelController) GetLabelSheet(c *gin.Context) {
+	var batchIDs []string
+	for _, id := range strings.Split(c.Query("ids"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			batchIDs = append(batchIDs, id)
+		}
+	}
+	if len(batchIDs) == 0 || len(batchIDs) > maxLabelsPerSheet {
+		c.JSON(http.StatusBadRequest, models.APIResponse{
+			Success: false,
+			Message: "Invalid batch IDs",
+			Error:   fmt.Sprintf("ids must list between 1 and %d comma-separated batch IDs", maxLabelsPerSheet),
+		})
+		return
+	}
+
+	ledger := lc.ledgerFor(c)
+	sheet := make([]labels.Label, 0, len(batchIDs))
+	for _, batchID := range batchIDs {
+		herbBatch, err := ledger.ReadHerbBatch(batchID)
+		if err != nil {
+			c.JSON(errorStatus(err, http.StatusServiceUnavailable), models.APIResponse{
+				Success: false,
+				Message: "Herb batch " + batchID + " not found",
+				Error:   err.Error(),
+			})
+			return
+		}
+		sheet = append(sheet, labels.Label{
+			BatchID:       herbBatch.ID,
+			BotanicalName: herbBatch.BotanicalName,
+			Farm:          herbBatch.Farm,
+			HarvestDate:   herbBatch.HarvestDate,
+			VerifyURL:     lc.verifyURL(herbBatch.ID),
+		})
+	}
+
+	pdf, err := lc.printer.Sheet(sheet, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, models.APIResponse{
+			Success: false,
+			Message: "Failed to render label sheet",
+			Error:   err.Error(),
+		})
+		return
+	}
+
+	c.Header("Content-Disposition", `inline; filename="herb-labels.pdf"`)
+	c.Data(http.StatusOK, "application/pdf", pdf)
+}
+
+// verifyURL returns the public verification URL of a batch, the link its QR code carries
+func (lc *LabelController) verifyURL(batchID string) string {
+	return lc.publicURL + "/verify/" + url.PathEscape(batchID)
+}
+
+func (lc *LabelController) ledgerFor(c *gin.Context) services.HerbLedger {
+	return middleware.Ledger(c, lc.ledger)
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"herb-api/labels"
+	"herb-api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func serveLabels(lc *LabelController, path string) *httptest.ResponseRecorder {
+	router := gin.New()
+	router.GET("/api/herbs/:id/qr", lc.GetHerbBatchQRCode)
+	router.GET("/api/labels", lc.GetLabelSheet)
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Host = "attacker.example.net"
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestGetHerbBatchQRCode(t *testing.T) {
+	ledger := newFakeLedger()
+	ledger.batches["batch 1"] = &models.HerbBatch{ID: "batch 1"}
+	printer, err := labels.NewPrinter("")
+	require.NoError(t, err)
+	lc := NewLabelController(ledger, printer, "https://herbtrace.example.com/")
+
+	recorder := serveLabels(lc, "/api/herbs/batch%201/qr?format=svg")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "image/svg+xml", recorder.Header().Get("Content-Type"))
+	require.Equal(t, "https://herbtrace.example.com/verify/batch%201", recorder.Header().Get("X-Verify-URL"), "the request's host is never used")
+
+	recorder = serveLabels(lc, "/api/herbs/batch2/qr")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	ledger.failure = errors.New("failed to evaluate transaction: connection refused")
+	recorder = serveLabels(lc, "/api/herbs/batch%201/qr")
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
+
+func TestGetLabelSheet(t *testing.T) {
+	ledger := newFakeLedger()
+	ledger.batches["batch1"] = &models.HerbBatch{ID: "batch1", BotanicalName: "Withania somnifera"}
+	printer, err := labels.NewPrinter("")
+	require.NoError(t, err)
+	lc := NewLabelController(ledger, printer, "https://herbtrace.example.com")
+
+	recorder := serveLabels(lc, "/api/labels?ids=batch1")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "application/pdf", recorder.Header().Get("Content-Type"))
+
+	recorder = serveLabels(lc, "/api/labels?ids=batch1,batch2")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	recorder = serveLabels(lc, "/api/labels?ids=,")
+	require.Equal(t, http.StatusBadRequest, recorder.Code)
+
+	ledger.failure = errors.New("failed to evaluate transaction: connection refused")
+	recorder = serveLabels(lc, "/api/labels?ids=batch1")
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+}
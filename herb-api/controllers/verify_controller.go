@@ -0,0 +1,120 @@
+package controllers
+
+import (
+	"embed"
+	"html/template"
+	"log"
+	"net/http"
+	"time"
+
+	"herb-api/models"
+	"herb-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed templates/verify.html
+var templates embed.FS
+
+var labVerdicts = map[string]string{
+	models.LabVerdictPassed:     "Passed",
+	models.LabVerdictPending:    "In progress",
+	models.LabVerdictNotTested:  "Not yet tested",
+	models.LabVerdictUnverified: "No lab record",
+}
+
+var verifyPage = template.Must(template.New("verify.html").Funcs(template.FuncMap{
+	"date": func(t time.Time) string {
+		return t.Format("2 January 2006")
+	},
+	"verdict": func(verdict string) string {
+		if label, ok := labVerdicts[verdict]; ok {
+			return label
+		}
+		return verdict
+	},
+}).ParseFS(templates, "templates/verify.html"))
+
+// verifyPageData is rendered by the verification page: the provenance of a batch,
+// or why there is none
+type verifyPageData struct {
+	BatchID    string
+	Provenance *models.PublicProvenance
+	NotFound   bool
+}
+
+// VerifyController serves the public provenance of herb batches to consumers who
+// scan a label. It needs no authentication and always reads the ledger as the
+// server identity.
+type VerifyController struct {
+	ledger services.HerbLedger
+}
+
+// NewVerifyController creates a new instance of VerifyController
+func NewVerifyController(ledger services.HerbLedger) *VerifyController {
+	return &VerifyController{
+		ledger: ledger,
+	}
+}
+
+// VerifyHerbBatch handles GET /verify/:id. Browsers get an HTML page; other clients,
+// or any request with ?format=json, get JSON.
+func (vc *VerifyController) VerifyHerbBatch(c *gin.Context) {
+	batchID := c.Param("id")
+	provenance, err := vc.ledger.GetPublicProvenance(batchID)
+
+	status := http.StatusOK
+	if err != nil {
+		status = errorStatus(err, http.StatusServiceUnavailable)
+		if status != http.StatusNotFound {
+			// ledger errors are logged rather than shown to the public
+			log.Printf("Failed to verify herb batch %s: %v", batchID, err)
+			status = http.StatusServiceUnavailable
+		}
+	}
+
+	c.Header("Vary", "Accept")
+	if status != http.StatusServiceUnavailable {
+		c.Header("Cache-Control", "public, max-age=60")
+	}
+	if c.Query("format") == "json" || c.NegotiateFormat(gin.MIMEJSON, gin.MIMEHTML) != gin.MIMEHTML {
+		vc.writeJSON(c, status, provenance)
+		return
+	}
+
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	err = verifyPage.Execute(c.Writer, verifyPageData{
+		BatchID:    batchID,
+		Provenance: provenance,
+		NotFound:   status == http.StatusNotFound,
+	})
+	if err != nil {
+		log.Printf("Failed to render the verification page of %s: %v", batchID, err)
+	}
+}
+
+func (vc *VerifyController) writeJSON(c *gin.Context, status int, provenance *models.PublicProvenance) {
+	switch status {
+	case http.StatusOK:
+		c.JSON(status, models.APIResponse{
+			Success: true,
+			Message: "Herb batch verified",
+			Data:    provenance,
+		})
+	case http.StatusNotFound:
+		c.JSON(status, models.APIResponse{
+			Success: false,
+			Message: "Herb batch not found",
+			Error:   "no herb batch with this ID is recorded on the ledger",
+		})
+	default:
+		c.JSON(status, models.APIResponse{
+			Success: false,
+			Message: "Verification is unavailable",
+			Error:   "the ledger could not be reached, retry later",
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"herb-api/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func verify(t *testing.T, ledger *fakeLedger, path string, accept string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := gin.New()
+	router.GET("/verify/:id", NewVerifyController(ledger).VerifyHerbBatch)
+	request := httptest.NewRequest(http.MethodGet, path, nil)
+	request.Header.Set("Accept", accept)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func verifiedLedger() *fakeLedger {
+	ledger := newFakeLedger()
+	ledger.provenance["batch1"] = &models.PublicProvenance{
+		BatchID:       "batch1",
+		BotanicalName: "Withania somnifera",
+		Region:        "Kerala",
+		HarvestDate:   "2024-08-15",
+		Certifications: []models.Certification{
+			{Type: "Organic", IssuedAt: time.Date(2024, time.August, 20, 0, 0, 0, 0, time.UTC)},
+		},
+		LabVerdict: models.LabVerdictPassed,
+	}
+	return ledger
+}
+
+func TestVerifyHerbBatchHTML(t *testing.T) {
+	recorder := verify(t, verifiedLedger(), "/verify/batch1", "text/html,application/xhtml+xml")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "text/html; charset=utf-8", recorder.Header().Get("Content-Type"))
+	require.Contains(t, recorder.Header().Get("Content-Security-Policy"), "default-src 'none'")
+	require.Contains(t, recorder.Body.String(), "Withania somnifera")
+	require.Contains(t, recorder.Body.String(), "20 August 2024")
+
+	recorder = verify(t, verifiedLedger(), "/verify/batch2", "text/html")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+
+	ledger := verifiedLedger()
+	ledger.provenance["batch1"].LabVerdict = models.LabVerdictUnverified
+	recorder = verify(t, ledger, "/verify/batch1", "text/html")
+	require.Contains(t, recorder.Body.String(), "No lab record")
+	require.NotContains(t, recorder.Body.String(), "Passed")
+}
+
+func TestVerifyHerbBatchJSON(t *testing.T) {
+	recorder := verify(t, verifiedLedger(), "/verify/batch1", "application/json")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), `"labVerdict":"passed"`)
+	require.Equal(t, "public, max-age=60", recorder.Header().Get("Cache-Control"))
+
+	recorder = verify(t, verifiedLedger(), "/verify/batch1?format=json", "text/html")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Header().Get("Content-Type"), "application/json")
+
+	recorder = verify(t, verifiedLedger(), "/verify/batch2", "application/json")
+	require.Equal(t, http.StatusNotFound, recorder.Code)
+}
+
+func TestVerifyHerbBatchHidesLedgerErrors(t *testing.T) {
+	ledger := verifiedLedger()
+	ledger.failure = errors.New("failed to evaluate transaction: peer0.org1.example.com:7051 unreachable")
+
+	recorder := verify(t, ledger, "/verify/batch1", "application/json")
+	require.Equal(t, http.StatusServiceUnavailable, recorder.Code)
+	require.Empty(t, recorder.Header().Get("Cache-Control"), "failures must not be cached")
+	require.NotContains(t, recorder.Body.String(), "peer0")
+}
+
+func TestVerifyRecalledHerbBatch(t *testing.T) {
+	ledger := verifiedLedger()
+	ledger.provenance["batch1"].Recalled = true
+	ledger.provenance["batch1"].Recall = &models.PublicRecall{
+		Reason:     "Aflatoxin above limits",
+		RecalledAt: time.Date(2024, time.September, 2, 10, 0, 0, 0, time.UTC),
+	}
+
+	recorder := verify(t, ledger, "/verify/batch1", "text/html")
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Contains(t, recorder.Body.String(), "recalled on 2 September 2024: Aflatoxin above limits")
+
+	recorder = verify(t, ledger, "/verify/batch1", "application/json")
+	require.Contains(t, recorder.Body.String(), `"recall":{"reason":"Aflatoxin above limits","recalledAt":"2024-09-02T10:00:00Z"}`)
+}
@@ -0,0 +1,88 @@
+package labels
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testVerifyURL = "https://herbtrace.example.com/verify/01M58QP9T4CDNSEHEE38"
+
+func TestQRCodePNG(t *testing.T) {
+	data, err := QRCodePNG(testVerifyURL, DefaultQRSize)
+	require.NoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, DefaultQRSize, img.Bounds().Dx())
+	require.Equal(t, DefaultQRSize, img.Bounds().Dy())
+
+	white := color.GrayModel.Convert(img.At(0, 0)).(color.Gray)
+	require.Equal(t, uint8(0xff), white.Y, "the quiet zone is white")
+	dark := 0
+	for y := 0; y < DefaultQRSize; y++ {
+		for x := 0; x < DefaultQRSize; x++ {
+			if color.GrayModel.Convert(img.At(x, y)).(color.Gray).Y == 0 {
+				dark++
+			}
+		}
+	}
+	require.NotZero(t, dark)
+}
+
+func TestQRCodeSVG(t *testing.T) {
+	data, err := QRCodeSVG(testVerifyURL, 300)
+	require.NoError(t, err)
+	svg := string(data)
+
+	code, err := newQRCode(testVerifyURL)
+	require.NoError(t, err)
+	bitmap := code.Bitmap()
+	modules := strconv.Itoa(len(bitmap))
+	require.True(t, strings.HasPrefix(svg, `<svg xmlns="http://www.w3.org/2000/svg" width="300" height="300" viewBox="0 0 `+modules+" "+modules+`"`))
+	require.True(t, strings.HasSuffix(svg, `"/></svg>`))
+
+	// the runs of the path cover exactly the dark modules
+	drawn := make([][]bool, len(bitmap))
+	for y := range drawn {
+		drawn[y] = make([]bool, len(bitmap))
+	}
+	runs := regexp.MustCompile(`M(\d+) (\d+)h(\d+)v1h-(\d+)z`).FindAllStringSubmatch(svg, -1)
+	require.NotEmpty(t, runs)
+	for _, run := range runs {
+		x, _ := strconv.Atoi(run[1])
+		y, _ := strconv.Atoi(run[2])
+		length, _ := strconv.Atoi(run[3])
+		require.Equal(t, run[3], run[4])
+		for i := x; i < x+length; i++ {
+			drawn[y][i] = true
+		}
+	}
+	require.Equal(t, bitmap, drawn)
+}
+
+func TestQRCodeRejectsOversizedContent(t *testing.T) {
+	_, err := QRCodePNG(strings.Repeat("x", 3000), DefaultQRSize)
+	require.ErrorContains(t, err, "failed to encode QR code")
+	_, err = QRCodeSVG(strings.Repeat("x", 3000), DefaultQRSize)
+	require.ErrorContains(t, err, "failed to encode QR code")
+}
+
+func TestForEachRun(t *testing.T) {
+	bitmap := [][]bool{
+		{true, true, false, true},
+		{false, false, false, false},
+		{false, true, true, true},
+	}
+	var runs [][3]int
+	forEachRun(bitmap, func(x int, y int, length int) {
+		runs = append(runs, [3]int{x, y, length})
+	})
+	require.Equal(t, [][3]int{{0, 0, 2}, {3, 0, 1}, {1, 2, 3}}, runs)
+}
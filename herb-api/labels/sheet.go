@@ -0,0 +1,177 @@
+package labels
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// Label is the text and verification link printed on one batch label
+type Label struct {
+	BatchID       string
+	BotanicalName string
+	Farm          string
+	HarvestDate   string
+	VerifyURL     string
+}
+
+// Sheet geometry in millimetres: A4 with 3 columns of 7 labels of 63.5 x 38.1 mm,
+// the layout of common 21-up label stock (e.g. Avery L7160)
+const (
+	pageWidth     = 210.0
+	pageHeight    = 297.0
+	labelColumns  = 3
+	labelRows     = 7
+	labelWidth    = 63.5
+	labelHeight   = 38.1
+	columnGap     = 2.5
+	labelPadding  = 2.5
+	qrSize        = 26.0
+	textGap       = 2.0
+	LabelsPerPage = labelColumns * labelRows
+)
+
+// Printer renders label sheets
+type Printer struct {
+	font []byte // UTF-8 TrueType font, or nil for Helvetica limited to Windows-1252
+}
+
+// NewPrinter creates a Printer. fontFile names a TrueType font used for all label
+// text; without one, labels use Helvetica and characters outside Windows-1252, such
+// as Devanagari or Tamil farm names, print as dots.
+func NewPrinter(fontFile string) (*Printer, error) {
+	if fontFile == "" {
+		return &Printer{}, nil
+	}
+	font, err := os.ReadFile(fontFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read label font: %v", err)
+	}
+	return &Printer{font: font}, nil
+}
+
+// Sheet renders labels onto as many A4 pages as they need and returns the PDF
+func (p *Printer) Sheet(labels []Label, created time.Time) ([]byte, error) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetCreationDate(created)
+	pdf.SetTitle("HerbTrace batch labels", true)
+	pdf.SetCreator("HerbTrace API", true)
+
+	family, translate := "Helvetica", pdf.UnicodeTranslatorFromDescriptor("")
+	if p.font != nil {
+		family, translate = "LabelFont", func(s string) string { return s }
+		pdf.AddUTF8FontFromBytes(family, "", p.font)
+	}
+
+	marginLeft := (pageWidth - labelColumns*labelWidth - (labelColumns-1)*columnGap) / 2
+	marginTop := (pageHeight - labelRows*labelHeight) / 2
+
+	for i, label := range labels {
+		if i%LabelsPerPage == 0 {
+			pdf.AddPage()
+		}
+		slot := i % LabelsPerPage
+		x := marginLeft + float64(slot%labelColumns)*(labelWidth+columnGap)
+		y := marginTop + float64(slot/labelColumns)*labelHeight
+
+		code, err := newQRCode(label.VerifyURL)
+		if err != nil {
+			return nil, fmt.Errorf("label of %s: %v", label.BatchID, err)
+		}
+		drawQRCode(pdf, code.Bitmap(), x+labelPadding, y+(labelHeight-qrSize)/2, qrSize)
+
+		textX := x + labelPadding + qrSize + textGap
+		textWidth := labelWidth - 2*labelPadding - qrSize - textGap
+		lines := []struct {
+			size     float64
+			text     string
+			maxLines int
+		}{
+			{8, label.BotanicalName, 2},
+			{6.5, label.Farm, 2},
+			{6.5, "Harvested " + label.HarvestDate, 1},
+			{6.5, "Lot " + label.BatchID, 2},
+		}
+
+		lineY := y + labelPadding + 1
+		for _, line := range lines {
+			pdf.SetFont(family, "", line.size)
+			height := line.size * 0.3528 * 1.25 // points to millimetres, with leading
+			for _, text := range wrapText(pdf, translate, line.text, textWidth, line.maxLines) {
+				pdf.SetXY(textX, lineY)
+				pdf.CellFormat(textWidth, height, translate(text), "", 0, "L", false, 0, "")
+				lineY += height
+			}
+			lineY += 0.8
+		}
+	}
+
+	var out bytes.Buffer
+	if err := pdf.Output(&out); err != nil {
+		return nil, fmt.Errorf("failed to render label sheet: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// drawQRCode draws a QR code bitmap, quiet zone included, as vector rectangles
+func drawQRCode(pdf *fpdf.Fpdf, bitmap [][]bool, x float64, y float64, size float64) {
+	module := size / float64(len(bitmap))
+	pdf.SetFillColor(0, 0, 0)
+	forEachRun(bitmap, func(runX int, runY int, length int) {
+		pdf.Rect(x+float64(runX)*module, y+float64(runY)*module, float64(length)*module, module, "F")
+	})
+}
+
+// wrapText breaks text into at most maxLines lines that fit width in the current font,
+// ending a truncated last line with an ellipsis. fpdf's SplitText is not used because
+// it fails on text outside Latin-1 with the core fonts.
+func wrapText(pdf *fpdf.Fpdf, translate func(string) string, text string, width float64, maxLines int) []string {
+	fits := func(s string) bool {
+		return pdf.GetStringWidth(translate(s)) <= width
+	}
+
+	var lines []string
+	current := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if fits(candidate) {
+			current = candidate
+			continue
+		}
+		if current != "" {
+			lines = append(lines, current)
+		}
+		current = word
+		// a word wider than the label is broken wherever it overflows
+		for !fits(current) {
+			runes := []rune(current)
+			cut := 1
+			for cut < len(runes) && fits(string(runes[:cut+1])) {
+				cut++
+			}
+			lines = append(lines, string(runes[:cut]))
+			current = string(runes[cut:])
+		}
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		last := []rune(lines[maxLines-1])
+		for len(last) > 0 && !fits(string(last)+"…") {
+			last = last[:len(last)-1]
+		}
+		lines[maxLines-1] = strings.TrimRight(string(last), " ") + "…"
+	}
+	return lines
+}
@@ -0,0 +1,82 @@
+package labels
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-pdf/fpdf"
+	"github.com/stretchr/testify/require"
+)
+
+func testLabels(count int) []Label {
+	labels := make([]Label, count)
+	for i := range labels {
+		id := fmt.Sprintf("01M58QP9T4CDNSEHEE%02d", i)
+		labels[i] = Label{
+			BatchID:       id,
+			BotanicalName: "Withania somnifera",
+			Farm:          "Green Valley Organic Farm, Wayanad",
+			HarvestDate:   "2024-08-15",
+			VerifyURL:     "https://herbtrace.example.com/verify/" + id,
+		}
+	}
+	return labels
+}
+
+func TestSheet(t *testing.T) {
+	printer, err := NewPrinter("")
+	require.NoError(t, err)
+	created := time.Date(2024, time.August, 20, 9, 0, 0, 0, time.UTC)
+
+	pdf, err := printer.Sheet(testLabels(LabelsPerPage), created)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(string(pdf), "%PDF-"))
+	require.Contains(t, string(pdf), "/Count 1")
+
+	pdf, err = printer.Sheet(testLabels(LabelsPerPage+1), created)
+	require.NoError(t, err)
+	require.Contains(t, string(pdf), "/Count 2", "labels past a full page start a new one")
+}
+
+func TestNewPrinterFont(t *testing.T) {
+	_, err := NewPrinter(filepath.Join(t.TempDir(), "missing.ttf"))
+	require.ErrorContains(t, err, "failed to read label font")
+
+	fontFile := filepath.Join(t.TempDir(), "broken.ttf")
+	require.NoError(t, os.WriteFile(fontFile, []byte("not a font"), 0600))
+	printer, err := NewPrinter(fontFile)
+	require.NoError(t, err)
+	_, err = printer.Sheet(testLabels(1), time.Now())
+	require.ErrorContains(t, err, "failed to render label sheet")
+}
+
+func TestWrapText(t *testing.T) {
+	pdf := fpdf.New("P", "mm", "A4", "")
+	pdf.SetFont("Helvetica", "", 8)
+	translate := pdf.UnicodeTranslatorFromDescriptor("")
+	width := 30.0
+	fits := func(line string) bool {
+		return pdf.GetStringWidth(translate(line)) <= width
+	}
+
+	require.Equal(t, []string{"Withania somnifera"}, wrapText(pdf, translate, "Withania  somnifera", width, 2))
+	require.Empty(t, wrapText(pdf, translate, "  ", width, 2))
+
+	lines := wrapText(pdf, translate, "Green Valley Organic Farm and Cooperative, Wayanad District", width, 2)
+	require.Len(t, lines, 2)
+	require.True(t, strings.HasSuffix(lines[1], "…"), "truncated text ends with an ellipsis")
+	for _, line := range lines {
+		require.True(t, fits(line), line)
+	}
+
+	lines = wrapText(pdf, translate, strings.Repeat("W", 40), width, 10)
+	require.Greater(t, len(lines), 1)
+	for _, line := range lines {
+		require.True(t, fits(line), line)
+	}
+	require.Equal(t, strings.Repeat("W", 40), strings.Join(lines, ""), "a word wider than the label is broken")
+}
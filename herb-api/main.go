@@ -1,43 +1,141 @@
 package main
 
 import (
+	"flag"
 	"log"
+	"net"
 	"net/http"
+	"os"
 
+	"herb-api/auth"
+	"herb-api/config"
 	"herb-api/controllers"
+	"herb-api/labels"
+	"herb-api/middleware"
+	"herb-api/services"
+	"herb-api/wallet"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
+	configPath := flag.String("config", os.Getenv("HERB_API_CONFIG"), "path of the YAML configuration file (defaults to $HERB_API_CONFIG; settings may be overridden by environment variables)")
+	repairUnderscores := flag.Bool("repair-underscores", false, "restore the spaces that earlier versions replaced with underscores in the herb batches of the client's organisation, then exit (requires an admin identity; runs once per organisation)")
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath)
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
 	// Set Gin to release mode for production
 	// gin.SetMode(gin.ReleaseMode)
 
 	// Create Gin router
 	router := gin.Default()
 
+	// Take client addresses from X-Forwarded-For only when set by a trusted proxy
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalf("Invalid trusted proxies: %v", err)
+	}
+
 	// Add CORS middleware
-	router.Use(func(c *gin.Context) {
-		c.Header("Access-Control-Allow-Origin", "*")
-		c.Header("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Header("Access-Control-Allow-Headers", "Origin, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
-
-		if c.Request.Method == "OPTIONS" {
-			c.AbortWithStatus(204)
-			return
+	router.Use(middleware.CORS(cfg.Server.CORSOrigins))
+
+	// Open the ledger backend: the Fabric Gateway, or the chaincode run in-memory
+	// for local development
+	var ledger services.HerbLedger
+	switch cfg.Ledger.Backend {
+	case config.BackendFabric:
+		ledger, err = services.NewFabricService(cfg.FabricServiceConfig())
+		if err != nil {
+			log.Fatalf("Failed to connect to Fabric: %v", err)
+		}
+	case config.BackendMemory:
+		ledger, err = services.NewMemoryLedger(cfg.Fabric.MSPID, true)
+		if err != nil {
+			log.Fatalf("Failed to create in-memory ledger: %v", err)
+		}
+	}
+	defer ledger.Close()
+
+	if *repairUnderscores {
+		fabricService, ok := ledger.(*services.FabricService)
+		if !ok {
+			log.Fatalf("-repair-underscores requires the fabric ledger backend")
 		}
+		repaired, err := fabricService.RepairUnderscoredHerbBatches()
+		if err != nil {
+			log.Fatalf("Failed to repair herb batches: %v", err)
+		}
+		log.Printf("Repaired %d herb batches: %v", len(repaired), repaired)
+		return
+	}
 
-		c.Next()
-	})
+	// Authenticate API callers and sign their transactions with their own identity
+	var apiMiddleware, adminMiddleware []gin.HandlerFunc
+	authenticator, err := auth.New(cfg.AuthOptions())
+	if err != nil {
+		log.Fatalf("Failed to set up authentication: %v", err)
+	}
+	var identityController *controllers.IdentityController
+	if authenticator != nil {
+		var identities auth.IdentityStores
+		if cfg.Auth.IdentitiesFile != "" {
+			fileIdentities, err := auth.LoadIdentityFile(cfg.Auth.IdentitiesFile)
+			if err != nil {
+				log.Fatalf("Failed to load identities: %v", err)
+			}
+			identities = append(identities, fileIdentities)
+		}
+		if cfg.Wallet.Enabled() {
+			identityWallet, enroller, err := openWallet(cfg)
+			if err != nil {
+				log.Fatalf("Failed to open the identity wallet: %v", err)
+			}
+			identities = append(identities, identityWallet)
+			identityController = controllers.NewIdentityController(identityWallet, enroller)
+		}
+
+		authenticate := middleware.Authenticate(authenticator)
+		apiMiddleware = append(apiMiddleware, authenticate, middleware.BindIdentity(identities, ledger))
+		adminMiddleware = append(adminMiddleware, authenticate, middleware.RequireRole(auth.RoleAdmin))
+	} else {
+		log.Println("⚠️  Authentication is disabled: every caller acts as the server identity")
+	}
 
-	// Create controller
-	herbController := controllers.NewHerbController()
+	// Workflow endpoints check the caller's role when callers are authenticated
+	requireRole := func(roles ...string) gin.HandlerFunc {
+		if authenticator == nil {
+			return func(c *gin.Context) { c.Next() }
+		}
+		return middleware.RequireRole(roles...)
+	}
+
+	// Create controllers
+	herbController := controllers.NewHerbController(ledger)
+	// Printed labels outlive any host name a request happens to use, so QR codes
+	// and labels are only served with a configured public URL
+	var labelController *controllers.LabelController
+	if cfg.Server.PublicURL != "" {
+		printer, err := labels.NewPrinter(cfg.Labels.FontFile)
+		if err != nil {
+			log.Fatalf("Failed to set up label printing: %v", err)
+		}
+		labelController = controllers.NewLabelController(ledger, printer, cfg.Server.PublicURL)
+	} else {
+		log.Println("⚠️  QR codes and labels are disabled: set server.publicURL to the address consumers can reach")
+	}
+	verifyController := controllers.NewVerifyController(ledger)
 
 	// Health check endpoint
 	router.GET("/health", herbController.HealthCheck)
 
+	// Public verification of scanned labels: read-only, unauthenticated and rate limited
+	router.GET("/verify/:id", middleware.RateLimit(cfg.Verify.RequestsPerMinute, cfg.Verify.Burst), verifyController.VerifyHerbBatch)
+
 	// API routes
-	api := router.Group("/api")
+	api := router.Group("/api", apiMiddleware...)
 	{
 		// Herb batch routes
 		herbs := api.Group("/herbs")
@@ -45,93 +143,172 @@ func main() {
 			herbs.POST("", herbController.CreateHerbBatch)                      // Create new herb batch
 			herbs.GET("", herbController.GetAllHerbBatches)                     // Get all herb batches
 			herbs.GET("/:id", herbController.GetHerbBatch)                      // Get specific herb batch
-			herbs.PUT("/:id/status", herbController.UpdateHerbBatchStatus)      // Update herb batch status
 			herbs.PUT("/:id/transfer", herbController.TransferHerbBatch)        // Transfer herb batch ownership
 			herbs.GET("/:id/supply-chain", herbController.GetSupplyChainStatus) // Get supply chain status
+			herbs.GET("/:id/epcis", herbController.GetHerbBatchEPCIS)           // Export lifecycle as EPCIS 2.0
+			if labelController != nil {
+				herbs.GET("/:id/qr", labelController.GetHerbBatchQRCode) // QR code linking to the verification page
+			}
+
+			// Status changes outside the workflow, by the holding farmer or an admin
+			herbs.PUT("/:id/status", requireRole(auth.RoleFarmer, auth.RoleAdmin), herbController.UpdateHerbBatchStatus)
+
+			// Admin endpoints
+			herbs.POST("/:id/recall", requireRole(auth.RoleAdmin), herbController.RecallHerbBatch)
+		}
+
+		// GS1 EPCIS 2.0 export by harvest date
+		api.GET("/epcis", herbController.GetEPCISByHarvestDate)
+
+		// Printable label sheet of several batches
+		if labelController != nil {
+			api.GET("/labels", labelController.GetLabelSheet)
 		}
 
 		// Statistics endpoint
 		api.GET("/stats", herbController.GetStats)
+
+		// Farmer device keys for signed harvest attestations
+		api.POST("/devices", herbController.RegisterDeviceKey)
+	}
+
+	// Identity wallet administration; administrators need no Fabric identity of their own
+	if identityController != nil {
+		admin := router.Group("/api/admin", adminMiddleware...)
+		{
+			admin.GET("/identities", identityController.ListIdentities)                  // List wallet identities
+			admin.POST("/identities", identityController.ImportIdentity)                 // Import a certificate and key
+			admin.POST("/identities/enroll", identityController.EnrollIdentity)          // Register and enroll with the Fabric CA
+			admin.POST("/identities/:subject/rotate", identityController.RotateIdentity) // Reenroll or replace the key
+			admin.POST("/identities/:subject/revoke", identityController.RevokeIdentity) // Revoke an identity
+		}
 	}
 
 	// Supply chain specific endpoints
 	supplyChain := api.Group("/supply-chain")
 	{
 		// Farmer endpoints
-		supplyChain.POST("/harvest", func(c *gin.Context) {
-			// Set status to "Harvested" and call CreateHerbBatch
-			var req map[string]interface{}
-			if err := c.ShouldBindJSON(&req); err != nil {
-				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
-				return
-			}
-			req["status"] = "Harvested"
-			c.Set("herbData", req)
-			herbController.CreateHerbBatch(c)
-		})
+		supplyChain.POST("/harvest", requireRole(auth.RoleFarmer), herbController.RegisterHarvest)
 
 		// Transporter endpoints
-		supplyChain.PUT("/transport/:id", func(c *gin.Context) {
-			batchID := c.Param("id")
-			c.JSON(http.StatusOK, gin.H{
-				"message": "Herb batch " + batchID + " picked up for transport",
-				"action":  "Use PUT /api/herbs/" + batchID + "/status with newStatus: 'In-Transit'",
-			})
-		})
+		supplyChain.PUT("/transport/:id", requireRole(auth.RoleTransporter), herbController.TransportHerbBatch)
 
 		// Lab endpoints
-		supplyChain.PUT("/lab-receive/:id", func(c *gin.Context) {
-			batchID := c.Param("id")
-			c.JSON(http.StatusOK, gin.H{
-				"message": "Herb batch " + batchID + " received at lab",
-				"action":  "Use PUT /api/herbs/" + batchID + "/status with newStatus: 'Lab-Testing'",
-			})
-		})
-
-		supplyChain.PUT("/certify/:id", func(c *gin.Context) {
-			batchID := c.Param("id")
-			c.JSON(http.StatusOK, gin.H{
-				"message": "Herb batch " + batchID + " certified",
-				"action":  "Use PUT /api/herbs/" + batchID + "/status with newStatus: 'Certified'",
-			})
-		})
+		supplyChain.PUT("/lab-receive/:id", requireRole(auth.RoleLab), herbController.ReceiveHerbBatchAtLab)
+		supplyChain.PUT("/certify/:id", requireRole(auth.RoleLab), herbController.CertifyHerbBatch)
 	}
 
 	// API documentation endpoint
+	herbEndpoints := map[string]string{
+		"create":       "POST /api/herbs",
+		"getAll":       "GET /api/herbs",
+		"getById":      "GET /api/herbs/:id",
+		"updateStatus": "PUT /api/herbs/:id/status",
+		"transfer":     "PUT /api/herbs/:id/transfer",
+		"supplyChain":  "GET /api/herbs/:id/supply-chain",
+		"epcis":        "GET /api/herbs/:id/epcis",
+		"recall":       "POST /api/herbs/:id/recall",
+	}
+	endpoints := map[string]interface{}{
+		"health": "GET /health",
+		"verify": "GET /verify/:id",
+		"herbs":  herbEndpoints,
+		"identities": map[string]string{
+			"list":   "GET /api/admin/identities",
+			"import": "POST /api/admin/identities",
+			"enroll": "POST /api/admin/identities/enroll",
+			"rotate": "POST /api/admin/identities/:subject/rotate",
+			"revoke": "POST /api/admin/identities/:subject/revoke",
+		},
+		"epcis":   "GET /api/epcis",
+		"stats":   "GET /api/stats",
+		"devices": "POST /api/devices",
+		"supplyChain": map[string]string{
+			"harvest":    "POST /api/supply-chain/harvest",
+			"transport":  "PUT /api/supply-chain/transport/:id",
+			"labReceive": "PUT /api/supply-chain/lab-receive/:id",
+			"certify":    "PUT /api/supply-chain/certify/:id",
+		},
+	}
+	if labelController != nil {
+		herbEndpoints["qrCode"] = "GET /api/herbs/:id/qr"
+		endpoints["labels"] = "GET /api/labels"
+	}
 	router.GET("/", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{
 			"service":     "HerbTrace Blockchain API",
 			"version":     "1.0.0",
 			"description": "API for Ayurvedic Supply Chain Management on Hyperledger Fabric",
-			"endpoints": map[string]interface{}{
-				"health": "GET /health",
-				"herbs": map[string]string{
-					"create":       "POST /api/herbs",
-					"getAll":       "GET /api/herbs",
-					"getById":      "GET /api/herbs/:id",
-					"updateStatus": "PUT /api/herbs/:id/status",
-					"transfer":     "PUT /api/herbs/:id/transfer",
-					"supplyChain":  "GET /api/herbs/:id/supply-chain",
-				},
-				"stats": "GET /api/stats",
-				"supplyChain": map[string]string{
-					"harvest":    "POST /api/supply-chain/harvest",
-					"transport":  "PUT /api/supply-chain/transport/:id",
-					"labReceive": "PUT /api/supply-chain/lab-receive/:id",
-					"certify":    "PUT /api/supply-chain/certify/:id",
-				},
-			},
+			"endpoints":   endpoints,
 		})
 	})
 
 	// Start server
-	log.Println("🌿 HerbTrace API Server starting on :8080")
-	log.Println("📡 Blockchain Network: Hyperledger Fabric")
-	log.Println("🔗 Channel: herbtrace-temp")
-	log.Println("📋 API Documentation: http://localhost:8080")
-	log.Println("❤️  Health Check: http://localhost:8080/health")
+	server := &http.Server{
+		Addr:         cfg.Server.ListenAddress,
+		Handler:      router,
+		ReadTimeout:  cfg.Server.ReadTimeout,
+		WriteTimeout: cfg.Server.WriteTimeout,
+	}
+	baseURL := "http://" + displayAddress(cfg.Server.ListenAddress)
+	if cfg.Server.TLS.Enabled() {
+		baseURL = "https://" + displayAddress(cfg.Server.ListenAddress)
+	}
 
-	if err := router.Run(":8080"); err != nil {
+	log.Printf("🌿 HerbTrace API Server starting on %s", cfg.Server.ListenAddress)
+	if cfg.Ledger.Backend == config.BackendMemory {
+		log.Println("📡 Blockchain Network: in-memory ledger (data is lost on restart)")
+	} else {
+		log.Println("📡 Blockchain Network: Hyperledger Fabric")
+		log.Printf("🔗 Gateway: %s, channel: %s, chaincode: %s", cfg.Fabric.PeerEndpoint, cfg.Fabric.Channel, cfg.Fabric.Chaincode)
+	}
+	log.Printf("📋 API Documentation: %s", baseURL)
+	log.Printf("❤️  Health Check: %s/health", baseURL)
+
+	if cfg.Server.TLS.Enabled() {
+		err = server.ListenAndServeTLS(cfg.Server.TLS.CertFile, cfg.Server.TLS.KeyFile)
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err != nil {
 		log.Fatal("Failed to start server:", err)
 	}
 }
+
+// openWallet opens the encrypted identity wallet and, when a Fabric CA is
+// configured, the enroller that issues its identities
+func openWallet(cfg *config.Config) (*wallet.Wallet, *wallet.Enroller, error) {
+	masterKey, err := wallet.LoadMasterKey(cfg.Wallet.MasterKey, cfg.Wallet.MasterKeyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	store, err := wallet.NewFileStore(cfg.Wallet.Directory)
+	if err != nil {
+		return nil, nil, err
+	}
+	identityWallet, err := wallet.New(store, masterKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !cfg.CA.Enabled() {
+		return identityWallet, nil, nil
+	}
+	ca, err := wallet.NewCAClient(cfg.CAClientConfig())
+	if err != nil {
+		return nil, nil, err
+	}
+	return identityWallet, wallet.NewEnroller(identityWallet, ca), nil
+}
+
+// displayAddress turns a listen address such as :8080 into one a browser can open
+func displayAddress(listenAddress string) string {
+	host, port, err := net.SplitHostPort(listenAddress)
+	if err != nil {
+		return listenAddress
+	}
+	if host == "" || host == "0.0.0.0" || host == "::" {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"herb-api/auth"
+	"herb-api/models"
+	"herb-api/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Context keys set by Authenticate and BindIdentity
+const (
+	userKey   = "user"
+	ledgerKey = "ledger"
+)
+
+// Authenticate requires a valid bearer token and records the caller for
+// CurrentUser and RequireRole
+func Authenticate(authenticator *auth.Authenticator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token, ok := bearerToken(c.GetHeader("Authorization"))
+		if !ok {
+			c.Header("WWW-Authenticate", `Bearer realm="herb-api"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Message: "Authentication required",
+				Error:   "missing bearer token",
+			})
+			return
+		}
+
+		user, err := authenticator.Authenticate(token)
+		if err != nil {
+			c.Header("WWW-Authenticate", `Bearer realm="herb-api", error="invalid_token"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Message: "Authentication failed",
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.Set(userKey, user)
+		c.Next()
+	}
+}
+
+// BindIdentity binds an authenticated request to the caller's Fabric identity:
+// handlers reach the ledger through Ledger, so every transaction they submit is
+// signed by the caller rather than the server identity. It must follow Authenticate.
+func BindIdentity(identities auth.IdentityStore, ledger services.HerbLedger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, models.APIResponse{
+				Success: false,
+				Message: "Authentication required",
+				Error:   "no authenticated user",
+			})
+			return
+		}
+
+		identity, err := identities.Identity(user.Subject)
+		if err != nil {
+			status := http.StatusInternalServerError
+			if errors.Is(err, auth.ErrNoIdentity) {
+				status = http.StatusForbidden
+			}
+			c.AbortWithStatusJSON(status, models.APIResponse{
+				Success: false,
+				Message: "No ledger identity for " + user.Name,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		userLedger, err := ledger.WithIdentity(identity)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, models.APIResponse{
+				Success: false,
+				Message: "Failed to use the ledger identity of " + user.Name,
+				Error:   err.Error(),
+			})
+			return
+		}
+
+		c.Set(ledgerKey, userLedger)
+		c.Next()
+	}
+}
+
+// RequireRole admits authenticated callers holding any of the given roles. It must
+// follow Authenticate.
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user := CurrentUser(c)
+		if user == nil || !user.HasRole(roles...) {
+			c.AbortWithStatusJSON(http.StatusForbidden, models.APIResponse{
+				Success: false,
+				Message: "Permission denied",
+				Error:   "requires the role " + strings.Join(roles, " or "),
+			})
+			return
+		}
+		c.Next()
+	}
+}
+
+// CurrentUser returns the authenticated caller, or nil when authentication is disabled
+func CurrentUser(c *gin.Context) *auth.User {
+	if user, ok := c.Get(userKey); ok {
+		return user.(*auth.User)
+	}
+	return nil
+}
+
+// Ledger returns the ledger bound to the caller's identity by BindIdentity, or
+// fallback when authentication is disabled
+func Ledger(c *gin.Context, fallback services.HerbLedger) services.HerbLedger {
+	if ledger, ok := c.Get(ledgerKey); ok {
+		return ledger.(services.HerbLedger)
+	}
+	return fallback
+}
+
+func bearerToken(header string) (string, bool) {
+	scheme, token, found := strings.Cut(header, " ")
+	if !found || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
@@ -0,0 +1,160 @@
+package middleware
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"herb-api/auth"
+	"herb-api/models"
+	"herb-api/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+func bearer(t *testing.T, subject string, roles ...string) string {
+	t.Helper()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   subject,
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"roles": roles,
+	}).SignedString([]byte(testSecret))
+	require.NoError(t, err)
+	return "Bearer " + token
+}
+
+func responseError(t *testing.T, recorder *httptest.ResponseRecorder) string {
+	t.Helper()
+
+	var response models.APIResponse
+	require.NoError(t, json.Unmarshal(recorder.Body.Bytes(), &response))
+	require.False(t, response.Success)
+	return response.Error
+}
+
+func newTestAuthenticator(t *testing.T) *auth.Authenticator {
+	t.Helper()
+
+	authenticator, err := auth.New(auth.Options{Mode: auth.ModeHS256, HS256Secret: testSecret})
+	require.NoError(t, err)
+	return authenticator
+}
+
+func TestAuthenticate(t *testing.T) {
+	authenticate := Authenticate(newTestAuthenticator(t))
+	var user *auth.User
+	handler := func(c *gin.Context) {
+		user = CurrentUser(c)
+		c.Status(http.StatusNoContent)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Authorization", bearer(t, "farmer-ravi", auth.RoleFarmer))
+	recorder := serve(t, request, authenticate, handler)
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Equal(t, "farmer-ravi", user.Subject)
+
+	for _, header := range []string{"", "Basic cmF2aTpzZWNyZXQ=", "Bearer ", "Bearer not-a-token"} {
+		user = nil
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", header)
+		recorder := serve(t, request, authenticate, handler)
+		require.Equal(t, http.StatusUnauthorized, recorder.Code, header)
+		require.Contains(t, recorder.Header().Get("WWW-Authenticate"), "Bearer")
+		require.Nil(t, user, "the handler must not run")
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	authenticate := Authenticate(newTestAuthenticator(t))
+	ok := func(c *gin.Context) { c.Status(http.StatusNoContent) }
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Authorization", bearer(t, "lab-priya", auth.RoleLab))
+	require.Equal(t, http.StatusNoContent, serve(t, request, authenticate, RequireRole(auth.RoleTransporter, auth.RoleLab), ok).Code)
+
+	request = httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Authorization", bearer(t, "farmer-ravi", auth.RoleFarmer))
+	recorder := serve(t, request, authenticate, RequireRole(auth.RoleAdmin), ok)
+	require.Equal(t, http.StatusForbidden, recorder.Code)
+	require.Equal(t, "requires the role admin", responseError(t, recorder))
+
+	recorder = serve(t, httptest.NewRequest(http.MethodGet, "/", nil), RequireRole(auth.RoleAdmin), ok)
+	require.Equal(t, http.StatusForbidden, recorder.Code, "RequireRole rejects unauthenticated requests")
+}
+
+// fakeLedger records the identity its views are bound to; its other methods are
+// not implemented
+type fakeLedger struct {
+	services.HerbLedger
+	identity *services.Identity
+}
+
+func (l *fakeLedger) WithIdentity(identity *services.Identity) (services.HerbLedger, error) {
+	if identity.MSPID == "BrokenMSP" {
+		return nil, errors.New("invalid client identity")
+	}
+	return &fakeLedger{identity: identity}, nil
+}
+
+// identityStore maps subjects to identities of the MSP of the same name
+type identityStore map[string]error
+
+func (s identityStore) Identity(subject string) (*services.Identity, error) {
+	err, ok := s[subject]
+	if !ok {
+		return nil, auth.ErrNoIdentity
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &services.Identity{MSPID: subject}, nil
+}
+
+func TestBindIdentity(t *testing.T) {
+	serverLedger := &fakeLedger{}
+	identities := identityStore{
+		"Org1MSP":   nil,
+		"BrokenMSP": nil,
+		"Revoked":   errors.New("failed to decrypt identity"),
+	}
+	authenticate := Authenticate(newTestAuthenticator(t))
+	bind := BindIdentity(identities, serverLedger)
+
+	var ledger services.HerbLedger
+	handler := func(c *gin.Context) {
+		ledger = Ledger(c, serverLedger)
+		c.Status(http.StatusNoContent)
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set("Authorization", bearer(t, "Org1MSP"))
+	require.Equal(t, http.StatusNoContent, serve(t, request, authenticate, bind, handler).Code)
+	require.Equal(t, "Org1MSP", ledger.(*fakeLedger).identity.MSPID)
+
+	statuses := map[string]int{
+		"Unknown":   http.StatusForbidden,
+		"Revoked":   http.StatusInternalServerError,
+		"BrokenMSP": http.StatusInternalServerError,
+	}
+	for subject, status := range statuses {
+		request := httptest.NewRequest(http.MethodGet, "/", nil)
+		request.Header.Set("Authorization", bearer(t, subject))
+		require.Equal(t, status, serve(t, request, authenticate, bind, handler).Code, subject)
+	}
+
+	require.Equal(t, http.StatusUnauthorized, serve(t, httptest.NewRequest(http.MethodGet, "/", nil), bind, handler).Code)
+
+	// without authentication handlers use the server's ledger
+	ledger = nil
+	require.Equal(t, http.StatusNoContent, serve(t, httptest.NewRequest(http.MethodGet, "/", nil), handler).Code)
+	require.Same(t, serverLedger, ledger)
+}
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve runs one request through handlers and returns the response
+func serve(t *testing.T, request *http.Request, handlers ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+
+	router := gin.New()
+	router.Handle(request.Method, "/", handlers...)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func corsRequest(method string, origin string) *http.Request {
+	request := httptest.NewRequest(method, "/", nil)
+	request.Header.Set("Origin", origin)
+	return request
+}
+
+func TestCORSAllowedOrigins(t *testing.T) {
+	cors := CORS([]string{"https://herbtrace.example.com"})
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	recorder := serve(t, corsRequest(http.MethodGet, "https://herbtrace.example.com"), cors, ok)
+	require.Equal(t, http.StatusOK, recorder.Code)
+	require.Equal(t, "https://herbtrace.example.com", recorder.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, "Origin", recorder.Header().Get("Vary"))
+
+	recorder = serve(t, corsRequest(http.MethodGet, "https://evil.example.com"), cors, ok)
+	require.Empty(t, recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	recorder := serve(t, corsRequest(http.MethodGet, "https://evil.example.com"), CORS([]string{"*"}), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+	require.Equal(t, "*", recorder.Header().Get("Access-Control-Allow-Origin"))
+}
+
+func TestCORSPreflight(t *testing.T) {
+	called := false
+	recorder := serve(t, corsRequest(http.MethodOptions, "https://herbtrace.example.com"), CORS([]string{"https://herbtrace.example.com"}), func(c *gin.Context) {
+		called = true
+	})
+	require.Equal(t, http.StatusNoContent, recorder.Code)
+	require.Contains(t, recorder.Header().Get("Access-Control-Allow-Headers"), "Authorization")
+	require.False(t, called, "preflight requests end at the middleware")
+}
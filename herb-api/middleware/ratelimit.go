@@ -0,0 +1,95 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"herb-api/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// bucket holds the requests a client may still make: tokens are refilled at the
+// limit's rate up to its burst, and each request takes one
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// rateLimiter keeps a token bucket per client IP address
+type rateLimiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+// RateLimit limits each client, identified by its IP address, to requestsPerMinute
+// requests with bursts of up to burst requests. Requests over the limit get 429 Too
+// Many Requests and a Retry-After header.
+func RateLimit(requestsPerMinute int, burst int) gin.HandlerFunc {
+	limiter := &rateLimiter{
+		rate:    float64(requestsPerMinute) / 60,
+		burst:   float64(burst),
+		buckets: map[string]*bucket{},
+	}
+
+	return func(c *gin.Context) {
+		retryAfter, ok := limiter.allow(c.ClientIP(), time.Now())
+		if !ok {
+			c.Header("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			c.AbortWithStatusJSON(http.StatusTooManyRequests, models.APIResponse{
+				Success: false,
+				Message: "Too many requests",
+				Error:   "rate limit exceeded, retry later",
+			})
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// allow takes a token from the client's bucket, or returns how long until one is
+// available
+func (rl *rateLimiter) allow(client string, now time.Time) (time.Duration, bool) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	rl.sweep(now)
+
+	b, ok := rl.buckets[client]
+	if !ok {
+		b = &bucket{tokens: rl.burst, updated: now}
+		rl.buckets[client] = b
+	}
+	b.tokens = math.Min(rl.burst, b.tokens+now.Sub(b.updated).Seconds()*rl.rate)
+	b.updated = now
+
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / rl.rate * float64(time.Second)), false
+	}
+	b.tokens--
+	return 0, true
+}
+
+// sweep forgets, at most once a minute, the clients whose buckets have refilled,
+// since a new bucket starts full anyway
+func (rl *rateLimiter) sweep(now time.Time) {
+	if now.Sub(rl.lastSweep) < time.Minute {
+		return
+	}
+	rl.lastSweep = now
+
+	refill := time.Duration(rl.burst / rl.rate * float64(time.Second))
+	for client, b := range rl.buckets {
+		if now.Sub(b.updated) >= refill {
+			delete(rl.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiterAllow(t *testing.T) {
+	limiter := &rateLimiter{rate: 1, burst: 2, buckets: map[string]*bucket{}}
+	now := time.Date(2024, time.August, 15, 6, 30, 0, 0, time.UTC)
+
+	_, ok := limiter.allow("10.0.0.1", now)
+	require.True(t, ok)
+	_, ok = limiter.allow("10.0.0.1", now)
+	require.True(t, ok)
+	retryAfter, ok := limiter.allow("10.0.0.1", now)
+	require.False(t, ok, "the burst is used up")
+	require.Equal(t, time.Second, retryAfter)
+
+	_, ok = limiter.allow("10.0.0.2", now)
+	require.True(t, ok, "each client has its own bucket")
+
+	retryAfter, ok = limiter.allow("10.0.0.1", now.Add(500*time.Millisecond))
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, retryAfter)
+	_, ok = limiter.allow("10.0.0.1", now.Add(time.Second))
+	require.True(t, ok, "tokens refill at the limit's rate")
+}
+
+func TestRateLimiterSweep(t *testing.T) {
+	limiter := &rateLimiter{rate: 1.0 / 60, burst: 2, buckets: map[string]*bucket{}}
+	now := time.Date(2024, time.August, 15, 6, 30, 0, 0, time.UTC)
+
+	limiter.allow("10.0.0.1", now)
+	limiter.allow("10.0.0.2", now.Add(90*time.Second))
+	require.Len(t, limiter.buckets, 2)
+
+	limiter.allow("10.0.0.3", now.Add(150*time.Second))
+	require.Len(t, limiter.buckets, 2, "refilled buckets are forgotten")
+	require.NotContains(t, limiter.buckets, "10.0.0.1")
+}
+
+func TestRateLimit(t *testing.T) {
+	limit := RateLimit(60, 1)
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+
+	require.Equal(t, http.StatusOK, serve(t, httptest.NewRequest(http.MethodGet, "/", nil), limit, ok).Code)
+
+	router := gin.New()
+	router.GET("/", limit, ok)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	require.Equal(t, http.StatusTooManyRequests, recorder.Code)
+	require.Equal(t, "1", recorder.Header().Get("Retry-After"))
+}
@@ -1,25 +1,81 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 // HerbBatch represents the herb batch data structure
 type HerbBatch struct {
-	ID            string `json:"id" binding:"required"`
-	BotanicalName string `json:"botanicalName" binding:"required"`
-	Farm          string `json:"farm" binding:"required"`
-	HarvestDate   string `json:"harvestDate" binding:"required"`
-	Owner         string `json:"owner" binding:"required"`
-	Status        string `json:"status" binding:"required"`
+	ID                string  `json:"id" binding:"required"`
+	BotanicalName     string  `json:"botanicalName" binding:"required"`
+	ExpiryDate        string  `json:"expiryDate,omitempty"` // last day the lot may be transferred or distributed
+	Farm              string  `json:"farm" binding:"required"`
+	HarvestDate       string  `json:"harvestDate" binding:"required"`
+	Owner             string  `json:"owner" binding:"required"`
+	OwnerID           string  `json:"ownerId,omitempty"` // client identity holding the batch, if known
+	OwnerOrg          string  `json:"ownerOrg"`
+	Quantity          float64 `json:"quantity" binding:"required,gt=0"`
+	QuotaRegion       string  `json:"quotaRegion,omitempty"`  // region of the harvest quota the quantity was charged to
+	QuotaSeason       string  `json:"quotaSeason,omitempty"`  // harvest quota season the quantity was charged to
+	QuotaSpecies      string  `json:"quotaSpecies,omitempty"` // species of the harvest quota the quantity was charged to
+	Region            string  `json:"region" binding:"required"`
+	RemainingQuantity float64 `json:"remainingQuantity"`
+	Status            string  `json:"status" binding:"required"`
 }
 
-// CreateHerbBatchRequest represents the request payload for creating a herb batch
+// CreateHerbBatchRequest represents the request payload for creating a herb batch.
+// DeviceKeyID and Signature carry the farmer's optional device attestation: a base64
+// signature over the canonical JSON of the harvest data.
 type CreateHerbBatchRequest struct {
-	ID            string `json:"id" binding:"required"`
-	BotanicalName string `json:"botanicalName" binding:"required"`
-	Farm          string `json:"farm" binding:"required"`
-	HarvestDate   string `json:"harvestDate" binding:"required"`
-	Owner         string `json:"owner" binding:"required"`
-	Status        string `json:"status" binding:"required"`
+	ID            string  `json:"id" binding:"required"`
+	BotanicalName string  `json:"botanicalName" binding:"required"`
+	Farm          string  `json:"farm" binding:"required"`
+	HarvestDate   string  `json:"harvestDate" binding:"required"`
+	Owner         string  `json:"owner" binding:"required"`
+	Quantity      float64 `json:"quantity" binding:"required,gt=0"`
+	Region        string  `json:"region" binding:"required"`
+	Status        string  `json:"status" binding:"required"`
+	DeviceKeyID   string  `json:"deviceKeyId"`
+	Signature     string  `json:"signature"`
+}
+
+// HarvestRequest represents the request payload for registering a harvest. The
+// batch starts as Harvested. The authenticated user is the owner; Owner is only used
+// when authentication is disabled. The server assigns the batch ID unless the harvest
+// carries a device signature, which covers the ID the device generated.
+type HarvestRequest struct {
+	ID            string  `json:"id" binding:"required_with=Signature,excluded_without=Signature"`
+	BotanicalName string  `json:"botanicalName" binding:"required"`
+	Farm          string  `json:"farm" binding:"required"`
+	HarvestDate   string  `json:"harvestDate" binding:"required"`
+	Owner         string  `json:"owner"`
+	Quantity      float64 `json:"quantity" binding:"required,gt=0"`
+	Region        string  `json:"region" binding:"required"`
+	DeviceKeyID   string  `json:"deviceKeyId" binding:"required_with=Signature"`
+	Signature     string  `json:"signature" binding:"required_with=DeviceKeyID"`
+}
+
+// RegisterDeviceKeyRequest represents the request payload for registering a farmer's device key
+type RegisterDeviceKeyRequest struct {
+	KeyID     string `json:"keyId" binding:"required"`
+	Farmer    string `json:"farmer" binding:"required"`
+	Algorithm string `json:"algorithm" binding:"required,oneof=ECDSA-P256 Ed25519"`
+	PublicKey string `json:"publicKey" binding:"required"` // base64 DER SubjectPublicKeyInfo
+}
+
+// HerbBatchPage represents one page of a paginated herb batch query
+type HerbBatchPage struct {
+	Bookmark            string      `json:"bookmark"`
+	FetchedRecordsCount int         `json:"fetchedRecordsCount"`
+	Records             []HerbBatch `json:"records"`
+}
+
+// EPCISPage represents one page of an EPCIS export over a harvest date range. The
+// document is passed through unchanged as EPCIS 2.0 JSON-LD.
+type EPCISPage struct {
+	Bookmark string          `json:"bookmark"`
+	Document json.RawMessage `json:"document"`
 }
 
 // UpdateStatusRequest represents the request payload for updating herb batch status
@@ -29,7 +85,39 @@ type UpdateStatusRequest struct {
 
 // TransferRequest represents the request payload for transferring herb batch ownership
 type TransferRequest struct {
-	NewOwner string `json:"newOwner" binding:"required"`
+	NewOwner    string `json:"newOwner" binding:"required"`
+	NewOwnerOrg string `json:"newOwnerOrg"` // MSP ID of the receiving organisation; empty keeps the current one
+}
+
+// ImportIdentityRequest represents the request payload for importing a user's
+// Fabric identity into the wallet
+type ImportIdentityRequest struct {
+	Subject     string `json:"subject" binding:"required"` // token subject of the user
+	MSPID       string `json:"mspId" binding:"required"`
+	Certificate string `json:"certificate" binding:"required"` // PEM
+	PrivateKey  string `json:"privateKey" binding:"required"`  // PEM PKCS#8
+}
+
+// EnrollIdentityRequest represents the request payload for registering a user with
+// the Fabric CA and enrolling it into the wallet
+type EnrollIdentityRequest struct {
+	Subject      string            `json:"subject" binding:"required"` // token subject of the user
+	EnrollmentID string            `json:"enrollmentId"`               // CA enrollment ID; defaults to the subject
+	Type         string            `json:"type" binding:"omitempty,oneof=client peer orderer admin"`
+	Affiliation  string            `json:"affiliation"`
+	Attributes   map[string]string `json:"attributes"` // added to the enrollment certificate
+}
+
+// RotateIdentityRequest represents the request payload for rotating an imported
+// identity; enrolled identities are reenrolled with the CA and need no body
+type RotateIdentityRequest struct {
+	Certificate string `json:"certificate" binding:"required"` // PEM
+	PrivateKey  string `json:"privateKey" binding:"required"`  // PEM PKCS#8
+}
+
+// RevokeIdentityRequest represents the request payload for revoking an identity
+type RevokeIdentityRequest struct {
+	Reason string `json:"reason"`
 }
 
 // APIResponse represents a standard API response
@@ -40,14 +128,35 @@ type APIResponse struct {
 	Error   string      `json:"error,omitempty"`
 }
 
-// SupplyChainEvent represents a supply chain event
+// LedgerStats represents the aggregate herb batch counters kept by the chaincode
+type LedgerStats struct {
+	ByFarm       map[string]int `json:"byFarm"`
+	ByMonth      map[string]int `json:"byMonth"`
+	BySpecies    map[string]int `json:"bySpecies"`
+	ByStatus     map[string]int `json:"byStatus"`
+	TotalBatches int            `json:"totalBatches"`
+}
+
+// SupplyChainEvent represents a workflow action recorded on the blockchain. Its ID is
+// the ID of the transaction that recorded it.
 type SupplyChainEvent struct {
-	BatchID     string    `json:"batchId"`
-	Event       string    `json:"event"`
-	Actor       string    `json:"actor"`
-	Location    string    `json:"location,omitempty"`
-	Timestamp   time.Time `json:"timestamp"`
-	Description string    `json:"description,omitempty"`
+	ID         string    `json:"id"`
+	BatchID    string    `json:"batchId"`
+	Action     string    `json:"action"` // transport, lab-receive or certify
+	Actor      string    `json:"actor"`  // Fabric ID of the submitting client
+	ActorOrg   string    `json:"actorOrg"`
+	Location   string    `json:"location"`
+	Notes      string    `json:"notes,omitempty"`
+	FromStatus string    `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// SupplyChainActionRequest represents the request payload of a supply chain workflow
+// action. The chaincode records the submitting Fabric identity as the actor.
+type SupplyChainActionRequest struct {
+	Location string `json:"location" binding:"required"`
+	Notes    string `json:"notes"`
 }
 
 // Supply chain status constants
@@ -61,3 +170,61 @@ const (
 	StatusDistributed = "Distributed"
 	StatusDelivered   = "Delivered"
 )
+
+// Supply chain workflow actions
+const (
+	ActionTransport  = "transport"
+	ActionLabReceive = "lab-receive"
+	ActionCertify    = "certify"
+)
+
+// Recall withdraws a herb batch from sale. RecalledBy is the MSP ID of the
+// organisation whose admin recalled it.
+type Recall struct {
+	BatchID    string    `json:"batchId"`
+	Reason     string    `json:"reason"`
+	RecalledAt time.Time `json:"recalledAt"`
+	RecalledBy string    `json:"recalledBy"`
+	TxID       string    `json:"txId"`
+}
+
+// RecallHerbBatchRequest represents the request payload for recalling a herb batch
+type RecallHerbBatchRequest struct {
+	Reason string `json:"reason" binding:"required"`
+}
+
+// Certification is a certificate held by a herb batch
+type Certification struct {
+	Type     string    `json:"type"`
+	IssuedAt time.Time `json:"issuedAt"`
+}
+
+// PublicRecall is what consumers learn about a recall: when and why, not who
+type PublicRecall struct {
+	Reason     string    `json:"reason"`
+	RecalledAt time.Time `json:"recalledAt"`
+}
+
+// PublicProvenance is the provenance of a herb batch shown to consumers: its origin
+// and test results, without its owner, quantities or trading partners
+type PublicProvenance struct {
+	BatchID        string          `json:"batchId"`
+	BotanicalName  string          `json:"botanicalName"`
+	Region         string          `json:"region"`
+	HarvestDate    string          `json:"harvestDate"`
+	ExpiryDate     string          `json:"expiryDate,omitempty"`
+	Certifications []Certification `json:"certifications"`
+	LabVerdict     string          `json:"labVerdict"` // passed, pending, not-tested or unverified
+	Recalled       bool            `json:"recalled"`
+	Recall         *PublicRecall   `json:"recall,omitempty"`
+}
+
+// Lab verdicts of a herb batch
+const (
+	LabVerdictPassed    = "passed"
+	LabVerdictPending   = "pending"
+	LabVerdictNotTested = "not-tested"
+	// LabVerdictUnverified is reported for batches whose status claims lab testing
+	// without a recorded lab event, such as those certified before the workflow
+	LabVerdictUnverified = "unverified"
+)
@@ -0,0 +1,100 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"google.golang.org/grpc/status"
+)
+
+// Chaincode error codes, as returned in the JSON error message of every transaction
+const (
+	CodeNotFound          = "NOT_FOUND"
+	CodeAlreadyExists     = "ALREADY_EXISTS"
+	CodeInvalidTransition = "INVALID_TRANSITION"
+	CodeForbidden         = "FORBIDDEN"
+	CodeValidation        = "VALIDATION"
+	CodeInternal          = "INTERNAL"
+)
+
+// ChaincodeError is a structured error returned by the herb batch chaincode
+type ChaincodeError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *ChaincodeError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// HTTPStatus maps the chaincode error code to the matching HTTP status
+func (e *ChaincodeError) HTTPStatus() int {
+	switch e.Code {
+	case CodeNotFound:
+		return http.StatusNotFound
+	case CodeAlreadyExists, CodeInvalidTransition:
+		return http.StatusConflict
+	case CodeForbidden:
+		return http.StatusForbidden
+	case CodeValidation:
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// AsChaincodeError returns the chaincode error wrapped by err, if any
+func AsChaincodeError(err error) (*ChaincodeError, bool) {
+	var chaincodeError *ChaincodeError
+	if errors.As(err, &chaincodeError) {
+		return chaincodeError, true
+	}
+	return nil, false
+}
+
+// parseChaincodeError extracts the structured chaincode error from a message such as
+// `chaincode response 500, {"code":"NOT_FOUND","message":"..."}`
+func parseChaincodeError(message string) *ChaincodeError {
+	for start := strings.Index(message, "{"); start >= 0; {
+		var chaincodeError ChaincodeError
+		decoder := json.NewDecoder(strings.NewReader(message[start:]))
+		if err := decoder.Decode(&chaincodeError); err == nil && chaincodeError.Code != "" {
+			return &chaincodeError
+		}
+
+		next := strings.Index(message[start+1:], "{")
+		if next < 0 {
+			break
+		}
+		start += next + 1
+	}
+
+	return nil
+}
+
+// gatewayError builds the error of a failed gateway call, wrapping the chaincode
+// error when the status message or the per-peer error details carry one
+func gatewayError(action string, err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return fmt.Errorf("%s: %v", action, err)
+	}
+
+	messages := []string{st.Message()}
+	for _, detail := range st.Details() {
+		if errorDetail, ok := detail.(*gateway.ErrorDetail); ok {
+			messages = append(messages, errorDetail.GetMessage())
+		}
+	}
+	for _, message := range messages {
+		if chaincodeError := parseChaincodeError(message); chaincodeError != nil {
+			return fmt.Errorf("%s: %w", action, chaincodeError)
+		}
+	}
+
+	return fmt.Errorf("%s: %v", action, err)
+}
@@ -3,221 +3,310 @@ package services
 import (
 	"encoding/json"
 	"fmt"
-	"os/exec"
-	"strings"
+	"strconv"
 
 	"herb-api/models"
 )
 
-type FabricService struct {
-	NetworkPath   string
+// FabricConfig locates the gateway peer and the client identity used to sign transactions
+type FabricConfig struct {
+	PeerEndpoint  string // host:port of the gateway peer
+	PeerHostAlias string // TLS server name of the gateway peer
+	TLSCertPath   string // PEM CA certificate of the peer's TLS certificate
+	MSPID         string
+	CertPath      string // PEM client certificate, or its MSP signcerts directory
+	KeyPath       string // PEM PKCS#8 client private key, or its MSP keystore directory
 	ChannelName   string
 	ChaincodeName string
+	Timeouts      GatewayTimeouts
+}
+
+// FabricService invokes the herb batch chaincode through the Fabric Gateway
+type FabricService struct {
+	gateway *gatewayClient
 }
 
-// NewFabricService creates a new instance of FabricService
-func NewFabricService() *FabricService {
-	return &FabricService{
-		NetworkPath:   "../test-network", // Adjust path relative to your API server
-		ChannelName:   "herbtrace-temp",
-		ChaincodeName: "herbbatch",
+// NewFabricService creates a new instance of FabricService connected to the gateway
+// peer, submitting transactions as the client identity of the configuration
+func NewFabricService(config FabricConfig) (*FabricService, error) {
+	identity, err := LoadIdentity(config.MSPID, config.CertPath, config.KeyPath)
+	if err != nil {
+		return nil, err
+	}
+	gateway, err := newGatewayClient(config.PeerEndpoint, config.PeerHostAlias, config.TLSCertPath, identity, config.ChannelName, config.ChaincodeName, config.Timeouts)
+	if err != nil {
+		return nil, err
 	}
+
+	return &FabricService{gateway: gateway}, nil
 }
 
-// CreateHerbBatch creates a new herb batch on the blockchain
-func (fs *FabricService) CreateHerbBatch(herb models.CreateHerbBatchRequest) error {
-	// Clean the arguments by replacing spaces with underscores to avoid shell parsing issues
-	cleanID := strings.ReplaceAll(herb.ID, " ", "_")
-	cleanBotanicalName := strings.ReplaceAll(herb.BotanicalName, " ", "_")
-	cleanFarm := strings.ReplaceAll(herb.Farm, " ", "_")
-	cleanHarvestDate := strings.ReplaceAll(herb.HarvestDate, " ", "_")
-	cleanOwner := strings.ReplaceAll(herb.Owner, " ", "_")
-	cleanStatus := strings.ReplaceAll(herb.Status, " ", "_")
+// WithIdentity returns a FabricService sharing the gateway connection whose
+// transactions are signed by identity, so that the chaincode sees it as the actor.
+// Closing either closes the shared connection.
+func (fs *FabricService) WithIdentity(identity *Identity) (HerbLedger, error) {
+	gateway, err := fs.gateway.withIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
 
-	// Construct the chaincode invoke command
-	args := fmt.Sprintf(`{"function":"CreateHerbBatch","Args":["%s","%s","%s","%s","%s","%s"]}`,
-		cleanID, cleanBotanicalName, cleanFarm, cleanHarvestDate, cleanOwner, cleanStatus)
+	return &FabricService{gateway: gateway}, nil
+}
 
-	cmd := exec.Command("./network.sh", "cc", "invoke",
-		"-ccn", fs.ChaincodeName,
-		"-c", fs.ChannelName,
-		"-d", "3", // CLI delay
-		"-ccic", args)
+// Close closes the connection to the gateway peer
+func (fs *FabricService) Close() error {
+	return fs.gateway.Close()
+}
 
-	cmd.Dir = fs.NetworkPath
-	output, err := cmd.CombinedOutput()
+// CreateHerbBatch creates a new herb batch on the blockchain
+func (fs *FabricService) CreateHerbBatch(herb models.CreateHerbBatchRequest) error {
+	// arguments are sent to the peer as raw UTF-8 bytes, so every field is stored exactly as given
+	quantity := strconv.FormatFloat(herb.Quantity, 'f', -1, 64)
 
+	_, err := fs.gateway.submit("CreateHerbBatch",
+		herb.ID, herb.BotanicalName, herb.Farm, herb.HarvestDate, herb.Owner, herb.Status, herb.Region, quantity,
+		herb.DeviceKeyID, herb.Signature)
 	if err != nil {
-		return fmt.Errorf("failed to create herb batch: %v, output: %s", err, string(output))
-	}
-
-	// Check if the output contains success indicators
-	if !strings.Contains(string(output), "Invoke successful") {
-		return fmt.Errorf("chaincode invocation failed: %s", string(output))
+		return gatewayError("failed to create herb batch", err)
 	}
 
 	return nil
-} // ReadHerbBatch retrieves a herb batch from the blockchain
+}
+
+// ReadHerbBatch retrieves a herb batch from the blockchain
 func (fs *FabricService) ReadHerbBatch(batchID string) (*models.HerbBatch, error) {
-	args := fmt.Sprintf(`{"function":"ReadHerbBatch","Args":["%s"]}`, batchID)
+	result, err := fs.gateway.evaluate("ReadHerbBatch", batchID)
+	if err != nil {
+		return nil, gatewayError("failed to read herb batch", err)
+	}
 
-	cmd := exec.Command("./network.sh", "cc", "query",
-		"-ccn", fs.ChaincodeName,
-		"-c", fs.ChannelName,
-		"-ccqc", args)
+	var herbBatch models.HerbBatch
+	if err := json.Unmarshal(result, &herbBatch); err != nil {
+		return nil, fmt.Errorf("failed to parse herb batch JSON: %v", err)
+	}
 
-	cmd.Dir = fs.NetworkPath
-	output, err := cmd.CombinedOutput()
+	return &herbBatch, nil
+}
 
+// GetAllHerbBatches retrieves all herb batches from the blockchain
+func (fs *FabricService) GetAllHerbBatches() ([]models.HerbBatch, error) {
+	result, err := fs.gateway.evaluate("GetAllHerbBatches")
 	if err != nil {
-		return nil, fmt.Errorf("failed to read herb batch: %v, output: %s", err, string(output))
+		return nil, gatewayError("failed to get all herb batches", err)
+	}
+
+	herbBatches := []models.HerbBatch{}
+	if err := unmarshalResult(result, &herbBatches); err != nil {
+		return nil, fmt.Errorf("failed to parse herb batches JSON: %v", err)
 	}
 
-	// Extract JSON from the output
-	outputStr := string(output)
-	lines := strings.Split(outputStr, "\n")
-	var jsonLine string
+	return herbBatches, nil
+}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "{") && strings.HasSuffix(line, "}") {
-			jsonLine = line
-			break
-		}
+// GetHerbBatchesExpiringWithin retrieves the herb batches expiring within the given number of days, including expired lots
+func (fs *FabricService) GetHerbBatchesExpiringWithin(days int) ([]models.HerbBatch, error) {
+	result, err := fs.gateway.evaluate("GetHerbBatchesExpiringWithin", strconv.Itoa(days))
+	if err != nil {
+		return nil, gatewayError("failed to get expiring herb batches", err)
 	}
 
-	if jsonLine == "" {
-		return nil, fmt.Errorf("no valid JSON found in output: %s", outputStr)
+	herbBatches := []models.HerbBatch{}
+	if err := unmarshalResult(result, &herbBatches); err != nil {
+		return nil, fmt.Errorf("failed to parse herb batches JSON: %v", err)
 	}
 
-	var herbBatch models.HerbBatch
-	if err := json.Unmarshal([]byte(jsonLine), &herbBatch); err != nil {
-		return nil, fmt.Errorf("failed to parse herb batch JSON: %v", err)
+	return herbBatches, nil
+}
+
+// UpdateHerbBatchStatus updates the status of a herb batch
+func (fs *FabricService) UpdateHerbBatchStatus(batchID, newStatus string) error {
+	_, err := fs.gateway.submit("UpdateHerbBatchStatus", batchID, newStatus)
+	if err != nil {
+		return gatewayError("failed to update herb batch status", err)
 	}
 
-	return &herbBatch, nil
+	return nil
 }
 
-// GetAllHerbBatches retrieves all herb batches from the blockchain
-func (fs *FabricService) GetAllHerbBatches() ([]models.HerbBatch, error) {
-	args := `{"function":"GetAllHerbBatches","Args":[]}`
+// TransferHerbBatch transfers ownership of a herb batch and returns the previous owner
+func (fs *FabricService) TransferHerbBatch(batchID, newOwner, newOwnerOrg string) (string, error) {
+	result, err := fs.gateway.submit("TransferHerbBatch", batchID, newOwner, newOwnerOrg)
+	if err != nil {
+		return "", gatewayError("failed to transfer herb batch", err)
+	}
 
-	cmd := exec.Command("./network.sh", "cc", "query",
-		"-ccn", fs.ChaincodeName,
-		"-c", fs.ChannelName,
-		"-ccqc", args)
+	return string(result), nil
+}
 
-	cmd.Dir = fs.NetworkPath
-	output, err := cmd.CombinedOutput()
+// HerbBatchExists checks if a herb batch exists on the blockchain
+func (fs *FabricService) HerbBatchExists(batchID string) (bool, error) {
+	result, err := fs.gateway.evaluate("HerbBatchExists", batchID)
+	if err != nil {
+		return false, gatewayError("failed to check herb batch existence", err)
+	}
 
+	exists, err := strconv.ParseBool(string(result))
 	if err != nil {
-		return nil, fmt.Errorf("failed to get all herb batches: %v, output: %s", err, string(output))
+		return false, fmt.Errorf("unexpected result format: %s", string(result))
 	}
 
-	// Extract JSON from the output
-	outputStr := string(output)
-	lines := strings.Split(outputStr, "\n")
-	var jsonLine string
+	return exists, nil
+}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
-			jsonLine = line
-			break
-		}
+// GetLedgerStats retrieves the aggregate herb batch counters from the blockchain
+func (fs *FabricService) GetLedgerStats() (*models.LedgerStats, error) {
+	result, err := fs.gateway.evaluate("GetLedgerStats")
+	if err != nil {
+		return nil, gatewayError("failed to get ledger stats", err)
 	}
 
-	if jsonLine == "" {
-		return nil, fmt.Errorf("no valid JSON array found in output: %s", outputStr)
+	var stats models.LedgerStats
+	if err := json.Unmarshal(result, &stats); err != nil {
+		return nil, fmt.Errorf("failed to parse ledger stats JSON: %v", err)
 	}
 
-	var herbBatches []models.HerbBatch
-	if err := json.Unmarshal([]byte(jsonLine), &herbBatches); err != nil {
-		return nil, fmt.Errorf("failed to parse herb batches JSON: %v", err)
+	return &stats, nil
+}
+
+// GetHerbBatchesByHarvestDateRange retrieves one page of herb batches harvested between from and to
+func (fs *FabricService) GetHerbBatchesByHarvestDateRange(from, to string, pageSize int, bookmark string) (*models.HerbBatchPage, error) {
+	result, err := fs.gateway.evaluate("GetHerbBatchesByHarvestDateRange", from, to, strconv.Itoa(pageSize), bookmark)
+	if err != nil {
+		return nil, gatewayError("failed to get herb batches by harvest date", err)
 	}
 
-	return herbBatches, nil
-}
+	var page models.HerbBatchPage
+	if err := json.Unmarshal(result, &page); err != nil {
+		return nil, fmt.Errorf("failed to parse herb batch page JSON: %v", err)
+	}
 
-// UpdateHerbBatchStatus updates the status of a herb batch
-func (fs *FabricService) UpdateHerbBatchStatus(batchID, newStatus string) error {
-	args := fmt.Sprintf(`{"function":"UpdateHerbBatchStatus","Args":["%s","%s"]}`,
-		batchID, newStatus)
+	return &page, nil
+}
 
-	cmd := exec.Command("./network.sh", "cc", "invoke",
-		"-ccn", fs.ChaincodeName,
-		"-c", fs.ChannelName,
-		"-d", "3",
-		"-ccic", args)
+// GetHerbBatchEPCIS retrieves the lifecycle of a herb batch as an EPCIS 2.0 JSON-LD document
+func (fs *FabricService) GetHerbBatchEPCIS(batchID string) (json.RawMessage, error) {
+	result, err := fs.gateway.evaluate("GetHerbBatchEPCIS", batchID)
+	if err != nil {
+		return nil, gatewayError("failed to get EPCIS events", err)
+	}
+	if !json.Valid(result) {
+		return nil, fmt.Errorf("failed to parse EPCIS document JSON")
+	}
 
-	cmd.Dir = fs.NetworkPath
-	output, err := cmd.CombinedOutput()
+	return json.RawMessage(result), nil
+}
 
+// GetEPCISByHarvestDateRange retrieves one page of EPCIS events for the herb batches harvested between from and to
+func (fs *FabricService) GetEPCISByHarvestDateRange(from, to string, pageSize int, bookmark string) (*models.EPCISPage, error) {
+	result, err := fs.gateway.evaluate("GetEPCISByHarvestDateRange", from, to, strconv.Itoa(pageSize), bookmark)
 	if err != nil {
-		return fmt.Errorf("failed to update herb batch status: %v, output: %s", err, string(output))
+		return nil, gatewayError("failed to get EPCIS events by harvest date", err)
 	}
 
-	if !strings.Contains(string(output), "Invoke successful") {
-		return fmt.Errorf("chaincode invocation failed: %s", string(output))
+	var page models.EPCISPage
+	if err := json.Unmarshal(result, &page); err != nil {
+		return nil, fmt.Errorf("failed to parse EPCIS page JSON: %v", err)
+	}
+
+	return &page, nil
+}
+
+// RegisterDeviceKey registers a farmer's device public key on the blockchain
+func (fs *FabricService) RegisterDeviceKey(req models.RegisterDeviceKeyRequest) error {
+	_, err := fs.gateway.submit("RegisterDeviceKey", req.KeyID, req.Farmer, req.Algorithm, req.PublicKey)
+	if err != nil {
+		return gatewayError("failed to register device key", err)
 	}
 
 	return nil
 }
 
-// TransferHerbBatch transfers ownership of a herb batch
-func (fs *FabricService) TransferHerbBatch(batchID, newOwner string) (string, error) {
-	args := fmt.Sprintf(`{"function":"TransferHerbBatch","Args":["%s","%s"]}`,
-		batchID, newOwner)
+// RecordSupplyChainEvent performs a workflow action on a herb batch and returns the
+// recorded event, whose ID is the transaction ID. The client identity is recorded as
+// the actor and must carry the action's role.
+func (fs *FabricService) RecordSupplyChainEvent(batchID, action, location, notes string) (*models.SupplyChainEvent, error) {
+	result, err := fs.gateway.submit("RecordSupplyChainEvent", batchID, action, location, notes)
+	if err != nil {
+		return nil, gatewayError("failed to record supply chain event", err)
+	}
 
-	cmd := exec.Command("./network.sh", "cc", "invoke",
-		"-ccn", fs.ChaincodeName,
-		"-c", fs.ChannelName,
-		"-d", "3",
-		"-ccic", args)
+	var event models.SupplyChainEvent
+	if err := json.Unmarshal(result, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse supply chain event: %v", err)
+	}
 
-	cmd.Dir = fs.NetworkPath
-	output, err := cmd.CombinedOutput()
+	return &event, nil
+}
 
+// GetSupplyChainEvents retrieves the workflow events of a herb batch in the order they happened
+func (fs *FabricService) GetSupplyChainEvents(batchID string) ([]models.SupplyChainEvent, error) {
+	result, err := fs.gateway.evaluate("GetSupplyChainEvents", batchID)
 	if err != nil {
-		return "", fmt.Errorf("failed to transfer herb batch: %v, output: %s", err, string(output))
+		return nil, gatewayError("failed to get supply chain events", err)
 	}
 
-	if !strings.Contains(string(output), "Invoke successful") {
-		return "", fmt.Errorf("chaincode invocation failed: %s", string(output))
+	events := []models.SupplyChainEvent{}
+	if err := json.Unmarshal(result, &events); err != nil {
+		return nil, fmt.Errorf("failed to parse supply chain events: %v", err)
 	}
 
-	// For now, return empty string as old owner (would need to parse from chaincode response in production)
-	return "Previous Owner", nil
+	return events, nil
 }
 
-// HerbBatchExists checks if a herb batch exists on the blockchain
-func (fs *FabricService) HerbBatchExists(batchID string) (bool, error) {
-	args := fmt.Sprintf(`{"function":"HerbBatchExists","Args":["%s"]}`, batchID)
+// RecallHerbBatch withdraws a herb batch from sale. The client identity must be an
+// organisation admin.
+func (fs *FabricService) RecallHerbBatch(batchID, reason string) (*models.Recall, error) {
+	result, err := fs.gateway.submit("RecallHerbBatch", batchID, reason)
+	if err != nil {
+		return nil, gatewayError("failed to recall herb batch", err)
+	}
 
-	cmd := exec.Command("./network.sh", "cc", "query",
-		"-ccn", fs.ChaincodeName,
-		"-c", fs.ChannelName,
-		"-ccqc", args)
+	var recall models.Recall
+	if err := json.Unmarshal(result, &recall); err != nil {
+		return nil, fmt.Errorf("failed to parse recall: %v", err)
+	}
 
-	cmd.Dir = fs.NetworkPath
-	output, err := cmd.CombinedOutput()
+	return &recall, nil
+}
 
+// GetPublicProvenance retrieves the provenance of a herb batch that may be shown to consumers
+func (fs *FabricService) GetPublicProvenance(batchID string) (*models.PublicProvenance, error) {
+	result, err := fs.gateway.evaluate("GetPublicProvenance", batchID)
 	if err != nil {
-		return false, fmt.Errorf("failed to check herb batch existence: %v, output: %s", err, string(output))
+		return nil, gatewayError("failed to read herb batch provenance", err)
+	}
+
+	var provenance models.PublicProvenance
+	if err := json.Unmarshal(result, &provenance); err != nil {
+		return nil, fmt.Errorf("failed to parse herb batch provenance: %v", err)
 	}
 
-	// Parse boolean result
-	outputStr := strings.TrimSpace(string(output))
-	lines := strings.Split(outputStr, "\n")
+	return &provenance, nil
+}
 
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "true" {
-			return true, nil
-		} else if line == "false" {
-			return false, nil
-		}
+// RepairUnderscoredHerbBatches restores the spaces that earlier versions of herb-api
+// replaced with underscores in the herb batches of the client's organisation and
+// returns the IDs of the repaired batches. The client identity must be an
+// organisation admin, and the repair runs once per organisation.
+func (fs *FabricService) RepairUnderscoredHerbBatches() ([]string, error) {
+	result, err := fs.gateway.submit("RepairUnderscoredHerbBatches")
+	if err != nil {
+		return nil, gatewayError("failed to repair herb batches", err)
 	}
 
-	return false, fmt.Errorf("unexpected output format: %s", outputStr)
+	repaired := []string{}
+	if err := unmarshalResult(result, &repaired); err != nil {
+		return nil, fmt.Errorf("failed to parse repaired herb batch IDs: %v", err)
+	}
+
+	return repaired, nil
+}
+
+// unmarshalResult decodes a JSON result, leaving v unchanged when the chaincode
+// returned an empty result for a nil slice
+func unmarshalResult(result []byte, v interface{}) error {
+	if len(result) == 0 {
+		return nil
+	}
+	return json.Unmarshal(result, v)
 }
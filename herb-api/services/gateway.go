@@ -0,0 +1,129 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-gateway/pkg/hash"
+	fabricidentity "github.com/hyperledger/fabric-gateway/pkg/identity"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+)
+
+// GatewayTimeouts are the deadlines of the calls to the gateway peer
+type GatewayTimeouts struct {
+	Evaluate     time.Duration
+	Endorse      time.Duration
+	Submit       time.Duration
+	CommitStatus time.Duration
+}
+
+// DefaultGatewayTimeouts match the defaults of the Fabric Gateway client SDKs
+var DefaultGatewayTimeouts = GatewayTimeouts{
+	Evaluate:     5 * time.Second,
+	Endorse:      15 * time.Second,
+	Submit:       5 * time.Second,
+	CommitStatus: time.Minute,
+}
+
+// gatewayClient invokes chaincode through the Fabric Gateway service of a peer with
+// the Fabric Gateway client SDK. Clients for different identities share one gRPC
+// connection.
+type gatewayClient struct {
+	conn          *grpc.ClientConn
+	gateway       *client.Gateway
+	contract      *client.Contract
+	channelName   string
+	chaincodeName string
+	timeouts      GatewayTimeouts
+}
+
+// newGatewayClient connects to the gateway peer as identity. The connection is
+// established lazily and reused by every call.
+func newGatewayClient(peerEndpoint string, peerHostAlias string, tlsCertPath string, identity *Identity, channelName string, chaincodeName string, timeouts GatewayTimeouts) (*gatewayClient, error) {
+	tlsCertPEM, err := os.ReadFile(tlsCertPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read peer TLS CA certificate: %v", err)
+	}
+	certPool := x509.NewCertPool()
+	if !certPool.AppendCertsFromPEM(tlsCertPEM) {
+		return nil, fmt.Errorf("no certificates found in %s", tlsCertPath)
+	}
+
+	conn, err := grpc.NewClient(peerEndpoint, grpc.WithTransportCredentials(credentials.NewClientTLSFromCert(certPool, peerHostAlias)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create gRPC connection to %s: %v", peerEndpoint, err)
+	}
+
+	gc := &gatewayClient{
+		conn:          conn,
+		channelName:   channelName,
+		chaincodeName: chaincodeName,
+		timeouts:      timeouts,
+	}
+	connected, err := gc.withIdentity(identity)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return connected, nil
+}
+
+// withIdentity returns a client sharing the connection whose transactions are signed
+// by identity
+func (gc *gatewayClient) withIdentity(identity *Identity) (*gatewayClient, error) {
+	id, err := fabricidentity.NewX509Identity(identity.MSPID, identity.Certificate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client identity: %v", err)
+	}
+	sign, err := fabricidentity.NewPrivateKeySign(identity.privateKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client private key: %v", err)
+	}
+
+	options := []client.ConnectOption{
+		client.WithSign(sign),
+		client.WithClientConnection(gc.conn),
+		client.WithEvaluateTimeout(gc.timeouts.Evaluate),
+		client.WithEndorseTimeout(gc.timeouts.Endorse),
+		client.WithSubmitTimeout(gc.timeouts.Submit),
+		client.WithCommitStatusTimeout(gc.timeouts.CommitStatus),
+	}
+	// Ed25519 signs the message itself rather than its digest
+	if _, ok := identity.privateKey.(ed25519.PrivateKey); ok {
+		options = append(options, client.WithHash(hash.NONE))
+	}
+
+	gateway, err := client.Connect(id, options...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to the gateway: %v", err)
+	}
+
+	clone := *gc
+	clone.gateway = gateway
+	clone.contract = gateway.GetNetwork(gc.channelName).GetContract(gc.chaincodeName)
+	return &clone, nil
+}
+
+// Close closes the gRPC connection shared by every identity
+func (gc *gatewayClient) Close() error {
+	gc.gateway.Close()
+	return gc.conn.Close()
+}
+
+// evaluate runs a transaction function on one peer without updating the ledger and
+// returns its result
+func (gc *gatewayClient) evaluate(function string, args ...string) ([]byte, error) {
+	return gc.contract.EvaluateTransaction(function, args...)
+}
+
+// submit endorses a transaction, sends it to the orderer and waits until it is
+// committed. It returns the transaction function's result.
+func (gc *gatewayClient) submit(function string, args ...string) ([]byte, error) {
+	return gc.contract.SubmitTransaction(function, args...)
+}
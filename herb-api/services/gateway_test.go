@@ -0,0 +1,325 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-gateway/pkg/client"
+	"github.com/hyperledger/fabric-protos-go-apiv2/common"
+	"github.com/hyperledger/fabric-protos-go-apiv2/gateway"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const testPeerHostAlias = "peer0.org1.example.com"
+
+// newTestIdentity returns an identity of mspID with a self-signed ECDSA certificate
+func newTestIdentity(t *testing.T, mspID string, name string) *Identity {
+	t.Helper()
+
+	certPEM, keyPEM := newTestCertificate(t, name)
+	identity, err := NewIdentity(mspID, certPEM, keyPEM)
+	require.NoError(t, err)
+	return identity
+}
+
+// newTestCertificate returns a self-signed PEM certificate for name and its PEM
+// PKCS#8 private key
+func newTestCertificate(t *testing.T, name string) ([]byte, []byte) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+// fakeGateway is a Fabric Gateway service that runs no chaincode. Each transaction
+// returns the function name and arguments joined by spaces, and fails when the
+// function is named in failures.
+type fakeGateway struct {
+	gateway.UnimplementedGatewayServer
+
+	mu          sync.Mutex
+	invocations []invocation
+	submitted   []string
+	failures    map[string]error
+	commitCode  peer.TxValidationCode
+}
+
+// invocation is a transaction function invoked through the fake gateway
+type invocation struct {
+	channel  string
+	function string
+	args     []string
+	mspID    string
+}
+
+// startFakeGateway serves a fake gateway over TLS and returns it with the path of the
+// CA certificate of its TLS certificate
+func startFakeGateway(t *testing.T) (*fakeGateway, string, string) {
+	t.Helper()
+
+	certPEM, keyPEM := newTestCertificate(t, testPeerHostAlias)
+	tlsCert, err := tls.X509KeyPair(certPEM, keyPEM)
+	require.NoError(t, err)
+	tlsCertPath := filepath.Join(t.TempDir(), "tlsca.pem")
+	require.NoError(t, os.WriteFile(tlsCertPath, certPEM, 0o600))
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	fake := &fakeGateway{failures: map[string]error{}, commitCode: peer.TxValidationCode_VALID}
+	server := grpc.NewServer(grpc.Creds(credentials.NewServerTLSFromCert(&tlsCert)))
+	gateway.RegisterGatewayServer(server, fake)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	return fake, listener.Addr().String(), tlsCertPath
+}
+
+func (fg *fakeGateway) Evaluate(ctx context.Context, request *gateway.EvaluateRequest) (*gateway.EvaluateResponse, error) {
+	result, err := fg.invoke(request.GetChannelId(), request.GetProposedTransaction())
+	if err != nil {
+		return nil, err
+	}
+
+	return &gateway.EvaluateResponse{Result: &peer.Response{Status: 200, Payload: result}}, nil
+}
+
+func (fg *fakeGateway) Endorse(ctx context.Context, request *gateway.EndorseRequest) (*gateway.EndorseResponse, error) {
+	result, err := fg.invoke(request.GetChannelId(), request.GetProposedTransaction())
+	if err != nil {
+		return nil, err
+	}
+
+	envelope, err := preparedTransaction(request.GetChannelId(), request.GetTransactionId(), result)
+	if err != nil {
+		return nil, err
+	}
+	return &gateway.EndorseResponse{PreparedTransaction: envelope}, nil
+}
+
+func (fg *fakeGateway) Submit(ctx context.Context, request *gateway.SubmitRequest) (*gateway.SubmitResponse, error) {
+	if len(request.GetPreparedTransaction().GetSignature()) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "the transaction is not signed")
+	}
+
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	fg.submitted = append(fg.submitted, request.GetTransactionId())
+	return &gateway.SubmitResponse{}, nil
+}
+
+func (fg *fakeGateway) CommitStatus(ctx context.Context, request *gateway.SignedCommitStatusRequest) (*gateway.CommitStatusResponse, error) {
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	return &gateway.CommitStatusResponse{Result: fg.commitCode}, nil
+}
+
+// invoke checks the proposal is signed by its creator and records the invocation
+func (fg *fakeGateway) invoke(channel string, signedProposal *peer.SignedProposal) ([]byte, error) {
+	var proposal peer.Proposal
+	if err := proto.Unmarshal(signedProposal.GetProposalBytes(), &proposal); err != nil {
+		return nil, err
+	}
+	var header common.Header
+	if err := proto.Unmarshal(proposal.GetHeader(), &header); err != nil {
+		return nil, err
+	}
+	var signatureHeader common.SignatureHeader
+	if err := proto.Unmarshal(header.GetSignatureHeader(), &signatureHeader); err != nil {
+		return nil, err
+	}
+	var creator msp.SerializedIdentity
+	if err := proto.Unmarshal(signatureHeader.GetCreator(), &creator); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(creator.GetIdBytes())
+	if block == nil {
+		return nil, status.Error(codes.InvalidArgument, "the creator has no PEM certificate")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	digest := sha256.Sum256(signedProposal.GetProposalBytes())
+	if !ecdsa.VerifyASN1(certificate.PublicKey.(*ecdsa.PublicKey), digest[:], signedProposal.GetSignature()) {
+		return nil, status.Error(codes.PermissionDenied, "the proposal signature does not match its creator")
+	}
+
+	var payload peer.ChaincodeProposalPayload
+	if err := proto.Unmarshal(proposal.GetPayload(), &payload); err != nil {
+		return nil, err
+	}
+	var invocationSpec peer.ChaincodeInvocationSpec
+	if err := proto.Unmarshal(payload.GetInput(), &invocationSpec); err != nil {
+		return nil, err
+	}
+	input := invocationSpec.GetChaincodeSpec().GetInput().GetArgs()
+	call := invocation{channel: channel, function: string(input[0]), mspID: creator.GetMspid()}
+	for _, arg := range input[1:] {
+		call.args = append(call.args, string(arg))
+	}
+
+	fg.mu.Lock()
+	defer fg.mu.Unlock()
+	fg.invocations = append(fg.invocations, call)
+	if err := fg.failures[call.function]; err != nil {
+		return nil, err
+	}
+
+	result := call.function
+	for _, arg := range call.args {
+		result += " " + arg
+	}
+	return []byte(result), nil
+}
+
+// preparedTransaction wraps a chaincode result in the transaction envelope a gateway
+// peer returns from Endorse
+func preparedTransaction(channel string, txID string, result []byte) (*common.Envelope, error) {
+	chaincodeAction, err := proto.Marshal(&peer.ChaincodeAction{Response: &peer.Response{Status: 200, Payload: result}})
+	if err != nil {
+		return nil, err
+	}
+	responsePayload, err := proto.Marshal(&peer.ProposalResponsePayload{Extension: chaincodeAction})
+	if err != nil {
+		return nil, err
+	}
+	actionPayload, err := proto.Marshal(&peer.ChaincodeActionPayload{
+		Action: &peer.ChaincodeEndorsedAction{ProposalResponsePayload: responsePayload},
+	})
+	if err != nil {
+		return nil, err
+	}
+	transaction, err := proto.Marshal(&peer.Transaction{Actions: []*peer.TransactionAction{{Payload: actionPayload}}})
+	if err != nil {
+		return nil, err
+	}
+	channelHeader, err := proto.Marshal(&common.ChannelHeader{ChannelId: channel, TxId: txID})
+	if err != nil {
+		return nil, err
+	}
+	payload, err := proto.Marshal(&common.Payload{
+		Header: &common.Header{ChannelHeader: channelHeader},
+		Data:   transaction,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &common.Envelope{Payload: payload}, nil
+}
+
+func newTestGatewayClient(t *testing.T) (*fakeGateway, *gatewayClient) {
+	t.Helper()
+
+	fake, endpoint, tlsCertPath := startFakeGateway(t)
+	gc, err := newGatewayClient(endpoint, testPeerHostAlias, tlsCertPath, newTestIdentity(t, "Org1MSP", "herb-api"), "herbtrace", "herbbatch", DefaultGatewayTimeouts)
+	require.NoError(t, err)
+	t.Cleanup(func() { gc.Close() })
+
+	return fake, gc
+}
+
+func TestGatewayClientEvaluate(t *testing.T) {
+	fake, gc := newTestGatewayClient(t)
+
+	result, err := gc.evaluate("ReadHerbBatch", "batch1")
+	require.NoError(t, err)
+	require.Equal(t, "ReadHerbBatch batch1", string(result))
+	require.Equal(t, []invocation{{channel: "herbtrace", function: "ReadHerbBatch", args: []string{"batch1"}, mspID: "Org1MSP"}}, fake.invocations)
+	require.Empty(t, fake.submitted, "an evaluation must not be submitted")
+}
+
+func TestGatewayClientSubmit(t *testing.T) {
+	fake, gc := newTestGatewayClient(t)
+
+	result, err := gc.submit("TransferHerbBatch", "batch1", "Priya Patel", "Org2MSP")
+	require.NoError(t, err)
+	require.Equal(t, "TransferHerbBatch batch1 Priya Patel Org2MSP", string(result))
+	require.Len(t, fake.submitted, 1)
+
+	fake.commitCode = peer.TxValidationCode_MVCC_READ_CONFLICT
+	_, err = gc.submit("UpdateHerbBatchStatus", "batch1", "Processing")
+	var commitError *client.CommitError
+	require.ErrorAs(t, err, &commitError)
+	require.Equal(t, peer.TxValidationCode_MVCC_READ_CONFLICT, commitError.Code)
+}
+
+func TestGatewayClientWithIdentity(t *testing.T) {
+	fake, gc := newTestGatewayClient(t)
+
+	buyer, err := gc.withIdentity(newTestIdentity(t, "Org2MSP", "buyer"))
+	require.NoError(t, err)
+	_, err = buyer.submit("AcceptTransferOffer", "offer1")
+	require.NoError(t, err)
+	_, err = gc.evaluate("GetLedgerStats")
+	require.NoError(t, err)
+
+	require.Equal(t, "Org2MSP", fake.invocations[0].mspID)
+	require.Equal(t, "Org1MSP", fake.invocations[1].mspID)
+}
+
+func TestGatewayClientChaincodeError(t *testing.T) {
+	fake, gc := newTestGatewayClient(t)
+
+	st, err := status.New(codes.Aborted, "failed to endorse transaction").WithDetails(&gateway.ErrorDetail{
+		Address: testPeerHostAlias,
+		MspId:   "Org1MSP",
+		Message: `chaincode response 500, {"code":"NOT_FOUND","message":"the herb batch batch9 does not exist"}`,
+	})
+	require.NoError(t, err)
+	fake.failures["ReadHerbBatch"] = st.Err()
+
+	_, err = gc.evaluate("ReadHerbBatch", "batch9")
+	chaincodeError, ok := AsChaincodeError(gatewayError("failed to read herb batch", err))
+	require.True(t, ok, "got %v", err)
+	require.Equal(t, CodeNotFound, chaincodeError.Code)
+	require.Equal(t, http.StatusNotFound, chaincodeError.HTTPStatus())
+}
+
+func TestNewGatewayClientTLSCertificate(t *testing.T) {
+	identity := newTestIdentity(t, "Org1MSP", "herb-api")
+
+	_, err := newGatewayClient("127.0.0.1:7051", testPeerHostAlias, filepath.Join(t.TempDir(), "missing.pem"), identity, "herbtrace", "herbbatch", DefaultGatewayTimeouts)
+	require.Error(t, err)
+
+	empty := filepath.Join(t.TempDir(), "empty.pem")
+	require.NoError(t, os.WriteFile(empty, []byte("not a certificate"), 0o600))
+	_, err = newGatewayClient("127.0.0.1:7051", testPeerHostAlias, empty, identity, "herbtrace", "herbbatch", DefaultGatewayTimeouts)
+	require.ErrorContains(t, err, "no certificates found")
+}
@@ -0,0 +1,143 @@
+package services
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+)
+
+// Identity is a Fabric client identity: an X.509 certificate issued to a member of an
+// MSP and the private key used to sign transactions with it
+type Identity struct {
+	MSPID          string
+	CertificatePEM []byte
+	Certificate    *x509.Certificate
+
+	privateKey crypto.Signer
+}
+
+// NewIdentity parses a PEM certificate and its PEM PKCS#8 private key and checks that
+// they belong together
+func NewIdentity(mspID string, certPEM []byte, keyPEM []byte) (*Identity, error) {
+	certBlock, _ := pem.Decode(certPEM)
+	if certBlock == nil || certBlock.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	certificate, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return nil, fmt.Errorf("no PEM data found in the private key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	privateKey, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+
+	publicKey, err := x509.MarshalPKIXPublicKey(privateKey.Public())
+	if err != nil {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	if !bytes.Equal(publicKey, certificate.RawSubjectPublicKeyInfo) {
+		return nil, fmt.Errorf("the private key does not match the certificate of %s", certificate.Subject.CommonName)
+	}
+
+	return &Identity{
+		MSPID:          mspID,
+		CertificatePEM: pem.EncodeToMemory(certBlock),
+		Certificate:    certificate,
+		privateKey:     privateKey,
+	}, nil
+}
+
+// Sign signs a message with the identity's private key the way Fabric verifies it
+func (id *Identity) Sign(message []byte) ([]byte, error) {
+	return signMessage(id.privateKey, message)
+}
+
+// signMessage signs a message the way Fabric verifies it: ECDSA over the SHA-256
+// digest with a low S value, or Ed25519 over the message itself
+func signMessage(privateKey crypto.Signer, message []byte) ([]byte, error) {
+	switch privateKey := privateKey.(type) {
+	case *ecdsa.PrivateKey:
+		digest := sha256.Sum256(message)
+		r, sigS, err := ecdsa.Sign(rand.Reader, privateKey, digest[:])
+		if err != nil {
+			return nil, err
+		}
+		halfOrder := new(big.Int).Rsh(privateKey.Curve.Params().N, 1)
+		if sigS.Cmp(halfOrder) > 0 {
+			sigS.Sub(privateKey.Curve.Params().N, sigS)
+		}
+		return asn1.Marshal(struct{ R, S *big.Int }{r, sigS})
+	case ed25519.PrivateKey:
+		return ed25519.Sign(privateKey, message), nil
+	default:
+		return nil, fmt.Errorf("unsupported client private key type %T", privateKey)
+	}
+}
+
+// LoadIdentity reads an identity from its PEM certificate and private key files.
+// certPath and keyPath may name a directory holding a single file, as in an MSP
+// signcerts or keystore directory.
+func LoadIdentity(mspID string, certPath string, keyPath string) (*Identity, error) {
+	certPEM, err := readPEMFile(certPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client certificate: %v", err)
+	}
+	keyPEM, err := readPEMFile(keyPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read client private key: %v", err)
+	}
+
+	identity, err := NewIdentity(mspID, certPEM, keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("invalid client identity %s: %v", certPath, err)
+	}
+
+	return identity, nil
+}
+
+// readPEMFile reads a file, or the only file in a directory
+func readPEMFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return os.ReadFile(path)
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			files = append(files, entry.Name())
+		}
+	}
+	if len(files) != 1 {
+		return nil, fmt.Errorf("expected one file in %s, found %d", path, len(files))
+	}
+
+	return os.ReadFile(filepath.Join(path, files[0]))
+}
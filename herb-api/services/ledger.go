@@ -0,0 +1,35 @@
+package services
+
+import (
+	"encoding/json"
+
+	"herb-api/models"
+)
+
+// HerbLedger is the herb batch ledger used by the API. FabricService invokes the
+// chaincode on a Fabric network; MemoryLedger runs the same chaincode in-process for
+// local development in builds with the dev tag.
+type HerbLedger interface {
+	CreateHerbBatch(herb models.CreateHerbBatchRequest) error
+	ReadHerbBatch(batchID string) (*models.HerbBatch, error)
+	GetAllHerbBatches() ([]models.HerbBatch, error)
+	GetHerbBatchesExpiringWithin(days int) ([]models.HerbBatch, error)
+	UpdateHerbBatchStatus(batchID, newStatus string) error
+	TransferHerbBatch(batchID, newOwner, newOwnerOrg string) (string, error)
+	HerbBatchExists(batchID string) (bool, error)
+	GetLedgerStats() (*models.LedgerStats, error)
+	GetHerbBatchesByHarvestDateRange(from, to string, pageSize int, bookmark string) (*models.HerbBatchPage, error)
+	GetHerbBatchEPCIS(batchID string) (json.RawMessage, error)
+	GetEPCISByHarvestDateRange(from, to string, pageSize int, bookmark string) (*models.EPCISPage, error)
+	RegisterDeviceKey(req models.RegisterDeviceKeyRequest) error
+	RecordSupplyChainEvent(batchID, action, location, notes string) (*models.SupplyChainEvent, error)
+	GetSupplyChainEvents(batchID string) ([]models.SupplyChainEvent, error)
+	RecallHerbBatch(batchID, reason string) (*models.Recall, error)
+	GetPublicProvenance(batchID string) (*models.PublicProvenance, error)
+
+	// WithIdentity returns a view of the same ledger whose transactions are submitted as identity
+	WithIdentity(identity *Identity) (HerbLedger, error)
+	Close() error
+}
+
+var _ HerbLedger = (*FabricService)(nil)
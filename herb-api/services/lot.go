@@ -0,0 +1,54 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"strings"
+	"time"
+)
+
+// crockfordAlphabet is Crockford's base32 alphabet: digits and upper case letters
+// without I, L, O and U, so lot numbers survive being read aloud or hand-copied
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// LotNumberLength fits the 20 characters GS1 allows for a batch/lot number (AI 10)
+const LotNumberLength = 20
+
+// NewLotNumber generates a herb batch ID: 10 characters of the millisecond timestamp
+// followed by 10 random characters, like a ULID shortened to fit a GS1 lot number.
+// IDs sort by creation time and a collision needs 2^25 batches in one millisecond
+// to become likely.
+func NewLotNumber(now time.Time) (string, error) {
+	var random [8]byte
+	if _, err := rand.Read(random[:]); err != nil {
+		return "", err
+	}
+
+	lot := make([]byte, LotNumberLength)
+	encodeCrockford(lot[:10], uint64(now.UnixMilli()))
+	encodeCrockford(lot[10:], binary.BigEndian.Uint64(random[:]))
+
+	return string(lot), nil
+}
+
+// IsLotNumber reports whether id has the form of a lot number from NewLotNumber:
+// LotNumberLength characters of Crockford's base32 alphabet
+func IsLotNumber(id string) bool {
+	if len(id) != LotNumberLength {
+		return false
+	}
+	for _, r := range id {
+		if !strings.ContainsRune(crockfordAlphabet, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// encodeCrockford writes the low 5*len(dst) bits of value into dst, most significant first
+func encodeCrockford(dst []byte, value uint64) {
+	for i := len(dst) - 1; i >= 0; i-- {
+		dst[i] = crockfordAlphabet[value&0x1f]
+		value >>= 5
+	}
+}
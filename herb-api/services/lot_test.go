@@ -0,0 +1,65 @@
+package services
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLotNumber(t *testing.T) {
+	now := time.Date(2024, time.August, 15, 6, 30, 0, 0, time.UTC)
+
+	lot, err := NewLotNumber(now)
+	require.NoError(t, err)
+	require.Len(t, lot, LotNumberLength)
+	for _, r := range lot {
+		require.True(t, strings.ContainsRune(crockfordAlphabet, r), "%q is not a Crockford base32 character", r)
+	}
+
+	other, err := NewLotNumber(now)
+	require.NoError(t, err)
+	require.Equal(t, lot[:10], other[:10], "lots of the same millisecond share their timestamp")
+	require.NotEqual(t, lot, other)
+}
+
+func TestNewLotNumberSortsByCreationTime(t *testing.T) {
+	start := time.Date(2024, time.August, 15, 6, 30, 0, 0, time.UTC)
+
+	var lots []string
+	for _, offset := range []time.Duration{0, time.Millisecond, time.Second, time.Hour, 24 * 365 * time.Hour} {
+		lot, err := NewLotNumber(start.Add(offset))
+		require.NoError(t, err)
+		lots = append(lots, lot)
+	}
+
+	require.True(t, sort.StringsAreSorted(lots), "lots must sort by creation time: %v", lots)
+}
+
+func TestIsLotNumber(t *testing.T) {
+	lot, err := NewLotNumber(time.Now())
+	require.NoError(t, err)
+	require.True(t, IsLotNumber(lot))
+	require.True(t, IsLotNumber("01M58QP9T4CDNSEHEE38"))
+
+	require.False(t, IsLotNumber(""))
+	require.False(t, IsLotNumber("batch1"))
+	require.False(t, IsLotNumber("01M58QP9T4CDNSEHEE3"), "too short")
+	require.False(t, IsLotNumber("01M58QP9T4CDNSEHEE388"), "too long")
+	require.False(t, IsLotNumber("01m58qp9t4cdnseheE38"), "lower case")
+	require.False(t, IsLotNumber("01M58QP9T4CDNSEHEEU8"), "U is not in the alphabet")
+}
+
+func TestEncodeCrockford(t *testing.T) {
+	dst := make([]byte, 4)
+	encodeCrockford(dst, 0)
+	require.Equal(t, "0000", string(dst))
+
+	encodeCrockford(dst, 31)
+	require.Equal(t, "000Z", string(dst))
+
+	encodeCrockford(dst, 32*32+10)
+	require.Equal(t, "010A", string(dst))
+}
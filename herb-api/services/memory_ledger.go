@@ -0,0 +1,367 @@
+//go:build dev
+
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"herb-api/models"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/fakestub"
+)
+
+var _ HerbLedger = (*MemoryLedger)(nil)
+
+// MemoryLedger runs the herb batch chaincode in-process against an in-memory ledger,
+// so the API can be developed and tried out without a Fabric network. Every
+// transaction goes through the same contract code as on a peer, so existence checks,
+// ownership and status rules behave as with FabricService. Nothing is persisted. It
+// uses the chaincode's test stub and is only built with the dev build tag.
+type MemoryLedger struct {
+	mu       *sync.Mutex
+	ledger   *fakestub.Ledger
+	contract *chaincode.SmartContract
+	identity *fakestub.Identity
+}
+
+// NewMemoryLedger creates an empty in-memory ledger whose transactions are submitted
+// by an admin identity of mspID, like the organisation admin the Fabric backend is
+// usually run with. When seed is set the ledger starts with the sample batches of
+// InitLedger.
+func NewMemoryLedger(mspID string, seed bool) (*MemoryLedger, error) {
+	identity, err := fakestub.NewIdentity(mspID, "herb-api", []string{"admin"}, map[string]string{"hf.Type": "admin"})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create client identity: %v", err)
+	}
+
+	ml := &MemoryLedger{
+		mu:       new(sync.Mutex),
+		ledger:   fakestub.NewLedger(),
+		contract: new(chaincode.SmartContract),
+		identity: identity,
+	}
+
+	if seed {
+		err := ml.submit("failed to initialise ledger", func(ctx contractapi.TransactionContextInterface) error {
+			return ml.contract.InitLedger(ctx)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return ml, nil
+}
+
+// WithIdentity returns a view of the same in-memory ledger whose transactions run as
+// the holder of the identity's certificate
+func (ml *MemoryLedger) WithIdentity(identity *Identity) (HerbLedger, error) {
+	clientIdentity, err := fakestub.IdentityFromCertificate(identity.MSPID, identity.CertificatePEM)
+	if err != nil {
+		return nil, err
+	}
+
+	view := *ml
+	view.identity = clientIdentity
+	return &view, nil
+}
+
+// Close releases nothing; the ledger is discarded with the process
+func (ml *MemoryLedger) Close() error {
+	return nil
+}
+
+// CreateHerbBatch creates a new herb batch on the ledger
+func (ml *MemoryLedger) CreateHerbBatch(herb models.CreateHerbBatchRequest) error {
+	return ml.submit("failed to create herb batch", func(ctx contractapi.TransactionContextInterface) error {
+		return ml.contract.CreateHerbBatch(ctx, herb.ID, herb.BotanicalName, herb.Farm, herb.HarvestDate, herb.Owner,
+			herb.Status, herb.Region, herb.Quantity, herb.DeviceKeyID, herb.Signature)
+	})
+}
+
+// ReadHerbBatch retrieves a herb batch from the ledger
+func (ml *MemoryLedger) ReadHerbBatch(batchID string) (*models.HerbBatch, error) {
+	var herbBatch models.HerbBatch
+	err := ml.evaluate("failed to read herb batch", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.ReadHerbBatch(ctx, batchID)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &herbBatch)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &herbBatch, nil
+}
+
+// GetAllHerbBatches retrieves all herb batches from the ledger
+func (ml *MemoryLedger) GetAllHerbBatches() ([]models.HerbBatch, error) {
+	herbBatches := []models.HerbBatch{}
+	err := ml.evaluate("failed to get all herb batches", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.GetAllHerbBatches(ctx)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &herbBatches)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return herbBatches, nil
+}
+
+// GetHerbBatchesExpiringWithin retrieves the herb batches expiring within the given number of days, including expired lots
+func (ml *MemoryLedger) GetHerbBatchesExpiringWithin(days int) ([]models.HerbBatch, error) {
+	herbBatches := []models.HerbBatch{}
+	err := ml.evaluate("failed to get expiring herb batches", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.GetHerbBatchesExpiringWithin(ctx, days)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &herbBatches)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return herbBatches, nil
+}
+
+// UpdateHerbBatchStatus updates the status of a herb batch
+func (ml *MemoryLedger) UpdateHerbBatchStatus(batchID, newStatus string) error {
+	return ml.submit("failed to update herb batch status", func(ctx contractapi.TransactionContextInterface) error {
+		return ml.contract.UpdateHerbBatchStatus(ctx, batchID, newStatus)
+	})
+}
+
+// TransferHerbBatch transfers ownership of a herb batch and returns the previous owner
+func (ml *MemoryLedger) TransferHerbBatch(batchID, newOwner, newOwnerOrg string) (string, error) {
+	var oldOwner string
+	err := ml.submit("failed to transfer herb batch", func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		oldOwner, err = ml.contract.TransferHerbBatch(ctx, batchID, newOwner, newOwnerOrg)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return oldOwner, nil
+}
+
+// HerbBatchExists checks if a herb batch exists on the ledger
+func (ml *MemoryLedger) HerbBatchExists(batchID string) (bool, error) {
+	var exists bool
+	err := ml.evaluate("failed to check herb batch existence", func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		exists, err = ml.contract.HerbBatchExists(ctx, batchID)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return exists, nil
+}
+
+// GetLedgerStats retrieves the aggregate herb batch counters from the ledger
+func (ml *MemoryLedger) GetLedgerStats() (*models.LedgerStats, error) {
+	var stats models.LedgerStats
+	err := ml.evaluate("failed to get ledger stats", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.GetLedgerStats(ctx)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &stats)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &stats, nil
+}
+
+// GetHerbBatchesByHarvestDateRange retrieves one page of herb batches harvested between from and to
+func (ml *MemoryLedger) GetHerbBatchesByHarvestDateRange(from, to string, pageSize int, bookmark string) (*models.HerbBatchPage, error) {
+	var page models.HerbBatchPage
+	err := ml.evaluate("failed to get herb batches by harvest date", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.GetHerbBatchesByHarvestDateRange(ctx, from, to, int32(pageSize), bookmark)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &page)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// GetHerbBatchEPCIS retrieves the lifecycle of a herb batch as an EPCIS 2.0 JSON-LD document
+func (ml *MemoryLedger) GetHerbBatchEPCIS(batchID string) (json.RawMessage, error) {
+	var document json.RawMessage
+	err := ml.evaluate("failed to get EPCIS events", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.GetHerbBatchEPCIS(ctx, batchID)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &document)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return document, nil
+}
+
+// GetEPCISByHarvestDateRange retrieves one page of EPCIS events for the herb batches harvested between from and to
+func (ml *MemoryLedger) GetEPCISByHarvestDateRange(from, to string, pageSize int, bookmark string) (*models.EPCISPage, error) {
+	var page models.EPCISPage
+	err := ml.evaluate("failed to get EPCIS events by harvest date", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.GetEPCISByHarvestDateRange(ctx, from, to, int32(pageSize), bookmark)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &page)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// RegisterDeviceKey registers a farmer's device public key on the ledger
+func (ml *MemoryLedger) RegisterDeviceKey(req models.RegisterDeviceKeyRequest) error {
+	return ml.submit("failed to register device key", func(ctx contractapi.TransactionContextInterface) error {
+		return ml.contract.RegisterDeviceKey(ctx, req.KeyID, req.Farmer, req.Algorithm, req.PublicKey)
+	})
+}
+
+// RecordSupplyChainEvent performs a workflow action on a herb batch and returns the
+// recorded event, whose ID is the transaction ID. The client identity is recorded as
+// the actor and must carry the action's role.
+func (ml *MemoryLedger) RecordSupplyChainEvent(batchID, action, location, notes string) (*models.SupplyChainEvent, error) {
+	var event models.SupplyChainEvent
+	err := ml.submit("failed to record supply chain event", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.RecordSupplyChainEvent(ctx, batchID, action, location, notes)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &event)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// GetSupplyChainEvents retrieves the workflow events of a herb batch in the order they happened
+func (ml *MemoryLedger) GetSupplyChainEvents(batchID string) ([]models.SupplyChainEvent, error) {
+	events := []models.SupplyChainEvent{}
+	err := ml.evaluate("failed to get supply chain events", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.GetSupplyChainEvents(ctx, batchID)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &events)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return events, nil
+}
+
+// RecallHerbBatch withdraws a herb batch from sale. The client identity must be an
+// organisation admin.
+func (ml *MemoryLedger) RecallHerbBatch(batchID, reason string) (*models.Recall, error) {
+	var recall models.Recall
+	err := ml.submit("failed to recall herb batch", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.RecallHerbBatch(ctx, batchID, reason)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &recall)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &recall, nil
+}
+
+// GetPublicProvenance retrieves the provenance of a herb batch that may be shown to consumers
+func (ml *MemoryLedger) GetPublicProvenance(batchID string) (*models.PublicProvenance, error) {
+	var provenance models.PublicProvenance
+	err := ml.evaluate("failed to read herb batch provenance", func(ctx contractapi.TransactionContextInterface) error {
+		result, err := ml.contract.GetPublicProvenance(ctx, batchID)
+		if err != nil {
+			return err
+		}
+		return convertResult(result, &provenance)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &provenance, nil
+}
+
+// submit runs fn as a transaction and commits its writes when it succeeds
+func (ml *MemoryLedger) submit(action string, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	// transactions carry the wall clock time so that expiry dates are checked against today
+	ml.ledger.SetTime(time.Now())
+	return memoryError(action, ml.ledger.Submit(ml.identity, fn))
+}
+
+// evaluate runs fn as a query and discards its writes
+func (ml *MemoryLedger) evaluate(action string, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	ml.mu.Lock()
+	defer ml.mu.Unlock()
+
+	ml.ledger.SetTime(time.Now())
+	return memoryError(action, ml.ledger.Evaluate(ml.identity, fn))
+}
+
+// convertResult copies a chaincode result into its API model through its JSON
+// encoding, as the result would reach FabricService from a peer. A nil result leaves
+// v unchanged.
+func convertResult(result interface{}, v interface{}) error {
+	resultJSON, err := json.Marshal(result)
+	if err != nil {
+		return fmt.Errorf("failed to encode chaincode result: %v", err)
+	}
+	if string(resultJSON) == "null" {
+		return nil
+	}
+
+	return json.Unmarshal(resultJSON, v)
+}
+
+// memoryError builds the error of a failed in-process transaction, wrapping the
+// chaincode error as gatewayError does for a peer
+func memoryError(action string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if chaincodeError := parseChaincodeError(err.Error()); chaincodeError != nil {
+		return fmt.Errorf("%s: %w", action, chaincodeError)
+	}
+
+	return fmt.Errorf("%s: %v", action, err)
+}
@@ -0,0 +1,11 @@
+//go:build !dev
+
+package services
+
+import "errors"
+
+// NewMemoryLedger is only available in builds with the dev tag, as the in-memory
+// ledger runs the chaincode on its test stub
+func NewMemoryLedger(mspID string, seed bool) (HerbLedger, error) {
+	return nil, errors.New(`ledger.backend "memory" is only available when built with -tags dev (go run -tags dev main.go); set ledger.backend to "fabric" otherwise`)
+}
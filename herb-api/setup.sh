@@ -37,7 +37,7 @@ echo ""
 echo "🎉 Setup complete!"
 echo ""
 echo "To start the API server:"
-echo "  go run main.go"
+echo "  HERB_API_AUTH_ALLOW_ANONYMOUS=true go run main.go"
 echo ""
 echo "API will be available at: http://localhost:8080"
 echo "Health check: http://localhost:8080/health"
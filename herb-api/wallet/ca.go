@@ -0,0 +1,336 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"herb-api/services"
+)
+
+// CAConfig locates a Fabric CA and the registrar that registers new users with it
+type CAConfig struct {
+	URL             string // e.g. https://localhost:7054
+	CAName          string // CA name on a server hosting several CAs, empty for the default CA
+	TLSCertPath     string // PEM CA certificate of the CA server's TLS certificate, for https URLs
+	MSPID           string // MSP of the identities the CA issues
+	RegistrarID     string
+	RegistrarSecret string
+	Timeout         time.Duration
+}
+
+// RegistrationRequest registers a new user with the Fabric CA
+type RegistrationRequest struct {
+	EnrollmentID string            // defaults to the subject
+	Type         string            // client, peer, orderer or admin; defaults to client
+	Affiliation  string            // e.g. org1.department1
+	Attributes   map[string]string // added to the enrollment certificate, e.g. {"role": "farmer"}
+}
+
+// CAClient speaks the REST API of a Fabric CA server
+type CAClient struct {
+	config     CAConfig
+	httpClient *http.Client
+
+	mu        sync.Mutex
+	registrar *services.Identity
+}
+
+// caResponse is the envelope of every Fabric CA response
+type caResponse struct {
+	Success bool            `json:"success"`
+	Result  json.RawMessage `json:"result"`
+	Errors  []struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// NewCAClient creates a client of the Fabric CA at config.URL. The registrar is
+// enrolled on first use.
+func NewCAClient(config CAConfig) (*CAClient, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if config.TLSCertPath != "" {
+		tlsCertPEM, err := os.ReadFile(config.TLSCertPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA TLS certificate: %v", err)
+		}
+		certPool := x509.NewCertPool()
+		if !certPool.AppendCertsFromPEM(tlsCertPEM) {
+			return nil, fmt.Errorf("no certificates found in %s", config.TLSCertPath)
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: certPool, MinVersion: tls.VersionTLS12}
+	}
+
+	return &CAClient{
+		config:     config,
+		httpClient: &http.Client{Transport: transport, Timeout: config.Timeout},
+	}, nil
+}
+
+// Enroll requests a certificate for a new P-256 key with the enrollment ID and secret,
+// returning the PEM certificate and PEM PKCS#8 private key
+func (ca *CAClient) Enroll(enrollmentID string, secret string) ([]byte, []byte, error) {
+	key, csrPEM, err := newCertificateRequest(enrollmentID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := json.Marshal(map[string]string{"certificate_request": string(csrPEM), "caname": ca.config.CAName})
+	if err != nil {
+		return nil, nil, err
+	}
+	request, err := http.NewRequest(http.MethodPost, ca.endpoint("enroll"), bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, err
+	}
+	request.SetBasicAuth(enrollmentID, secret)
+
+	certPEM, err := ca.enrollment(request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to enroll %s: %v", enrollmentID, err)
+	}
+	return certPEM, key, nil
+}
+
+// Reenroll requests a certificate for a new key, authenticated by the current identity
+func (ca *CAClient) Reenroll(identity *services.Identity) ([]byte, []byte, error) {
+	key, csrPEM, err := newCertificateRequest(identity.Certificate.Subject.CommonName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	body, err := json.Marshal(map[string]string{"certificate_request": string(csrPEM), "caname": ca.config.CAName})
+	if err != nil {
+		return nil, nil, err
+	}
+	request, err := ca.newTokenRequest(identity, "reenroll", body)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	certPEM, err := ca.enrollment(request)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to reenroll %s: %v", identity.Certificate.Subject.CommonName, err)
+	}
+	return certPEM, key, nil
+}
+
+// Register registers a new identity with the CA and returns its enrollment secret
+func (ca *CAClient) Register(registration RegistrationRequest) (string, error) {
+	registrar, err := ca.registrarIdentity()
+	if err != nil {
+		return "", err
+	}
+
+	type attribute struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+		ECert bool   `json:"ecert"`
+	}
+	attributes := []attribute{}
+	for name, value := range registration.Attributes {
+		attributes = append(attributes, attribute{Name: name, Value: value, ECert: true})
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"id":              registration.EnrollmentID,
+		"type":            registration.Type,
+		"affiliation":     registration.Affiliation,
+		"attrs":           attributes,
+		"max_enrollments": -1,
+		"caname":          ca.config.CAName,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	request, err := ca.newTokenRequest(registrar, "register", body)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		Secret string `json:"secret"`
+	}
+	if err := ca.do(request, &result); err != nil {
+		return "", fmt.Errorf("failed to register %s: %v", registration.EnrollmentID, err)
+	}
+	return result.Secret, nil
+}
+
+// Revoke revokes an enrollment ID and all of its certificates
+func (ca *CAClient) Revoke(enrollmentID string, reason string) error {
+	registrar, err := ca.registrarIdentity()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"id":     enrollmentID,
+		"reason": reason,
+		"caname": ca.config.CAName,
+	})
+	if err != nil {
+		return err
+	}
+	request, err := ca.newTokenRequest(registrar, "revoke", body)
+	if err != nil {
+		return err
+	}
+	if err := ca.do(request, nil); err != nil {
+		return fmt.Errorf("failed to revoke %s: %v", enrollmentID, err)
+	}
+	return nil
+}
+
+// RevokeCertificate revokes one certificate, leaving its enrollment ID usable
+func (ca *CAClient) RevokeCertificate(certificate *x509.Certificate, reason string) error {
+	registrar, err := ca.registrarIdentity()
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"serial": hex.EncodeToString(certificate.SerialNumber.Bytes()),
+		"aki":    hex.EncodeToString(certificate.AuthorityKeyId),
+		"reason": reason,
+		"caname": ca.config.CAName,
+	})
+	if err != nil {
+		return err
+	}
+	request, err := ca.newTokenRequest(registrar, "revoke", body)
+	if err != nil {
+		return err
+	}
+	if err := ca.do(request, nil); err != nil {
+		return fmt.Errorf("failed to revoke certificate %s: %v", certificate.SerialNumber.Text(16), err)
+	}
+	return nil
+}
+
+// registrarIdentity enrolls the registrar the first time it is needed
+func (ca *CAClient) registrarIdentity() (*services.Identity, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	if ca.registrar != nil {
+		return ca.registrar, nil
+	}
+
+	certPEM, keyPEM, err := ca.Enroll(ca.config.RegistrarID, ca.config.RegistrarSecret)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enroll the CA registrar: %v", err)
+	}
+	registrar, err := services.NewIdentity(ca.config.MSPID, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	ca.registrar = registrar
+
+	return registrar, nil
+}
+
+func (ca *CAClient) endpoint(name string) string {
+	return strings.TrimSuffix(ca.config.URL, "/") + "/api/v1/" + name
+}
+
+// newTokenRequest builds a request authenticated with a Fabric CA token: the
+// identity's certificate and its signature over the method, URI, body and certificate
+func (ca *CAClient) newTokenRequest(identity *services.Identity, name string, body []byte) (*http.Request, error) {
+	request, err := http.NewRequest(http.MethodPost, ca.endpoint(name), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	b64Cert := base64.StdEncoding.EncodeToString(identity.CertificatePEM)
+	payload := request.Method + "." +
+		base64.StdEncoding.EncodeToString([]byte(request.URL.RequestURI())) + "." +
+		base64.StdEncoding.EncodeToString(body) + "." +
+		b64Cert
+	signature, err := identity.Sign([]byte(payload))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Authorization", b64Cert+"."+base64.StdEncoding.EncodeToString(signature))
+
+	return request, nil
+}
+
+func (ca *CAClient) enrollment(request *http.Request) ([]byte, error) {
+	var result struct {
+		Cert string `json:"Cert"`
+	}
+	if err := ca.do(request, &result); err != nil {
+		return nil, err
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(result.Cert)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate in the CA response: %v", err)
+	}
+	return certPEM, nil
+}
+
+func (ca *CAClient) do(request *http.Request, result interface{}) error {
+	request.Header.Set("Content-Type", "application/json")
+	response, err := ca.httpClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	var envelope caResponse
+	if err := json.NewDecoder(response.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("unexpected CA response (%s): %v", response.Status, err)
+	}
+	if !envelope.Success {
+		var messages []string
+		for _, caError := range envelope.Errors {
+			messages = append(messages, fmt.Sprintf("%s (code %d)", caError.Message, caError.Code))
+		}
+		if len(messages) == 0 {
+			messages = append(messages, response.Status)
+		}
+		return fmt.Errorf("the CA refused the request: %s", strings.Join(messages, "; "))
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Result, result)
+}
+
+// newCertificateRequest generates a P-256 key and a certificate signing request for it
+func newCertificateRequest(commonName string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	csrDER, err := x509.CreateCertificateRequest(rand.Reader, &x509.CertificateRequest{
+		Subject: pkix.Name{CommonName: commonName},
+	}, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate request: %v", err)
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	csrPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE REQUEST", Bytes: csrDER})
+	return keyPEM, csrPEM, nil
+}
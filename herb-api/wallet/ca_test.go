@@ -0,0 +1,322 @@
+package wallet
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testRegistrarID     = "admin"
+	testRegistrarSecret = "adminpw"
+)
+
+// fakeCA is a Fabric CA server that keeps its users in memory. It checks enrollment
+// secrets and token signatures, and refuses tokens of revoked certificates.
+type fakeCA struct {
+	t    *testing.T
+	key  *ecdsa.PrivateKey
+	cert *x509.Certificate
+
+	mu          sync.Mutex
+	secrets     map[string]string   // enrollment ID to secret
+	attributes  map[string][]string // enrollment ID to registered attribute names
+	revokedIDs  map[string]string   // enrollment ID to reason
+	revokedCert map[string]string   // serial number (hex) to reason
+	serial      int64
+}
+
+func startFakeCA(t *testing.T) (*fakeCA, *CAClient) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca.org1.example.com"},
+		SubjectKeyId:          []byte{1, 2, 3, 4},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	ca := &fakeCA{
+		t:           t,
+		key:         key,
+		cert:        cert,
+		secrets:     map[string]string{testRegistrarID: testRegistrarSecret},
+		attributes:  map[string][]string{},
+		revokedIDs:  map[string]string{},
+		revokedCert: map[string]string{},
+		serial:      1,
+	}
+	server := httptest.NewServer(ca)
+	t.Cleanup(server.Close)
+
+	client, err := NewCAClient(CAConfig{
+		URL:             server.URL,
+		MSPID:           "Org1MSP",
+		RegistrarID:     testRegistrarID,
+		RegistrarSecret: testRegistrarSecret,
+		Timeout:         5 * time.Second,
+	})
+	require.NoError(t, err)
+	return ca, client
+}
+
+func (ca *fakeCA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	body, err := io.ReadAll(r.Body)
+	require.NoError(ca.t, err)
+
+	var result interface{}
+	switch r.URL.Path {
+	case "/api/v1/enroll":
+		id, secret, ok := r.BasicAuth()
+		if !ok || ca.secrets[id] != secret || ca.revokedIDs[id] != "" {
+			ca.fail(w, 20, "authentication failure")
+			return
+		}
+		result, err = ca.issue(body)
+	case "/api/v1/reenroll":
+		var caller *x509.Certificate
+		if caller, err = ca.authenticate(r, body); err == nil {
+			result, err = ca.issue(body)
+			if err == nil && caller.Subject.CommonName != ca.csrCommonName(body) {
+				err = fmt.Errorf("the certificate request names another identity")
+			}
+		}
+	case "/api/v1/register":
+		var request struct {
+			ID    string `json:"id"`
+			Attrs []struct {
+				Name string `json:"name"`
+			} `json:"attrs"`
+		}
+		if _, err = ca.authenticateRegistrar(r, body); err == nil {
+			err = json.Unmarshal(body, &request)
+		}
+		if err == nil {
+			if _, exists := ca.secrets[request.ID]; exists {
+				err = fmt.Errorf("identity '%s' is already registered", request.ID)
+			} else {
+				ca.secrets[request.ID] = request.ID + "pw"
+				for _, attribute := range request.Attrs {
+					ca.attributes[request.ID] = append(ca.attributes[request.ID], attribute.Name)
+				}
+				result = map[string]string{"secret": request.ID + "pw"}
+			}
+		}
+	case "/api/v1/revoke":
+		var request struct {
+			ID     string `json:"id"`
+			Serial string `json:"serial"`
+			AKI    string `json:"aki"`
+			Reason string `json:"reason"`
+		}
+		if _, err = ca.authenticateRegistrar(r, body); err == nil {
+			err = json.Unmarshal(body, &request)
+		}
+		if err == nil {
+			switch {
+			case request.ID != "":
+				ca.revokedIDs[request.ID] = request.Reason
+			case request.AKI != hex.EncodeToString(ca.cert.SubjectKeyId):
+				err = fmt.Errorf("unknown authority key identifier %s", request.AKI)
+			default:
+				ca.revokedCert[request.Serial] = request.Reason
+			}
+			result = map[string]interface{}{}
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		ca.fail(w, 0, err.Error())
+		return
+	}
+
+	resultJSON, err := json.Marshal(result)
+	require.NoError(ca.t, err)
+	json.NewEncoder(w).Encode(caResponse{Success: true, Result: resultJSON})
+}
+
+func (ca *fakeCA) fail(w http.ResponseWriter, code int, message string) {
+	w.WriteHeader(http.StatusUnauthorized)
+	fmt.Fprintf(w, `{"success":false,"result":null,"errors":[{"code":%d,"message":%q}]}`, code, message)
+}
+
+// authenticate verifies a token: the caller's certificate, issued by the CA and not
+// revoked, and its signature over the method, URI, body and certificate
+func (ca *fakeCA) authenticate(r *http.Request, body []byte) (*x509.Certificate, error) {
+	b64Cert, b64Signature, ok := strings.Cut(r.Header.Get("Authorization"), ".")
+	if !ok {
+		return nil, fmt.Errorf("missing token")
+	}
+	certPEM, err := base64.StdEncoding.DecodeString(b64Cert)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := parseCertificate(certPEM)
+	if err != nil {
+		return nil, err
+	}
+	if err := cert.CheckSignatureFrom(ca.cert); err != nil {
+		return nil, fmt.Errorf("the certificate was not issued by this CA")
+	}
+	if reason, revoked := ca.revokedCert[hex.EncodeToString(cert.SerialNumber.Bytes())]; revoked {
+		return nil, fmt.Errorf("the certificate has been revoked (%s)", reason)
+	}
+	if reason, revoked := ca.revokedIDs[cert.Subject.CommonName]; revoked {
+		return nil, fmt.Errorf("the identity has been revoked (%s)", reason)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(b64Signature)
+	if err != nil {
+		return nil, err
+	}
+	payload := r.Method + "." +
+		base64.StdEncoding.EncodeToString([]byte(r.URL.RequestURI())) + "." +
+		base64.StdEncoding.EncodeToString(body) + "." +
+		b64Cert
+	digest := sha256.Sum256([]byte(payload))
+	if !ecdsa.VerifyASN1(cert.PublicKey.(*ecdsa.PublicKey), digest[:], signature) {
+		return nil, fmt.Errorf("invalid token signature")
+	}
+
+	return cert, nil
+}
+
+func (ca *fakeCA) authenticateRegistrar(r *http.Request, body []byte) (*x509.Certificate, error) {
+	cert, err := ca.authenticate(r, body)
+	if err != nil {
+		return nil, err
+	}
+	if cert.Subject.CommonName != testRegistrarID {
+		return nil, fmt.Errorf("%s is not a registrar", cert.Subject.CommonName)
+	}
+	return cert, nil
+}
+
+func (ca *fakeCA) csrCommonName(body []byte) string {
+	csr, err := ca.parseRequest(body)
+	if err != nil {
+		return ""
+	}
+	return csr.Subject.CommonName
+}
+
+func (ca *fakeCA) parseRequest(body []byte) (*x509.CertificateRequest, error) {
+	var request struct {
+		CertificateRequest string `json:"certificate_request"`
+	}
+	if err := json.Unmarshal(body, &request); err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode([]byte(request.CertificateRequest))
+	if block == nil {
+		return nil, fmt.Errorf("no certificate request found")
+	}
+	csr, err := x509.ParseCertificateRequest(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	return csr, csr.CheckSignature()
+}
+
+// issue signs the certificate request in body
+func (ca *fakeCA) issue(body []byte) (interface{}, error) {
+	csr, err := ca.parseRequest(body)
+	if err != nil {
+		return nil, err
+	}
+
+	ca.serial++
+	template := &x509.Certificate{
+		SerialNumber:   big.NewInt(ca.serial),
+		Subject:        csr.Subject,
+		NotBefore:      time.Now().Add(-time.Minute),
+		NotAfter:       time.Now().Add(24 * time.Hour),
+		AuthorityKeyId: ca.cert.SubjectKeyId,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, csr.PublicKey, ca.key)
+	if err != nil {
+		return nil, err
+	}
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return map[string]string{"Cert": base64.StdEncoding.EncodeToString(certPEM)}, nil
+}
+
+func TestCAClientEnroll(t *testing.T) {
+	_, client := startFakeCA(t)
+
+	certPEM, keyPEM, err := client.Enroll(testRegistrarID, testRegistrarSecret)
+	require.NoError(t, err)
+	cert, err := parseCertificate(certPEM)
+	require.NoError(t, err)
+	require.Equal(t, testRegistrarID, cert.Subject.CommonName)
+	require.Contains(t, string(keyPEM), "PRIVATE KEY")
+
+	_, _, err = client.Enroll(testRegistrarID, "wrong")
+	require.ErrorContains(t, err, "authentication failure (code 20)")
+}
+
+func TestCAClientRegister(t *testing.T) {
+	ca, client := startFakeCA(t)
+
+	secret, err := client.Register(RegistrationRequest{
+		EnrollmentID: "ravi",
+		Type:         "client",
+		Attributes:   map[string]string{"role": "farmer"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "ravipw", secret)
+	require.Equal(t, []string{"role"}, ca.attributes["ravi"])
+
+	_, err = client.Register(RegistrationRequest{EnrollmentID: "ravi", Type: "client"})
+	require.ErrorContains(t, err, "already registered")
+}
+
+func TestCAClientRevokeCertificate(t *testing.T) {
+	ca, client := startFakeCA(t)
+	_, err := client.Register(RegistrationRequest{EnrollmentID: "ravi", Type: "client"})
+	require.NoError(t, err)
+	certPEM, _, err := client.Enroll("ravi", "ravipw")
+	require.NoError(t, err)
+	cert, err := parseCertificate(certPEM)
+	require.NoError(t, err)
+
+	require.NoError(t, client.RevokeCertificate(cert, "keycompromise"))
+	require.Equal(t, "keycompromise", ca.revokedCert[hex.EncodeToString(cert.SerialNumber.Bytes())])
+	require.Empty(t, ca.revokedIDs, "the enrollment ID stays usable")
+
+	_, _, err = client.Enroll("ravi", "ravipw")
+	require.NoError(t, err)
+}
@@ -0,0 +1,102 @@
+package wallet
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Enroller enrolls wallet identities against a Fabric CA
+type Enroller struct {
+	wallet *Wallet
+	ca     *CAClient
+}
+
+// NewEnroller creates an Enroller storing the identities issued by ca in wallet
+func NewEnroller(wallet *Wallet, ca *CAClient) *Enroller {
+	return &Enroller{wallet: wallet, ca: ca}
+}
+
+// RegisterAndEnroll registers a user with the CA, enrolls it with a key generated on
+// the server and stores the identity in the wallet under subject. The enrollment
+// secret never leaves the server.
+func (e *Enroller) RegisterAndEnroll(subject string, registration RegistrationRequest) (*Entry, error) {
+	if registration.EnrollmentID == "" {
+		registration.EnrollmentID = subject
+	}
+	if registration.Type == "" {
+		registration.Type = "client"
+	}
+
+	if existing, err := e.wallet.Get(subject); err == nil && existing.Status == StatusActive {
+		return nil, ErrExists
+	}
+
+	secret, err := e.ca.Register(registration)
+	if err != nil {
+		return nil, err
+	}
+	certPEM, keyPEM, err := e.ca.Enroll(registration.EnrollmentID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.wallet.add(subject, e.ca.config.MSPID, certPEM, keyPEM, SourceEnrolled, registration.EnrollmentID)
+}
+
+// ErrPreviousCertificateValid is returned by Reenroll when the identity was rotated
+// but the CA did not revoke its previous certificate
+var ErrPreviousCertificateValid = errors.New("the previous certificate could not be revoked")
+
+// Reenroll rotates an enrolled identity to a new key and certificate issued by the
+// CA, then revokes the previous certificate so that a leaked copy of the old key
+// stops working. When only the revocation fails, the rotated entry is returned with
+// an error wrapping ErrPreviousCertificateValid.
+func (e *Enroller) Reenroll(subject string) (*Entry, error) {
+	entry, err := e.wallet.Get(subject)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Source != SourceEnrolled {
+		return nil, fmt.Errorf("the identity of %s was imported; rotate it with a new certificate and key", subject)
+	}
+	identity, err := e.wallet.Identity(subject)
+	if err != nil {
+		return nil, err
+	}
+
+	certPEM, keyPEM, err := e.ca.Reenroll(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	rotated, err := e.wallet.Rotate(subject, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := e.ca.RevokeCertificate(identity.Certificate, "superseded"); err != nil {
+		return rotated, fmt.Errorf("%w: %v", ErrPreviousCertificateValid, err)
+	}
+
+	return rotated, nil
+}
+
+// Revoke revokes an identity in the wallet and, when it was enrolled by the API,
+// its enrollment ID at the CA as well so that it cannot be enrolled again
+func (e *Enroller) Revoke(subject string, reason string) (*Entry, error) {
+	entry, err := e.wallet.Get(subject)
+	if err != nil {
+		return nil, err
+	}
+	if entry.Status == StatusRevoked {
+		return nil, ErrRevoked
+	}
+
+	if entry.Source == SourceEnrolled {
+		if err := e.ca.Revoke(entry.EnrollmentID, reason); err != nil {
+			return nil, err
+		}
+	}
+
+	return e.wallet.Revoke(subject, reason)
+}
@@ -0,0 +1,103 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newTestEnroller(t *testing.T) (*fakeCA, *Enroller, *Wallet) {
+	t.Helper()
+
+	ca, client := startFakeCA(t)
+	w, _, _ := newTestWallet(t)
+	return ca, NewEnroller(w, client), w
+}
+
+func TestRegisterAndEnroll(t *testing.T) {
+	_, enroller, w := newTestEnroller(t)
+
+	entry, err := enroller.RegisterAndEnroll("farmer-ravi", RegistrationRequest{Attributes: map[string]string{"role": "farmer"}})
+	require.NoError(t, err)
+	require.Equal(t, SourceEnrolled, entry.Source)
+	require.Equal(t, "farmer-ravi", entry.EnrollmentID, "the enrollment ID defaults to the subject")
+	require.Equal(t, "farmer-ravi", entry.CommonName)
+	require.Equal(t, "Org1MSP", entry.MSPID)
+
+	_, err = w.Identity("farmer-ravi")
+	require.NoError(t, err)
+
+	_, err = enroller.RegisterAndEnroll("farmer-ravi", RegistrationRequest{EnrollmentID: "ravi2"})
+	require.ErrorIs(t, err, ErrExists)
+}
+
+func TestReenrollRevokesThePreviousCertificate(t *testing.T) {
+	ca, enroller, w := newTestEnroller(t)
+	before, err := enroller.RegisterAndEnroll("farmer-ravi", RegistrationRequest{})
+	require.NoError(t, err)
+	previous, err := w.Identity("farmer-ravi")
+	require.NoError(t, err)
+
+	after, err := enroller.Reenroll("farmer-ravi")
+	require.NoError(t, err)
+	require.NotEqual(t, before.SerialNumber, after.SerialNumber)
+	require.Equal(t, "superseded", ca.revokedCert[hex.EncodeToString(previous.Certificate.SerialNumber.Bytes())])
+	require.Empty(t, ca.revokedIDs, "the enrollment ID stays usable")
+
+	// the CA refuses the previous certificate, so only the rotated key can reenroll
+	_, _, err = enroller.ca.Reenroll(previous)
+	require.ErrorContains(t, err, "revoked")
+	_, err = enroller.Reenroll("farmer-ravi")
+	require.NoError(t, err)
+}
+
+func TestReenrollReportsAPreviousCertificateLeftValid(t *testing.T) {
+	ca, enroller, w := newTestEnroller(t)
+	_, err := enroller.RegisterAndEnroll("farmer-ravi", RegistrationRequest{})
+	require.NoError(t, err)
+
+	// a registrar that lost its revoke permission cannot revoke the old certificate
+	ca.mu.Lock()
+	ca.revokedIDs[testRegistrarID] = "rotated"
+	ca.mu.Unlock()
+
+	entry, err := enroller.Reenroll("farmer-ravi")
+	require.True(t, errors.Is(err, ErrPreviousCertificateValid))
+	require.NotNil(t, entry, "the identity was rotated all the same")
+	identity, err := w.Identity("farmer-ravi")
+	require.NoError(t, err)
+	require.Equal(t, entry.SerialNumber, identity.Certificate.SerialNumber.Text(16))
+}
+
+func TestReenrollRefusesImportedIdentities(t *testing.T) {
+	_, enroller, w := newTestEnroller(t)
+	certPEM, keyPEM := newTestCertificate(t, "ravi")
+	_, err := w.Import("farmer-ravi", "Org1MSP", certPEM, keyPEM)
+	require.NoError(t, err)
+
+	_, err = enroller.Reenroll("farmer-ravi")
+	require.ErrorContains(t, err, "was imported")
+}
+
+func TestEnrollerRevoke(t *testing.T) {
+	ca, enroller, w := newTestEnroller(t)
+	_, err := enroller.RegisterAndEnroll("farmer-ravi", RegistrationRequest{EnrollmentID: "ravi"})
+	require.NoError(t, err)
+	certPEM, keyPEM := newTestCertificate(t, "priya")
+	_, err = w.Import("lab-priya", "Org1MSP", certPEM, keyPEM)
+	require.NoError(t, err)
+
+	entry, err := enroller.Revoke("farmer-ravi", "left the cooperative")
+	require.NoError(t, err)
+	require.Equal(t, StatusRevoked, entry.Status)
+	require.Equal(t, "left the cooperative", ca.revokedIDs["ravi"])
+
+	_, err = enroller.Revoke("lab-priya", "key lost")
+	require.NoError(t, err)
+	require.NotContains(t, ca.revokedIDs, "lab-priya", "imported identities are only revoked in the wallet")
+
+	_, err = enroller.Revoke("farmer-ravi", "")
+	require.ErrorIs(t, err, ErrRevoked)
+}
@@ -0,0 +1,129 @@
+package wallet
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by a Store for a subject without a record
+var ErrNotFound = errors.New("identity not found")
+
+// Record is a wallet entry as persisted by a Store. The private key is only ever
+// stored encrypted.
+type Record struct {
+	Subject          string     `json:"subject"`
+	MSPID            string     `json:"mspId"`
+	Certificate      string     `json:"certificate"`  // PEM
+	EncryptedKey     []byte     `json:"encryptedKey"` // AES-256-GCM nonce and sealed PEM PKCS#8 private key
+	EnrollmentID     string     `json:"enrollmentId,omitempty"`
+	Source           string     `json:"source"` // SourceImported or SourceEnrolled
+	Status           string     `json:"status"` // StatusActive or StatusRevoked
+	CreatedAt        time.Time  `json:"createdAt"`
+	RotatedAt        *time.Time `json:"rotatedAt,omitempty"`
+	RevokedAt        *time.Time `json:"revokedAt,omitempty"`
+	RevocationReason string     `json:"revocationReason,omitempty"`
+}
+
+// Store persists wallet records by subject
+type Store interface {
+	Get(subject string) (*Record, error)
+	Put(record *Record) error
+	List() ([]*Record, error)
+}
+
+// FileStore keeps one JSON file per record in a directory readable by the owner only
+type FileStore struct {
+	directory string
+}
+
+// NewFileStore opens the wallet directory, creating it when it does not exist
+func NewFileStore(directory string) (*FileStore, error) {
+	err := os.MkdirAll(directory, 0o700)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create wallet directory: %v", err)
+	}
+	return &FileStore{directory: directory}, nil
+}
+
+// file names are the hex encoded subject, as subjects may contain any character
+func (fs *FileStore) path(subject string) string {
+	return filepath.Join(fs.directory, hex.EncodeToString([]byte(subject))+".id")
+}
+
+// Get reads the record of a subject
+func (fs *FileStore) Get(subject string) (*Record, error) {
+	data, err := os.ReadFile(fs.path(subject))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var record Record
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, fmt.Errorf("failed to parse wallet record of %s: %v", subject, err)
+	}
+	return &record, nil
+}
+
+// Put writes a record, replacing any previous record of its subject atomically
+func (fs *FileStore) Put(record *Record) error {
+	data, err := json.MarshalIndent(record, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	temp, err := os.CreateTemp(fs.directory, ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to write wallet record: %v", err)
+	}
+	defer os.Remove(temp.Name())
+
+	if _, err := temp.Write(data); err != nil {
+		temp.Close()
+		return fmt.Errorf("failed to write wallet record: %v", err)
+	}
+	if err := temp.Close(); err != nil {
+		return fmt.Errorf("failed to write wallet record: %v", err)
+	}
+
+	return os.Rename(temp.Name(), fs.path(record.Subject))
+}
+
+// List reads every record, ordered by subject
+func (fs *FileStore) List() ([]*Record, error) {
+	entries, err := os.ReadDir(fs.directory)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []*Record{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".id") {
+			continue
+		}
+		subject, err := hex.DecodeString(strings.TrimSuffix(name, ".id"))
+		if err != nil {
+			continue
+		}
+		record, err := fs.Get(string(subject))
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Subject < records[j].Subject
+	})
+
+	return records, nil
+}
@@ -0,0 +1,339 @@
+// Package wallet holds the enrolled X.509 identities the API signs transactions with
+// on behalf of its users. Private keys are encrypted at rest with a master key, and
+// identities can be enrolled against a Fabric CA, rotated and revoked.
+package wallet
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"herb-api/auth"
+	"herb-api/services"
+)
+
+// Record sources
+const (
+	SourceImported = "imported" // certificate and key supplied by an administrator
+	SourceEnrolled = "enrolled" // enrolled against the Fabric CA by the API
+)
+
+// Record statuses
+const (
+	StatusActive  = "active"
+	StatusRevoked = "revoked"
+)
+
+// MasterKeySize is the size in bytes of the AES-256 master key
+const MasterKeySize = 32
+
+// Wallet errors
+var (
+	ErrExists  = errors.New("an active identity already exists for the subject")
+	ErrRevoked = errors.New("the identity has been revoked")
+)
+
+// Entry describes a wallet identity without its private key
+type Entry struct {
+	Subject          string     `json:"subject"`
+	MSPID            string     `json:"mspId"`
+	EnrollmentID     string     `json:"enrollmentId,omitempty"`
+	Source           string     `json:"source"`
+	Status           string     `json:"status"`
+	CommonName       string     `json:"commonName"`
+	SerialNumber     string     `json:"serialNumber"`
+	NotAfter         time.Time  `json:"notAfter"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	RotatedAt        *time.Time `json:"rotatedAt,omitempty"`
+	RevokedAt        *time.Time `json:"revokedAt,omitempty"`
+	RevocationReason string     `json:"revocationReason,omitempty"`
+}
+
+// Wallet encrypts identities into a Store and serves them to the API as an
+// auth.IdentityStore
+type Wallet struct {
+	mu    sync.Mutex
+	store Store
+	aead  cipher.AEAD
+	cache map[string]*services.Identity
+}
+
+// New opens a wallet over store. Every record is decrypted once so that a wrong
+// master key is reported at startup rather than on a user's first request.
+func New(store Store, masterKey []byte) (*Wallet, error) {
+	if len(masterKey) != MasterKeySize {
+		return nil, fmt.Errorf("the wallet master key must be %d bytes, got %d", MasterKeySize, len(masterKey))
+	}
+	block, err := aes.NewCipher(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Wallet{store: store, aead: aead, cache: map[string]*services.Identity{}}
+
+	records, err := store.List()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read wallet: %v", err)
+	}
+	for _, record := range records {
+		if _, err := w.decrypt(record); err != nil {
+			return nil, fmt.Errorf("failed to open the identity of %s, is the master key right? %v", record.Subject, err)
+		}
+	}
+
+	return w, nil
+}
+
+// LoadMasterKey reads a master key given as base64 text, or from a file holding the
+// raw key or its base64 encoding
+func LoadMasterKey(encoded string, path string) ([]byte, error) {
+	if encoded == "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read wallet master key: %v", err)
+		}
+		if len(data) == MasterKeySize {
+			return data, nil
+		}
+		encoded = strings.TrimSpace(string(data))
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("the wallet master key is not base64: %v", err)
+	}
+	if len(key) != MasterKeySize {
+		return nil, fmt.Errorf("the wallet master key must be %d bytes, got %d", MasterKeySize, len(key))
+	}
+	return key, nil
+}
+
+// Identity returns the active identity of a subject, implementing auth.IdentityStore
+func (w *Wallet) Identity(subject string) (*services.Identity, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if identity, ok := w.cache[subject]; ok {
+		return identity, nil
+	}
+
+	record, err := w.store.Get(subject)
+	if errors.Is(err, ErrNotFound) {
+		return nil, auth.ErrNoIdentity
+	}
+	if err != nil {
+		return nil, err
+	}
+	if record.Status == StatusRevoked {
+		return nil, fmt.Errorf("%w: %v", auth.ErrNoIdentity, ErrRevoked)
+	}
+
+	identity, err := w.decrypt(record)
+	if err != nil {
+		return nil, err
+	}
+	w.cache[subject] = identity
+
+	return identity, nil
+}
+
+// List describes every identity in the wallet, ordered by subject
+func (w *Wallet) List() ([]*Entry, error) {
+	records, err := w.store.List()
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []*Entry{}
+	for _, record := range records {
+		entry, err := describe(record)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Get describes the identity of a subject
+func (w *Wallet) Get(subject string) (*Entry, error) {
+	record, err := w.store.Get(subject)
+	if err != nil {
+		return nil, err
+	}
+	return describe(record)
+}
+
+// Import adds an identity from its PEM certificate and PEM PKCS#8 private key. A
+// revoked identity of the same subject is replaced; an active one is not.
+func (w *Wallet) Import(subject string, mspID string, certPEM []byte, keyPEM []byte) (*Entry, error) {
+	return w.add(subject, mspID, certPEM, keyPEM, SourceImported, "")
+}
+
+func (w *Wallet) add(subject string, mspID string, certPEM []byte, keyPEM []byte, source string, enrollmentID string) (*Entry, error) {
+	if subject == "" || mspID == "" {
+		return nil, fmt.Errorf("a subject and MSP ID are required")
+	}
+	identity, err := services.NewIdentity(mspID, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	existing, err := w.store.Get(subject)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if existing != nil && existing.Status == StatusActive {
+		return nil, ErrExists
+	}
+
+	encryptedKey, err := w.encrypt(subject, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	record := &Record{
+		Subject:      subject,
+		MSPID:        mspID,
+		Certificate:  string(identity.CertificatePEM),
+		EncryptedKey: encryptedKey,
+		EnrollmentID: enrollmentID,
+		Source:       source,
+		Status:       StatusActive,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := w.store.Put(record); err != nil {
+		return nil, err
+	}
+	w.cache[subject] = identity
+
+	return describe(record)
+}
+
+// Rotate replaces the certificate and private key of an active identity
+func (w *Wallet) Rotate(subject string, certPEM []byte, keyPEM []byte) (*Entry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	record, err := w.store.Get(subject)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status == StatusRevoked {
+		return nil, ErrRevoked
+	}
+
+	identity, err := services.NewIdentity(record.MSPID, certPEM, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+	encryptedKey, err := w.encrypt(subject, keyPEM)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	record.Certificate = string(identity.CertificatePEM)
+	record.EncryptedKey = encryptedKey
+	record.RotatedAt = &now
+	if err := w.store.Put(record); err != nil {
+		return nil, err
+	}
+	w.cache[subject] = identity
+
+	return describe(record)
+}
+
+// Revoke marks an identity as revoked so that its user can no longer act on the
+// ledger. The record is kept for audit.
+func (w *Wallet) Revoke(subject string, reason string) (*Entry, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	record, err := w.store.Get(subject)
+	if err != nil {
+		return nil, err
+	}
+	if record.Status == StatusRevoked {
+		return nil, ErrRevoked
+	}
+
+	now := time.Now().UTC()
+	record.Status = StatusRevoked
+	record.RevokedAt = &now
+	record.RevocationReason = reason
+	if err := w.store.Put(record); err != nil {
+		return nil, err
+	}
+	delete(w.cache, subject)
+
+	return describe(record)
+}
+
+// encrypt seals a private key, binding the ciphertext to its subject so that it
+// cannot be swapped into another user's record
+func (w *Wallet) encrypt(subject string, keyPEM []byte) ([]byte, error) {
+	nonce := make([]byte, w.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return w.aead.Seal(nonce, nonce, keyPEM, []byte(subject)), nil
+}
+
+func (w *Wallet) decrypt(record *Record) (*services.Identity, error) {
+	nonceSize := w.aead.NonceSize()
+	if len(record.EncryptedKey) < nonceSize {
+		return nil, fmt.Errorf("the encrypted private key is truncated")
+	}
+	keyPEM, err := w.aead.Open(nil, record.EncryptedKey[:nonceSize], record.EncryptedKey[nonceSize:], []byte(record.Subject))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt private key: %v", err)
+	}
+
+	return services.NewIdentity(record.MSPID, []byte(record.Certificate), keyPEM)
+}
+
+func describe(record *Record) (*Entry, error) {
+	certificate, err := parseCertificate([]byte(record.Certificate))
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate of %s: %v", record.Subject, err)
+	}
+
+	return &Entry{
+		Subject:          record.Subject,
+		MSPID:            record.MSPID,
+		EnrollmentID:     record.EnrollmentID,
+		Source:           record.Source,
+		Status:           record.Status,
+		CommonName:       certificate.Subject.CommonName,
+		SerialNumber:     certificate.SerialNumber.Text(16),
+		NotAfter:         certificate.NotAfter,
+		CreatedAt:        record.CreatedAt,
+		RotatedAt:        record.RotatedAt,
+		RevokedAt:        record.RevokedAt,
+		RevocationReason: record.RevocationReason,
+	}, nil
+}
+
+func parseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
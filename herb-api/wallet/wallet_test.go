@@ -0,0 +1,212 @@
+package wallet
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"herb-api/auth"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newMasterKey(t *testing.T) []byte {
+	t.Helper()
+
+	key := make([]byte, MasterKeySize)
+	_, err := rand.Read(key)
+	require.NoError(t, err)
+	return key
+}
+
+// newTestCertificate returns a self-signed PEM certificate for name and its PEM
+// PKCS#8 private key
+func newTestCertificate(t *testing.T, name string) ([]byte, []byte) {
+	t.Helper()
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &privateKey.PublicKey, privateKey)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	require.NoError(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+}
+
+func newTestWallet(t *testing.T) (*Wallet, *FileStore, []byte) {
+	t.Helper()
+
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "wallet"))
+	require.NoError(t, err)
+	masterKey := newMasterKey(t)
+	w, err := New(store, masterKey)
+	require.NoError(t, err)
+	return w, store, masterKey
+}
+
+func TestWalletEncryptsPrivateKeys(t *testing.T) {
+	w, store, masterKey := newTestWallet(t)
+	certPEM, keyPEM := newTestCertificate(t, "ravi")
+
+	entry, err := w.Import("farmer-ravi", "Org1MSP", certPEM, keyPEM)
+	require.NoError(t, err)
+	require.Equal(t, SourceImported, entry.Source)
+	require.Equal(t, StatusActive, entry.Status)
+	require.Equal(t, "ravi", entry.CommonName)
+
+	record, err := store.Get("farmer-ravi")
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(record.EncryptedKey, keyPEM), "the private key must not be stored in the clear")
+	files, err := os.ReadDir(store.directory)
+	require.NoError(t, err)
+	for _, file := range files {
+		data, err := os.ReadFile(filepath.Join(store.directory, file.Name()))
+		require.NoError(t, err)
+		require.NotContains(t, string(data), "PRIVATE KEY")
+	}
+
+	// a wallet reopened with the same master key decrypts the identity
+	reopened, err := New(store, masterKey)
+	require.NoError(t, err)
+	identity, err := reopened.Identity("farmer-ravi")
+	require.NoError(t, err)
+	require.Equal(t, "Org1MSP", identity.MSPID)
+	_, err = identity.Sign([]byte("proposal"))
+	require.NoError(t, err)
+
+	_, err = New(store, newMasterKey(t))
+	require.ErrorContains(t, err, "is the master key right?")
+}
+
+func TestWalletBindsKeysToTheirSubject(t *testing.T) {
+	w, store, masterKey := newTestWallet(t)
+	ravi, raviKey := newTestCertificate(t, "ravi")
+	priya, priyaKey := newTestCertificate(t, "priya")
+	_, err := w.Import("farmer-ravi", "Org1MSP", ravi, raviKey)
+	require.NoError(t, err)
+	_, err = w.Import("lab-priya", "Org1MSP", priya, priyaKey)
+	require.NoError(t, err)
+
+	// copying another user's encrypted key and certificate into a record does not
+	// let its subject use them
+	stolen, err := store.Get("lab-priya")
+	require.NoError(t, err)
+	stolen.Subject = "farmer-ravi"
+	require.NoError(t, store.Put(stolen))
+
+	_, err = New(store, masterKey)
+	require.ErrorContains(t, err, "failed to open the identity of farmer-ravi")
+}
+
+func TestWalletImport(t *testing.T) {
+	w, _, _ := newTestWallet(t)
+	certPEM, keyPEM := newTestCertificate(t, "ravi")
+	_, otherKeyPEM := newTestCertificate(t, "priya")
+
+	_, err := w.Import("farmer-ravi", "Org1MSP", certPEM, otherKeyPEM)
+	require.ErrorContains(t, err, "does not match")
+	_, err = w.Import("", "Org1MSP", certPEM, keyPEM)
+	require.Error(t, err)
+
+	_, err = w.Import("farmer-ravi", "Org1MSP", certPEM, keyPEM)
+	require.NoError(t, err)
+	_, err = w.Import("farmer-ravi", "Org1MSP", certPEM, keyPEM)
+	require.ErrorIs(t, err, ErrExists)
+
+	_, err = w.Identity("lab-priya")
+	require.Equal(t, auth.ErrNoIdentity, err)
+}
+
+func TestWalletRotate(t *testing.T) {
+	w, _, _ := newTestWallet(t)
+	certPEM, keyPEM := newTestCertificate(t, "ravi")
+	before, err := w.Import("farmer-ravi", "Org1MSP", certPEM, keyPEM)
+	require.NoError(t, err)
+
+	newCertPEM, newKeyPEM := newTestCertificate(t, "ravi")
+	after, err := w.Rotate("farmer-ravi", newCertPEM, newKeyPEM)
+	require.NoError(t, err)
+	require.NotEqual(t, before.SerialNumber, after.SerialNumber)
+	require.NotNil(t, after.RotatedAt)
+
+	identity, err := w.Identity("farmer-ravi")
+	require.NoError(t, err)
+	require.Equal(t, newCertPEM, identity.CertificatePEM, "the cached identity is replaced")
+
+	_, err = w.Rotate("farmer-ravi", certPEM, newKeyPEM)
+	require.Error(t, err)
+	_, err = w.Rotate("lab-priya", newCertPEM, newKeyPEM)
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestWalletRevoke(t *testing.T) {
+	w, _, _ := newTestWallet(t)
+	certPEM, keyPEM := newTestCertificate(t, "ravi")
+	_, err := w.Import("farmer-ravi", "Org1MSP", certPEM, keyPEM)
+	require.NoError(t, err)
+	_, err = w.Identity("farmer-ravi")
+	require.NoError(t, err)
+
+	entry, err := w.Revoke("farmer-ravi", "left the cooperative")
+	require.NoError(t, err)
+	require.Equal(t, StatusRevoked, entry.Status)
+	require.Equal(t, "left the cooperative", entry.RevocationReason)
+
+	_, err = w.Identity("farmer-ravi")
+	require.True(t, errors.Is(err, auth.ErrNoIdentity))
+	require.NotEqual(t, auth.ErrNoIdentity, err, "a revoked identity must not fall through to other identity stores")
+
+	_, err = w.Revoke("farmer-ravi", "")
+	require.ErrorIs(t, err, ErrRevoked)
+	newCertPEM, newKeyPEM := newTestCertificate(t, "ravi")
+	_, err = w.Rotate("farmer-ravi", newCertPEM, newKeyPEM)
+	require.ErrorIs(t, err, ErrRevoked)
+
+	// a revoked subject may be given a new identity
+	_, err = w.Import("farmer-ravi", "Org1MSP", newCertPEM, newKeyPEM)
+	require.NoError(t, err)
+}
+
+func TestLoadMasterKey(t *testing.T) {
+	key := newMasterKey(t)
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	loaded, err := LoadMasterKey(encoded, "")
+	require.NoError(t, err)
+	require.Equal(t, key, loaded)
+
+	dir := t.TempDir()
+	rawPath := filepath.Join(dir, "raw.key")
+	require.NoError(t, os.WriteFile(rawPath, key, 0600))
+	loaded, err = LoadMasterKey("", rawPath)
+	require.NoError(t, err)
+	require.Equal(t, key, loaded)
+
+	encodedPath := filepath.Join(dir, "encoded.key")
+	require.NoError(t, os.WriteFile(encodedPath, []byte(encoded+"\n"), 0600))
+	loaded, err = LoadMasterKey("", encodedPath)
+	require.NoError(t, err)
+	require.Equal(t, key, loaded)
+
+	_, err = LoadMasterKey(base64.StdEncoding.EncodeToString(key[:16]), "")
+	require.ErrorContains(t, err, "must be 32 bytes")
+}
@@ -6,18 +6,105 @@ package main
 
 import (
 	"log"
+	"os"
+	"strconv"
+	"strings"
 
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
 )
 
+type serverConfig struct {
+	CCID    string
+	Address string
+}
+
 func main() {
 	assetChaincode, err := contractapi.NewChaincode(&chaincode.SmartContract{})
 	if err != nil {
 		log.Panicf("Error creating asset-transfer-basic chaincode: %v", err)
 	}
 
-	if err := assetChaincode.Start(); err != nil {
-		log.Panicf("Error starting asset-transfer-basic chaincode: %v", err)
+	config := serverConfig{
+		CCID:    os.Getenv("CHAINCODE_ID"),
+		Address: os.Getenv("CHAINCODE_SERVER_ADDRESS"),
+	}
+
+	// Without a server address the peer launches the chaincode and we dial back to it
+	if config.Address == "" {
+		if err := assetChaincode.Start(); err != nil {
+			log.Panicf("Error starting asset-transfer-basic chaincode: %v", err)
+		}
+		return
+	}
+
+	if config.CCID == "" {
+		log.Panicf("CHAINCODE_ID must be set when CHAINCODE_SERVER_ADDRESS is set")
+	}
+
+	server := &shim.ChaincodeServer{
+		CCID:     config.CCID,
+		Address:  config.Address,
+		CC:       assetChaincode,
+		TLSProps: getTLSProperties(),
+	}
+
+	log.Printf("Starting asset-transfer-basic chaincode server on %s", config.Address)
+	if err := server.Start(); err != nil {
+		log.Panicf("Error starting asset-transfer-basic chaincode server: %v", err)
+	}
+}
+
+// getTLSProperties builds the chaincode server TLS settings from the environment.
+// TLS stays disabled unless CHAINCODE_TLS_DISABLED is "false". The key, certificate
+// and client CA variables hold either PEM content or the path of a PEM file.
+func getTLSProperties() shim.TLSProperties {
+	tlsDisabled, err := strconv.ParseBool(getEnvOrDefault("CHAINCODE_TLS_DISABLED", "true"))
+	if err != nil {
+		log.Panicf("Invalid CHAINCODE_TLS_DISABLED value: %v", err)
+	}
+	if tlsDisabled {
+		return shim.TLSProperties{Disabled: true}
+	}
+
+	key := loadPEM("CHAINCODE_TLS_KEY")
+	cert := loadPEM("CHAINCODE_TLS_CERT")
+	if key == nil || cert == nil {
+		log.Panicf("CHAINCODE_TLS_KEY and CHAINCODE_TLS_CERT must be set when TLS is enabled")
+	}
+
+	return shim.TLSProperties{
+		Disabled:      false,
+		Key:           key,
+		Cert:          cert,
+		ClientCACerts: loadPEM("CHAINCODE_CLIENT_CA_CERT"),
+	}
+}
+
+// loadPEM returns the PEM content named by the environment variable, reading it from
+// a file unless the variable holds the PEM itself. It returns nil if the variable is unset.
+func loadPEM(name string) []byte {
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	if strings.HasPrefix(strings.TrimSpace(value), "-----BEGIN") {
+		return []byte(value)
+	}
+
+	content, err := os.ReadFile(value)
+	if err != nil {
+		log.Panicf("Error reading %s from %s: %v", name, value, err)
+	}
+
+	return content
+}
+
+func getEnvOrDefault(env, defaultVal string) string {
+	value, ok := os.LookupEnv(env)
+	if !ok {
+		value = defaultVal
 	}
+	return value
 }
@@ -0,0 +1,337 @@
+package chaincode
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	deviceKeyObjectType   = "devicekey"
+	attestationObjectType = "attestation"
+)
+
+// Device key algorithms
+const (
+	AlgorithmECDSAP256 = "ECDSA-P256"
+	AlgorithmEd25519   = "Ed25519"
+)
+
+// DeviceKey is the public key of a farmer's mobile device used to sign harvest
+// records captured in the field. The key is bound to the client identity that
+// registered it, RegisteredBy of organisation RegisteredOrg.
+type DeviceKey struct {
+	ID            string `json:"ID"`
+	Algorithm     string `json:"algorithm"`
+	Farmer        string `json:"farmer"`
+	PublicKey     string `json:"publicKey"` // base64 encoded DER SubjectPublicKeyInfo
+	RegisteredAt  string `json:"registeredAt"`
+	RegisteredBy  string `json:"registeredBy"`
+	RegisteredOrg string `json:"registeredOrg"`
+	Revoked       bool   `json:"revoked"`
+}
+
+// HarvestClaim is the harvest data a farmer's device signs. Its canonical form is
+// the compact JSON encoding of this struct: keys in the order below, no insignificant
+// whitespace, no HTML escaping and numbers in shortest round-trip form.
+type HarvestClaim struct {
+	ID            string  `json:"ID"`
+	BotanicalName string  `json:"botanicalName"`
+	Farm          string  `json:"farm"`
+	HarvestDate   string  `json:"harvestDate"`
+	Owner         string  `json:"owner"`
+	Quantity      float64 `json:"quantity"`
+	Region        string  `json:"region"`
+}
+
+// HarvestAttestation stores the verified device signature over a herb batch's
+// harvest data
+type HarvestAttestation struct {
+	BatchID     string `json:"batchId"`
+	DeviceKeyID string `json:"deviceKeyId"`
+	Payload     string `json:"payload"`
+	Signature   string `json:"signature"` // base64 encoded
+	VerifiedAt  string `json:"verifiedAt"`
+}
+
+// RegisterDeviceKey registers the public key of a farmer's device. publicKey is a
+// base64 encoded DER SubjectPublicKeyInfo holding an ECDSA P-256 or Ed25519 key.
+// The key is bound to the submitting client, so farmers register their own devices
+// and only harvests they submit themselves can be attested with them.
+func (s *SmartContract) RegisterDeviceKey(ctx contractapi.TransactionContextInterface, keyID string, farmer string, algorithm string, publicKey string) error {
+	if keyID == "" || farmer == "" {
+		return validationError("a key ID and farmer are required")
+	}
+	if _, err := parseDevicePublicKey(algorithm, publicKey); err != nil {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(deviceKeyObjectType, []string{keyID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return internalError("failed to read from world state: %v", err)
+	}
+	if existing != nil {
+		return alreadyExistsError("the device key %s already exists", keyID)
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return internalError("failed to get client identity: %v", err)
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return internalError("failed to get client MSP ID: %v", err)
+	}
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	deviceKey := DeviceKey{
+		ID:            keyID,
+		Algorithm:     algorithm,
+		Farmer:        farmer,
+		PublicKey:     publicKey,
+		RegisteredAt:  now,
+		RegisteredBy:  clientID,
+		RegisteredOrg: mspID,
+	}
+
+	return putDeviceKey(ctx, &deviceKey)
+}
+
+// ReadDeviceKey returns the device key registered with given id
+func (s *SmartContract) ReadDeviceKey(ctx contractapi.TransactionContextInterface, keyID string) (*DeviceKey, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(deviceKeyObjectType, []string{keyID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+
+	deviceKeyJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if deviceKeyJSON == nil {
+		return nil, notFoundError("the device key %s does not exist", keyID)
+	}
+
+	var deviceKey DeviceKey
+	err = json.Unmarshal(deviceKeyJSON, &deviceKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &deviceKey, nil
+}
+
+// RevokeDeviceKey stops a device key from attesting further harvests, e.g. when the
+// phone is lost. Only the registering client or an admin of its organisation may
+// revoke a key, and attestations already recorded remain valid.
+func (s *SmartContract) RevokeDeviceKey(ctx contractapi.TransactionContextInterface, keyID string) error {
+	deviceKey, err := s.ReadDeviceKey(ctx, keyID)
+	if err != nil {
+		return err
+	}
+
+	registrant, err := isDeviceKeyRegistrant(ctx, deviceKey)
+	if err != nil {
+		return err
+	}
+	if !registrant {
+		mspID, err := ctx.GetClientIdentity().GetMSPID()
+		if err != nil {
+			return internalError("failed to get client MSP ID: %v", err)
+		}
+		if mspID != deviceKey.RegisteredOrg {
+			return forbiddenError("only the organisation that registered device key %s may revoke it", keyID)
+		}
+		err = requireAdmin(ctx)
+		if err != nil {
+			return err
+		}
+	}
+
+	deviceKey.Revoked = true
+
+	return putDeviceKey(ctx, deviceKey)
+}
+
+// GetHarvestAttestation returns the device attestation recorded for a herb batch
+func (s *SmartContract) GetHarvestAttestation(ctx contractapi.TransactionContextInterface, batchID string) (*HarvestAttestation, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(attestationObjectType, []string{batchID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+
+	attestationJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if attestationJSON == nil {
+		return nil, notFoundError("the herb batch %s has no harvest attestation", batchID)
+	}
+
+	var attestation HarvestAttestation
+	err = json.Unmarshal(attestationJSON, &attestation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &attestation, nil
+}
+
+// attestHarvest verifies the device signature over the canonical harvest claim of a
+// new herb batch and stores it. The device key must belong to the batch owner and
+// have been registered by the submitting client.
+func (s *SmartContract) attestHarvest(ctx contractapi.TransactionContextInterface, claim HarvestClaim, deviceKeyID string, signature string) error {
+	deviceKey, err := s.ReadDeviceKey(ctx, deviceKeyID)
+	if err != nil {
+		return err
+	}
+	if deviceKey.Revoked {
+		return forbiddenError("the device key %s has been revoked", deviceKeyID)
+	}
+	registrant, err := isDeviceKeyRegistrant(ctx, deviceKey)
+	if err != nil {
+		return err
+	}
+	if !registrant {
+		return forbiddenError("the device key %s was registered by another client", deviceKeyID)
+	}
+	if deviceKey.Farmer != claim.Owner {
+		return forbiddenError("the device key %s belongs to %s, not the batch owner %s", deviceKeyID, deviceKey.Farmer, claim.Owner)
+	}
+
+	payload, err := canonicalHarvestClaim(claim)
+	if err != nil {
+		return err
+	}
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return validationError("the signature is not valid base64: %v", err)
+	}
+
+	publicKey, err := parseDevicePublicKey(deviceKey.Algorithm, deviceKey.PublicKey)
+	if err != nil {
+		return err
+	}
+	if !verifyDeviceSignature(publicKey, payload, signatureBytes) {
+		return validationError("the signature of device key %s does not match the harvest data of herb batch %s", deviceKeyID, claim.ID)
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	attestation := HarvestAttestation{
+		BatchID:     claim.ID,
+		DeviceKeyID: deviceKeyID,
+		Payload:     string(payload),
+		Signature:   signature,
+		VerifiedAt:  now,
+	}
+	attestationJSON, err := json.Marshal(attestation)
+	if err != nil {
+		return err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(attestationObjectType, []string{claim.ID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(key, attestationJSON)
+}
+
+// canonicalHarvestClaim returns the exact bytes a device signs for a harvest claim
+func canonicalHarvestClaim(claim HarvestClaim) ([]byte, error) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(claim); err != nil {
+		return nil, err
+	}
+
+	return bytes.TrimRight(buffer.Bytes(), "\n"), nil
+}
+
+// parseDevicePublicKey decodes a device public key and checks it matches the algorithm
+func parseDevicePublicKey(algorithm string, publicKey string) (interface{}, error) {
+	der, err := base64.StdEncoding.DecodeString(publicKey)
+	if err != nil {
+		return nil, validationError("the public key is not valid base64: %v", err)
+	}
+	parsed, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, validationError("failed to parse public key: %v", err)
+	}
+
+	switch key := parsed.(type) {
+	case *ecdsa.PublicKey:
+		if algorithm != AlgorithmECDSAP256 || key.Curve != elliptic.P256() {
+			return nil, validationError("the public key does not match algorithm %s", algorithm)
+		}
+	case ed25519.PublicKey:
+		if algorithm != AlgorithmEd25519 {
+			return nil, validationError("the public key does not match algorithm %s", algorithm)
+		}
+	default:
+		return nil, validationError("unsupported public key type %T", parsed)
+	}
+
+	return parsed, nil
+}
+
+// verifyDeviceSignature checks a signature over payload. ECDSA signatures are ASN.1
+// DER encoded over the SHA-256 digest; Ed25519 signatures are over the payload itself.
+func verifyDeviceSignature(publicKey interface{}, payload []byte, signature []byte) bool {
+	switch key := publicKey.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(payload)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, payload, signature)
+	default:
+		return false
+	}
+}
+
+// isDeviceKeyRegistrant returns true when the submitting client is the identity that
+// registered the device key
+func isDeviceKeyRegistrant(ctx contractapi.TransactionContextInterface, deviceKey *DeviceKey) (bool, error) {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return false, internalError("failed to get client identity: %v", err)
+	}
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, internalError("failed to get client MSP ID: %v", err)
+	}
+
+	return clientID == deviceKey.RegisteredBy && mspID == deviceKey.RegisteredOrg, nil
+}
+
+func putDeviceKey(ctx contractapi.TransactionContextInterface, deviceKey *DeviceKey) error {
+	key, err := ctx.GetStub().CreateCompositeKey(deviceKeyObjectType, []string{deviceKey.ID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	deviceKeyJSON, err := json.Marshal(deviceKey)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, deviceKeyJSON)
+}
@@ -0,0 +1,149 @@
+package chaincode_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func testHarvestClaim(id string) chaincode.HarvestClaim {
+	return chaincode.HarvestClaim{
+		ID:            id,
+		BotanicalName: "Withania somnifera",
+		Farm:          "Test Farm",
+		HarvestDate:   "2024-08-15",
+		Owner:         "Ravi Sharma",
+		Quantity:      12.5,
+		Region:        "Kerala",
+	}
+}
+
+func (n *testNetwork) registerDeviceKey(keyID string, farmer string, algorithm string, publicKey []byte) error {
+	return n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RegisterDeviceKey(ctx, keyID, farmer, algorithm, base64.StdEncoding.EncodeToString(publicKey))
+	})
+}
+
+func (n *testNetwork) createAttestedHerbBatch(claim chaincode.HarvestClaim, deviceKeyID string, signature []byte) error {
+	return n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CreateHerbBatch(ctx, claim.ID, claim.BotanicalName, claim.Farm, claim.HarvestDate, claim.Owner, chaincode.StatusHarvested, claim.Region, claim.Quantity, deviceKeyID, base64.StdEncoding.EncodeToString(signature))
+	})
+}
+
+func canonicalClaim(t *testing.T, claim chaincode.HarvestClaim) []byte {
+	payload, err := json.Marshal(claim)
+	require.NoError(t, err)
+	return payload
+}
+
+func TestEd25519HarvestAttestation(t *testing.T) {
+	n := newTestNetwork(t)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+
+	require.NoError(t, n.registerDeviceKey("phone1", "Ravi Sharma", chaincode.AlgorithmEd25519, publicKeyDER))
+	requireCode(t, n.registerDeviceKey("phone1", "Ravi Sharma", chaincode.AlgorithmEd25519, publicKeyDER), chaincode.CodeAlreadyExists)
+	requireCode(t, n.registerDeviceKey("phone2", "Ravi Sharma", chaincode.AlgorithmECDSAP256, publicKeyDER), chaincode.CodeValidation)
+
+	claim := testHarvestClaim("batch1")
+	payload := canonicalClaim(t, claim)
+	signature := ed25519.Sign(privateKey, payload)
+
+	tampered := claim
+	tampered.Quantity = 125
+	requireCode(t, n.createAttestedHerbBatch(tampered, "phone1", signature), chaincode.CodeValidation)
+
+	otherOwner := testHarvestClaim("batch2")
+	otherOwner.Owner = "Priya Patel"
+	requireCode(t, n.createAttestedHerbBatch(otherOwner, "phone1", ed25519.Sign(privateKey, canonicalClaim(t, otherOwner))), chaincode.CodeForbidden)
+
+	// the key only attests harvests submitted by the client that registered it
+	clerk := newIdentity(t, org1MSP, "clerk", []string{"client"}, nil)
+	err = n.submit(clerk, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CreateHerbBatch(ctx, claim.ID, claim.BotanicalName, claim.Farm, claim.HarvestDate, claim.Owner, chaincode.StatusHarvested, claim.Region, claim.Quantity, "phone1", base64.StdEncoding.EncodeToString(signature))
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	require.NoError(t, n.createAttestedHerbBatch(claim, "phone1", signature))
+
+	var attestation *chaincode.HarvestAttestation
+	err = n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		attestation, err = n.contract.GetHarvestAttestation(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, string(payload), attestation.Payload)
+	require.Equal(t, "phone1", attestation.DeviceKeyID)
+
+	n.mustCreateHerbBatch("batch3", "Curcuma longa", "Kerala", "2024-08-20", 10)
+	err = n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.GetHarvestAttestation(ctx, "batch3")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+}
+
+func TestECDSAHarvestAttestation(t *testing.T) {
+	n := newTestNetwork(t)
+
+	privateKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(&privateKey.PublicKey)
+	require.NoError(t, err)
+	require.NoError(t, n.registerDeviceKey("phone1", "Ravi Sharma", chaincode.AlgorithmECDSAP256, publicKeyDER))
+
+	claim := testHarvestClaim("batch1")
+	digest := sha256.Sum256(canonicalClaim(t, claim))
+	signature, err := ecdsa.SignASN1(rand.Reader, privateKey, digest[:])
+	require.NoError(t, err)
+
+	require.NoError(t, n.createAttestedHerbBatch(claim, "phone1", signature))
+}
+
+func TestRevokeDeviceKey(t *testing.T) {
+	n := newTestNetwork(t)
+
+	publicKey, privateKey, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	publicKeyDER, err := x509.MarshalPKIXPublicKey(publicKey)
+	require.NoError(t, err)
+	require.NoError(t, n.registerDeviceKey("phone1", "Ravi Sharma", chaincode.AlgorithmEd25519, publicKeyDER))
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RevokeDeviceKey(ctx, "phone1")
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	org2Admin := newIdentity(t, org2MSP, "admin", []string{"admin"}, map[string]string{"hf.Type": "admin"})
+	err = n.submit(org2Admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RevokeDeviceKey(ctx, "phone1")
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RevokeDeviceKey(ctx, "phone1")
+	})
+	require.NoError(t, err)
+
+	claim := testHarvestClaim("batch1")
+	signature := ed25519.Sign(privateKey, canonicalClaim(t, claim))
+	requireCode(t, n.createAttestedHerbBatch(claim, "phone1", signature), chaincode.CodeForbidden)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RevokeDeviceKey(ctx, "missing")
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+}
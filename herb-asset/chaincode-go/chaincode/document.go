@@ -0,0 +1,235 @@
+package chaincode
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	documentObjectType      = "document"
+	documentDigestIndexName = "document~digest"
+)
+
+// Off-chain document types
+const (
+	DocumentLabReport                = "LabReport"
+	DocumentHarvestPhoto             = "HarvestPhoto"
+	DocumentInvoice                  = "Invoice"
+	DocumentPhytosanitaryCertificate = "PhytosanitaryCertificate"
+	DocumentOther                    = "Other"
+)
+
+var validDocumentTypes = map[string]bool{
+	DocumentLabReport:                true,
+	DocumentHarvestPhoto:             true,
+	DocumentInvoice:                  true,
+	DocumentPhytosanitaryCertificate: true,
+	DocumentOther:                    true,
+}
+
+// DocumentAnchor proves the content of an off-chain document attached to a herb
+// batch through its SHA-256 digest, and records who anchored it
+type DocumentAnchor struct {
+	AnchoredAt   string `json:"anchoredAt"`
+	AnchoredBy   string `json:"anchoredBy"`                                  // Fabric ID of the submitting client
+	AnchoredOrg  string `json:"anchoredOrg"`                                 // MSP ID of the submitting client
+	AnchoredRole string `json:"anchoredRole,omitempty" metadata:",optional"` // supply chain role of the submitting client
+	BatchID      string `json:"batchId"`
+	DocumentType string `json:"documentType"`
+	MediaType    string `json:"mediaType"`
+	SHA256       string `json:"sha256"`
+	Size         int64  `json:"size"`
+	StorageURI   string `json:"storageUri"`
+	TxID         string `json:"txId"`
+}
+
+// DocumentVerification reports whether a digest has been anchored and to which batches
+type DocumentVerification struct {
+	Anchored bool              `json:"anchored"`
+	Anchors  []*DocumentAnchor `json:"anchors"`
+	SHA256   string            `json:"sha256"`
+}
+
+// AttachDocument anchors the SHA-256 digest of an off-chain document to a herb batch.
+// Only the organisation owning the batch may attach documents, except phytosanitary
+// certificates, which only a client with the phytosanitary-authority role may attach.
+func (s *SmartContract) AttachDocument(ctx contractapi.TransactionContextInterface, batchID string, documentType string, sha256Hex string, size int64, mediaType string, storageURI string) (*DocumentAnchor, error) {
+	if !validDocumentTypes[documentType] {
+		return nil, validationError("invalid document type %s", documentType)
+	}
+	digest, err := normalizeDigest(sha256Hex)
+	if err != nil {
+		return nil, err
+	}
+	if size < 0 {
+		return nil, validationError("the document size must not be negative")
+	}
+
+	herbBatch, err := s.ReadHerbBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	anchoredRole := ""
+	if documentType == DocumentPhytosanitaryCertificate {
+		authority, err := hasRole(ctx, phytosanitaryAuthorityRole)
+		if err != nil {
+			return nil, err
+		}
+		if !authority {
+			return nil, forbiddenError("only a client with the role %s may attach a phytosanitary certificate", phytosanitaryAuthorityRole)
+		}
+		anchoredRole = phytosanitaryAuthorityRole
+	} else {
+		err = requireOwnerOrg(ctx, herbBatch)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(documentObjectType, []string{batchID, digest})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if existing != nil {
+		return nil, alreadyExistsError("the document %s is already attached to herb batch %s", digest, batchID)
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	anchoredBy, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, internalError("failed to get client identity: %v", err)
+	}
+	anchoredOrg, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, internalError("failed to get client MSP ID: %v", err)
+	}
+
+	anchor := DocumentAnchor{
+		AnchoredAt:   now,
+		AnchoredBy:   anchoredBy,
+		AnchoredOrg:  anchoredOrg,
+		AnchoredRole: anchoredRole,
+		BatchID:      batchID,
+		DocumentType: documentType,
+		MediaType:    mediaType,
+		SHA256:       digest,
+		Size:         size,
+		StorageURI:   storageURI,
+		TxID:         ctx.GetStub().GetTxID(),
+	}
+	anchorJSON, err := json.Marshal(anchor)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(key, anchorJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(documentDigestIndexName, []string{digest, batchID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(indexKey, []byte{0x00})
+	if err != nil {
+		return nil, err
+	}
+
+	return &anchor, nil
+}
+
+// GetHerbBatchDocuments returns the documents anchored to a herb batch
+func (s *SmartContract) GetHerbBatchDocuments(ctx contractapi.TransactionContextInterface, batchID string) ([]*DocumentAnchor, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(documentObjectType, []string{batchID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var anchors []*DocumentAnchor
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var anchor DocumentAnchor
+		err = json.Unmarshal(queryResponse.Value, &anchor)
+		if err != nil {
+			return nil, err
+		}
+		anchors = append(anchors, &anchor)
+	}
+
+	return anchors, nil
+}
+
+// VerifyDocument reports whether a document with the given SHA-256 digest has been
+// anchored, and to which herb batches
+func (s *SmartContract) VerifyDocument(ctx contractapi.TransactionContextInterface, sha256Hex string) (*DocumentVerification, error) {
+	digest, err := normalizeDigest(sha256Hex)
+	if err != nil {
+		return nil, err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(documentDigestIndexName, []string{digest})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	anchors := []*DocumentAnchor{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		key, err := ctx.GetStub().CreateCompositeKey(documentObjectType, []string{keyParts[1], digest})
+		if err != nil {
+			return nil, internalError("failed to create composite key: %v", err)
+		}
+		anchorJSON, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return nil, internalError("failed to read from world state: %v", err)
+		}
+
+		var anchor DocumentAnchor
+		err = json.Unmarshal(anchorJSON, &anchor)
+		if err != nil {
+			return nil, err
+		}
+		anchors = append(anchors, &anchor)
+	}
+
+	return &DocumentVerification{
+		Anchored: len(anchors) > 0,
+		Anchors:  anchors,
+		SHA256:   digest,
+	}, nil
+}
+
+// normalizeDigest validates a hex encoded SHA-256 digest and returns it in lower case
+func normalizeDigest(sha256Hex string) (string, error) {
+	digest := strings.ToLower(strings.TrimSpace(sha256Hex))
+	decoded, err := hex.DecodeString(digest)
+	if err != nil || len(decoded) != 32 {
+		return "", validationError("invalid SHA-256 digest %s", sha256Hex)
+	}
+
+	return digest, nil
+}
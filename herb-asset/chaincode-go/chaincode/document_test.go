@@ -0,0 +1,95 @@
+package chaincode_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/fakestub"
+	"github.com/stretchr/testify/require"
+)
+
+const testDigest = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+
+func (n *testNetwork) attachDocument(identity *fakestub.Identity, batchID string, documentType string, digest string) (*chaincode.DocumentAnchor, error) {
+	var anchor *chaincode.DocumentAnchor
+	err := n.submit(identity, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		anchor, err = n.contract.AttachDocument(ctx, batchID, documentType, digest, 1024, "application/pdf", "ipfs://report")
+		return err
+	})
+	return anchor, err
+}
+
+func TestAttachDocument(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	n.mustCreateHerbBatch("batch2", "Curcuma longa", "Kerala", "2024-08-20", 80)
+
+	anchor, err := n.attachDocument(n.farmer, "batch1", chaincode.DocumentLabReport, strings.ToUpper(testDigest))
+	require.NoError(t, err)
+	require.Equal(t, testDigest, anchor.SHA256)
+	require.Equal(t, n.accountID(n.farmer), anchor.AnchoredBy)
+	require.Equal(t, org1MSP, anchor.AnchoredOrg)
+
+	// other organisations cannot anchor documents to the batch
+	_, err = n.attachDocument(n.buyer, "batch1", chaincode.DocumentInvoice, "1"+testDigest[1:])
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	// phytosanitary certificates come from the authority, not from the owner
+	_, err = n.attachDocument(n.farmer, "batch1", chaincode.DocumentPhytosanitaryCertificate, "2"+testDigest[1:])
+	requireCode(t, err, chaincode.CodeForbidden)
+	authority := newIdentity(t, org2MSP, "officer", []string{"client"}, map[string]string{"role": "phytosanitary-authority"})
+	anchor, err = n.attachDocument(authority, "batch1", chaincode.DocumentPhytosanitaryCertificate, "2"+testDigest[1:])
+	require.NoError(t, err)
+	require.Equal(t, org2MSP, anchor.AnchoredOrg)
+
+	_, err = n.attachDocument(n.farmer, "batch1", chaincode.DocumentLabReport, testDigest)
+	requireCode(t, err, chaincode.CodeAlreadyExists)
+
+	_, err = n.attachDocument(n.farmer, "batch2", chaincode.DocumentInvoice, testDigest)
+	require.NoError(t, err)
+
+	_, err = n.attachDocument(n.farmer, "missing", chaincode.DocumentLabReport, testDigest)
+	requireCode(t, err, chaincode.CodeNotFound)
+
+	_, err = n.attachDocument(n.farmer, "batch1", "Selfie", testDigest)
+	requireCode(t, err, chaincode.CodeValidation)
+
+	_, err = n.attachDocument(n.farmer, "batch1", chaincode.DocumentLabReport, "not-a-digest")
+	requireCode(t, err, chaincode.CodeValidation)
+
+	var documents []*chaincode.DocumentAnchor
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		documents, err = n.contract.GetHerbBatchDocuments(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, documents, 2)
+}
+
+func TestVerifyDocument(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	_, err := n.attachDocument(n.farmer, "batch1", chaincode.DocumentLabReport, testDigest)
+	require.NoError(t, err)
+
+	var verification *chaincode.DocumentVerification
+	err = n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		verification, err = n.contract.VerifyDocument(ctx, testDigest)
+		return err
+	})
+	require.NoError(t, err)
+	require.True(t, verification.Anchored)
+	require.Len(t, verification.Anchors, 1)
+	require.Equal(t, "batch1", verification.Anchors[0].BatchID)
+
+	err = n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		verification, err = n.contract.VerifyDocument(ctx, strings.Repeat("0", 64))
+		return err
+	})
+	require.NoError(t, err)
+	require.False(t, verification.Anchored)
+	require.Empty(t, verification.Anchors)
+}
@@ -0,0 +1,59 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/statebased"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// GetHerbBatchEndorsingOrgs returns the organisations whose peers must endorse
+// changes to the herb batch with given id
+func (s *SmartContract) GetHerbBatchEndorsingOrgs(ctx contractapi.TransactionContextInterface, id string) ([]string, error) {
+	exists, err := s.HerbBatchExists(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, notFoundError("the herb batch %s does not exist", id)
+	}
+
+	policy, err := ctx.GetStub().GetStateValidationParameter(id)
+	if err != nil {
+		return nil, internalError("failed to read endorsement policy: %v", err)
+	}
+	if len(policy) == 0 {
+		return []string{}, nil
+	}
+
+	endorsementPolicy, err := statebased.NewStateEP(policy)
+	if err != nil {
+		return nil, internalError("failed to parse endorsement policy: %v", err)
+	}
+
+	return endorsementPolicy.ListOrgs(), nil
+}
+
+// setHerbBatchEndorsement replaces the key-level endorsement policy of a herb batch
+// so that a peer of the owning organisation must endorse any change to it
+func setHerbBatchEndorsement(ctx contractapi.TransactionContextInterface, id string, ownerOrg string) error {
+	endorsementPolicy, err := statebased.NewStateEP(nil)
+	if err != nil {
+		return err
+	}
+
+	err = endorsementPolicy.AddOrgs(statebased.RoleTypePeer, ownerOrg)
+	if err != nil {
+		return internalError("failed to add org to endorsement policy: %v", err)
+	}
+
+	policy, err := endorsementPolicy.Policy()
+	if err != nil {
+		return internalError("failed to create endorsement policy bytes: %v", err)
+	}
+
+	err = ctx.GetStub().SetStateValidationParameter(id, policy)
+	if err != nil {
+		return internalError("failed to set validation parameter on herb batch: %v", err)
+	}
+
+	return nil
+}
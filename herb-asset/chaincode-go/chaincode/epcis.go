@@ -0,0 +1,362 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// EPCIS 2.0 document constants
+const (
+	epcisContext       = "https://ref.gs1.org/standards/epcis/2.0.0/epcis-context.jsonld"
+	epcisSchemaVersion = "2.0"
+	epcisUnitKilogram  = "KGM" // UN/ECE Recommendation 20 code for kilograms
+	epcisOwningParty   = "owning_party"
+)
+
+// EPCIS event types and actions
+const (
+	EPCISObjectEvent         = "ObjectEvent"
+	EPCISTransformationEvent = "TransformationEvent"
+
+	EPCISActionAdd     = "ADD"
+	EPCISActionObserve = "OBSERVE"
+	EPCISActionDelete  = "DELETE"
+)
+
+// epcisStep is the CBV business step and disposition recorded for a supply chain status
+type epcisStep struct {
+	bizStep     string
+	disposition string
+}
+
+var statusEPCISSteps = map[string]epcisStep{
+	StatusHarvested:   {"commissioning", "active"},
+	StatusInTransit:   {"shipping", "in_transit"},
+	StatusLabTesting:  {"inspecting", "in_progress"},
+	StatusCertified:   {"inspecting", "conformant"},
+	StatusProcessing:  {"transforming", "in_progress"},
+	StatusPackaged:    {"packing", "in_progress"},
+	StatusDistributed: {"shipping", "in_transit"},
+	StatusDelivered:   {"retail_selling", "retail_sold"},
+}
+
+// EPCISDocument is a GS1 EPCIS 2.0 JSON-LD document
+type EPCISDocument struct {
+	Context       []string  `json:"@context"`
+	CreationDate  string    `json:"creationDate"`
+	EPCISBody     EPCISBody `json:"epcisBody"`
+	SchemaVersion string    `json:"schemaVersion"`
+	Type          string    `json:"type"`
+}
+
+// EPCISBody holds the events of an EPCIS document
+type EPCISBody struct {
+	EventList []*EPCISEvent `json:"eventList"`
+}
+
+// EPCISEvent is an EPCIS ObjectEvent or TransformationEvent. Herb batches are
+// identified at class level, so quantities are used instead of EPC lists.
+type EPCISEvent struct {
+	Action              string                  `json:"action,omitempty" metadata:",optional"`
+	BizStep             string                  `json:"bizStep,omitempty" metadata:",optional"`
+	DestinationList     []*EPCISDestination     `json:"destinationList,omitempty" metadata:",optional"`
+	Disposition         string                  `json:"disposition,omitempty" metadata:",optional"`
+	EventID             string                  `json:"eventID"`
+	EventTime           string                  `json:"eventTime"`
+	EventTimeZoneOffset string                  `json:"eventTimeZoneOffset"`
+	InputQuantityList   []*EPCISQuantityElement `json:"inputQuantityList,omitempty" metadata:",optional"`
+	OutputQuantityList  []*EPCISQuantityElement `json:"outputQuantityList,omitempty" metadata:",optional"`
+	QuantityList        []*EPCISQuantityElement `json:"quantityList,omitempty" metadata:",optional"`
+	ReadPoint           *EPCISLocation          `json:"readPoint,omitempty" metadata:",optional"`
+	SourceList          []*EPCISSource          `json:"sourceList,omitempty" metadata:",optional"`
+	TransformationID    string                  `json:"transformationID,omitempty" metadata:",optional"`
+	Type                string                  `json:"type"`
+}
+
+// EPCISQuantityElement is a quantity of an EPC class
+type EPCISQuantityElement struct {
+	EPCClass string  `json:"epcClass"`
+	Quantity float64 `json:"quantity"`
+	UOM      string  `json:"uom"`
+}
+
+// EPCISLocation identifies a read point or business location
+type EPCISLocation struct {
+	ID string `json:"id"`
+}
+
+// EPCISSource is a party or location an object came from
+type EPCISSource struct {
+	Source string `json:"source"`
+	Type   string `json:"type"`
+}
+
+// EPCISDestination is a party or location an object went to
+type EPCISDestination struct {
+	Destination string `json:"destination"`
+	Type        string `json:"type"`
+}
+
+// EPCISPage is one page of an EPCIS export over a harvest date range
+type EPCISPage struct {
+	Bookmark string         `json:"bookmark"`
+	Document *EPCISDocument `json:"document"`
+}
+
+// GetHerbBatchEPCIS returns the lifecycle of a herb batch as an EPCIS 2.0 document:
+// its creation, ownership transfers, status changes, processing steps, blending
+// into other batches and deletion
+func (s *SmartContract) GetHerbBatchEPCIS(ctx contractapi.TransactionContextInterface, batchID string) (*EPCISDocument, error) {
+	events, err := s.herbBatchEPCISEvents(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if len(events) == 0 {
+		return nil, notFoundError("the herb batch %s does not exist", batchID)
+	}
+
+	return newEPCISDocument(ctx, events)
+}
+
+// GetEPCISByHarvestDateRange returns the EPCIS events of the herb batches harvested
+// between from and to inclusive, paginated like GetHerbBatchesByHarvestDateRange
+func (s *SmartContract) GetEPCISByHarvestDateRange(ctx contractapi.TransactionContextInterface, from string, to string, pageSize int32, bookmark string) (*EPCISPage, error) {
+	page, err := s.GetHerbBatchesByHarvestDateRange(ctx, from, to, pageSize, bookmark)
+	if err != nil {
+		return nil, err
+	}
+
+	events := []*EPCISEvent{}
+	for _, herbBatch := range page.Records {
+		batchEvents, err := s.herbBatchEPCISEvents(ctx, herbBatch.ID)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, batchEvents...)
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].EventTime < events[j].EventTime
+	})
+
+	document, err := newEPCISDocument(ctx, events)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EPCISPage{Bookmark: page.Bookmark, Document: document}, nil
+}
+
+// herbBatchEPCISEvents replays the history of a herb batch key into EPCIS events in
+// commit order. Transactions that recorded a processing step become a single
+// TransformationEvent, and a blend that consumed the batch becomes a
+// TransformationEvent sharing the blend's transformation ID.
+func (s *SmartContract) herbBatchEPCISEvents(ctx contractapi.TransactionContextInterface, batchID string) ([]*EPCISEvent, error) {
+	steps, err := s.GetProcessingHistory(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	stepsByTxID := map[string]*ProcessingStep{}
+	for _, step := range steps {
+		stepsByTxID[step.ID] = step
+	}
+	workflowEvents, err := s.GetSupplyChainEvents(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	workflowEventsByTxID := map[string]*SupplyChainEvent{}
+	for _, workflowEvent := range workflowEvents {
+		workflowEventsByTxID[workflowEvent.ID] = workflowEvent
+	}
+
+	historyIterator, err := ctx.GetStub().GetHistoryForKey(batchID)
+	if err != nil {
+		return nil, internalError("failed to read history of herb batch %s: %v", batchID, err)
+	}
+	defer historyIterator.Close()
+
+	type modification struct {
+		txID      string
+		time      string
+		herbBatch *HerbBatch
+	}
+	var modifications []modification
+	for historyIterator.HasNext() {
+		entry, err := historyIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		m := modification{
+			txID: entry.TxId,
+			time: entry.Timestamp.AsTime().UTC().Format(time.RFC3339),
+		}
+		if !entry.IsDelete {
+			m.herbBatch = &HerbBatch{}
+			err = json.Unmarshal(entry.Value, m.herbBatch)
+			if err != nil {
+				return nil, err
+			}
+		}
+		modifications = append(modifications, m)
+	}
+
+	events := []*EPCISEvent{}
+	var previous *HerbBatch
+	// the peer returns history newest first
+	for i := len(modifications) - 1; i >= 0; i-- {
+		m := modifications[i]
+		current := m.herbBatch
+
+		switch {
+		case current == nil && previous != nil:
+			event := newEPCISObjectEvent(previous, m.txID, m.time, "delete", EPCISActionDelete, previous.RemainingQuantity)
+			event.BizStep = "decommissioning"
+			event.Disposition = "inactive"
+			events = append(events, event)
+		case current == nil:
+		case previous == nil:
+			event := newEPCISObjectEvent(current, m.txID, m.time, "create", EPCISActionAdd, current.Quantity)
+			event.BizStep = "commissioning"
+			event.Disposition = "active"
+			event.ReadPoint = &EPCISLocation{ID: epcisURN("farm", current.Farm)}
+			events = append(events, event)
+			if current.Status != StatusHarvested {
+				events = append(events, newEPCISStatusEvent(current, m.txID, m.time))
+			}
+		case stepsByTxID[m.txID] != nil:
+			events = append(events, newEPCISTransformationEvent(current, stepsByTxID[m.txID]))
+		default:
+			// a blend recorded on another batch takes what was left of this one
+			if current.RemainingQuantity < previous.RemainingQuantity {
+				events = append(events, newEPCISBlendSourceEvent(current, m.txID, m.time, previous.RemainingQuantity-current.RemainingQuantity))
+			}
+			if current.Owner != previous.Owner || current.OwnerOrg != previous.OwnerOrg {
+				event := newEPCISObjectEvent(current, m.txID, m.time, "transfer", EPCISActionObserve, current.RemainingQuantity)
+				event.BizStep = "accepting"
+				event.Disposition = "in_progress"
+				event.SourceList = []*EPCISSource{{Source: epcisParty(previous), Type: epcisOwningParty}}
+				event.DestinationList = []*EPCISDestination{{Destination: epcisParty(current), Type: epcisOwningParty}}
+				events = append(events, event)
+			}
+			if current.Status != previous.Status {
+				event := newEPCISStatusEvent(current, m.txID, m.time)
+				if workflowEvent, ok := workflowEventsByTxID[m.txID]; ok {
+					event.ReadPoint = &EPCISLocation{ID: epcisURN("location", workflowEvent.Location)}
+				}
+				events = append(events, event)
+			}
+		}
+
+		previous = current
+	}
+
+	return events, nil
+}
+
+func newEPCISDocument(ctx contractapi.TransactionContextInterface, events []*EPCISEvent) (*EPCISDocument, error) {
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EPCISDocument{
+		Context:       []string{epcisContext},
+		CreationDate:  now,
+		EPCISBody:     EPCISBody{EventList: events},
+		SchemaVersion: epcisSchemaVersion,
+		Type:          "EPCISDocument",
+	}, nil
+}
+
+func newEPCISObjectEvent(herbBatch *HerbBatch, txID string, eventTime string, kind string, action string, quantity float64) *EPCISEvent {
+	return &EPCISEvent{
+		Action:              action,
+		EventID:             epcisEventID(txID, herbBatch.ID, kind),
+		EventTime:           eventTime,
+		EventTimeZoneOffset: "+00:00",
+		QuantityList:        []*EPCISQuantityElement{epcisQuantity(herbBatch.ID, quantity)},
+		ReadPoint:           &EPCISLocation{ID: epcisURN("org", herbBatch.OwnerOrg)},
+		Type:                EPCISObjectEvent,
+	}
+}
+
+// newEPCISStatusEvent records a herb batch reaching its current status. Statuses
+// without a CBV mapping are exported without business step and disposition.
+func newEPCISStatusEvent(herbBatch *HerbBatch, txID string, eventTime string) *EPCISEvent {
+	event := newEPCISObjectEvent(herbBatch, txID, eventTime, "status", EPCISActionObserve, herbBatch.RemainingQuantity)
+	if step, ok := statusEPCISSteps[herbBatch.Status]; ok {
+		event.BizStep = step.bizStep
+		event.Disposition = step.disposition
+	}
+	return event
+}
+
+// newEPCISTransformationEvent records a processing step, listing the batches a
+// blend took in as inputs alongside the processed batch
+func newEPCISTransformationEvent(herbBatch *HerbBatch, step *ProcessingStep) *EPCISEvent {
+	inputs := []*EPCISQuantityElement{epcisQuantity(herbBatch.ID, step.InputWeight)}
+	sourceIDs := make([]string, 0, len(step.SourceQuantities))
+	for sourceID := range step.SourceQuantities {
+		sourceIDs = append(sourceIDs, sourceID)
+	}
+	sort.Strings(sourceIDs)
+	for _, sourceID := range sourceIDs {
+		inputs = append(inputs, epcisQuantity(sourceID, step.SourceQuantities[sourceID]))
+	}
+
+	return &EPCISEvent{
+		BizStep:             "transforming",
+		Disposition:         "in_progress",
+		EventID:             epcisEventID(step.ID, herbBatch.ID, "processing"),
+		EventTime:           step.Timestamp,
+		EventTimeZoneOffset: "+00:00",
+		InputQuantityList:   inputs,
+		OutputQuantityList:  []*EPCISQuantityElement{epcisQuantity(herbBatch.ID, step.OutputWeight)},
+		ReadPoint:           &EPCISLocation{ID: epcisURN("facility", step.Facility)},
+		TransformationID:    epcisURN("transformation", step.ID),
+		Type:                EPCISTransformationEvent,
+	}
+}
+
+// newEPCISBlendSourceEvent records the quantity of a herb batch blended into another
+// batch. It shares the transformation ID of the blend's processing step, which
+// lists the output.
+func newEPCISBlendSourceEvent(herbBatch *HerbBatch, txID string, eventTime string, quantity float64) *EPCISEvent {
+	return &EPCISEvent{
+		BizStep:             "transforming",
+		Disposition:         "in_progress",
+		EventID:             epcisEventID(txID, herbBatch.ID, "blending"),
+		EventTime:           eventTime,
+		EventTimeZoneOffset: "+00:00",
+		InputQuantityList:   []*EPCISQuantityElement{epcisQuantity(herbBatch.ID, quantity)},
+		ReadPoint:           &EPCISLocation{ID: epcisURN("org", herbBatch.OwnerOrg)},
+		TransformationID:    epcisURN("transformation", txID),
+		Type:                EPCISTransformationEvent,
+	}
+}
+
+func epcisQuantity(batchID string, quantity float64) *EPCISQuantityElement {
+	return &EPCISQuantityElement{
+		EPCClass: epcisURN("batch", batchID),
+		Quantity: quantity,
+		UOM:      epcisUnitKilogram,
+	}
+}
+
+// epcisParty identifies the owner of a herb batch within its organisation
+func epcisParty(herbBatch *HerbBatch) string {
+	return epcisURN("party", herbBatch.OwnerOrg+"/"+herbBatch.Owner)
+}
+
+func epcisEventID(txID string, batchID string, kind string) string {
+	return epcisURN("event", txID+"/"+batchID+"/"+kind)
+}
+
+// epcisURN builds the identifier URIs used where batches carry no GS1 keys
+func epcisURN(kind string, value string) string {
+	return "urn:herbtrace:" + kind + ":" + url.PathEscape(value)
+}
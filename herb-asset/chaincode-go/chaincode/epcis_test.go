@@ -0,0 +1,161 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (n *testNetwork) herbBatchEPCIS(batchID string) (*chaincode.EPCISDocument, error) {
+	var document *chaincode.EPCISDocument
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		document, err = n.contract.GetHerbBatchEPCIS(ctx, batchID)
+		return err
+	})
+	return document, err
+}
+
+func TestGetHerbBatchEPCIS(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	n.registerOrg2()
+	org2Admin := newIdentity(t, org2MSP, "admin", []string{"admin"}, map[string]string{"hf.Type": "admin"})
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.TransferHerbBatch(ctx, "batch1", "Spice Traders", org2MSP)
+		return err
+	})
+	require.NoError(t, err)
+
+	_, err = n.recordSupplyChainEvent(n.transporter, chaincode.ActionTransport, "Kochi")
+	require.NoError(t, err)
+
+	var step *chaincode.ProcessingStep
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		step, err = n.contract.RecordProcessingStep(ctx, "batch1", chaincode.StepDrying, "Kochi Plant", "Operator A", 100, 80, nil)
+		return err
+	})
+	require.NoError(t, err)
+
+	err = n.submit(org2Admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DeleteHerbBatch(ctx, "batch1")
+	})
+	require.NoError(t, err)
+
+	document, err := n.herbBatchEPCIS("batch1")
+	require.NoError(t, err)
+	require.Equal(t, "EPCISDocument", document.Type)
+	require.Equal(t, "2.0", document.SchemaVersion)
+
+	events := document.EPCISBody.EventList
+	require.Len(t, events, 5)
+
+	require.Equal(t, chaincode.EPCISObjectEvent, events[0].Type)
+	require.Equal(t, chaincode.EPCISActionAdd, events[0].Action)
+	require.Equal(t, "commissioning", events[0].BizStep)
+	require.Equal(t, "urn:herbtrace:farm:Test%20Farm", events[0].ReadPoint.ID)
+	require.Equal(t, 120.0, events[0].QuantityList[0].Quantity)
+	require.Equal(t, "urn:herbtrace:batch:batch1", events[0].QuantityList[0].EPCClass)
+
+	require.Equal(t, "accepting", events[1].BizStep)
+	require.Equal(t, "urn:herbtrace:party:Org1MSP%2FRavi%20Sharma", events[1].SourceList[0].Source)
+	require.Equal(t, "urn:herbtrace:party:Org2MSP%2FSpice%20Traders", events[1].DestinationList[0].Destination)
+
+	require.Equal(t, "shipping", events[2].BizStep)
+	require.Equal(t, "in_transit", events[2].Disposition)
+
+	require.Equal(t, chaincode.EPCISTransformationEvent, events[3].Type)
+	require.Equal(t, step.Timestamp, events[3].EventTime)
+	require.Equal(t, 100.0, events[3].InputQuantityList[0].Quantity)
+	require.Equal(t, 80.0, events[3].OutputQuantityList[0].Quantity)
+	require.Equal(t, "urn:herbtrace:facility:Kochi%20Plant", events[3].ReadPoint.ID)
+
+	require.Equal(t, chaincode.EPCISActionDelete, events[4].Action)
+	require.Equal(t, "decommissioning", events[4].BizStep)
+	require.Equal(t, 100.0, events[4].QuantityList[0].Quantity)
+
+	for i := 1; i < len(events); i++ {
+		require.Less(t, events[i-1].EventTime, events[i].EventTime)
+	}
+
+	_, err = n.herbBatchEPCIS("missing")
+	requireCode(t, err, chaincode.CodeNotFound)
+}
+
+func TestGetHerbBatchEPCISOfBlendedLot(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	n.mustCreateHerbBatch("batch2", "Withania somnifera", "Kerala", "2024-08-16", 50)
+
+	var step *chaincode.ProcessingStep
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		step, err = n.contract.RecordProcessingStep(ctx, "batch1", chaincode.StepBlending, "Kochi Plant", "Operator A", 100, 140, map[string]string{chaincode.BlendSourcesParameter: "batch2"})
+		return err
+	})
+	require.NoError(t, err)
+
+	document, err := n.herbBatchEPCIS("batch1")
+	require.NoError(t, err)
+	events := document.EPCISBody.EventList
+	require.Len(t, events, 2)
+	blend := events[1]
+	require.Equal(t, chaincode.EPCISTransformationEvent, blend.Type)
+	require.Len(t, blend.InputQuantityList, 2)
+	require.Equal(t, "urn:herbtrace:batch:batch1", blend.InputQuantityList[0].EPCClass)
+	require.Equal(t, 100.0, blend.InputQuantityList[0].Quantity)
+	require.Equal(t, "urn:herbtrace:batch:batch2", blend.InputQuantityList[1].EPCClass)
+	require.Equal(t, 50.0, blend.InputQuantityList[1].Quantity)
+	require.Len(t, blend.OutputQuantityList, 1)
+	require.Equal(t, 140.0, blend.OutputQuantityList[0].Quantity)
+
+	document, err = n.herbBatchEPCIS("batch2")
+	require.NoError(t, err)
+	events = document.EPCISBody.EventList
+	require.Len(t, events, 2)
+	source := events[1]
+	require.Equal(t, chaincode.EPCISTransformationEvent, source.Type)
+	require.Equal(t, "transforming", source.BizStep)
+	require.Equal(t, step.Timestamp, source.EventTime)
+	require.Equal(t, blend.TransformationID, source.TransformationID, "the source event belongs to the blend")
+	require.Equal(t, "urn:herbtrace:batch:batch2", source.InputQuantityList[0].EPCClass)
+	require.Equal(t, 50.0, source.InputQuantityList[0].Quantity)
+	require.Empty(t, source.OutputQuantityList)
+}
+
+func TestGetEPCISByHarvestDateRange(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-16", 120)
+	n.mustCreateHerbBatch("batch2", "Withania somnifera", "Kerala", "2024-08-15", 80)
+	n.mustCreateHerbBatch("batch3", "Withania somnifera", "Kerala", "2024-09-01", 50)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "batch2", chaincode.StatusDistributed)
+	})
+	require.NoError(t, err)
+
+	var page *chaincode.EPCISPage
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		page, err = n.contract.GetEPCISByHarvestDateRange(ctx, "2024-08-01", "2024-08-31", 10, "")
+		return err
+	})
+	require.NoError(t, err)
+	require.Empty(t, page.Bookmark)
+
+	events := page.Document.EPCISBody.EventList
+	require.Len(t, events, 3)
+	require.Equal(t, "urn:herbtrace:batch:batch1", events[0].QuantityList[0].EPCClass)
+	require.Equal(t, "urn:herbtrace:batch:batch2", events[1].QuantityList[0].EPCClass)
+	require.Equal(t, "shipping", events[2].BizStep)
+	require.Equal(t, "in_transit", events[2].Disposition)
+
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.GetEPCISByHarvestDateRange(ctx, "2024-08-31", "2024-08-01", 10, "")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+}
@@ -0,0 +1,76 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrorCode classifies a chaincode failure so that clients can react to it without
+// parsing the message
+type ErrorCode string
+
+// Chaincode error codes
+const (
+	CodeNotFound          ErrorCode = "NOT_FOUND"
+	CodeAlreadyExists     ErrorCode = "ALREADY_EXISTS"
+	CodeInvalidTransition ErrorCode = "INVALID_TRANSITION"
+	CodeForbidden         ErrorCode = "FORBIDDEN"
+	CodeValidation        ErrorCode = "VALIDATION"
+	CodeInternal          ErrorCode = "INTERNAL"
+)
+
+// ChaincodeError is the error returned by every transaction. Its message is the JSON
+// encoding of the error, e.g. {"code":"NOT_FOUND","message":"the herb batch batch9 does not exist"},
+// which Fabric passes to the client unchanged.
+type ChaincodeError struct {
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+}
+
+func (e *ChaincodeError) Error() string {
+	errorJSON, err := json.Marshal(e)
+	if err != nil {
+		return string(e.Code) + ": " + e.Message
+	}
+
+	return string(errorJSON)
+}
+
+// ErrorCodeOf returns the code of a chaincode error, or CodeInternal for any other error
+func ErrorCodeOf(err error) ErrorCode {
+	var chaincodeError *ChaincodeError
+	if errors.As(err, &chaincodeError) {
+		return chaincodeError.Code
+	}
+
+	return CodeInternal
+}
+
+func newChaincodeError(code ErrorCode, format string, args ...interface{}) error {
+	return &ChaincodeError{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+func notFoundError(format string, args ...interface{}) error {
+	return newChaincodeError(CodeNotFound, format, args...)
+}
+
+func alreadyExistsError(format string, args ...interface{}) error {
+	return newChaincodeError(CodeAlreadyExists, format, args...)
+}
+
+func invalidTransitionError(format string, args ...interface{}) error {
+	return newChaincodeError(CodeInvalidTransition, format, args...)
+}
+
+func forbiddenError(format string, args ...interface{}) error {
+	return newChaincodeError(CodeForbidden, format, args...)
+}
+
+func validationError(format string, args ...interface{}) error {
+	return newChaincodeError(CodeValidation, format, args...)
+}
+
+func internalError(format string, args ...interface{}) error {
+	return newChaincodeError(CodeInternal, format, args...)
+}
@@ -0,0 +1,23 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChaincodeError(t *testing.T) {
+	err := error(&chaincode.ChaincodeError{Code: chaincode.CodeNotFound, Message: "the herb batch batch9 does not exist"})
+
+	var decoded chaincode.ChaincodeError
+	require.NoError(t, json.Unmarshal([]byte(err.Error()), &decoded))
+	require.Equal(t, chaincode.CodeNotFound, decoded.Code)
+	require.Equal(t, "the herb batch batch9 does not exist", decoded.Message)
+
+	require.Equal(t, chaincode.CodeNotFound, chaincode.ErrorCodeOf(fmt.Errorf("wrapped: %w", err)))
+	require.Equal(t, chaincode.CodeInternal, chaincode.ErrorCodeOf(errors.New("plain")))
+}
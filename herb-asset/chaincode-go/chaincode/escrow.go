@@ -0,0 +1,539 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	accountObjectType    = "account"
+	offerObjectType      = "offer"
+	settlementObjectType = "settlement"
+)
+
+// escrowAccount names the escrow as the counterparty in settlement entries
+const escrowAccount = "escrow"
+
+// Transfer offer statuses
+const (
+	OfferOpen     = "Open"
+	OfferAccepted = "Accepted"
+	OfferSettled  = "Settled"
+	OfferRejected = "Rejected"
+	// OfferWithdrawn marks an open offer that lapsed because the batch was sold
+	// through another offer
+	OfferWithdrawn = "Withdrawn"
+)
+
+// Settlement actions recorded against a herb batch
+const (
+	SettlementLock    = "Lock"
+	SettlementRelease = "Release"
+	SettlementRefund  = "Refund"
+)
+
+// Account holds the settlement balance of a client identity. Amounts are in the
+// smallest currency unit so that balances never suffer rounding.
+type Account struct {
+	ID      string `json:"ID"`
+	Balance int64  `json:"balance"`
+}
+
+// TransferOffer is a seller's offer to hand a herb batch to a buyer for a price.
+// Accepting the offer locks the price in escrow until custody is confirmed.
+type TransferOffer struct {
+	ID        string `json:"ID"`
+	BatchID   string `json:"batchId"`
+	Buyer     string `json:"buyer"`
+	BuyerName string `json:"buyerName"`
+	CreatedAt string `json:"createdAt"`
+	Escrowed  int64  `json:"escrowed"`
+	HolderID  string `json:"holderId,omitempty" metadata:",optional"` // Fabric ID holding the batch when it was offered
+	Price     int64  `json:"price"`
+	Seller    string `json:"seller"`
+	SellerOrg string `json:"sellerOrg"` // MSP ID of the organisation owning the batch when it was offered
+	Status    string `json:"status"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// SettlementEntry records a movement of escrowed funds for a herb batch
+type SettlementEntry struct {
+	Action    string `json:"action"`
+	Amount    int64  `json:"amount"`
+	BatchID   string `json:"batchId"`
+	From      string `json:"from"`
+	OfferID   string `json:"offerId"`
+	Timestamp string `json:"timestamp"`
+	To        string `json:"to"`
+	TxID      string `json:"txId"`
+}
+
+// GetClientAccountID returns the account ID of the submitting client
+func (s *SmartContract) GetClientAccountID(ctx contractapi.TransactionContextInterface) (string, error) {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return "", internalError("failed to get client identity: %v", err)
+	}
+
+	return clientID, nil
+}
+
+// DepositFunds credits the given account. Only an organisation admin may issue funds.
+func (s *SmartContract) DepositFunds(ctx contractapi.TransactionContextInterface, accountID string, amount int64) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if amount <= 0 {
+		return validationError("the deposit amount must be greater than zero")
+	}
+
+	account, err := readAccount(ctx, accountID)
+	if err != nil {
+		return err
+	}
+	account.Balance += amount
+
+	return putAccount(ctx, account)
+}
+
+// GetAccountBalance returns the available balance of the given account
+func (s *SmartContract) GetAccountBalance(ctx contractapi.TransactionContextInterface, accountID string) (int64, error) {
+	account, err := readAccount(ctx, accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	return account.Balance, nil
+}
+
+// OfferHerbBatch opens an offer from the submitting client to transfer a herb batch
+// to the buyer account for the given price. buyerName becomes the batch owner once
+// custody is confirmed. Only the client holding the batch, or an admin of its
+// organisation, may offer it.
+func (s *SmartContract) OfferHerbBatch(ctx contractapi.TransactionContextInterface, offerID string, batchID string, buyerID string, buyerName string, price int64) error {
+	if price <= 0 {
+		return validationError("the offer price must be greater than zero")
+	}
+
+	herbBatch, err := s.ReadHerbBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+	err = requireHerbBatchOwner(ctx, herbBatch)
+	if err != nil {
+		return err
+	}
+	err = requireDistributable(ctx, herbBatch)
+	if err != nil {
+		return err
+	}
+
+	offerKey, err := ctx.GetStub().CreateCompositeKey(offerObjectType, []string{offerID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+	offerJSON, err := ctx.GetStub().GetState(offerKey)
+	if err != nil {
+		return internalError("failed to read from world state: %v", err)
+	}
+	if offerJSON != nil {
+		return alreadyExistsError("the transfer offer %s already exists", offerID)
+	}
+
+	sellerID, err := s.GetClientAccountID(ctx)
+	if err != nil {
+		return err
+	}
+	if sellerID == buyerID {
+		return validationError("a herb batch cannot be offered to its seller")
+	}
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	offer := TransferOffer{
+		ID:        offerID,
+		BatchID:   batchID,
+		Buyer:     buyerID,
+		BuyerName: buyerName,
+		CreatedAt: now,
+		HolderID:  herbBatch.OwnerID,
+		Price:     price,
+		Seller:    sellerID,
+		SellerOrg: herbBatch.OwnerOrg,
+		Status:    OfferOpen,
+		UpdatedAt: now,
+	}
+	err = putTransferOffer(ctx, &offer)
+	if err != nil {
+		return err
+	}
+
+	indexKey, err := ctx.GetStub().CreateCompositeKey(offerObjectType+"~batch", []string{batchID, offerID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+}
+
+// ReadTransferOffer returns the transfer offer stored in the world state with given id
+func (s *SmartContract) ReadTransferOffer(ctx contractapi.TransactionContextInterface, offerID string) (*TransferOffer, error) {
+	offerKey, err := ctx.GetStub().CreateCompositeKey(offerObjectType, []string{offerID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+
+	offerJSON, err := ctx.GetStub().GetState(offerKey)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if offerJSON == nil {
+		return nil, notFoundError("the transfer offer %s does not exist", offerID)
+	}
+
+	var offer TransferOffer
+	err = json.Unmarshal(offerJSON, &offer)
+	if err != nil {
+		return nil, err
+	}
+
+	return &offer, nil
+}
+
+// AcceptTransferOffer accepts an open offer on behalf of the buyer and locks the
+// price from the buyer's account in escrow.
+func (s *SmartContract) AcceptTransferOffer(ctx contractapi.TransactionContextInterface, offerID string) error {
+	offer, err := s.readBuyerOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+	if offer.Status != OfferOpen {
+		return invalidTransitionError("the transfer offer %s is %s, not %s", offerID, offer.Status, OfferOpen)
+	}
+
+	err = s.requireNoAcceptedOffer(ctx, offer.BatchID)
+	if err != nil {
+		return err
+	}
+
+	buyer, err := readAccount(ctx, offer.Buyer)
+	if err != nil {
+		return err
+	}
+	if buyer.Balance < offer.Price {
+		return validationError("the buyer balance %d is insufficient for the offer price %d", buyer.Balance, offer.Price)
+	}
+	buyer.Balance -= offer.Price
+	err = putAccount(ctx, buyer)
+	if err != nil {
+		return err
+	}
+
+	offer.Escrowed = offer.Price
+	offer.Status = OfferAccepted
+
+	return settle(ctx, offer, SettlementLock, offer.Buyer, escrowAccount)
+}
+
+// ConfirmCustody is submitted by the buyer once the herb batch has been received.
+// It releases the escrowed funds to the seller and transfers the batch to the buyer,
+// withdrawing any other open offers for it. The batch must still be held as it was
+// when offered; otherwise the buyer can only reject the offer to recover the funds.
+func (s *SmartContract) ConfirmCustody(ctx contractapi.TransactionContextInterface, offerID string) error {
+	offer, err := s.readBuyerOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+	if offer.Status != OfferAccepted {
+		return invalidTransitionError("the transfer offer %s is %s, not %s", offerID, offer.Status, OfferAccepted)
+	}
+
+	herbBatch, err := s.ReadHerbBatch(ctx, offer.BatchID)
+	if err != nil {
+		return err
+	}
+	if herbBatch.OwnerOrg != offer.SellerOrg || herbBatch.OwnerID != offer.HolderID {
+		return invalidTransitionError("the herb batch %s is no longer held by the seller of transfer offer %s", offer.BatchID, offerID)
+	}
+
+	seller, err := readAccount(ctx, offer.Seller)
+	if err != nil {
+		return err
+	}
+	seller.Balance += offer.Escrowed
+	err = putAccount(ctx, seller)
+	if err != nil {
+		return err
+	}
+
+	buyerOrg, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return internalError("failed to get client MSP ID: %v", err)
+	}
+	_, err = s.transferHerbBatch(ctx, herbBatch, offer.BuyerName, buyerOrg, offer.Buyer)
+	if err != nil {
+		return err
+	}
+
+	offer.Status = OfferSettled
+
+	return settle(ctx, offer, SettlementRelease, escrowAccount, offer.Seller)
+}
+
+// RejectTransferOffer is submitted by the buyer to decline an offer, or to reject the
+// delivery of an accepted one. Any escrowed funds are refunded to the buyer.
+func (s *SmartContract) RejectTransferOffer(ctx contractapi.TransactionContextInterface, offerID string) error {
+	offer, err := s.readBuyerOffer(ctx, offerID)
+	if err != nil {
+		return err
+	}
+
+	switch offer.Status {
+	case OfferOpen:
+		offer.Status = OfferRejected
+		offer.UpdatedAt, err = transactionTime(ctx)
+		if err != nil {
+			return err
+		}
+		return putTransferOffer(ctx, offer)
+	case OfferAccepted:
+		buyer, err := readAccount(ctx, offer.Buyer)
+		if err != nil {
+			return err
+		}
+		buyer.Balance += offer.Escrowed
+		err = putAccount(ctx, buyer)
+		if err != nil {
+			return err
+		}
+
+		offer.Status = OfferRejected
+		return settle(ctx, offer, SettlementRefund, escrowAccount, offer.Buyer)
+	default:
+		return invalidTransitionError("the transfer offer %s is already %s", offerID, offer.Status)
+	}
+}
+
+// GetTransferOffersByHerbBatch returns every transfer offer made for the given herb batch
+func (s *SmartContract) GetTransferOffersByHerbBatch(ctx contractapi.TransactionContextInterface, batchID string) ([]*TransferOffer, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(offerObjectType+"~batch", []string{batchID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var offers []*TransferOffer
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		offer, err := s.ReadTransferOffer(ctx, keyParts[1])
+		if err != nil {
+			return nil, err
+		}
+		offers = append(offers, offer)
+	}
+
+	return offers, nil
+}
+
+// GetHerbBatchSettlements returns the escrow movements recorded for the given herb batch
+// in the order they were committed
+func (s *SmartContract) GetHerbBatchSettlements(ctx contractapi.TransactionContextInterface, batchID string) ([]*SettlementEntry, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(settlementObjectType, []string{batchID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var entries []*SettlementEntry
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var entry SettlementEntry
+		err = json.Unmarshal(queryResponse.Value, &entry)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, &entry)
+	}
+
+	// keys are ordered by transaction ID, so restore commit order from the timestamps
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Timestamp < entries[j].Timestamp
+	})
+
+	return entries, nil
+}
+
+// withdrawOpenOffers withdraws the open offers for a herb batch that has changed hands
+func (s *SmartContract) withdrawOpenOffers(ctx contractapi.TransactionContextInterface, batchID string) error {
+	offers, err := s.GetTransferOffersByHerbBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	for _, offer := range offers {
+		if offer.Status != OfferOpen {
+			continue
+		}
+		offer.Status = OfferWithdrawn
+		offer.UpdatedAt = now
+		err = putTransferOffer(ctx, offer)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// requireNoAcceptedOffer returns an error when a transfer offer for the herb batch
+// has been accepted, since its escrowed funds are waiting for the batch
+func (s *SmartContract) requireNoAcceptedOffer(ctx contractapi.TransactionContextInterface, batchID string) error {
+	offers, err := s.GetTransferOffersByHerbBatch(ctx, batchID)
+	if err != nil {
+		return err
+	}
+	for _, offer := range offers {
+		if offer.Status == OfferAccepted {
+			return invalidTransitionError("the herb batch %s already has accepted transfer offer %s", batchID, offer.ID)
+		}
+	}
+
+	return nil
+}
+
+// readBuyerOffer reads an offer and checks that the submitting client is its buyer
+func (s *SmartContract) readBuyerOffer(ctx contractapi.TransactionContextInterface, offerID string) (*TransferOffer, error) {
+	offer, err := s.ReadTransferOffer(ctx, offerID)
+	if err != nil {
+		return nil, err
+	}
+
+	clientID, err := s.GetClientAccountID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if clientID != offer.Buyer {
+		return nil, forbiddenError("only the buyer of transfer offer %s may perform this operation", offerID)
+	}
+
+	return offer, nil
+}
+
+// settle stores the offer and records the settlement entry and event for a movement
+// of the offer's escrowed amount between from and to
+func settle(ctx contractapi.TransactionContextInterface, offer *TransferOffer, action string, from string, to string) error {
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	offer.UpdatedAt = now
+	err = putTransferOffer(ctx, offer)
+	if err != nil {
+		return err
+	}
+
+	txID := ctx.GetStub().GetTxID()
+	entry := SettlementEntry{
+		Action:    action,
+		Amount:    offer.Escrowed,
+		BatchID:   offer.BatchID,
+		From:      from,
+		OfferID:   offer.ID,
+		Timestamp: now,
+		To:        to,
+		TxID:      txID,
+	}
+	entryJSON, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	entryKey, err := ctx.GetStub().CreateCompositeKey(settlementObjectType, []string{offer.BatchID, txID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(entryKey, entryJSON)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().SetEvent("Settlement"+action, entryJSON)
+}
+
+// readAccount returns the account with given ID, or an empty account if it has
+// never held funds
+func readAccount(ctx contractapi.TransactionContextInterface, accountID string) (*Account, error) {
+	if accountID == "" {
+		return nil, validationError("an account ID is required")
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(accountObjectType, []string{accountID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+
+	accountJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if accountJSON == nil {
+		return &Account{ID: accountID}, nil
+	}
+
+	var account Account
+	err = json.Unmarshal(accountJSON, &account)
+	if err != nil {
+		return nil, err
+	}
+
+	return &account, nil
+}
+
+func putAccount(ctx contractapi.TransactionContextInterface, account *Account) error {
+	key, err := ctx.GetStub().CreateCompositeKey(accountObjectType, []string{account.ID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	accountJSON, err := json.Marshal(account)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, accountJSON)
+}
+
+func putTransferOffer(ctx contractapi.TransactionContextInterface, offer *TransferOffer) error {
+	key, err := ctx.GetStub().CreateCompositeKey(offerObjectType, []string{offer.ID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	offerJSON, err := json.Marshal(offer)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, offerJSON)
+}
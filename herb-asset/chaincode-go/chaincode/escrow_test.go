@@ -0,0 +1,259 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/fakestub"
+	"github.com/stretchr/testify/require"
+)
+
+// newEscrowNetwork returns a network with one herb batch of the farmer and a buyer
+// account holding 1000
+func newEscrowNetwork(t *testing.T) *testNetwork {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	err := n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DepositFunds(ctx, n.accountID(n.buyer), 1000)
+	})
+	require.NoError(t, err)
+
+	return n
+}
+
+func (n *testNetwork) offerHerbBatch(offerID string, price int64) error {
+	return n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.OfferHerbBatch(ctx, offerID, "batch1", n.accountID(n.buyer), "Spice Traders", price)
+	})
+}
+
+func (n *testNetwork) balance(identity *fakestub.Identity) int64 {
+	accountID := n.accountID(identity)
+
+	var balance int64
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		balance, err = n.contract.GetAccountBalance(ctx, accountID)
+		return err
+	})
+	require.NoError(n.t, err)
+	return balance
+}
+
+func (n *testNetwork) readTransferOffer(offerID string) *chaincode.TransferOffer {
+	var offer *chaincode.TransferOffer
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		offer, err = n.contract.ReadTransferOffer(ctx, offerID)
+		return err
+	})
+	require.NoError(n.t, err)
+	return offer
+}
+
+func TestDepositFunds(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DepositFunds(ctx, n.accountID(n.farmer), 1000)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DepositFunds(ctx, n.accountID(n.buyer), 0)
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DepositFunds(ctx, n.accountID(n.buyer), 250)
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(250), n.balance(n.buyer))
+}
+
+func TestOfferHerbBatch(t *testing.T) {
+	n := newEscrowNetwork(t)
+
+	require.NoError(t, n.offerHerbBatch("offer1", 600))
+
+	offer := n.readTransferOffer("offer1")
+	require.Equal(t, chaincode.OfferOpen, offer.Status)
+	require.Equal(t, n.accountID(n.farmer), offer.Seller)
+	require.Equal(t, n.accountID(n.buyer), offer.Buyer)
+
+	requireCode(t, n.offerHerbBatch("offer1", 600), chaincode.CodeAlreadyExists)
+	requireCode(t, n.offerHerbBatch("offer2", 0), chaincode.CodeValidation)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.OfferHerbBatch(ctx, "offer3", "missing", n.accountID(n.buyer), "Spice Traders", 600)
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.OfferHerbBatch(ctx, "offer4", "batch1", n.accountID(n.farmer), "Ravi Sharma", 600)
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+
+	// only the identity holding the batch, or an admin of its organisation, may sell it
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.OfferHerbBatch(ctx, "offer5", "batch1", n.accountID(n.admin), "Kerala Ayurveda", 600)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	clerk := newIdentity(t, org1MSP, "clerk", []string{"client"}, nil)
+	err = n.submit(clerk, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.OfferHerbBatch(ctx, "offer6", "batch1", n.accountID(n.buyer), "Spice Traders", 600)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.OfferHerbBatch(ctx, "offer7", "batch1", n.accountID(n.buyer), "Spice Traders", 600)
+	})
+	require.NoError(t, err)
+}
+
+func TestConfirmCustody(t *testing.T) {
+	n := newEscrowNetwork(t)
+	require.NoError(t, n.offerHerbBatch("offer1", 600))
+	require.NoError(t, n.offerHerbBatch("offer2", 700))
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.AcceptTransferOffer(ctx, "offer1")
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.ConfirmCustody(ctx, "offer1")
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.AcceptTransferOffer(ctx, "offer1")
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(400), n.balance(n.buyer))
+	require.Equal(t, int64(600), n.readTransferOffer("offer1").Escrowed)
+	require.Equal(t, n.accountID(n.farmer), n.readTransferOffer("offer1").HolderID)
+	require.Equal(t, org1MSP, n.readTransferOffer("offer1").SellerOrg)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.AcceptTransferOffer(ctx, "offer2")
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.ConfirmCustody(ctx, "offer1")
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, int64(600), n.balance(n.farmer))
+	require.Equal(t, int64(400), n.balance(n.buyer))
+	require.Equal(t, chaincode.OfferSettled, n.readTransferOffer("offer1").Status)
+	require.Equal(t, chaincode.OfferWithdrawn, n.readTransferOffer("offer2").Status)
+
+	herbBatch := n.readHerbBatch("batch1")
+	require.Equal(t, "Spice Traders", herbBatch.Owner)
+	require.Equal(t, n.accountID(n.buyer), herbBatch.OwnerID)
+	require.Equal(t, org2MSP, herbBatch.OwnerOrg)
+
+	var settlements []*chaincode.SettlementEntry
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		settlements, err = n.contract.GetHerbBatchSettlements(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, settlements, 2)
+	require.Equal(t, chaincode.SettlementLock, settlements[0].Action)
+	require.Equal(t, chaincode.SettlementRelease, settlements[1].Action)
+	require.Equal(t, n.accountID(n.farmer), settlements[1].To)
+
+	events := n.ledger.Events()
+	require.Len(t, events, 2)
+	require.Equal(t, "SettlementLock", events[0].EventName)
+	require.Equal(t, "SettlementRelease", events[1].EventName)
+}
+
+func TestRejectTransferOffer(t *testing.T) {
+	n := newEscrowNetwork(t)
+	require.NoError(t, n.offerHerbBatch("offer1", 600))
+	require.NoError(t, n.offerHerbBatch("offer2", 300))
+
+	err := n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RejectTransferOffer(ctx, "offer2")
+	})
+	require.NoError(t, err)
+	require.Equal(t, chaincode.OfferRejected, n.readTransferOffer("offer2").Status)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.AcceptTransferOffer(ctx, "offer1")
+	})
+	require.NoError(t, err)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RejectTransferOffer(ctx, "offer1")
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), n.balance(n.buyer))
+	require.Equal(t, "Ravi Sharma", n.readHerbBatch("batch1").Owner)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RejectTransferOffer(ctx, "offer1")
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	var offers []*chaincode.TransferOffer
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		offers, err = n.contract.GetTransferOffersByHerbBatch(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, offers, 2)
+}
+
+func TestAcceptedOfferBlocksDirectTransfer(t *testing.T) {
+	n := newEscrowNetwork(t)
+	require.NoError(t, n.offerHerbBatch("offer1", 600))
+
+	err := n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.AcceptTransferOffer(ctx, "offer1")
+	})
+	require.NoError(t, err)
+
+	transfer := func() error {
+		return n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+			_, err := n.contract.TransferHerbBatch(ctx, "batch1", "Priya Patel", "")
+			return err
+		})
+	}
+	requireCode(t, transfer(), chaincode.CodeInvalidTransition)
+	require.Equal(t, "Ravi Sharma", n.readHerbBatch("batch1").Owner)
+
+	// the escrowed funds stay claimable by the buyer until the offer is closed
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RejectTransferOffer(ctx, "offer1")
+	})
+	require.NoError(t, err)
+	require.Equal(t, int64(1000), n.balance(n.buyer))
+
+	require.NoError(t, transfer())
+	require.Equal(t, "Priya Patel", n.readHerbBatch("batch1").Owner)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.ConfirmCustody(ctx, "offer1")
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+	require.Equal(t, int64(0), n.balance(n.farmer))
+}
+
+func TestAcceptTransferOfferInsufficientBalance(t *testing.T) {
+	n := newEscrowNetwork(t)
+	require.NoError(t, n.offerHerbBatch("offer1", 1500))
+
+	err := n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.AcceptTransferOffer(ctx, "offer1")
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+	require.Equal(t, int64(1000), n.balance(n.buyer))
+}
@@ -0,0 +1,220 @@
+package fakestub_test
+
+import (
+	"encoding/pem"
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/fakestub"
+	"github.com/stretchr/testify/require"
+)
+
+func collectKeys(t *testing.T, iterator shim.StateQueryIteratorInterface) []string {
+	defer iterator.Close()
+
+	var keys []string
+	for iterator.HasNext() {
+		kv, err := iterator.Next()
+		require.NoError(t, err)
+		keys = append(keys, kv.Key)
+	}
+	return keys
+}
+
+func TestWritesAreVisibleAfterCommit(t *testing.T) {
+	ledger := fakestub.NewLedger()
+
+	stub := ledger.NewStub(nil)
+	require.NoError(t, stub.PutState("batch1", []byte("v1")))
+	value, err := stub.GetState("batch1")
+	require.NoError(t, err)
+	require.Nil(t, value, "a transaction must not read its own writes")
+
+	discarded := ledger.NewStub(nil)
+	require.NoError(t, discarded.PutState("batch2", []byte("v1")))
+
+	require.NoError(t, stub.Commit())
+	require.Error(t, stub.Commit())
+	require.Equal(t, []byte("v1"), ledger.State("batch1"))
+	require.Nil(t, ledger.State("batch2"))
+}
+
+func TestRangeQueries(t *testing.T) {
+	ledger := fakestub.NewLedger()
+
+	stub := ledger.NewStub(nil)
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, stub.PutState(key, []byte(key)))
+	}
+	for _, serial := range []string{"1", "2", "3"} {
+		key, err := stub.CreateCompositeKey("serial", []string{"gtin", serial})
+		require.NoError(t, err)
+		require.NoError(t, stub.PutState(key, []byte(serial)))
+	}
+	require.NoError(t, stub.Commit())
+
+	stub = ledger.NewStub(nil)
+
+	iterator, err := stub.GetStateByRange("", "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "c"}, collectKeys(t, iterator))
+
+	iterator, err = stub.GetStateByRange("b", "c")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, collectKeys(t, iterator))
+
+	_, err = stub.GetStateByRange("\x00serial", "")
+	require.Error(t, err)
+
+	iterator, err = stub.GetStateByPartialCompositeKey("serial", []string{"gtin"})
+	require.NoError(t, err)
+	keys := collectKeys(t, iterator)
+	require.Len(t, keys, 3)
+	objectType, attributes, err := stub.SplitCompositeKey(keys[1])
+	require.NoError(t, err)
+	require.Equal(t, "serial", objectType)
+	require.Equal(t, []string{"gtin", "2"}, attributes)
+
+	iterator, metadata, err := stub.GetStateByPartialCompositeKeyWithPagination("serial", []string{}, 2, "")
+	require.NoError(t, err)
+	require.Len(t, collectKeys(t, iterator), 2)
+	require.Equal(t, int32(2), metadata.FetchedRecordsCount)
+	require.Equal(t, keys[2], metadata.Bookmark)
+
+	iterator, metadata, err = stub.GetStateByPartialCompositeKeyWithPagination("serial", []string{}, 2, metadata.Bookmark)
+	require.NoError(t, err)
+	require.Equal(t, keys[2:], collectKeys(t, iterator))
+	require.Empty(t, metadata.Bookmark)
+
+	_, err = stub.CreateCompositeKey("serial", []string{"bad\x00attribute"})
+	require.Error(t, err)
+}
+
+func TestHistory(t *testing.T) {
+	ledger := fakestub.NewLedger()
+	ledger.SetTime(time.Date(2024, time.August, 15, 10, 0, 0, 0, time.UTC))
+
+	stub := ledger.NewStub(nil)
+	require.NoError(t, stub.PutState("batch1", []byte("v1")))
+	require.NoError(t, stub.Commit())
+
+	stub = ledger.NewStub(nil)
+	require.NoError(t, stub.PutState("batch1", []byte("v2")))
+	require.NoError(t, stub.Commit())
+
+	stub = ledger.NewStub(nil)
+	require.NoError(t, stub.DelState("batch1"))
+	require.NoError(t, stub.Commit())
+
+	iterator, err := ledger.NewStub(nil).GetHistoryForKey("batch1")
+	require.NoError(t, err)
+	defer iterator.Close()
+
+	var values []string
+	var deletes []bool
+	for iterator.HasNext() {
+		modification, err := iterator.Next()
+		require.NoError(t, err)
+		values = append(values, string(modification.Value))
+		deletes = append(deletes, modification.IsDelete)
+	}
+	require.Equal(t, []string{"", "v2", "v1"}, values)
+	require.Equal(t, []bool{true, false, false}, deletes)
+
+	first := ledger.History("batch1")[0]
+	require.Equal(t, time.Date(2024, time.August, 15, 10, 0, 0, 0, time.UTC), first.Timestamp.AsTime())
+}
+
+func TestPrivateData(t *testing.T) {
+	ledger := fakestub.NewLedger()
+
+	stub := ledger.NewStub(nil)
+	require.NoError(t, stub.PutPrivateData("pricing", "batch1", []byte("420")))
+	require.Error(t, stub.PutPrivateData("", "batch1", []byte("420")))
+	require.NoError(t, stub.Commit())
+
+	stub = ledger.NewStub(nil)
+	value, err := stub.GetPrivateData("pricing", "batch1")
+	require.NoError(t, err)
+	require.Equal(t, []byte("420"), value)
+
+	hash, err := stub.GetPrivateDataHash("pricing", "batch1")
+	require.NoError(t, err)
+	require.Len(t, hash, 32)
+
+	value, err = stub.GetState("batch1")
+	require.NoError(t, err)
+	require.Nil(t, value)
+}
+
+func TestEvents(t *testing.T) {
+	ledger := fakestub.NewLedger()
+
+	stub := ledger.NewStub(nil)
+	require.Error(t, stub.SetEvent("", nil))
+	require.NoError(t, stub.SetEvent("First", []byte("1")))
+	require.NoError(t, stub.SetEvent("Second", []byte("2")))
+	require.NoError(t, stub.Commit())
+
+	events := ledger.Events()
+	require.Len(t, events, 1)
+	require.Equal(t, "Second", events[0].EventName)
+	require.Equal(t, stub.GetTxID(), events[0].TxId)
+}
+
+func TestClientIdentity(t *testing.T) {
+	ledger := fakestub.NewLedger()
+
+	identity, err := fakestub.NewIdentity("Org1MSP", "admin", []string{"admin"}, map[string]string{"hf.Type": "admin"})
+	require.NoError(t, err)
+
+	ctx, err := ledger.NewStub(identity).TransactionContext()
+	require.NoError(t, err)
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	require.NoError(t, err)
+	require.Equal(t, "Org1MSP", mspID)
+
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue("hf.Type")
+	require.NoError(t, err)
+	require.True(t, found)
+	require.Equal(t, "admin", value)
+
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	require.NoError(t, err)
+	require.Equal(t, []string{"admin"}, cert.Subject.OrganizationalUnit)
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	require.NoError(t, err)
+	expected, err := identity.ID()
+	require.NoError(t, err)
+	require.Equal(t, expected, clientID)
+}
+
+func TestIdentityFromCertificate(t *testing.T) {
+	issued, err := fakestub.NewIdentity("Org2MSP", "lab1", []string{"client"}, nil)
+	require.NoError(t, err)
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: issued.Certificate.Raw})
+
+	identity, err := fakestub.IdentityFromCertificate("Org2MSP", certPEM)
+	require.NoError(t, err)
+	require.Equal(t, "lab1", identity.Name)
+	require.Equal(t, issued.Creator(), identity.Creator())
+
+	_, err = fakestub.IdentityFromCertificate("Org2MSP", []byte("not a certificate"))
+	require.Error(t, err)
+}
+
+func TestTransactionTimestamps(t *testing.T) {
+	ledger := fakestub.NewLedger()
+	start := ledger.Now()
+
+	first, err := ledger.NewStub(nil).GetTxTimestamp()
+	require.NoError(t, err)
+	second, err := ledger.NewStub(nil).GetTxTimestamp()
+	require.NoError(t, err)
+
+	require.Equal(t, start, first.AsTime())
+	require.True(t, second.AsTime().After(first.AsTime()))
+}
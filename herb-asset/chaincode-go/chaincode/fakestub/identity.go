@@ -0,0 +1,127 @@
+package fakestub
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/attrmgr"
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-protos-go-apiv2/msp"
+	"google.golang.org/protobuf/proto"
+)
+
+// Identity is a client of an organisation, backed by a self-signed X.509
+// certificate carrying its organisational units and Fabric CA attributes
+type Identity struct {
+	MSPID       string
+	Name        string
+	Certificate *x509.Certificate
+
+	creator []byte
+}
+
+// NewIdentity creates a client identity of mspID with the given common name,
+// organisational units and attributes, e.g. {"hf.Type": "admin"}
+func NewIdentity(mspID string, name string, organizationalUnits []string, attributes map[string]string) (*Identity, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 64))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate serial number: %v", err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			CommonName:         name,
+			Organization:       []string{mspID},
+			OrganizationalUnit: organizationalUnits,
+		},
+		NotBefore: time.Now().Add(-time.Hour),
+		NotAfter:  time.Now().Add(24 * time.Hour),
+		KeyUsage:  x509.KeyUsageDigitalSignature,
+	}
+	if len(attributes) > 0 {
+		attributesJSON, err := json.Marshal(&attrmgr.Attributes{Attrs: attributes})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal attributes: %v", err)
+		}
+		template.ExtraExtensions = []pkix.Extension{{Id: attrmgr.AttrOID, Value: attributesJSON}}
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create certificate: %v", err)
+	}
+	certificate, err := x509.ParseCertificate(certDER)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{
+		Mspid:   mspID,
+		IdBytes: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal serialized identity: %v", err)
+	}
+
+	return &Identity{
+		MSPID:       mspID,
+		Name:        name,
+		Certificate: certificate,
+		creator:     creator,
+	}, nil
+}
+
+// IdentityFromCertificate wraps an existing PEM certificate of mspID, such as one
+// issued by a Fabric CA, so that transactions run as its holder
+func IdentityFromCertificate(mspID string, certPEM []byte) (*Identity, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	certificate, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse certificate: %v", err)
+	}
+
+	creator, err := proto.Marshal(&msp.SerializedIdentity{Mspid: mspID, IdBytes: certPEM})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal serialized identity: %v", err)
+	}
+
+	return &Identity{
+		MSPID:       mspID,
+		Name:        certificate.Subject.CommonName,
+		Certificate: certificate,
+		creator:     creator,
+	}, nil
+}
+
+// ID returns the client ID the chaincode sees for the identity, as returned by
+// cid.ClientIdentity.GetID
+func (id *Identity) ID() (string, error) {
+	clientIdentity, err := cid.New(&Stub{creator: id.creator})
+	if err != nil {
+		return "", err
+	}
+
+	return clientIdentity.GetID()
+}
+
+// Creator returns the serialized identity submitted with transactions
+func (id *Identity) Creator() []byte {
+	return id.creator
+}
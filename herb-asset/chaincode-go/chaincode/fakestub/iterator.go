@@ -0,0 +1,79 @@
+package fakestub
+
+import (
+	"errors"
+
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+)
+
+// errIteratorClosed is returned by Next once an iterator has been closed
+var errIteratorClosed = errors.New("iterator has been closed")
+
+// errIteratorExhausted is returned by Next when there are no more results
+var errIteratorExhausted = errors.New("no more results")
+
+// StateIterator iterates a snapshot of key-value pairs. It implements
+// shim.StateQueryIteratorInterface.
+type StateIterator struct {
+	results []*queryresult.KV
+	next    int
+	closed  bool
+}
+
+// HasNext returns true while there are results left
+func (it *StateIterator) HasNext() bool {
+	return !it.closed && it.next < len(it.results)
+}
+
+// Next returns the next key-value pair
+func (it *StateIterator) Next() (*queryresult.KV, error) {
+	if it.closed {
+		return nil, errIteratorClosed
+	}
+	if it.next >= len(it.results) {
+		return nil, errIteratorExhausted
+	}
+
+	result := it.results[it.next]
+	it.next++
+	return result, nil
+}
+
+// Close releases the iterator
+func (it *StateIterator) Close() error {
+	it.closed = true
+	return nil
+}
+
+// HistoryIterator iterates a snapshot of key modifications. It implements
+// shim.HistoryQueryIteratorInterface.
+type HistoryIterator struct {
+	results []*queryresult.KeyModification
+	next    int
+	closed  bool
+}
+
+// HasNext returns true while there are results left
+func (it *HistoryIterator) HasNext() bool {
+	return !it.closed && it.next < len(it.results)
+}
+
+// Next returns the next key modification
+func (it *HistoryIterator) Next() (*queryresult.KeyModification, error) {
+	if it.closed {
+		return nil, errIteratorClosed
+	}
+	if it.next >= len(it.results) {
+		return nil, errIteratorExhausted
+	}
+
+	result := it.results[it.next]
+	it.next++
+	return result, nil
+}
+
+// Close releases the iterator
+func (it *HistoryIterator) Close() error {
+	it.closed = true
+	return nil
+}
@@ -0,0 +1,216 @@
+// Package fakestub provides an in-memory ledger and a map-backed implementation of
+// shim.ChaincodeStubInterface for unit testing chaincode without a Fabric network.
+//
+// Each transaction runs against its own Stub. Reads see the state committed by
+// earlier transactions only, as on a peer, and the writes of a transaction are
+// applied to the ledger when it is committed.
+package fakestub
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// DefaultChannelID is the channel reported by stubs of a new ledger
+const DefaultChannelID = "herbtrace"
+
+// Ledger is the committed world state, private data, key history and events of a
+// single channel
+type Ledger struct {
+	ChannelID string
+
+	state          map[string][]byte
+	validation     map[string][]byte
+	privateData    map[string]map[string][]byte
+	privateParams  map[string]map[string][]byte
+	history        map[string][]*queryresult.KeyModification
+	events         []*peer.ChaincodeEvent
+	clock          time.Time
+	tick           time.Duration
+	txCount        int
+	committedTxIDs map[string]bool
+}
+
+// NewLedger returns an empty ledger whose clock starts at 2024-01-01T00:00:00Z and
+// advances by one second per transaction
+func NewLedger() *Ledger {
+	return &Ledger{
+		ChannelID:      DefaultChannelID,
+		state:          map[string][]byte{},
+		validation:     map[string][]byte{},
+		privateData:    map[string]map[string][]byte{},
+		privateParams:  map[string]map[string][]byte{},
+		history:        map[string][]*queryresult.KeyModification{},
+		clock:          time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC),
+		tick:           time.Second,
+		committedTxIDs: map[string]bool{},
+	}
+}
+
+// SetTime sets the timestamp of the next transaction
+func (l *Ledger) SetTime(t time.Time) {
+	l.clock = t.UTC()
+}
+
+// Now returns the timestamp the next transaction will carry
+func (l *Ledger) Now() time.Time {
+	return l.clock
+}
+
+// NewStub starts a transaction submitted by identity. A nil identity leaves the
+// creator empty, which makes client identity lookups fail.
+func (l *Ledger) NewStub(identity *Identity, args ...string) *Stub {
+	l.txCount++
+	txID := fmt.Sprintf("tx%06d", l.txCount)
+	timestamp := l.clock
+	l.clock = l.clock.Add(l.tick)
+
+	var creator []byte
+	if identity != nil {
+		creator = identity.creator
+	}
+
+	byteArgs := make([][]byte, len(args))
+	for i, arg := range args {
+		byteArgs[i] = []byte(arg)
+	}
+
+	return &Stub{
+		ledger:           l,
+		txID:             txID,
+		timestamp:        timestamppb.New(timestamp),
+		creator:          creator,
+		args:             byteArgs,
+		transient:        map[string][]byte{},
+		writes:           map[string]*write{},
+		validationWrites: map[string][]byte{},
+		privateWrites:    map[string]map[string]*write{},
+		privateParams:    map[string]map[string][]byte{},
+	}
+}
+
+// Submit runs fn as a transaction of identity and commits its writes when fn
+// returns no error
+func (l *Ledger) Submit(identity *Identity, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	stub := l.NewStub(identity)
+	ctx, err := stub.TransactionContext()
+	if err != nil {
+		return err
+	}
+
+	err = fn(ctx)
+	if err != nil {
+		return err
+	}
+
+	return stub.Commit()
+}
+
+// Evaluate runs fn as a transaction of identity and discards its writes
+func (l *Ledger) Evaluate(identity *Identity, fn func(ctx contractapi.TransactionContextInterface) error) error {
+	stub := l.NewStub(identity)
+	ctx, err := stub.TransactionContext()
+	if err != nil {
+		return err
+	}
+
+	return fn(ctx)
+}
+
+// State returns the committed value of key, or nil when it is not set
+func (l *Ledger) State(key string) []byte {
+	return l.state[key]
+}
+
+// Keys returns the committed world state keys in order, including composite keys
+func (l *Ledger) Keys() []string {
+	return sortedKeys(l.state)
+}
+
+// PrivateData returns the committed value of key in collection, or nil when it is not set
+func (l *Ledger) PrivateData(collection string, key string) []byte {
+	return l.privateData[collection][key]
+}
+
+// ValidationParameter returns the committed key-level endorsement policy of key
+func (l *Ledger) ValidationParameter(key string) []byte {
+	return l.validation[key]
+}
+
+// Events returns the chaincode events of every committed transaction in order
+func (l *Ledger) Events() []*peer.ChaincodeEvent {
+	return l.events
+}
+
+// History returns the committed modifications of key, oldest first
+func (l *Ledger) History(key string) []*queryresult.KeyModification {
+	return l.history[key]
+}
+
+func (l *Ledger) commit(stub *Stub) error {
+	if l.committedTxIDs[stub.txID] {
+		return fmt.Errorf("transaction %s has already been committed", stub.txID)
+	}
+	l.committedTxIDs[stub.txID] = true
+
+	for _, key := range sortedKeys(stub.writes) {
+		w := stub.writes[key]
+		if w.deleted {
+			delete(l.state, key)
+			delete(l.validation, key)
+		} else {
+			l.state[key] = w.value
+		}
+		l.history[key] = append(l.history[key], &queryresult.KeyModification{
+			TxId:      stub.txID,
+			Value:     w.value,
+			Timestamp: stub.timestamp,
+			IsDelete:  w.deleted,
+		})
+	}
+	for key, ep := range stub.validationWrites {
+		l.validation[key] = ep
+	}
+
+	for collection, writes := range stub.privateWrites {
+		if l.privateData[collection] == nil {
+			l.privateData[collection] = map[string][]byte{}
+		}
+		for key, w := range writes {
+			if w.deleted {
+				delete(l.privateData[collection], key)
+			} else {
+				l.privateData[collection][key] = w.value
+			}
+		}
+	}
+	for collection, params := range stub.privateParams {
+		if l.privateParams[collection] == nil {
+			l.privateParams[collection] = map[string][]byte{}
+		}
+		for key, ep := range params {
+			l.privateParams[collection][key] = ep
+		}
+	}
+
+	if stub.event != nil {
+		l.events = append(l.events, stub.event)
+	}
+
+	return nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,523 @@
+package fakestub
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/hyperledger/fabric-chaincode-go/v2/pkg/cid"
+	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
+	"github.com/hyperledger/fabric-protos-go-apiv2/peer"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Key encoding used by the peer, see shim.ChaincodeStub
+const (
+	compositeKeyNamespace = "\x00"
+	emptyKeySubstitute    = "\x01"
+	minUnicodeRuneValue   = 0
+	maxUnicodeRuneValue   = utf8.MaxRune
+)
+
+// ErrNotSupported is returned by stub operations that need a peer, such as rich
+// queries and chaincode to chaincode invocation
+var ErrNotSupported = errors.New("not supported by the fake stub")
+
+type write struct {
+	value   []byte
+	deleted bool
+}
+
+// Stub is a single transaction against a Ledger. It implements
+// shim.ChaincodeStubInterface.
+type Stub struct {
+	ledger    *Ledger
+	txID      string
+	timestamp *timestamppb.Timestamp
+	creator   []byte
+	args      [][]byte
+	transient map[string][]byte
+	event     *peer.ChaincodeEvent
+
+	writes           map[string]*write
+	validationWrites map[string][]byte
+	privateWrites    map[string]map[string]*write
+	privateParams    map[string]map[string][]byte
+}
+
+var _ shim.ChaincodeStubInterface = (*Stub)(nil)
+
+// TransactionContext returns a contract API transaction context for the stub whose
+// client identity is read from the creator, as on a peer
+func (s *Stub) TransactionContext() (*contractapi.TransactionContext, error) {
+	ctx := &contractapi.TransactionContext{}
+	ctx.SetStub(s)
+
+	if s.creator != nil {
+		clientIdentity, err := cid.New(s)
+		if err != nil {
+			return nil, err
+		}
+		ctx.SetClientIdentity(clientIdentity)
+	}
+
+	return ctx, nil
+}
+
+// Commit applies the writes, private data and event of the transaction to the ledger
+func (s *Stub) Commit() error {
+	return s.ledger.commit(s)
+}
+
+// SetTransient sets the transient data passed with the transaction proposal
+func (s *Stub) SetTransient(transient map[string][]byte) {
+	s.transient = transient
+}
+
+// Event returns the event set by the transaction, or nil
+func (s *Stub) Event() *peer.ChaincodeEvent {
+	return s.event
+}
+
+// GetArgs returns the arguments the stub was created with
+func (s *Stub) GetArgs() [][]byte {
+	return s.args
+}
+
+// GetStringArgs returns the arguments the stub was created with as strings
+func (s *Stub) GetStringArgs() []string {
+	args := make([]string, len(s.args))
+	for i, arg := range s.args {
+		args[i] = string(arg)
+	}
+	return args
+}
+
+// GetFunctionAndParameters returns the first argument as the function name and the
+// rest as its parameters
+func (s *Stub) GetFunctionAndParameters() (string, []string) {
+	args := s.GetStringArgs()
+	if len(args) == 0 {
+		return "", []string{}
+	}
+	return args[0], args[1:]
+}
+
+// GetArgsSlice returns the arguments concatenated into one slice
+func (s *Stub) GetArgsSlice() ([]byte, error) {
+	var slice []byte
+	for _, arg := range s.args {
+		slice = append(slice, arg...)
+	}
+	return slice, nil
+}
+
+// GetTxID returns the transaction ID
+func (s *Stub) GetTxID() string {
+	return s.txID
+}
+
+// GetChannelID returns the channel of the ledger
+func (s *Stub) GetChannelID() string {
+	return s.ledger.ChannelID
+}
+
+// InvokeChaincode is not supported
+func (s *Stub) InvokeChaincode(chaincodeName string, args [][]byte, channel string) *peer.Response {
+	return &peer.Response{
+		Status:  shim.ERROR,
+		Message: fmt.Sprintf("invoking chaincode %s: %v", chaincodeName, ErrNotSupported),
+	}
+}
+
+// GetState returns the committed value of key. Writes of the current transaction
+// are not visible, as on a peer.
+func (s *Stub) GetState(key string) ([]byte, error) {
+	return copyBytes(s.ledger.state[key]), nil
+}
+
+// PutState records a write of key
+func (s *Stub) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	if len(value) == 0 {
+		// the peer treats an empty value as a delete
+		return s.DelState(key)
+	}
+
+	s.writes[key] = &write{value: copyBytes(value)}
+	return nil
+}
+
+// DelState records the deletion of key
+func (s *Stub) DelState(key string) error {
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+
+	s.writes[key] = &write{deleted: true}
+	return nil
+}
+
+// SetStateValidationParameter records the key-level endorsement policy of key
+func (s *Stub) SetStateValidationParameter(key string, ep []byte) error {
+	s.validationWrites[key] = copyBytes(ep)
+	return nil
+}
+
+// GetStateValidationParameter returns the committed key-level endorsement policy of key
+func (s *Stub) GetStateValidationParameter(key string) ([]byte, error) {
+	return copyBytes(s.ledger.validation[key]), nil
+}
+
+// GetStateByRange iterates the committed simple keys in [startKey, endKey). Empty
+// keys leave the range open, without including composite keys.
+func (s *Stub) GetStateByRange(startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+
+	return s.rangeIterator(s.ledger.state, startKey, endKey, 0), nil
+}
+
+// GetStateByRangeWithPagination iterates one page of committed simple keys in
+// [startKey, endKey). The bookmark is the key the next page starts at.
+func (s *Stub) GetStateByRangeWithPagination(startKey string, endKey string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, nil, err
+	}
+	if pageSize <= 0 {
+		return nil, nil, errors.New("pageSize must be greater than zero")
+	}
+	if bookmark != "" {
+		startKey = bookmark
+	}
+
+	iterator, metadata := s.pageIterator(startKey, endKey, pageSize)
+	return iterator, metadata, nil
+}
+
+// GetStateByPartialCompositeKey iterates the committed composite keys of objectType
+// starting with the given attributes
+func (s *Stub) GetStateByPartialCompositeKey(objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.rangeIterator(s.ledger.state, startKey, endKey, 0), nil
+}
+
+// GetStateByPartialCompositeKeyWithPagination iterates one page of the committed
+// composite keys of objectType starting with the given attributes
+func (s *Stub) GetStateByPartialCompositeKeyWithPagination(objectType string, keys []string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pageSize <= 0 {
+		return nil, nil, errors.New("pageSize must be greater than zero")
+	}
+	if bookmark != "" {
+		if bookmark < startKey || bookmark >= endKey {
+			return nil, nil, fmt.Errorf("invalid bookmark %q", bookmark)
+		}
+		startKey = bookmark
+	}
+
+	iterator, metadata := s.pageIterator(startKey, endKey, pageSize)
+	return iterator, metadata, nil
+}
+
+// CreateCompositeKey combines objectType and attributes into a composite key
+func (s *Stub) CreateCompositeKey(objectType string, attributes []string) (string, error) {
+	return createCompositeKey(objectType, attributes)
+}
+
+// SplitCompositeKey splits a composite key into its object type and attributes
+func (s *Stub) SplitCompositeKey(compositeKey string) (string, []string, error) {
+	if !strings.HasPrefix(compositeKey, compositeKeyNamespace) {
+		return "", nil, fmt.Errorf("%q is not a composite key", compositeKey)
+	}
+
+	components := strings.Split(strings.TrimSuffix(compositeKey[1:], compositeKeyNamespace), compositeKeyNamespace)
+	return components[0], components[1:], nil
+}
+
+// GetQueryResult is not supported, as rich queries need CouchDB
+func (s *Stub) GetQueryResult(query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("rich query: %w", ErrNotSupported)
+}
+
+// GetQueryResultWithPagination is not supported, as rich queries need CouchDB
+func (s *Stub) GetQueryResultWithPagination(query string, pageSize int32, bookmark string) (shim.StateQueryIteratorInterface, *peer.QueryResponseMetadata, error) {
+	return nil, nil, fmt.Errorf("rich query: %w", ErrNotSupported)
+}
+
+// GetHistoryForKey iterates the committed modifications of key, newest first
+func (s *Stub) GetHistoryForKey(key string) (shim.HistoryQueryIteratorInterface, error) {
+	modifications := s.ledger.history[key]
+	results := make([]*queryresult.KeyModification, len(modifications))
+	for i, modification := range modifications {
+		results[len(modifications)-1-i] = modification
+	}
+
+	return &HistoryIterator{results: results}, nil
+}
+
+// GetPrivateData returns the committed value of key in collection
+func (s *Stub) GetPrivateData(collection string, key string) ([]byte, error) {
+	if collection == "" {
+		return nil, errors.New("collection must not be an empty string")
+	}
+	return copyBytes(s.ledger.privateData[collection][key]), nil
+}
+
+// GetPrivateDataHash returns the SHA-256 hash of the committed value of key in collection
+func (s *Stub) GetPrivateDataHash(collection string, key string) ([]byte, error) {
+	value, err := s.GetPrivateData(collection, key)
+	if err != nil || value == nil {
+		return nil, err
+	}
+
+	hash := sha256.Sum256(value)
+	return hash[:], nil
+}
+
+// PutPrivateData records a write of key in collection
+func (s *Stub) PutPrivateData(collection string, key string, value []byte) error {
+	if collection == "" {
+		return errors.New("collection must not be an empty string")
+	}
+	if key == "" {
+		return errors.New("key must not be an empty string")
+	}
+	if len(value) == 0 {
+		return s.DelPrivateData(collection, key)
+	}
+
+	s.privateWrite(collection)[key] = &write{value: copyBytes(value)}
+	return nil
+}
+
+// DelPrivateData records the deletion of key in collection
+func (s *Stub) DelPrivateData(collection string, key string) error {
+	if collection == "" {
+		return errors.New("collection must not be an empty string")
+	}
+
+	s.privateWrite(collection)[key] = &write{deleted: true}
+	return nil
+}
+
+// PurgePrivateData records the deletion of key in collection
+func (s *Stub) PurgePrivateData(collection string, key string) error {
+	return s.DelPrivateData(collection, key)
+}
+
+// SetPrivateDataValidationParameter records the key-level endorsement policy of key in collection
+func (s *Stub) SetPrivateDataValidationParameter(collection string, key string, ep []byte) error {
+	if s.privateParams[collection] == nil {
+		s.privateParams[collection] = map[string][]byte{}
+	}
+	s.privateParams[collection][key] = copyBytes(ep)
+	return nil
+}
+
+// GetPrivateDataValidationParameter returns the committed key-level endorsement
+// policy of key in collection
+func (s *Stub) GetPrivateDataValidationParameter(collection string, key string) ([]byte, error) {
+	return copyBytes(s.ledger.privateParams[collection][key]), nil
+}
+
+// GetPrivateDataByRange iterates the committed keys of collection in [startKey, endKey)
+func (s *Stub) GetPrivateDataByRange(collection string, startKey string, endKey string) (shim.StateQueryIteratorInterface, error) {
+	if collection == "" {
+		return nil, errors.New("collection must not be an empty string")
+	}
+	if startKey == "" {
+		startKey = emptyKeySubstitute
+	}
+	if err := validateSimpleKeys(startKey, endKey); err != nil {
+		return nil, err
+	}
+
+	return s.rangeIterator(s.ledger.privateData[collection], startKey, endKey, 0), nil
+}
+
+// GetPrivateDataByPartialCompositeKey iterates the committed composite keys of
+// objectType in collection starting with the given attributes
+func (s *Stub) GetPrivateDataByPartialCompositeKey(collection string, objectType string, keys []string) (shim.StateQueryIteratorInterface, error) {
+	if collection == "" {
+		return nil, errors.New("collection must not be an empty string")
+	}
+	startKey, endKey, err := partialCompositeKeyRange(objectType, keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.rangeIterator(s.ledger.privateData[collection], startKey, endKey, 0), nil
+}
+
+// GetPrivateDataQueryResult is not supported, as rich queries need CouchDB
+func (s *Stub) GetPrivateDataQueryResult(collection string, query string) (shim.StateQueryIteratorInterface, error) {
+	return nil, fmt.Errorf("rich query: %w", ErrNotSupported)
+}
+
+// GetCreator returns the serialized identity of the submitting client
+func (s *Stub) GetCreator() ([]byte, error) {
+	return s.creator, nil
+}
+
+// GetTransient returns the transient data set with SetTransient
+func (s *Stub) GetTransient() (map[string][]byte, error) {
+	return s.transient, nil
+}
+
+// GetBinding returns nil, as the fake stub has no proposal
+func (s *Stub) GetBinding() ([]byte, error) {
+	return nil, nil
+}
+
+// GetDecorations returns no decorations
+func (s *Stub) GetDecorations() map[string][]byte {
+	return map[string][]byte{}
+}
+
+// GetSignedProposal returns an empty signed proposal
+func (s *Stub) GetSignedProposal() (*peer.SignedProposal, error) {
+	return &peer.SignedProposal{}, nil
+}
+
+// GetTxTimestamp returns the timestamp of the transaction
+func (s *Stub) GetTxTimestamp() (*timestamppb.Timestamp, error) {
+	return s.timestamp, nil
+}
+
+// SetEvent sets the event of the transaction, replacing any earlier one
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	if name == "" {
+		return errors.New("event name can not be empty string")
+	}
+
+	s.event = &peer.ChaincodeEvent{
+		TxId:      s.txID,
+		EventName: name,
+		Payload:   copyBytes(payload),
+	}
+	return nil
+}
+
+func (s *Stub) privateWrite(collection string) map[string]*write {
+	if s.privateWrites[collection] == nil {
+		s.privateWrites[collection] = map[string]*write{}
+	}
+	return s.privateWrites[collection]
+}
+
+// rangeIterator returns the entries of values with keys in [startKey, endKey), up to
+// limit entries when limit is positive
+func (s *Stub) rangeIterator(values map[string][]byte, startKey string, endKey string, limit int) *StateIterator {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		if key >= startKey && (endKey == "" || key < endKey) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	if limit > 0 && len(keys) > limit {
+		keys = keys[:limit]
+	}
+
+	results := make([]*queryresult.KV, len(keys))
+	for i, key := range keys {
+		results[i] = &queryresult.KV{
+			Key:   key,
+			Value: copyBytes(values[key]),
+		}
+	}
+
+	return &StateIterator{results: results}
+}
+
+func (s *Stub) pageIterator(startKey string, endKey string, pageSize int32) (*StateIterator, *peer.QueryResponseMetadata) {
+	// fetch one extra entry to learn where the next page starts
+	iterator := s.rangeIterator(s.ledger.state, startKey, endKey, int(pageSize)+1)
+
+	bookmark := ""
+	if len(iterator.results) > int(pageSize) {
+		bookmark = iterator.results[pageSize].Key
+		iterator.results = iterator.results[:pageSize]
+	}
+
+	return iterator, &peer.QueryResponseMetadata{
+		FetchedRecordsCount: int32(len(iterator.results)),
+		Bookmark:            bookmark,
+	}
+}
+
+func createCompositeKey(objectType string, attributes []string) (string, error) {
+	if err := validateCompositeKeyAttribute(objectType); err != nil {
+		return "", err
+	}
+
+	key := compositeKeyNamespace + objectType + string(rune(minUnicodeRuneValue))
+	for _, attribute := range attributes {
+		if err := validateCompositeKeyAttribute(attribute); err != nil {
+			return "", err
+		}
+		key += attribute + string(rune(minUnicodeRuneValue))
+	}
+
+	return key, nil
+}
+
+func partialCompositeKeyRange(objectType string, attributes []string) (string, string, error) {
+	partialKey, err := createCompositeKey(objectType, attributes)
+	if err != nil {
+		return "", "", err
+	}
+
+	return partialKey, partialKey + string(maxUnicodeRuneValue), nil
+}
+
+func validateCompositeKeyAttribute(attribute string) error {
+	if !utf8.ValidString(attribute) {
+		return fmt.Errorf("not a valid utf8 string: [%x]", attribute)
+	}
+	for index, runeValue := range attribute {
+		if runeValue == minUnicodeRuneValue || runeValue == maxUnicodeRuneValue {
+			return fmt.Errorf("input contains unicode %#U starting at position [%d]. %#U and %#U are not allowed in the input attribute of a composite key",
+				runeValue, index, minUnicodeRuneValue, maxUnicodeRuneValue)
+		}
+	}
+	return nil
+}
+
+func validateSimpleKeys(keys ...string) error {
+	for _, key := range keys {
+		if strings.HasPrefix(key, compositeKeyNamespace) {
+			return fmt.Errorf("first character of the key [%s] contains a null character which is not allowed", key)
+		}
+	}
+	return nil
+}
+
+func copyBytes(value []byte) []byte {
+	if value == nil {
+		return nil
+	}
+	return append([]byte{}, value...)
+}
@@ -0,0 +1,153 @@
+package chaincode
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// harvestDateIndexName is the composite key index of herb batches by harvest date
+const harvestDateIndexName = "harvestdate~id"
+
+// maxHarvestDateRangeDays bounds the number of days one range query walks
+const maxHarvestDateRangeDays = 366
+
+// HerbBatchPage is one page of a paginated herb batch query. An empty bookmark
+// means there are no further pages.
+type HerbBatchPage struct {
+	Bookmark            string       `json:"bookmark"`
+	FetchedRecordsCount int32        `json:"fetchedRecordsCount"`
+	Records             []*HerbBatch `json:"records"`
+}
+
+// GetHerbBatchesByHarvestDateRange returns the herb batches harvested between from and
+// to inclusive, ordered by harvest date. Pass the bookmark of the previous page to
+// continue a query.
+func (s *SmartContract) GetHerbBatchesByHarvestDateRange(ctx contractapi.TransactionContextInterface, from string, to string, pageSize int32, bookmark string) (*HerbBatchPage, error) {
+	fromDate, err := time.Parse(dateLayout, from)
+	if err != nil {
+		return nil, validationError("invalid from date %s: %v", from, err)
+	}
+	toDate, err := time.Parse(dateLayout, to)
+	if err != nil {
+		return nil, validationError("invalid to date %s: %v", to, err)
+	}
+	if toDate.Before(fromDate) {
+		return nil, validationError("the to date %s is before the from date %s", to, from)
+	}
+	if toDate.Sub(fromDate) > maxHarvestDateRangeDays*24*time.Hour {
+		return nil, validationError("the date range must not exceed %d days", maxHarvestDateRangeDays)
+	}
+	if pageSize <= 0 {
+		return nil, validationError("the page size must be greater than zero")
+	}
+
+	// composite keys cannot be range scanned, so the index is walked one day at a
+	// time. The bookmark carries the day to resume from and the peer's bookmark
+	// within that day.
+	day := fromDate
+	innerBookmark := ""
+	if bookmark != "" {
+		parts := strings.SplitN(bookmark, "|", 2)
+		if len(parts) != 2 {
+			return nil, validationError("invalid bookmark %s", bookmark)
+		}
+		day, err = time.Parse(dateLayout, parts[0])
+		if err != nil || day.Before(fromDate) || day.After(toDate) {
+			return nil, validationError("invalid bookmark %s", bookmark)
+		}
+		innerBookmark = parts[1]
+	}
+
+	page := HerbBatchPage{Records: []*HerbBatch{}}
+	for ; !day.After(toDate); day = day.AddDate(0, 0, 1) {
+		remaining := pageSize - page.FetchedRecordsCount
+		date := day.Format(dateLayout)
+
+		resultsIterator, metadata, err := ctx.GetStub().GetStateByPartialCompositeKeyWithPagination(harvestDateIndexName, []string{date}, remaining, innerBookmark)
+		if err != nil {
+			return nil, err
+		}
+
+		var ids []string
+		for resultsIterator.HasNext() {
+			queryResponse, err := resultsIterator.Next()
+			if err != nil {
+				resultsIterator.Close()
+				return nil, err
+			}
+
+			_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+			if err != nil {
+				resultsIterator.Close()
+				return nil, err
+			}
+			ids = append(ids, keyParts[1])
+		}
+		resultsIterator.Close()
+
+		for _, id := range ids {
+			herbBatch, err := s.ReadHerbBatch(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			page.Records = append(page.Records, herbBatch)
+		}
+		page.FetchedRecordsCount += int32(len(ids))
+		innerBookmark = ""
+
+		if page.FetchedRecordsCount >= pageSize {
+			// an empty peer bookmark means the day is exhausted, so the next page
+			// starts at the following day
+			if metadata.GetBookmark() != "" {
+				page.Bookmark = date + "|" + metadata.GetBookmark()
+			} else if nextDay := day.AddDate(0, 0, 1); !nextDay.After(toDate) {
+				page.Bookmark = nextDay.Format(dateLayout) + "|"
+			}
+			break
+		}
+	}
+
+	return &page, nil
+}
+
+// RebuildHarvestDateIndex writes the harvest date index entry of every herb batch,
+// covering batches created before the index existed
+func (s *SmartContract) RebuildHarvestDateIndex(ctx contractapi.TransactionContextInterface) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	herbBatches, err := s.GetAllHerbBatches(ctx)
+	if err != nil {
+		return err
+	}
+	for _, herbBatch := range herbBatches {
+		err = putHarvestDateIndex(ctx, herbBatch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func putHarvestDateIndex(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(harvestDateIndexName, []string{herbBatch.HarvestDate, herbBatch.ID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(indexKey, []byte{0x00})
+}
+
+func deleteHarvestDateIndex(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) error {
+	indexKey, err := ctx.GetStub().CreateCompositeKey(harvestDateIndexName, []string{herbBatch.HarvestDate, herbBatch.ID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().DelState(indexKey)
+}
@@ -0,0 +1,99 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (n *testNetwork) herbBatchesByHarvestDate(from string, to string, pageSize int32, bookmark string) (*chaincode.HerbBatchPage, error) {
+	var page *chaincode.HerbBatchPage
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		page, err = n.contract.GetHerbBatchesByHarvestDateRange(ctx, from, to, pageSize, bookmark)
+		return err
+	})
+	return page, err
+}
+
+func TestGetHerbBatchesByHarvestDateRange(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-01", 10)
+	n.mustCreateHerbBatch("batch2", "Withania somnifera", "Kerala", "2024-08-01", 10)
+	n.mustCreateHerbBatch("batch3", "Curcuma longa", "Kerala", "2024-08-03", 10)
+	n.mustCreateHerbBatch("batch4", "Curcuma longa", "Kerala", "2024-08-05", 10)
+	n.mustCreateHerbBatch("batch5", "Curcuma longa", "Kerala", "2024-09-01", 10)
+
+	var ids []string
+	bookmark := ""
+	for pages := 0; ; pages++ {
+		require.Less(t, pages, 5, "pagination does not terminate")
+
+		page, err := n.herbBatchesByHarvestDate("2024-08-01", "2024-08-31", 2, bookmark)
+		require.NoError(t, err)
+		require.Equal(t, int32(len(page.Records)), page.FetchedRecordsCount)
+		for _, herbBatch := range page.Records {
+			ids = append(ids, herbBatch.ID)
+		}
+
+		bookmark = page.Bookmark
+		if bookmark == "" {
+			break
+		}
+	}
+	require.Equal(t, []string{"batch1", "batch2", "batch3", "batch4"}, ids)
+
+	page, err := n.herbBatchesByHarvestDate("2024-08-02", "2024-08-02", 10, "")
+	require.NoError(t, err)
+	require.Empty(t, page.Records)
+	require.Empty(t, page.Bookmark)
+
+	_, err = n.herbBatchesByHarvestDate("2024-08-31", "2024-08-01", 10, "")
+	requireCode(t, err, chaincode.CodeValidation)
+
+	_, err = n.herbBatchesByHarvestDate("2024-01-01", "2025-06-01", 10, "")
+	requireCode(t, err, chaincode.CodeValidation)
+
+	_, err = n.herbBatchesByHarvestDate("2024-08-01", "2024-08-31", 10, "garbage")
+	requireCode(t, err, chaincode.CodeValidation)
+}
+
+func TestHarvestDateIndexFollowsUpdates(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-01", 10)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatch(ctx, "batch1", "Withania somnifera", "Test Farm", "2024-08-10", "Ravi Sharma", chaincode.StatusHarvested)
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+
+	page, err := n.herbBatchesByHarvestDate("2024-08-01", "2024-08-01", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DeleteHerbBatch(ctx, "batch1")
+	})
+	require.NoError(t, err)
+
+	page, err = n.herbBatchesByHarvestDate("2024-08-01", "2024-08-01", 10, "")
+	require.NoError(t, err)
+	require.Empty(t, page.Records)
+}
+
+func TestRebuildHarvestDateIndex(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-01", 10)
+
+	err := n.submit(n.farmer, n.contract.RebuildHarvestDateIndex)
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.admin, n.contract.RebuildHarvestDateIndex)
+	require.NoError(t, err)
+
+	page, err := n.herbBatchesByHarvestDate("2024-08-01", "2024-08-01", 10, "")
+	require.NoError(t, err)
+	require.Len(t, page.Records, 1)
+}
@@ -0,0 +1,136 @@
+package chaincode
+
+import (
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// adminRole is the role value carried by administrator identities, either as
+// the Fabric CA "hf.Type" attribute or as a NodeOU in the certificate subject.
+const adminRole = "admin"
+
+// roleAttribute is the Fabric CA attribute naming a client's supply chain role
+const roleAttribute = "role"
+
+// Supply chain roles, carried in the "role" attribute of enrollment certificates
+const (
+	transporterRole = "transporter"
+	labRole         = "lab"
+	// phytosanitaryAuthorityRole is carried by the plant protection officers who
+	// issue phytosanitary certificates
+	phytosanitaryAuthorityRole = "phytosanitary-authority"
+)
+
+// isAdmin returns true when the submitting client is an organisation admin
+func isAdmin(ctx contractapi.TransactionContextInterface) (bool, error) {
+	clientIdentity := ctx.GetClientIdentity()
+
+	identityType, found, err := clientIdentity.GetAttributeValue("hf.Type")
+	if err != nil {
+		return false, internalError("failed to read client attributes: %v", err)
+	}
+	if found && identityType == adminRole {
+		return true, nil
+	}
+
+	cert, err := clientIdentity.GetX509Certificate()
+	if err != nil {
+		return false, internalError("failed to read client certificate: %v", err)
+	}
+	if cert == nil {
+		return false, nil
+	}
+	for _, unit := range cert.Subject.OrganizationalUnit {
+		if unit == adminRole {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// requireAdmin returns an error unless the submitting client is an organisation admin
+func requireAdmin(ctx contractapi.TransactionContextInterface) error {
+	admin, err := isAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return forbiddenError("only an organisation admin may perform this operation")
+	}
+
+	return nil
+}
+
+// hasRole returns true when the submitting client carries role in its "role" attribute
+func hasRole(ctx contractapi.TransactionContextInterface, role string) (bool, error) {
+	value, found, err := ctx.GetClientIdentity().GetAttributeValue(roleAttribute)
+	if err != nil {
+		return false, internalError("failed to read client attributes: %v", err)
+	}
+
+	return found && value == role, nil
+}
+
+// requireRole returns an error unless the submitting client carries role in its
+// "role" attribute or is an organisation admin
+func requireRole(ctx contractapi.TransactionContextInterface, role string) error {
+	held, err := hasRole(ctx, role)
+	if err != nil {
+		return err
+	}
+	if held {
+		return nil
+	}
+
+	admin, err := isAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return forbiddenError("only a client with the role %s may perform this operation", role)
+	}
+
+	return nil
+}
+
+// requireHerbBatchOwner returns an error unless the submitting client belongs to the
+// organisation owning the herb batch and is either the identity holding it or an
+// admin of that organisation
+func requireHerbBatchOwner(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) error {
+	err := requireOwnerOrg(ctx, herbBatch)
+	if err != nil {
+		return err
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return internalError("failed to get client identity: %v", err)
+	}
+	if herbBatch.OwnerID != "" && clientID == herbBatch.OwnerID {
+		return nil
+	}
+
+	admin, err := isAdmin(ctx)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return forbiddenError("only the owner of herb batch %s may perform this operation", herbBatch.ID)
+	}
+
+	return nil
+}
+
+// requireOwnerOrg returns an error unless the submitting client belongs to the
+// organisation owning the herb batch
+func requireOwnerOrg(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) error {
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return internalError("failed to get client MSP ID: %v", err)
+	}
+	if mspID != herbBatch.OwnerOrg {
+		return forbiddenError("only the organisation owning herb batch %s may perform this operation", herbBatch.ID)
+	}
+
+	return nil
+}
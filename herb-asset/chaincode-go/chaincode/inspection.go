@@ -0,0 +1,514 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// inspectionObjectType is the composite key namespace for farm inspections
+const inspectionObjectType = "inspection"
+
+// Farm inspection schemes
+const (
+	InspectionOrganic = "Organic"
+	InspectionGACP    = "GACP"
+)
+
+var validInspectionTypes = map[string]bool{
+	InspectionOrganic: true,
+	InspectionGACP:    true,
+}
+
+// Inspection statuses
+const (
+	InspectionScheduled = "Scheduled"
+	InspectionRecorded  = "Recorded"
+	InspectionClosed    = "Closed"
+)
+
+// Non-conformity severities
+const (
+	SeverityMinor    = "Minor"
+	SeverityMajor    = "Major"
+	SeverityCritical = "Critical"
+)
+
+var validSeverities = map[string]bool{
+	SeverityMinor:    true,
+	SeverityMajor:    true,
+	SeverityCritical: true,
+}
+
+// Inspection is an organic or GACP compliance inspection of a farm. It is scheduled
+// by an admin, recorded by the inspector and closed once every non-conformity found
+// has been resolved. Inspector is the enrollment ID, the certificate common name, of
+// the inspector's identity in InspectorOrg.
+type Inspection struct {
+	ID              string           `json:"ID"`
+	Checklist       []*ChecklistItem `json:"checklist"`
+	ClosedAt        string           `json:"closedAt,omitempty" metadata:",optional"`
+	Farm            string           `json:"farm"`
+	InspectedOn     string           `json:"inspectedOn,omitempty" metadata:",optional"`
+	InspectionType  string           `json:"inspectionType"`
+	Inspector       string           `json:"inspector"`
+	InspectorID     string           `json:"inspectorId,omitempty" metadata:",optional"` // client identity that recorded the results
+	InspectorOrg    string           `json:"inspectorOrg,omitempty" metadata:",optional"`
+	NonConformities []*NonConformity `json:"nonConformities"`
+	ScheduledDate   string           `json:"scheduledDate"`
+	Status          string           `json:"status"`
+}
+
+// ChecklistItem is the result of one checklist requirement
+type ChecklistItem struct {
+	Notes       string `json:"notes,omitempty" metadata:",optional"`
+	Passed      bool   `json:"passed"`
+	Requirement string `json:"requirement"`
+}
+
+// NonConformity is a finding that the farm must correct by its deadline
+type NonConformity struct {
+	ID               string `json:"ID"`
+	CorrectiveAction string `json:"correctiveAction"`
+	Deadline         string `json:"deadline"`
+	Description      string `json:"description"`
+	Resolution       string `json:"resolution,omitempty" metadata:",optional"`
+	ResolvedAt       string `json:"resolvedAt,omitempty" metadata:",optional"`
+	Severity         string `json:"severity"`
+}
+
+// FarmComplianceStatus lists the inspection items needing attention on one farm
+type FarmComplianceStatus struct {
+	Farm                     string   `json:"farm"`
+	OpenNonConformities      []string `json:"openNonConformities"`      // inspection ID and non-conformity ID joined by "/"
+	OverdueCorrectiveActions []string `json:"overdueCorrectiveActions"` // open non-conformities past their deadline
+	OverdueInspections       []string `json:"overdueInspections"`       // scheduled inspections past their date
+}
+
+// ScheduleInspection schedules an inspection of a farm that has registered herb
+// batches. inspector is the enrollment ID of the identity in inspectorOrg that will
+// record the results.
+func (s *SmartContract) ScheduleInspection(ctx contractapi.TransactionContextInterface, id string, farm string, inspectionType string, scheduledDate string, inspector string, inspectorOrg string) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if id == "" || inspector == "" || inspectorOrg == "" {
+		return validationError("the inspection ID, inspector and inspector organisation are required")
+	}
+	if !validInspectionTypes[inspectionType] {
+		return validationError("invalid inspection type %s", inspectionType)
+	}
+	if _, err := time.Parse(dateLayout, scheduledDate); err != nil {
+		return validationError("invalid scheduled date %s: %v", scheduledDate, err)
+	}
+
+	registered, err := farmRegistered(ctx, farm)
+	if err != nil {
+		return err
+	}
+	if !registered {
+		return notFoundError("no herb batches are registered for farm %s", farm)
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(inspectionObjectType, []string{id})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+	existing, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return internalError("failed to read from world state: %v", err)
+	}
+	if existing != nil {
+		return alreadyExistsError("the inspection %s already exists", id)
+	}
+
+	inspection := Inspection{
+		ID:              id,
+		Checklist:       []*ChecklistItem{},
+		Farm:            farm,
+		InspectionType:  inspectionType,
+		Inspector:       inspector,
+		InspectorOrg:    inspectorOrg,
+		NonConformities: []*NonConformity{},
+		ScheduledDate:   scheduledDate,
+		Status:          InspectionScheduled,
+	}
+
+	return putInspection(ctx, &inspection)
+}
+
+// RecordInspection records the checklist results and non-conformities of a scheduled
+// inspection. Only the scheduled inspector or an admin of its organisation may record the
+// results, and the submitting client is recorded as the inspector's identity.
+func (s *SmartContract) RecordInspection(ctx contractapi.TransactionContextInterface, id string, inspectedOn string, checklist []*ChecklistItem, nonConformities []*NonConformity) error {
+	inspection, err := s.ReadInspection(ctx, id)
+	if err != nil {
+		return err
+	}
+	if inspection.Status != InspectionScheduled {
+		return invalidTransitionError("the inspection %s has already been recorded", id)
+	}
+	err = requireScheduledInspector(ctx, inspection)
+	if err != nil {
+		return err
+	}
+
+	if _, err := time.Parse(dateLayout, inspectedOn); err != nil {
+		return validationError("invalid inspection date %s: %v", inspectedOn, err)
+	}
+	if len(checklist) == 0 {
+		return validationError("the checklist must contain at least one result")
+	}
+	for _, item := range checklist {
+		if item == nil || item.Requirement == "" {
+			return validationError("every checklist result must name its requirement")
+		}
+	}
+	if nonConformities == nil {
+		nonConformities = []*NonConformity{}
+	}
+	seen := map[string]bool{}
+	for _, nonConformity := range nonConformities {
+		if nonConformity == nil || nonConformity.ID == "" || nonConformity.Description == "" {
+			return validationError("every non-conformity needs an ID and a description")
+		}
+		if seen[nonConformity.ID] {
+			return validationError("duplicate non-conformity %s", nonConformity.ID)
+		}
+		seen[nonConformity.ID] = true
+		if !validSeverities[nonConformity.Severity] {
+			return validationError("invalid severity %s of non-conformity %s", nonConformity.Severity, nonConformity.ID)
+		}
+		if _, err := time.Parse(dateLayout, nonConformity.Deadline); err != nil {
+			return validationError("invalid corrective action deadline %s: %v", nonConformity.Deadline, err)
+		}
+		if nonConformity.Deadline < inspectedOn {
+			return validationError("the corrective action deadline of non-conformity %s is before the inspection", nonConformity.ID)
+		}
+		nonConformity.Resolution = ""
+		nonConformity.ResolvedAt = ""
+	}
+
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return internalError("failed to read client identity: %v", err)
+	}
+
+	inspection.Checklist = checklist
+	inspection.InspectedOn = inspectedOn
+	inspection.InspectorID = clientID
+	inspection.NonConformities = nonConformities
+	inspection.Status = InspectionRecorded
+
+	return putInspection(ctx, inspection)
+}
+
+// ResolveNonConformity marks a non-conformity of a recorded inspection as corrected.
+// Only the recording inspector or an admin of the inspecting organisation may resolve findings.
+func (s *SmartContract) ResolveNonConformity(ctx contractapi.TransactionContextInterface, inspectionID string, nonConformityID string, resolution string) error {
+	inspection, err := s.ReadInspection(ctx, inspectionID)
+	if err != nil {
+		return err
+	}
+	if inspection.Status != InspectionRecorded {
+		return invalidTransitionError("the inspection %s is %s", inspectionID, inspection.Status)
+	}
+	err = requireInspectorOrAdmin(ctx, inspection)
+	if err != nil {
+		return err
+	}
+	if resolution == "" {
+		return validationError("a resolution is required")
+	}
+
+	for _, nonConformity := range inspection.NonConformities {
+		if nonConformity.ID != nonConformityID {
+			continue
+		}
+		if nonConformity.ResolvedAt != "" {
+			return invalidTransitionError("the non-conformity %s is already resolved", nonConformityID)
+		}
+
+		now, err := transactionTime(ctx)
+		if err != nil {
+			return err
+		}
+		nonConformity.Resolution = resolution
+		nonConformity.ResolvedAt = now
+		return putInspection(ctx, inspection)
+	}
+
+	return notFoundError("the inspection %s has no non-conformity %s", inspectionID, nonConformityID)
+}
+
+// CloseInspection closes a recorded inspection once all its non-conformities are resolved
+func (s *SmartContract) CloseInspection(ctx contractapi.TransactionContextInterface, id string) error {
+	inspection, err := s.ReadInspection(ctx, id)
+	if err != nil {
+		return err
+	}
+	if inspection.Status != InspectionRecorded {
+		return invalidTransitionError("only a recorded inspection can be closed, %s is %s", id, inspection.Status)
+	}
+	err = requireInspectorOrAdmin(ctx, inspection)
+	if err != nil {
+		return err
+	}
+	for _, nonConformity := range inspection.NonConformities {
+		if nonConformity.ResolvedAt == "" {
+			return invalidTransitionError("the non-conformity %s of inspection %s is still open", nonConformity.ID, id)
+		}
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+	inspection.ClosedAt = now
+	inspection.Status = InspectionClosed
+
+	return putInspection(ctx, inspection)
+}
+
+// ReadInspection returns the inspection stored in the world state with given id
+func (s *SmartContract) ReadInspection(ctx contractapi.TransactionContextInterface, id string) (*Inspection, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(inspectionObjectType, []string{id})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+
+	inspectionJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if inspectionJSON == nil {
+		return nil, notFoundError("the inspection %s does not exist", id)
+	}
+
+	var inspection Inspection
+	err = json.Unmarshal(inspectionJSON, &inspection)
+	if err != nil {
+		return nil, err
+	}
+
+	return &inspection, nil
+}
+
+// GetInspectionsByFarm returns the inspections of a farm ordered by scheduled date
+func (s *SmartContract) GetInspectionsByFarm(ctx contractapi.TransactionContextInterface, farm string) ([]*Inspection, error) {
+	inspections, err := queryInspections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	farmInspections := []*Inspection{}
+	for _, inspection := range inspections {
+		if inspection.Farm == farm {
+			farmInspections = append(farmInspections, inspection)
+		}
+	}
+	sort.SliceStable(farmInspections, func(i, j int) bool {
+		return farmInspections[i].ScheduledDate < farmInspections[j].ScheduledDate
+	})
+
+	return farmInspections, nil
+}
+
+// GetFarmsRequiringAttention returns the farms with scheduled inspections past their
+// date or with open non-conformities, as of the transaction date
+func (s *SmartContract) GetFarmsRequiringAttention(ctx contractapi.TransactionContextInterface) ([]*FarmComplianceStatus, error) {
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	today := now[:len(dateLayout)]
+
+	inspections, err := queryInspections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := map[string]*FarmComplianceStatus{}
+	status := func(farm string) *FarmComplianceStatus {
+		if statuses[farm] == nil {
+			statuses[farm] = &FarmComplianceStatus{
+				Farm:                     farm,
+				OpenNonConformities:      []string{},
+				OverdueCorrectiveActions: []string{},
+				OverdueInspections:       []string{},
+			}
+		}
+		return statuses[farm]
+	}
+
+	for _, inspection := range inspections {
+		switch inspection.Status {
+		case InspectionScheduled:
+			if inspection.ScheduledDate < today {
+				farmStatus := status(inspection.Farm)
+				farmStatus.OverdueInspections = append(farmStatus.OverdueInspections, inspection.ID)
+			}
+		case InspectionRecorded:
+			for _, nonConformity := range inspection.NonConformities {
+				if nonConformity.ResolvedAt != "" {
+					continue
+				}
+				farmStatus := status(inspection.Farm)
+				ref := inspection.ID + "/" + nonConformity.ID
+				farmStatus.OpenNonConformities = append(farmStatus.OpenNonConformities, ref)
+				if nonConformity.Deadline < today {
+					farmStatus.OverdueCorrectiveActions = append(farmStatus.OverdueCorrectiveActions, ref)
+				}
+			}
+		}
+	}
+
+	farms := []*FarmComplianceStatus{}
+	for _, farmStatus := range statuses {
+		farms = append(farms, farmStatus)
+	}
+	sort.Slice(farms, func(i, j int) bool {
+		return farms[i].Farm < farms[j].Farm
+	})
+
+	return farms, nil
+}
+
+// farmRegistered returns true when a herb batch of the farm is in the world state.
+// Farms have no registry of their own, so the herb batches are searched.
+func farmRegistered(ctx contractapi.TransactionContextInterface, farm string) (bool, error) {
+	if farm == "" {
+		return false, nil
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByRange("", "")
+	if err != nil {
+		return false, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return false, err
+		}
+
+		var herbBatch HerbBatch
+		err = json.Unmarshal(queryResponse.Value, &herbBatch)
+		if err != nil {
+			return false, err
+		}
+		if herbBatch.Farm == farm {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// requireScheduledInspector returns an error unless the submitting client is the
+// inspector the inspection was scheduled for or an admin of the inspecting
+// organisation
+func requireScheduledInspector(ctx contractapi.TransactionContextInterface, inspection *Inspection) error {
+	clientOrg, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return internalError("failed to read client MSP ID: %v", err)
+	}
+	cert, err := ctx.GetClientIdentity().GetX509Certificate()
+	if err != nil {
+		return internalError("failed to read client certificate: %v", err)
+	}
+	if cert != nil && cert.Subject.CommonName == inspection.Inspector && clientOrg == inspection.InspectorOrg {
+		return nil
+	}
+
+	admin, err := isInspectorOrgAdmin(ctx, inspection)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return forbiddenError("only the inspector %s of %s or an admin of %s may record inspection %s", inspection.Inspector, inspection.InspectorOrg, inspection.InspectorOrg, inspection.ID)
+	}
+
+	return nil
+}
+
+// requireInspectorOrAdmin returns an error unless the submitting client recorded the
+// inspection or is an admin of the inspecting organisation
+func requireInspectorOrAdmin(ctx contractapi.TransactionContextInterface, inspection *Inspection) error {
+	clientID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return internalError("failed to read client identity: %v", err)
+	}
+	if clientID == inspection.InspectorID {
+		return nil
+	}
+
+	admin, err := isInspectorOrgAdmin(ctx, inspection)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return forbiddenError("only the inspector or an admin of %s may update inspection %s", inspection.InspectorOrg, inspection.ID)
+	}
+
+	return nil
+}
+
+// isInspectorOrgAdmin reports whether the submitting client is an admin of the
+// organisation the inspection was scheduled for. Admins of the inspected farm's
+// organisation must not record or clear their own findings.
+func isInspectorOrgAdmin(ctx contractapi.TransactionContextInterface, inspection *Inspection) (bool, error) {
+	clientOrg, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return false, internalError("failed to read client MSP ID: %v", err)
+	}
+	if clientOrg != inspection.InspectorOrg {
+		return false, nil
+	}
+
+	return isAdmin(ctx)
+}
+
+func putInspection(ctx contractapi.TransactionContextInterface, inspection *Inspection) error {
+	key, err := ctx.GetStub().CreateCompositeKey(inspectionObjectType, []string{inspection.ID})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	inspectionJSON, err := json.Marshal(inspection)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, inspectionJSON)
+}
+
+func queryInspections(ctx contractapi.TransactionContextInterface) ([]*Inspection, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(inspectionObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var inspections []*Inspection
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var inspection Inspection
+		err = json.Unmarshal(queryResponse.Value, &inspection)
+		if err != nil {
+			return nil, err
+		}
+		inspections = append(inspections, &inspection)
+	}
+
+	return inspections, nil
+}
@@ -0,0 +1,174 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/fakestub"
+	"github.com/stretchr/testify/require"
+)
+
+func (n *testNetwork) scheduleInspection(id string, farm string, scheduledDate string) error {
+	return n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.ScheduleInspection(ctx, id, farm, chaincode.InspectionGACP, scheduledDate, "buyer", org2MSP)
+	})
+}
+
+func (n *testNetwork) readInspection(id string) *chaincode.Inspection {
+	var inspection *chaincode.Inspection
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		inspection, err = n.contract.ReadInspection(ctx, id)
+		return err
+	})
+	require.NoError(n.t, err)
+	return inspection
+}
+
+func (n *testNetwork) farmsRequiringAttention() []*chaincode.FarmComplianceStatus {
+	var farms []*chaincode.FarmComplianceStatus
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		farms, err = n.contract.GetFarmsRequiringAttention(ctx)
+		return err
+	})
+	require.NoError(n.t, err)
+	return farms
+}
+
+func TestScheduleInspection(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.ScheduleInspection(ctx, "insp1", "Test Farm", chaincode.InspectionGACP, "2024-09-01", "buyer", org2MSP)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	requireCode(t, n.scheduleInspection("insp1", "Unknown Farm", "2024-09-01"), chaincode.CodeNotFound)
+	requireCode(t, n.scheduleInspection("insp1", "Test Farm", "2024-09-31"), chaincode.CodeValidation)
+
+	require.NoError(t, n.scheduleInspection("insp1", "Test Farm", "2024-09-01"))
+	requireCode(t, n.scheduleInspection("insp1", "Test Farm", "2024-09-01"), chaincode.CodeAlreadyExists)
+
+	inspection := n.readInspection("insp1")
+	require.Equal(t, chaincode.InspectionScheduled, inspection.Status)
+	require.Equal(t, org2MSP, inspection.InspectorOrg)
+	require.Empty(t, inspection.NonConformities)
+
+	// farms are known by their herb batches, so a farm without batches left cannot be inspected
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DeleteHerbBatch(ctx, "batch1")
+	})
+	require.NoError(t, err)
+	requireCode(t, n.scheduleInspection("insp2", "Test Farm", "2024-09-01"), chaincode.CodeNotFound)
+}
+
+func TestInspectionLifecycle(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	require.NoError(t, n.scheduleInspection("insp1", "Test Farm", "2024-09-01"))
+	require.NoError(t, n.scheduleInspection("insp2", "Test Farm", "2025-03-01"))
+
+	checklist := []*chaincode.ChecklistItem{
+		{Requirement: "Seed source documented", Passed: true},
+		{Requirement: "Irrigation water tested", Passed: false, Notes: "No report for 2024"},
+	}
+	nonConformities := []*chaincode.NonConformity{
+		{ID: "nc1", Description: "Irrigation water not tested", Severity: chaincode.SeverityMajor, CorrectiveAction: "Test the well water", Deadline: "2024-10-01"},
+	}
+
+	// only the scheduled inspector, buyer of Org2, or an Org2 admin may record the
+	// results; the admin of the farm's organisation may not
+	clerk := newIdentity(t, org2MSP, "clerk", []string{"client"}, nil)
+	for _, identity := range []*fakestub.Identity{n.farmer, clerk, n.admin} {
+		err := n.submit(identity, func(ctx contractapi.TransactionContextInterface) error {
+			return n.contract.RecordInspection(ctx, "insp1", "2024-09-02", checklist, nonConformities)
+		})
+		requireCode(t, err, chaincode.CodeForbidden)
+	}
+
+	err := n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RecordInspection(ctx, "insp1", "2024-09-02", checklist, []*chaincode.NonConformity{
+			{ID: "nc1", Description: "Irrigation water not tested", Severity: chaincode.SeverityMajor, Deadline: "2024-08-01"},
+		})
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RecordInspection(ctx, "insp1", "2024-09-02", checklist, nonConformities)
+	})
+	require.NoError(t, err)
+
+	inspection := n.readInspection("insp1")
+	require.Equal(t, chaincode.InspectionRecorded, inspection.Status)
+	require.Equal(t, org2MSP, inspection.InspectorOrg)
+	require.Equal(t, n.accountID(n.buyer), inspection.InspectorID)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RecordInspection(ctx, "insp1", "2024-09-02", checklist, nil)
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	n.ledger.SetTime(time.Date(2024, time.September, 15, 0, 0, 0, 0, time.UTC))
+	farms := n.farmsRequiringAttention()
+	require.Len(t, farms, 1)
+	require.Equal(t, []string{"insp1/nc1"}, farms[0].OpenNonConformities)
+	require.Empty(t, farms[0].OverdueCorrectiveActions)
+	require.Empty(t, farms[0].OverdueInspections)
+
+	n.ledger.SetTime(time.Date(2025, time.April, 1, 0, 0, 0, 0, time.UTC))
+	farms = n.farmsRequiringAttention()
+	require.Equal(t, []string{"insp1/nc1"}, farms[0].OverdueCorrectiveActions)
+	require.Equal(t, []string{"insp2"}, farms[0].OverdueInspections)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CloseInspection(ctx, "insp1")
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	for _, identity := range []*fakestub.Identity{n.farmer, n.admin} {
+		err = n.submit(identity, func(ctx contractapi.TransactionContextInterface) error {
+			return n.contract.ResolveNonConformity(ctx, "insp1", "nc1", "Water test report WT-88 attached")
+		})
+		requireCode(t, err, chaincode.CodeForbidden)
+	}
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.ResolveNonConformity(ctx, "insp1", "nc2", "Water test report WT-88 attached")
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.ResolveNonConformity(ctx, "insp1", "nc1", "Water test report WT-88 attached")
+	})
+	require.NoError(t, err)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CloseInspection(ctx, "insp1")
+	})
+	require.NoError(t, err)
+	require.Equal(t, chaincode.InspectionClosed, n.readInspection("insp1").Status)
+
+	farms = n.farmsRequiringAttention()
+	require.Len(t, farms, 1)
+	require.Empty(t, farms[0].OpenNonConformities)
+	require.Equal(t, []string{"insp2"}, farms[0].OverdueInspections)
+
+	var inspections []*chaincode.Inspection
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		inspections, err = n.contract.GetInspectionsByFarm(ctx, "Test Farm")
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, inspections, 2)
+	require.Equal(t, "insp1", inspections[0].ID)
+
+	org2Admin := newIdentity(t, org2MSP, "admin", []string{"admin"}, map[string]string{"hf.Type": "admin"})
+	err = n.submit(org2Admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RecordInspection(ctx, "insp2", "2025-03-01", checklist, nil)
+	})
+	require.NoError(t, err, "an admin of the inspecting organisation may record for its inspector")
+}
@@ -0,0 +1,130 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const organisationObjectType = "organisation"
+
+// Organisation is a member organisation of the channel that herb batches may be
+// transferred to
+type Organisation struct {
+	MSPID        string `json:"mspId"`
+	Name         string `json:"name"`
+	RegisteredAt string `json:"registeredAt"`
+}
+
+// RegisterOrganisation registers the submitting admin's organisation under a display
+// name so that herb batches can be transferred to it. An organisation can only
+// register itself.
+func (s *SmartContract) RegisterOrganisation(ctx contractapi.TransactionContextInterface, name string) (*Organisation, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(name) == "" {
+		return nil, validationError("the organisation name is required")
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, internalError("failed to get client MSP ID: %v", err)
+	}
+	existing, err := readOrganisation(ctx, mspID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, alreadyExistsError("the organisation %s is already registered", mspID)
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	organisation := Organisation{
+		MSPID:        mspID,
+		Name:         name,
+		RegisteredAt: now,
+	}
+	organisationJSON, err := json.Marshal(organisation)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(organisationObjectType, []string{mspID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(key, organisationJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return &organisation, nil
+}
+
+// GetOrganisations returns the registered organisations
+func (s *SmartContract) GetOrganisations(ctx contractapi.TransactionContextInterface) ([]*Organisation, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(organisationObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	organisations := []*Organisation{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var organisation Organisation
+		err = json.Unmarshal(queryResponse.Value, &organisation)
+		if err != nil {
+			return nil, err
+		}
+		organisations = append(organisations, &organisation)
+	}
+
+	return organisations, nil
+}
+
+// requireRegisteredOrg returns an error unless the organisation has registered itself
+func requireRegisteredOrg(ctx contractapi.TransactionContextInterface, mspID string) error {
+	organisation, err := readOrganisation(ctx, mspID)
+	if err != nil {
+		return err
+	}
+	if organisation == nil {
+		return validationError("the organisation %s is not registered", mspID)
+	}
+
+	return nil
+}
+
+func readOrganisation(ctx contractapi.TransactionContextInterface, mspID string) (*Organisation, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(organisationObjectType, []string{mspID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+
+	organisationJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if organisationJSON == nil {
+		return nil, nil
+	}
+
+	var organisation Organisation
+	err = json.Unmarshal(organisationJSON, &organisation)
+	if err != nil {
+		return nil, err
+	}
+
+	return &organisation, nil
+}
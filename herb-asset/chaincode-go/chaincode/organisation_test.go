@@ -0,0 +1,61 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+// registerOrg2 registers Org2 as a transfer destination through an Org2 admin
+func (n *testNetwork) registerOrg2() {
+	admin := newIdentity(n.t, org2MSP, "admin", []string{"admin"}, map[string]string{"hf.Type": "admin"})
+	err := n.submit(admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.RegisterOrganisation(ctx, "Spice Traders Ltd")
+		return err
+	})
+	require.NoError(n.t, err)
+}
+
+func TestRegisterOrganisation(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.RegisterOrganisation(ctx, "Kerala Ayurveda Farms")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.RegisterOrganisation(ctx, " ")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+
+	var organisation *chaincode.Organisation
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		organisation, err = n.contract.RegisterOrganisation(ctx, "Kerala Ayurveda Farms")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, org1MSP, organisation.MSPID)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.RegisterOrganisation(ctx, "Kerala Ayurveda Farms")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeAlreadyExists)
+
+	n.registerOrg2()
+
+	var organisations []*chaincode.Organisation
+	err = n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		organisations, err = n.contract.GetOrganisations(ctx)
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, organisations, 2)
+	require.Equal(t, "Spice Traders Ltd", organisations[1].Name)
+}
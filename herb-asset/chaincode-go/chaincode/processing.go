@@ -0,0 +1,271 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const processingObjectType = "processing"
+
+// Processing step types
+const (
+	StepCleaning   = "Cleaning"
+	StepDrying     = "Drying"
+	StepGrinding   = "Grinding"
+	StepExtraction = "Extraction"
+	StepBlending   = "Blending"
+)
+
+var validStepTypes = map[string]bool{
+	StepCleaning:   true,
+	StepDrying:     true,
+	StepGrinding:   true,
+	StepExtraction: true,
+	StepBlending:   true,
+}
+
+// BlendSourcesParameter is the parameter of a Blending step listing, comma
+// separated, the IDs of the herb batches blended into the processed batch
+const BlendSourcesParameter = "sourceBatches"
+
+// processableStatuses lists the statuses a herb batch may be processed from. Packaged
+// and later lots are finished goods and cannot go back to processing.
+var processableStatuses = map[string]bool{
+	StatusHarvested:  true,
+	StatusInTransit:  true,
+	StatusLabTesting: true,
+	StatusCertified:  true,
+	StatusProcessing: true,
+}
+
+// ProcessingStep records one operation performed on a herb batch. Weights are in
+// kilograms and parameters carry step specific settings such as
+// "temperatureCelsius" or "durationHours". A Blending step names the batches
+// blended in with BlendSourcesParameter and records the weight taken from each.
+type ProcessingStep struct {
+	ID               string             `json:"ID"`
+	BatchID          string             `json:"batchId"`
+	Facility         string             `json:"facility"`
+	InputWeight      float64            `json:"inputWeight"`
+	Operator         string             `json:"operator"`
+	OutputWeight     float64            `json:"outputWeight"`
+	Parameters       map[string]string  `json:"parameters"`
+	SourceQuantities map[string]float64 `json:"sourceQuantities,omitempty" metadata:",optional"`
+	StepType         string             `json:"stepType"`
+	Timestamp        string             `json:"timestamp"`
+	YieldPercent     float64            `json:"yieldPercent"`
+}
+
+// RecordProcessingStep records a processing step for a herb batch and returns it.
+// The weight lost in the step is deducted from the batch's remaining quantity and
+// the batch moves to the Processing status and its expiry date is brought forward to
+// the processed shelf life if that is sooner. Only the organisation owning the batch
+// may process it, and only until it is packaged or expires. A Blending step takes
+// the whole remaining quantity of each batch named in BlendSourcesParameter, which
+// the organisation must also own, so the output may exceed the input weight by
+// what the sources contributed; a source with nothing left cannot be blended again.
+func (s *SmartContract) RecordProcessingStep(ctx contractapi.TransactionContextInterface, batchID string, stepType string, facility string, operator string, inputWeight float64, outputWeight float64, parameters map[string]string) (*ProcessingStep, error) {
+	if !validStepTypes[stepType] {
+		return nil, validationError("invalid processing step type %s", stepType)
+	}
+	if inputWeight <= 0 {
+		return nil, validationError("the input weight must be greater than zero")
+	}
+	if outputWeight < 0 {
+		return nil, validationError("the output weight must not be negative")
+	}
+
+	herbBatch, err := s.ReadHerbBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	err = requireOwnerOrg(ctx, herbBatch)
+	if err != nil {
+		return nil, err
+	}
+	if !processableStatuses[herbBatch.Status] {
+		return nil, invalidTransitionError("the herb batch %s is %s and can no longer be processed", batchID, herbBatch.Status)
+	}
+	err = requireDistributable(ctx, herbBatch)
+	if err != nil {
+		return nil, err
+	}
+	if inputWeight > herbBatch.RemainingQuantity {
+		return nil, validationError("the input weight %.2f exceeds the %.2f kg remaining in herb batch %s", inputWeight, herbBatch.RemainingQuantity, batchID)
+	}
+	sources, err := s.readBlendSources(ctx, herbBatch, parameters)
+	if err != nil {
+		return nil, err
+	}
+	var sourceQuantities map[string]float64
+	sourceWeight := 0.0
+	for _, source := range sources {
+		if sourceQuantities == nil {
+			sourceQuantities = map[string]float64{}
+		}
+		sourceQuantities[source.ID] = source.RemainingQuantity
+		sourceWeight += source.RemainingQuantity
+	}
+	if outputWeight > inputWeight+sourceWeight {
+		return nil, validationError("the output weight must not exceed the input weight %.2f", inputWeight+sourceWeight)
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if parameters == nil {
+		parameters = map[string]string{}
+	}
+
+	step := ProcessingStep{
+		ID:               ctx.GetStub().GetTxID(),
+		BatchID:          batchID,
+		Facility:         facility,
+		InputWeight:      inputWeight,
+		Operator:         operator,
+		OutputWeight:     outputWeight,
+		Parameters:       parameters,
+		SourceQuantities: sourceQuantities,
+		StepType:         stepType,
+		Timestamp:        now,
+		YieldPercent:     outputWeight / (inputWeight + sourceWeight) * 100,
+	}
+	stepJSON, err := json.Marshal(step)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(processingObjectType, []string{batchID, step.ID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(key, stepJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *herbBatch
+	herbBatch.RemainingQuantity -= inputWeight - outputWeight
+	herbBatch.Status = StatusProcessing
+	processedExpiryDate, err := s.processedExpiryDate(ctx, herbBatch.BotanicalName)
+	if err != nil {
+		return nil, err
+	}
+	herbBatch.ExpiryDate = earliestDate(herbBatch.ExpiryDate, processedExpiryDate)
+	herbBatchJSON, err := json.Marshal(herbBatch)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(batchID, herbBatchJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordStatsChange(ctx, &before, herbBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sources live on in the blend
+	for _, source := range sources {
+		source.RemainingQuantity = 0
+		sourceJSON, err := json.Marshal(source)
+		if err != nil {
+			return nil, err
+		}
+		err = ctx.GetStub().PutState(source.ID, sourceJSON)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &step, nil
+}
+
+// readBlendSources reads the herb batches a processing step blends into herbBatch.
+// Each must be owned by the organisation blending it, still processable and have
+// some quantity left.
+func (s *SmartContract) readBlendSources(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch, parameters map[string]string) ([]*HerbBatch, error) {
+	var sources []*HerbBatch
+	seen := map[string]bool{}
+	for _, sourceID := range blendSources(parameters) {
+		if sourceID == herbBatch.ID {
+			return nil, validationError("the herb batch %s cannot be blended into itself", herbBatch.ID)
+		}
+		if seen[sourceID] {
+			return nil, validationError("the herb batch %s is named twice as a blend source", sourceID)
+		}
+		seen[sourceID] = true
+
+		source, err := s.ReadHerbBatch(ctx, sourceID)
+		if err != nil {
+			return nil, err
+		}
+		err = requireOwnerOrg(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		if !processableStatuses[source.Status] {
+			return nil, invalidTransitionError("the herb batch %s is %s and can no longer be blended", sourceID, source.Status)
+		}
+		err = requireDistributable(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		if source.RemainingQuantity <= 0 {
+			return nil, validationError("the herb batch %s has no quantity left to blend", sourceID)
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// GetProcessingHistory returns the processing steps recorded for a herb batch in the
+// order they were performed
+func (s *SmartContract) GetProcessingHistory(ctx contractapi.TransactionContextInterface, batchID string) ([]*ProcessingStep, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(processingObjectType, []string{batchID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var steps []*ProcessingStep
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var step ProcessingStep
+		err = json.Unmarshal(queryResponse.Value, &step)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, &step)
+	}
+
+	// keys are ordered by transaction ID, so restore processing order from the timestamps
+	sort.SliceStable(steps, func(i, j int) bool {
+		return steps[i].Timestamp < steps[j].Timestamp
+	})
+
+	return steps, nil
+}
+
+// blendSources returns the herb batches a processing step's parameters name as
+// blended in
+func blendSources(parameters map[string]string) []string {
+	var sources []string
+	for _, sourceID := range strings.Split(parameters[BlendSourcesParameter], ",") {
+		sourceID = strings.TrimSpace(sourceID)
+		if sourceID != "" {
+			sources = append(sources, sourceID)
+		}
+	}
+	return sources
+}
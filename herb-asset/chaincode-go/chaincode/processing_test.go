@@ -0,0 +1,113 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (n *testNetwork) recordProcessingStep(stepType string, inputWeight float64, outputWeight float64) (*chaincode.ProcessingStep, error) {
+	var step *chaincode.ProcessingStep
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		step, err = n.contract.RecordProcessingStep(ctx, "batch1", stepType, "Kochi Plant", "Operator A", inputWeight, outputWeight, map[string]string{"temperatureCelsius": "45"})
+		return err
+	})
+	return step, err
+}
+
+func TestRecordProcessingStep(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	step, err := n.recordProcessingStep(chaincode.StepDrying, 100, 80)
+	require.NoError(t, err)
+	require.Equal(t, 80.0, step.YieldPercent)
+	require.Equal(t, "45", step.Parameters["temperatureCelsius"])
+
+	herbBatch := n.readHerbBatch("batch1")
+	require.Equal(t, 100.0, herbBatch.RemainingQuantity)
+	require.Equal(t, chaincode.StatusProcessing, herbBatch.Status)
+	require.Equal(t, map[string]int{chaincode.StatusProcessing: 1}, n.ledgerStats().ByStatus)
+
+	_, err = n.recordProcessingStep(chaincode.StepGrinding, 80, 78)
+	require.NoError(t, err)
+
+	_, err = n.recordProcessingStep(chaincode.StepGrinding, 150, 100)
+	requireCode(t, err, chaincode.CodeValidation)
+
+	_, err = n.recordProcessingStep(chaincode.StepDrying, 10, 12)
+	requireCode(t, err, chaincode.CodeValidation)
+
+	_, err = n.recordProcessingStep("Roasting", 10, 8)
+	requireCode(t, err, chaincode.CodeValidation)
+
+	var steps []*chaincode.ProcessingStep
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		steps, err = n.contract.GetProcessingHistory(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, steps, 2)
+	require.Equal(t, chaincode.StepDrying, steps[0].StepType)
+	require.Equal(t, chaincode.StepGrinding, steps[1].StepType)
+}
+
+func TestRecordProcessingStepRestrictions(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	err := n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.RecordProcessingStep(ctx, "batch1", chaincode.StepDrying, "Mumbai Plant", "Operator B", 100, 80, nil)
+		return err
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "batch1", chaincode.StatusPackaged)
+	})
+	require.NoError(t, err)
+
+	_, err = n.recordProcessingStep(chaincode.StepBlending, 100, 100)
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+	require.Equal(t, chaincode.StatusPackaged, n.readHerbBatch("batch1").Status)
+}
+
+func TestBlendingConsumesSources(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	n.mustCreateHerbBatch("batch2", "Withania somnifera", "Kerala", "2024-08-16", 50)
+	err := n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CreateHerbBatch(ctx, "batch3", "Withania somnifera", "Spice Farm", "2024-08-16", "Spice Traders", chaincode.StatusHarvested, "Kerala", 30, "", "")
+	})
+	require.NoError(t, err)
+
+	blend := func(sources string, inputWeight float64, outputWeight float64) (*chaincode.ProcessingStep, error) {
+		var step *chaincode.ProcessingStep
+		err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+			var err error
+			step, err = n.contract.RecordProcessingStep(ctx, "batch1", chaincode.StepBlending, "Kochi Plant", "Operator A", inputWeight, outputWeight, map[string]string{chaincode.BlendSourcesParameter: sources})
+			return err
+		})
+		return step, err
+	}
+
+	// batches of another organisation cannot be blended in
+	_, err = blend("batch3", 100, 100)
+	requireCode(t, err, chaincode.CodeForbidden)
+	_, err = blend("batch2", 100, 151)
+	requireCode(t, err, chaincode.CodeValidation)
+
+	step, err := blend("batch2", 100, 135)
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"batch2": 50}, step.SourceQuantities)
+	require.Equal(t, 90.0, step.YieldPercent)
+	require.Equal(t, 155.0, n.readHerbBatch("batch1").RemainingQuantity)
+	require.Equal(t, 0.0, n.readHerbBatch("batch2").RemainingQuantity)
+
+	// a source is only blended once
+	_, err = blend("batch2", 10, 10)
+	requireCode(t, err, chaincode.CodeValidation)
+}
@@ -0,0 +1,225 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const recallObjectType = "recall"
+
+// Lab verdicts of a herb batch's public provenance
+const (
+	LabVerdictPassed    = "passed"     // a lab certified the batch
+	LabVerdictPending   = "pending"    // the batch is with a lab for testing
+	LabVerdictNotTested = "not-tested" // no lab has received the batch
+	// LabVerdictUnverified marks a batch whose status claims lab testing that no
+	// recorded lab event confirms, such as one certified before the workflow events
+	LabVerdictUnverified = "unverified"
+)
+
+// Certification types
+const (
+	CertificationLab           = "Lab certification"
+	CertificationPhytosanitary = "Phytosanitary certificate"
+)
+
+// Recall withdraws a herb batch from sale. A recalled batch can no longer move along
+// the supply chain, change status, be processed, offered or transferred.
+type Recall struct {
+	BatchID    string `json:"batchId"`
+	Reason     string `json:"reason"`
+	RecalledAt string `json:"recalledAt"`
+	RecalledBy string `json:"recalledBy"` // MSP ID of the recalling admin
+	TxID       string `json:"txId"`
+}
+
+// Certification is a certificate a herb batch holds, either issued by a lab through
+// the certify workflow action or anchored as a phytosanitary certificate
+type Certification struct {
+	IssuedAt string `json:"issuedAt"`
+	Type     string `json:"type"`
+}
+
+// PublicRecall is what consumers may learn about a recall: when and why, not who
+type PublicRecall struct {
+	Reason     string `json:"reason"`
+	RecalledAt string `json:"recalledAt"`
+}
+
+// PublicProvenance is what consumers may learn about a herb batch: its origin and
+// test results, without its owner, quantities or trading partners
+type PublicProvenance struct {
+	BatchID        string           `json:"batchId"`
+	BotanicalName  string           `json:"botanicalName"`
+	Certifications []*Certification `json:"certifications"`
+	ExpiryDate     string           `json:"expiryDate,omitempty" metadata:",optional"`
+	HarvestDate    string           `json:"harvestDate"`
+	LabVerdict     string           `json:"labVerdict"`
+	Recall         *PublicRecall    `json:"recall,omitempty" metadata:",optional"`
+	Recalled       bool             `json:"recalled"`
+	Region         string           `json:"region"`
+}
+
+// RecallHerbBatch withdraws a herb batch from sale. Only an organisation admin may
+// recall a batch, and a recall cannot be undone.
+func (s *SmartContract) RecallHerbBatch(ctx contractapi.TransactionContextInterface, batchID string, reason string) (*Recall, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(reason) == "" {
+		return nil, validationError("the recall reason is required")
+	}
+
+	exists, err := s.HerbBatchExists(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, notFoundError("the herb batch %s does not exist", batchID)
+	}
+	existing, err := readRecall(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		return nil, alreadyExistsError("the herb batch %s was recalled on %s", batchID, existing.RecalledAt)
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	recalledBy, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, internalError("failed to read client MSP ID: %v", err)
+	}
+
+	recall := Recall{
+		BatchID:    batchID,
+		Reason:     reason,
+		RecalledAt: now,
+		RecalledBy: recalledBy,
+		TxID:       ctx.GetStub().GetTxID(),
+	}
+	recallJSON, err := json.Marshal(recall)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(recallObjectType, []string{batchID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(key, recallJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recall, nil
+}
+
+// GetPublicProvenance returns the provenance of a herb batch that may be shown to
+// consumers who scan its label
+func (s *SmartContract) GetPublicProvenance(ctx contractapi.TransactionContextInterface, batchID string) (*PublicProvenance, error) {
+	herbBatch, err := s.ReadHerbBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	events, err := s.GetSupplyChainEvents(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	documents, err := s.GetHerbBatchDocuments(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	recall, err := readRecall(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+
+	provenance := PublicProvenance{
+		BatchID:        herbBatch.ID,
+		BotanicalName:  herbBatch.BotanicalName,
+		Certifications: []*Certification{},
+		ExpiryDate:     herbBatch.ExpiryDate,
+		HarvestDate:    herbBatch.HarvestDate,
+		LabVerdict:     LabVerdictNotTested,
+		Recalled:       recall != nil,
+		Region:         herbBatch.Region,
+	}
+	if recall != nil {
+		provenance.Recall = &PublicRecall{Reason: recall.Reason, RecalledAt: recall.RecalledAt}
+	}
+
+	for _, event := range events {
+		switch event.Action {
+		case ActionLabReceive:
+			if provenance.LabVerdict == LabVerdictNotTested {
+				provenance.LabVerdict = LabVerdictPending
+			}
+		case ActionCertify:
+			provenance.LabVerdict = LabVerdictPassed
+			provenance.Certifications = append(provenance.Certifications, &Certification{
+				IssuedAt: event.Timestamp,
+				Type:     CertificationLab,
+			})
+		}
+	}
+	// batches moved before the workflow events existed only carry the status, which
+	// no lab vouches for
+	if provenance.LabVerdict == LabVerdictNotTested && (herbBatch.Status == StatusLabTesting || herbBatch.Status == StatusCertified) {
+		provenance.LabVerdict = LabVerdictUnverified
+	}
+
+	// only certificates a phytosanitary authority anchored are shown to consumers
+	for _, document := range documents {
+		if document.DocumentType == DocumentPhytosanitaryCertificate && document.AnchoredRole == phytosanitaryAuthorityRole {
+			provenance.Certifications = append(provenance.Certifications, &Certification{
+				IssuedAt: document.AnchoredAt,
+				Type:     CertificationPhytosanitary,
+			})
+		}
+	}
+
+	return &provenance, nil
+}
+
+// requireNotRecalled returns an error when the herb batch has been recalled
+func requireNotRecalled(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) error {
+	recall, err := readRecall(ctx, herbBatch.ID)
+	if err != nil {
+		return err
+	}
+	if recall != nil {
+		return invalidTransitionError("the herb batch %s was recalled on %s: %s", herbBatch.ID, recall.RecalledAt, recall.Reason)
+	}
+
+	return nil
+}
+
+// readRecall returns the recall of a herb batch, or nil when it has not been recalled
+func readRecall(ctx contractapi.TransactionContextInterface, batchID string) (*Recall, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(recallObjectType, []string{batchID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+	recallJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if recallJSON == nil {
+		return nil, nil
+	}
+
+	var recall Recall
+	err = json.Unmarshal(recallJSON, &recall)
+	if err != nil {
+		return nil, err
+	}
+
+	return &recall, nil
+}
@@ -0,0 +1,154 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/fakestub"
+	"github.com/stretchr/testify/require"
+)
+
+func (n *testNetwork) recallHerbBatch(identity *fakestub.Identity, batchID string, reason string) (*chaincode.Recall, error) {
+	var recall *chaincode.Recall
+	err := n.submit(identity, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		recall, err = n.contract.RecallHerbBatch(ctx, batchID, reason)
+		return err
+	})
+	return recall, err
+}
+
+func (n *testNetwork) publicProvenance(batchID string) (*chaincode.PublicProvenance, error) {
+	var provenance *chaincode.PublicProvenance
+	err := n.evaluate(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		provenance, err = n.contract.GetPublicProvenance(ctx, batchID)
+		return err
+	})
+	return provenance, err
+}
+
+func TestRecallHerbBatch(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	_, err := n.recallHerbBatch(n.farmer, "batch1", "Aflatoxin above limits")
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	_, err = n.recallHerbBatch(n.admin, "batch1", " ")
+	requireCode(t, err, chaincode.CodeValidation)
+
+	_, err = n.recallHerbBatch(n.admin, "missing", "Aflatoxin above limits")
+	requireCode(t, err, chaincode.CodeNotFound)
+
+	recall, err := n.recallHerbBatch(n.admin, "batch1", "Aflatoxin above limits")
+	require.NoError(t, err)
+	require.Equal(t, "batch1", recall.BatchID)
+	require.Equal(t, org1MSP, recall.RecalledBy)
+	require.NotEmpty(t, recall.RecalledAt)
+
+	_, err = n.recallHerbBatch(n.admin, "batch1", "Mislabelled species")
+	requireCode(t, err, chaincode.CodeAlreadyExists)
+}
+
+func TestRecalledHerbBatchesCannotMove(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	_, err := n.recallHerbBatch(n.admin, "batch1", "Aflatoxin above limits")
+	require.NoError(t, err)
+
+	_, err = n.recordSupplyChainEvent(n.transporter, chaincode.ActionTransport, "Kochi Depot")
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+	require.ErrorContains(t, err, "Aflatoxin above limits")
+
+	for _, status := range []string{chaincode.StatusDistributed, chaincode.StatusPackaged} {
+		err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+			return n.contract.UpdateHerbBatchStatus(ctx, "batch1", status)
+		})
+		requireCode(t, err, chaincode.CodeInvalidTransition)
+	}
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatch(ctx, "batch1", "Withania somnifera", "Test Farm", "2024-08-15", "Ravi Sharma", chaincode.StatusDelivered)
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.TransferHerbBatch(ctx, "batch1", "Priya Patel", "")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	_, err = n.recordProcessingStep(chaincode.StepDrying, 40, 15)
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	err = n.offerHerbBatch("offer1", 100)
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	require.Equal(t, chaincode.StatusHarvested, n.readHerbBatch("batch1").Status)
+}
+
+func TestGetPublicProvenance(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	provenance, err := n.publicProvenance("batch1")
+	require.NoError(t, err)
+	require.Equal(t, "Withania somnifera", provenance.BotanicalName)
+	require.Equal(t, "Kerala", provenance.Region)
+	require.Equal(t, "2024-08-15", provenance.HarvestDate)
+	require.Equal(t, chaincode.LabVerdictNotTested, provenance.LabVerdict)
+	require.Empty(t, provenance.Certifications)
+	require.False(t, provenance.Recalled)
+	require.Nil(t, provenance.Recall)
+
+	_, err = n.recordSupplyChainEvent(n.transporter, chaincode.ActionTransport, "Kochi Depot")
+	require.NoError(t, err)
+	_, err = n.recordSupplyChainEvent(n.lab, chaincode.ActionLabReceive, "Kochi Lab")
+	require.NoError(t, err)
+
+	provenance, err = n.publicProvenance("batch1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.LabVerdictPending, provenance.LabVerdict)
+
+	_, err = n.recordSupplyChainEvent(n.lab, chaincode.ActionCertify, "Kochi Lab")
+	require.NoError(t, err)
+	authority := newIdentity(t, org2MSP, "officer", []string{"client"}, map[string]string{"role": "phytosanitary-authority"})
+	_, err = n.attachDocument(authority, "batch1", chaincode.DocumentPhytosanitaryCertificate, testDigest)
+	require.NoError(t, err)
+	_, err = n.attachDocument(n.farmer, "batch1", chaincode.DocumentInvoice, "1"+testDigest[1:])
+	require.NoError(t, err)
+	_, err = n.recallHerbBatch(n.admin, "batch1", "Aflatoxin above limits")
+	require.NoError(t, err)
+
+	provenance, err = n.publicProvenance("batch1")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.LabVerdictPassed, provenance.LabVerdict)
+	require.Len(t, provenance.Certifications, 2)
+	require.Equal(t, chaincode.CertificationLab, provenance.Certifications[0].Type)
+	require.Equal(t, chaincode.CertificationPhytosanitary, provenance.Certifications[1].Type)
+	require.True(t, provenance.Recalled)
+	require.Equal(t, "Aflatoxin above limits", provenance.Recall.Reason)
+	require.NotEmpty(t, provenance.Recall.RecalledAt)
+	provenanceJSON, err := json.Marshal(provenance)
+	require.NoError(t, err)
+	require.NotContains(t, string(provenanceJSON), org1MSP, "consumers do not learn which organisation recalled the batch")
+	require.NotContains(t, string(provenanceJSON), org2MSP, "consumers do not learn which lab certified the batch")
+
+	_, err = n.publicProvenance("missing")
+	requireCode(t, err, chaincode.CodeNotFound)
+}
+
+func TestGetPublicProvenanceOfSeededBatches(t *testing.T) {
+	n := newTestNetwork(t)
+	err := n.submit(n.admin, n.contract.InitLedger)
+	require.NoError(t, err)
+
+	// batch3 was certified through a status update, without a workflow event
+	provenance, err := n.publicProvenance("batch3")
+	require.NoError(t, err)
+	require.Equal(t, chaincode.LabVerdictUnverified, provenance.LabVerdict, "only a lab event passes a batch")
+	require.Empty(t, provenance.Certifications)
+}
@@ -0,0 +1,302 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// quotaObjectType is the composite key namespace for harvest quotas. Composite
+// keys keep quotas out of the plain key range scanned by GetAllHerbBatches.
+const quotaObjectType = "quota"
+
+// HarvestQuota caps the weight of a wild species that may be collected in a
+// region during one season. Quantities are in kilograms.
+type HarvestQuota struct {
+	Allocated   float64 `json:"allocated"`
+	Region      string  `json:"region"`
+	Remaining   float64 `json:"remaining"`
+	Season      string  `json:"season"`
+	SeasonEnd   string  `json:"seasonEnd"`
+	SeasonStart string  `json:"seasonStart"`
+	Species     string  `json:"species"`
+}
+
+// QuotaUtilization reports how much of a harvest quota has been used
+type QuotaUtilization struct {
+	HarvestQuota
+	Used               float64 `json:"used"`
+	UtilizationPercent float64 `json:"utilizationPercent"`
+}
+
+// SetHarvestQuota creates or updates the quota for a species in a region for one season.
+// Changing the allocation of an existing quota keeps the amount already harvested.
+func (s *SmartContract) SetHarvestQuota(ctx contractapi.TransactionContextInterface, species string, region string, season string, seasonStart string, seasonEnd string, allocated float64) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if species == "" || region == "" || season == "" {
+		return validationError("species, region and season are required")
+	}
+	if allocated < 0 {
+		return validationError("the allocated quantity must not be negative")
+	}
+	start, err := time.Parse(dateLayout, seasonStart)
+	if err != nil {
+		return validationError("invalid season start %s: %v", seasonStart, err)
+	}
+	end, err := time.Parse(dateLayout, seasonEnd)
+	if err != nil {
+		return validationError("invalid season end %s: %v", seasonEnd, err)
+	}
+	if end.Before(start) {
+		return validationError("the season end %s is before the season start %s", seasonEnd, seasonStart)
+	}
+
+	quotas, err := queryHarvestQuotas(ctx, species, region)
+	if err != nil {
+		return err
+	}
+
+	used := 0.0
+	for _, quota := range quotas {
+		if quota.Season == season {
+			used = quota.Allocated - quota.Remaining
+			continue
+		}
+		if quota.SeasonStart <= seasonEnd && seasonStart <= quota.SeasonEnd {
+			return validationError("the season %s overlaps season %s of the %s quota in %s", season, quota.Season, species, region)
+		}
+	}
+	if allocated < used {
+		return validationError("the allocation %.2f is below the %.2f already harvested in season %s", allocated, used, season)
+	}
+
+	quota := HarvestQuota{
+		Allocated:   allocated,
+		Region:      region,
+		Remaining:   allocated - used,
+		Season:      season,
+		SeasonEnd:   seasonEnd,
+		SeasonStart: seasonStart,
+		Species:     species,
+	}
+
+	return putHarvestQuota(ctx, &quota)
+}
+
+// ReadHarvestQuota returns the quota for a species in a region for the given season
+func (s *SmartContract) ReadHarvestQuota(ctx contractapi.TransactionContextInterface, species string, region string, season string) (*HarvestQuota, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(quotaObjectType, []string{species, region, season})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+
+	quotaJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if quotaJSON == nil {
+		return nil, notFoundError("no harvest quota exists for %s in %s for season %s", species, region, season)
+	}
+
+	var quota HarvestQuota
+	err = json.Unmarshal(quotaJSON, &quota)
+	if err != nil {
+		return nil, err
+	}
+
+	return &quota, nil
+}
+
+// GetQuotaUtilization returns the utilization of every harvest quota matching the
+// given species and region. An empty region matches all regions of the species and
+// an empty species matches all quotas.
+func (s *SmartContract) GetQuotaUtilization(ctx contractapi.TransactionContextInterface, species string, region string) ([]*QuotaUtilization, error) {
+	if species == "" && region != "" {
+		return nil, validationError("a species is required when filtering by region")
+	}
+
+	quotas, err := queryHarvestQuotas(ctx, species, region)
+	if err != nil {
+		return nil, err
+	}
+
+	var utilization []*QuotaUtilization
+	for _, quota := range quotas {
+		used := quota.Allocated - quota.Remaining
+		percent := 0.0
+		if quota.Allocated > 0 {
+			percent = used / quota.Allocated * 100
+		}
+		utilization = append(utilization, &QuotaUtilization{
+			HarvestQuota:       *quota,
+			Used:               used,
+			UtilizationPercent: percent,
+		})
+	}
+
+	return utilization, nil
+}
+
+// consumeHarvestQuota deducts the quantity of a herb batch from the quota of its
+// species and region whose season covers the harvest date, and records the key of
+// that quota on the batch. Species without a quota in the region are not
+// restricted, but a species under quota in any region needs the region named.
+func consumeHarvestQuota(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) error {
+	herbBatch.QuotaRegion, herbBatch.QuotaSeason, herbBatch.QuotaSpecies = "", "", ""
+
+	quota, err := coveringHarvestQuota(ctx, herbBatch)
+	if err != nil || quota == nil {
+		return err
+	}
+	if herbBatch.Quantity > quota.Remaining {
+		return validationError("harvesting %.2f kg of %s in %s exceeds the remaining season %s quota of %.2f kg", herbBatch.Quantity, quota.Species, quota.Region, quota.Season, quota.Remaining)
+	}
+
+	quota.Remaining -= herbBatch.Quantity
+	herbBatch.QuotaRegion = quota.Region
+	herbBatch.QuotaSeason = quota.Season
+	herbBatch.QuotaSpecies = quota.Species
+
+	return putHarvestQuota(ctx, quota)
+}
+
+// coveringHarvestQuota returns the quota of the herb batch's species in its region
+// whose season covers the harvest date, or nil when the harvest is not restricted
+func coveringHarvestQuota(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) (*HarvestQuota, error) {
+	if herbBatch.Region == "" {
+		// an empty region would match the quotas of every region
+		quotas, err := queryHarvestQuotas(ctx, herbBatch.BotanicalName, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(quotas) > 0 {
+			return nil, validationError("the region of herb batch %s is required, as %s is harvested under quota", herbBatch.ID, herbBatch.BotanicalName)
+		}
+		return nil, nil
+	}
+
+	quotas, err := queryHarvestQuotas(ctx, herbBatch.BotanicalName, herbBatch.Region)
+	if err != nil {
+		return nil, err
+	}
+	if len(quotas) == 0 {
+		return nil, nil
+	}
+
+	if _, err := time.Parse(dateLayout, herbBatch.HarvestDate); err != nil {
+		return nil, validationError("invalid harvest date %s: %v", herbBatch.HarvestDate, err)
+	}
+	for _, quota := range quotas {
+		if herbBatch.HarvestDate >= quota.SeasonStart && herbBatch.HarvestDate <= quota.SeasonEnd {
+			return quota, nil
+		}
+	}
+
+	return nil, nil
+}
+
+// chargedQuotaKey returns the species and region of the quota a herb batch was
+// charged to. Batches charged before the key was recorded were charged under
+// their own species and region.
+func chargedQuotaKey(herbBatch *HerbBatch) (string, string) {
+	if herbBatch.QuotaSpecies == "" {
+		return herbBatch.BotanicalName, herbBatch.Region
+	}
+
+	return herbBatch.QuotaSpecies, herbBatch.QuotaRegion
+}
+
+// releaseHarvestQuota returns the quantity of a herb batch to the quota it was
+// charged to, if any
+func (s *SmartContract) releaseHarvestQuota(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) error {
+	if herbBatch.QuotaSeason == "" {
+		return nil
+	}
+
+	species, region := chargedQuotaKey(herbBatch)
+	quota, err := s.ReadHarvestQuota(ctx, species, region, herbBatch.QuotaSeason)
+	if err != nil {
+		return err
+	}
+	quota.Remaining = math.Min(quota.Allocated, quota.Remaining+herbBatch.Quantity)
+
+	return putHarvestQuota(ctx, quota)
+}
+
+// rechargeHarvestQuota moves the quantity of a herb batch whose species, region or
+// harvest date changed from the quota it was charged to onto the quota covering
+// its new values, rejecting the change when that quota cannot take it. A
+// transaction does not read its own writes, so a batch that stays under the same
+// quota is left as is.
+func (s *SmartContract) rechargeHarvestQuota(ctx contractapi.TransactionContextInterface, before *HerbBatch, after *HerbBatch) error {
+	quota, err := coveringHarvestQuota(ctx, after)
+	if err != nil {
+		return err
+	}
+	species, region := chargedQuotaKey(before)
+	if quota != nil && quota.Species == species && quota.Region == region && quota.Season == before.QuotaSeason {
+		after.QuotaRegion, after.QuotaSeason, after.QuotaSpecies = quota.Region, quota.Season, quota.Species
+		return nil
+	}
+
+	err = s.releaseHarvestQuota(ctx, before)
+	if err != nil {
+		return err
+	}
+
+	return consumeHarvestQuota(ctx, after)
+}
+
+// queryHarvestQuotas returns the quotas whose keys start with the given species and region
+func queryHarvestQuotas(ctx contractapi.TransactionContextInterface, species string, region string) ([]*HarvestQuota, error) {
+	var attributes []string
+	if species != "" {
+		attributes = append(attributes, species)
+		if region != "" {
+			attributes = append(attributes, region)
+		}
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(quotaObjectType, attributes)
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var quotas []*HarvestQuota
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var quota HarvestQuota
+		err = json.Unmarshal(queryResponse.Value, &quota)
+		if err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, &quota)
+	}
+
+	return quotas, nil
+}
+
+func putHarvestQuota(ctx contractapi.TransactionContextInterface, quota *HarvestQuota) error {
+	key, err := ctx.GetStub().CreateCompositeKey(quotaObjectType, []string{quota.Species, quota.Region, quota.Season})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	quotaJSON, err := json.Marshal(quota)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, quotaJSON)
+}
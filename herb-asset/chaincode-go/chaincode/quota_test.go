@@ -0,0 +1,158 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetHarvestQuota(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024", "2024-01-01", "2024-12-31", 100)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024", "2024-12-31", "2024-01-01", 100)
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024", "2024-01-01", "2024-12-31", 100)
+	})
+	require.NoError(t, err)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024-late", "2024-12-01", "2025-03-31", 50)
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+
+	var quota *chaincode.HarvestQuota
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		quota, err = n.contract.ReadHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 100.0, quota.Remaining)
+
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.ReadHarvestQuota(ctx, "Withania somnifera", "Kerala", "2025")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+}
+
+func TestHarvestQuotaConsumption(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024", "2024-01-01", "2024-12-31", 100)
+	})
+	require.NoError(t, err)
+
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 60)
+
+	err = n.createHerbBatch("batch2", "Withania somnifera", "Kerala", "2024-08-16", 50)
+	requireCode(t, err, chaincode.CodeValidation)
+
+	// other regions and harvests outside the season are not restricted
+	n.mustCreateHerbBatch("batch3", "Withania somnifera", "Tamil Nadu", "2024-08-16", 500)
+	n.mustCreateHerbBatch("batch4", "Withania somnifera", "Kerala", "2025-01-10", 500)
+	require.Empty(t, n.readHerbBatch("batch3").QuotaSeason)
+
+	// a species under quota needs its region, which must not match every region
+	err = n.createHerbBatch("batch5", "Withania somnifera", "", "2024-08-16", 10)
+	requireCode(t, err, chaincode.CodeValidation)
+	n.mustCreateHerbBatch("batch6", "Curcuma longa", "", "2024-08-16", 10)
+
+	var utilization []*chaincode.QuotaUtilization
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		utilization, err = n.contract.GetQuotaUtilization(ctx, "Withania somnifera", "Kerala")
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, utilization, 1)
+	require.Equal(t, 60.0, utilization[0].Used)
+	require.Equal(t, 40.0, utilization[0].Remaining)
+	require.Equal(t, 60.0, utilization[0].UtilizationPercent)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024", "2024-01-01", "2024-12-31", 50)
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024", "2024-01-01", "2024-12-31", 150)
+	})
+	require.NoError(t, err)
+
+	var quota *chaincode.HarvestQuota
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		quota, err = n.contract.ReadHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 90.0, quota.Remaining)
+}
+
+func (n *testNetwork) quotaRemaining(species string, season string) float64 {
+	var quota *chaincode.HarvestQuota
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		quota, err = n.contract.ReadHarvestQuota(ctx, species, "Kerala", season)
+		return err
+	})
+	require.NoError(n.t, err)
+	return quota.Remaining
+}
+
+func TestHarvestQuotaFollowsUpdates(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		err := n.contract.SetHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024", "2024-01-01", "2024-12-31", 100)
+		if err != nil {
+			return err
+		}
+		return n.contract.SetHarvestQuota(ctx, "Curcuma longa", "Kerala", "2024", "2024-01-01", "2024-12-31", 80)
+	})
+	require.NoError(t, err)
+
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 60)
+	herbBatch := n.readHerbBatch("batch1")
+	require.Equal(t, "Withania somnifera", herbBatch.QuotaSpecies)
+	require.Equal(t, "Kerala", herbBatch.QuotaRegion)
+	require.Equal(t, "2024", herbBatch.QuotaSeason)
+
+	updateHerbBatch := func(botanicalName string) error {
+		return n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+			return n.contract.UpdateHerbBatch(ctx, "batch1", botanicalName, "Kerala Farm", "2024-08-15", "Ravi Sharma", chaincode.StatusHarvested)
+		})
+	}
+
+	require.NoError(t, updateHerbBatch("Withania somnifera"))
+	require.Equal(t, 40.0, n.quotaRemaining("Withania somnifera", "2024"))
+
+	require.NoError(t, updateHerbBatch("Curcuma longa"))
+	require.Equal(t, 100.0, n.quotaRemaining("Withania somnifera", "2024"))
+	require.Equal(t, 20.0, n.quotaRemaining("Curcuma longa", "2024"))
+	require.Equal(t, "Curcuma longa", n.readHerbBatch("batch1").QuotaSpecies)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetHarvestQuota(ctx, "Withania somnifera", "Kerala", "2024", "2024-01-01", "2024-12-31", 50)
+	})
+	require.NoError(t, err)
+	requireCode(t, updateHerbBatch("Withania somnifera"), chaincode.CodeValidation)
+	require.Equal(t, 20.0, n.quotaRemaining("Curcuma longa", "2024"))
+	require.Equal(t, 50.0, n.quotaRemaining("Withania somnifera", "2024"))
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DeleteHerbBatch(ctx, "batch1")
+	})
+	require.NoError(t, err)
+	require.Equal(t, 80.0, n.quotaRemaining("Curcuma longa", "2024"))
+}
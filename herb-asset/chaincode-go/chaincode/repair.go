@@ -0,0 +1,127 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const repairObjectType = "repair"
+
+// underscoreRepair names the underscore repair in the keys recording where it ran
+const underscoreRepair = "underscores"
+
+// repairRun records that an organisation ran a one-off migration
+type repairRun struct {
+	MSPID    string   `json:"mspId"`
+	RanAt    string   `json:"ranAt"`
+	Repaired []string `json:"repaired"`
+}
+
+// RepairUnderscoredHerbBatches restores the spaces in the botanical name, farm, owner
+// and region of herb batches created by earlier versions of herb-api, which replaced
+// every space in the arguments with an underscore. It returns the IDs of the
+// repaired batches. The statistics follow the repaired values and the shelf life of
+// the restored species may bring a raw material expiry date forward, but never
+// pushes it back. Batch IDs are left as they are, since offers, processing steps
+// and attestations refer to them, and so are harvest quotas, which keep the charge
+// of every batch drawn from them.
+//
+// Each organisation's admin runs the repair for the batches their organisation
+// owns, since only its peers can endorse changes to them. The repair runs once per
+// organisation, as it cannot tell an underscore entered on purpose from a replaced
+// space.
+func (s *SmartContract) RepairUnderscoredHerbBatches(ctx contractapi.TransactionContextInterface) ([]string, error) {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	mspID, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, internalError("failed to get client MSP ID: %v", err)
+	}
+	runKey, err := ctx.GetStub().CreateCompositeKey(repairObjectType, []string{underscoreRepair, mspID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+	previousRun, err := ctx.GetStub().GetState(runKey)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if previousRun != nil {
+		return nil, invalidTransitionError("the underscore repair already ran for %s", mspID)
+	}
+
+	herbBatches, err := s.GetAllHerbBatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	repaired := []string{}
+	for _, herbBatch := range herbBatches {
+		if herbBatch.OwnerOrg != mspID {
+			continue
+		}
+
+		before := *herbBatch
+		herbBatch.BotanicalName = strings.ReplaceAll(herbBatch.BotanicalName, "_", " ")
+		herbBatch.Farm = strings.ReplaceAll(herbBatch.Farm, "_", " ")
+		herbBatch.Owner = strings.ReplaceAll(herbBatch.Owner, "_", " ")
+		herbBatch.Region = strings.ReplaceAll(herbBatch.Region, "_", " ")
+		if *herbBatch == before {
+			continue
+		}
+		if herbBatch.QuotaSeason != "" {
+			herbBatch.QuotaSpecies, herbBatch.QuotaRegion = chargedQuotaKey(&before)
+		}
+
+		if herbBatch.BotanicalName != before.BotanicalName {
+			steps, err := s.GetProcessingHistory(ctx, herbBatch.ID)
+			if err != nil {
+				return nil, err
+			}
+			if len(steps) == 0 {
+				expiryDate, err := s.harvestExpiryDate(ctx, herbBatch.BotanicalName, herbBatch.HarvestDate)
+				if err != nil {
+					return nil, err
+				}
+				herbBatch.ExpiryDate = earliestDate(herbBatch.ExpiryDate, expiryDate)
+			}
+		}
+
+		herbBatchJSON, err := json.Marshal(herbBatch)
+		if err != nil {
+			return nil, err
+		}
+		err = ctx.GetStub().PutState(herbBatch.ID, herbBatchJSON)
+		if err != nil {
+			return nil, err
+		}
+
+		err = recordStatsChange(ctx, &before, herbBatch)
+		if err != nil {
+			return nil, err
+		}
+
+		repaired = append(repaired, herbBatch.ID)
+	}
+	sort.Strings(repaired)
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	runJSON, err := json.Marshal(repairRun{MSPID: mspID, RanAt: now, Repaired: repaired})
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(runKey, runJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return repaired, nil
+}
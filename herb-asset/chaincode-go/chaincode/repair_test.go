@@ -0,0 +1,148 @@
+package chaincode_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/fakestub"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnicodeArgumentsRoundTrip(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CreateHerbBatch(ctx, "batch1", "Withania somnifera", "कृष्णा \"जैविक\" फार्म", "2024-08-15", "முருகன் \\ பழனி", chaincode.StatusHarvested, "தமிழ் நாடு", 10, "", "")
+	})
+	require.NoError(t, err)
+
+	herbBatch := n.readHerbBatch("batch1")
+	require.Equal(t, "कृष्णा \"जैविक\" फार्म", herbBatch.Farm)
+	require.Equal(t, "முருகன் \\ பழனி", herbBatch.Owner)
+	require.Equal(t, "தமிழ் நாடு", herbBatch.Region)
+}
+
+func (n *testNetwork) repairUnderscores(identity *fakestub.Identity) ([]string, error) {
+	var repaired []string
+	err := n.submit(identity, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		repaired, err = n.contract.RepairUnderscoredHerbBatches(ctx)
+		return err
+	})
+	return repaired, err
+}
+
+func TestRepairUnderscoredHerbBatches(t *testing.T) {
+	n := newTestNetwork(t)
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CreateHerbBatch(ctx, "batch_1", "Withania_somnifera", "Kerala_Ayurveda_Farms", "2024-08-15", "Ravi_Sharma", chaincode.StatusHarvested, "Tamil_Nadu", 10, "", "")
+	})
+	require.NoError(t, err)
+	n.mustCreateHerbBatch("batch2", "Curcuma longa", "Kerala", "2024-08-20", 10)
+	require.Equal(t, "2025-02-11", n.readHerbBatch("batch_1").ExpiryDate)
+
+	_, err = n.repairUnderscores(n.farmer)
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	repaired, err := n.repairUnderscores(n.admin)
+	require.NoError(t, err)
+	require.Equal(t, []string{"batch_1"}, repaired)
+
+	herbBatch := n.readHerbBatch("batch_1")
+	require.Equal(t, "Withania somnifera", herbBatch.BotanicalName)
+	require.Equal(t, "Kerala Ayurveda Farms", herbBatch.Farm)
+	require.Equal(t, "Ravi Sharma", herbBatch.Owner)
+	require.Equal(t, "Tamil Nadu", herbBatch.Region)
+	require.Equal(t, "2025-02-11", herbBatch.ExpiryDate, "a longer shelf life must not extend the expiry date")
+
+	stats := n.ledgerStats()
+	require.Equal(t, map[string]int{"Kerala Ayurveda Farms": 1, "Test Farm": 1}, stats.ByFarm)
+	require.Equal(t, map[string]int{"Withania somnifera": 1, "Curcuma longa": 1}, stats.BySpecies)
+
+	_, err = n.repairUnderscores(n.admin)
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+}
+
+func TestRepairUnderscoresKeepsQuotaCharge(t *testing.T) {
+	n := newTestNetwork(t)
+	err := n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetHarvestQuota(ctx, "Ocimum_tenuiflorum", "Tamil_Nadu", "2024", "2024-01-01", "2024-12-31", 50)
+	})
+	require.NoError(t, err)
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CreateHerbBatch(ctx, "batch_1", "Ocimum_tenuiflorum", "Test_Farm", "2024-08-15", "Ravi_Sharma", chaincode.StatusHarvested, "Tamil_Nadu", 10, "", "")
+	})
+	require.NoError(t, err)
+
+	// batches charged before the quota key was recorded only carry the season
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		herbBatch, err := n.contract.ReadHerbBatch(ctx, "batch_1")
+		if err != nil {
+			return err
+		}
+		herbBatch.QuotaRegion, herbBatch.QuotaSpecies = "", ""
+		herbBatchJSON, err := json.Marshal(herbBatch)
+		if err != nil {
+			return err
+		}
+		return ctx.GetStub().PutState("batch_1", herbBatchJSON)
+	})
+	require.NoError(t, err)
+
+	_, err = n.repairUnderscores(n.admin)
+	require.NoError(t, err)
+
+	herbBatch := n.readHerbBatch("batch_1")
+	require.Equal(t, "Ocimum tenuiflorum", herbBatch.BotanicalName)
+	require.Equal(t, "2024-11-13", herbBatch.ExpiryDate)
+	require.Equal(t, "Ocimum_tenuiflorum", herbBatch.QuotaSpecies)
+	require.Equal(t, "Tamil_Nadu", herbBatch.QuotaRegion)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DeleteHerbBatch(ctx, "batch_1")
+	})
+	require.NoError(t, err)
+
+	var quota *chaincode.HarvestQuota
+	err = n.evaluate(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		quota, err = n.contract.ReadHarvestQuota(ctx, "Ocimum_tenuiflorum", "Tamil_Nadu", "2024")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, 50.0, quota.Remaining, "deleting the batch releases the quota it was charged to")
+}
+
+func TestRepairUnderscoredHerbBatchesPerOrganisation(t *testing.T) {
+	n := newTestNetwork(t)
+	n.registerOrg2()
+	for _, id := range []string{"batch_1", "batch_2"} {
+		err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+			return n.contract.CreateHerbBatch(ctx, id, "Curcuma_longa", "Test_Farm", "2024-08-15", "Ravi_Sharma", chaincode.StatusHarvested, "Kerala", 10, "", "")
+		})
+		require.NoError(t, err)
+	}
+	err := n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.TransferHerbBatch(ctx, "batch_2", "Spice_Traders", org2MSP)
+		return err
+	})
+	require.NoError(t, err)
+
+	repaired, err := n.repairUnderscores(n.admin)
+	require.NoError(t, err)
+	require.Equal(t, []string{"batch_1"}, repaired, "an organisation repairs only the batches it owns")
+	require.Equal(t, "Curcuma_longa", n.readHerbBatch("batch_2").BotanicalName)
+
+	org2Admin := newIdentity(t, org2MSP, "admin", []string{"admin"}, map[string]string{"hf.Type": "admin"})
+	repaired, err = n.repairUnderscores(org2Admin)
+	require.NoError(t, err)
+	require.Equal(t, []string{"batch_2"}, repaired)
+
+	herbBatch := n.readHerbBatch("batch_2")
+	require.Equal(t, "Curcuma longa", herbBatch.BotanicalName)
+	require.Equal(t, "Spice Traders", herbBatch.Owner)
+
+	_, err = n.repairUnderscores(org2Admin)
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+}
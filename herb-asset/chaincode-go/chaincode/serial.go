@@ -0,0 +1,317 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"math"
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const (
+	serialObjectType      = "serial"
+	serialRangeObjectType = "serialrange"
+)
+
+// maxSerialRange bounds the number of units registered in one transaction so the
+// write set stays within the peer's limits
+const maxSerialRange = 5000
+
+// Unit serial statuses
+const (
+	SerialActive             = "Active"
+	SerialSold               = "Sold"
+	SerialReturned           = "Returned"
+	SerialCounterfeitFlagged = "Counterfeit-Flagged"
+)
+
+// validSerialTransitions lists the statuses a unit may move to from each status.
+// Any unit may be flagged as counterfeit.
+var validSerialTransitions = map[string][]string{
+	SerialActive:   {SerialSold, SerialCounterfeitFlagged},
+	SerialSold:     {SerialReturned, SerialCounterfeitFlagged},
+	SerialReturned: {SerialActive, SerialCounterfeitFlagged},
+}
+
+// SerialUnit is a single consumer unit identified GS1 SGTIN style by its GTIN and
+// serial number. LotID is the packaged herb batch the unit was filled from.
+type SerialUnit struct {
+	GTIN      string `json:"gtin"`
+	LotID     string `json:"lotId"`
+	Serial    string `json:"serial"`
+	Status    string `json:"status"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// SerialRange records a contiguous block of serial numbers registered under a lot
+type SerialRange struct {
+	Count        int64  `json:"count"`
+	GTIN         string `json:"gtin"`
+	LotID        string `json:"lotId"`
+	RegisteredAt string `json:"registeredAt"`
+	StartSerial  int64  `json:"startSerial"`
+}
+
+// SerialProvenance resolves a unit to the lot it was packaged from and the herb
+// batches that lot originates from
+type SerialProvenance struct {
+	Lot           *HerbBatch  `json:"lot"`
+	OriginBatches []string    `json:"originBatches"`
+	Unit          *SerialUnit `json:"unit"`
+}
+
+// RegisterSerialRange registers count consecutive serial numbers starting at
+// startSerial for the given GTIN under a packaged herb batch. Only the owner of the
+// lot, or an admin of its organisation, may register its units.
+func (s *SmartContract) RegisterSerialRange(ctx contractapi.TransactionContextInterface, lotID string, gtin string, startSerial int64, count int64) error {
+	if !validGTIN(gtin) {
+		return validationError("invalid GTIN %s", gtin)
+	}
+	if startSerial < 0 {
+		return validationError("the start serial must not be negative")
+	}
+	if count <= 0 || count > maxSerialRange {
+		return validationError("the serial count must be between 1 and %d", maxSerialRange)
+	}
+	if startSerial > math.MaxInt64-count {
+		return validationError("the serial range starting at %d overflows the serial numbers", startSerial)
+	}
+
+	lot, err := s.ReadHerbBatch(ctx, lotID)
+	if err != nil {
+		return err
+	}
+	err = requireHerbBatchOwner(ctx, lot)
+	if err != nil {
+		return err
+	}
+	if lot.Status != StatusPackaged {
+		return invalidTransitionError("the herb batch %s is %s; units can only be registered once it is %s", lotID, lot.Status, StatusPackaged)
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	for serial := startSerial; serial < startSerial+count; serial++ {
+		unit := SerialUnit{
+			GTIN:      gtin,
+			LotID:     lotID,
+			Serial:    strconv.FormatInt(serial, 10),
+			Status:    SerialActive,
+			UpdatedAt: now,
+		}
+
+		key, err := ctx.GetStub().CreateCompositeKey(serialObjectType, []string{unit.GTIN, unit.Serial})
+		if err != nil {
+			return internalError("failed to create composite key: %v", err)
+		}
+		existing, err := ctx.GetStub().GetState(key)
+		if err != nil {
+			return internalError("failed to read from world state: %v", err)
+		}
+		if existing != nil {
+			return alreadyExistsError("the serial %s of GTIN %s is already registered", unit.Serial, gtin)
+		}
+
+		err = putSerialUnit(ctx, &unit)
+		if err != nil {
+			return err
+		}
+	}
+
+	serialRange := SerialRange{
+		Count:        count,
+		GTIN:         gtin,
+		LotID:        lotID,
+		RegisteredAt: now,
+		StartSerial:  startSerial,
+	}
+	serialRangeJSON, err := json.Marshal(serialRange)
+	if err != nil {
+		return err
+	}
+	rangeKey, err := ctx.GetStub().CreateCompositeKey(serialRangeObjectType, []string{lotID, gtin, strconv.FormatInt(startSerial, 10)})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(rangeKey, serialRangeJSON)
+}
+
+// ReadSerialUnit returns the unit registered with the given GTIN and serial number
+func (s *SmartContract) ReadSerialUnit(ctx contractapi.TransactionContextInterface, gtin string, serial string) (*SerialUnit, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(serialObjectType, []string{gtin, serial})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+
+	unitJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if unitJSON == nil {
+		return nil, notFoundError("the serial %s of GTIN %s is not registered", serial, gtin)
+	}
+
+	var unit SerialUnit
+	err = json.Unmarshal(unitJSON, &unit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unit, nil
+}
+
+// UpdateSerialStatus moves a unit to a new status, e.g. when it is sold or returned.
+// Only the owner of the unit's lot, or an admin of the owning organisation, may
+// update it.
+func (s *SmartContract) UpdateSerialStatus(ctx contractapi.TransactionContextInterface, gtin string, serial string, newStatus string) error {
+	unit, err := s.ReadSerialUnit(ctx, gtin, serial)
+	if err != nil {
+		return err
+	}
+	lot, err := s.ReadHerbBatch(ctx, unit.LotID)
+	if err != nil {
+		return err
+	}
+	err = requireHerbBatchOwner(ctx, lot)
+	if err != nil {
+		return err
+	}
+
+	allowed := false
+	for _, status := range validSerialTransitions[unit.Status] {
+		if status == newStatus {
+			allowed = true
+			break
+		}
+	}
+	if !allowed {
+		return invalidTransitionError("the serial %s of GTIN %s cannot move from %s to %s", serial, gtin, unit.Status, newStatus)
+	}
+
+	unit.Status = newStatus
+	unit.UpdatedAt, err = transactionTime(ctx)
+	if err != nil {
+		return err
+	}
+
+	return putSerialUnit(ctx, unit)
+}
+
+// ResolveSerial returns the unit with the lot and origin herb batches it came from:
+// the lot itself and every batch blended into it, directly or through other blends
+func (s *SmartContract) ResolveSerial(ctx contractapi.TransactionContextInterface, gtin string, serial string) (*SerialProvenance, error) {
+	unit, err := s.ReadSerialUnit(ctx, gtin, serial)
+	if err != nil {
+		return nil, err
+	}
+
+	lot, err := s.ReadHerbBatch(ctx, unit.LotID)
+	if err != nil {
+		return nil, err
+	}
+	originBatches, err := s.originBatches(ctx, lot.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SerialProvenance{
+		Lot:           lot,
+		OriginBatches: originBatches,
+		Unit:          unit,
+	}, nil
+}
+
+// originBatches walks the Blending steps of a herb batch's processing history and
+// returns the batch followed by every batch blended into it, each once
+func (s *SmartContract) originBatches(ctx contractapi.TransactionContextInterface, batchID string) ([]string, error) {
+	origins := []string{batchID}
+	seen := map[string]bool{batchID: true}
+	for i := 0; i < len(origins); i++ {
+		steps, err := s.GetProcessingHistory(ctx, origins[i])
+		if err != nil {
+			return nil, err
+		}
+		for _, step := range steps {
+			if step.StepType != StepBlending {
+				continue
+			}
+			for _, sourceID := range blendSources(step.Parameters) {
+				if !seen[sourceID] {
+					seen[sourceID] = true
+					origins = append(origins, sourceID)
+				}
+			}
+		}
+	}
+
+	return origins, nil
+}
+
+// GetSerialRangesByLot returns the serial ranges registered under a packaged herb batch
+func (s *SmartContract) GetSerialRangesByLot(ctx contractapi.TransactionContextInterface, lotID string) ([]*SerialRange, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(serialRangeObjectType, []string{lotID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	var ranges []*SerialRange
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var serialRange SerialRange
+		err = json.Unmarshal(queryResponse.Value, &serialRange)
+		if err != nil {
+			return nil, err
+		}
+		ranges = append(ranges, &serialRange)
+	}
+
+	return ranges, nil
+}
+
+func putSerialUnit(ctx contractapi.TransactionContextInterface, unit *SerialUnit) error {
+	key, err := ctx.GetStub().CreateCompositeKey(serialObjectType, []string{unit.GTIN, unit.Serial})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	unitJSON, err := json.Marshal(unit)
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, unitJSON)
+}
+
+// validGTIN checks the length and GS1 mod-10 check digit of a GTIN-8, -12, -13 or -14
+func validGTIN(gtin string) bool {
+	switch len(gtin) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+
+	sum := 0
+	for i := len(gtin) - 2; i >= 0; i-- {
+		digit := int(gtin[i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		// weights alternate 3, 1, ... starting from the digit next to the check digit
+		if (len(gtin)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+
+	check := int(gtin[len(gtin)-1] - '0')
+	return check >= 0 && check <= 9 && (10-sum%10)%10 == check
+}
@@ -0,0 +1,127 @@
+package chaincode_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+const testGTIN = "4006381333931"
+
+func (n *testNetwork) registerSerialRange(gtin string, startSerial int64, count int64) error {
+	return n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RegisterSerialRange(ctx, "batch1", gtin, startSerial, count)
+	})
+}
+
+func (n *testNetwork) updateSerialStatus(serial string, newStatus string) error {
+	return n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateSerialStatus(ctx, testGTIN, serial, newStatus)
+	})
+}
+
+func TestRegisterSerialRange(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	requireCode(t, n.registerSerialRange(testGTIN, 1, 3), chaincode.CodeInvalidTransition)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "batch1", chaincode.StatusPackaged)
+	})
+	require.NoError(t, err)
+
+	requireCode(t, n.registerSerialRange("4006381333932", 1, 3), chaincode.CodeValidation)
+	requireCode(t, n.registerSerialRange(testGTIN, 1, 0), chaincode.CodeValidation)
+	requireCode(t, n.registerSerialRange(testGTIN, math.MaxInt64-1, 3), chaincode.CodeValidation)
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.RegisterSerialRange(ctx, "batch1", testGTIN, 1, 3)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	require.NoError(t, n.registerSerialRange(testGTIN, 1, 3))
+	requireCode(t, n.registerSerialRange(testGTIN, 3, 2), chaincode.CodeAlreadyExists)
+
+	var ranges []*chaincode.SerialRange
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		ranges, err = n.contract.GetSerialRangesByLot(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, ranges, 1)
+	require.Equal(t, int64(3), ranges[0].Count)
+
+	var provenance *chaincode.SerialProvenance
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		provenance, err = n.contract.ResolveSerial(ctx, testGTIN, "2")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, chaincode.SerialActive, provenance.Unit.Status)
+	require.Equal(t, "batch1", provenance.Lot.ID)
+
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.ResolveSerial(ctx, testGTIN, "4")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+}
+
+func TestUpdateSerialStatus(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "batch1", chaincode.StatusPackaged)
+	})
+	require.NoError(t, err)
+	require.NoError(t, n.registerSerialRange(testGTIN, 1, 1))
+
+	err = n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateSerialStatus(ctx, testGTIN, "1", chaincode.SerialSold)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	requireCode(t, n.updateSerialStatus("1", chaincode.SerialReturned), chaincode.CodeInvalidTransition)
+	require.NoError(t, n.updateSerialStatus("1", chaincode.SerialSold))
+	require.NoError(t, n.updateSerialStatus("1", chaincode.SerialReturned))
+	require.NoError(t, n.updateSerialStatus("1", chaincode.SerialCounterfeitFlagged))
+	requireCode(t, n.updateSerialStatus("1", chaincode.SerialActive), chaincode.CodeInvalidTransition)
+}
+
+func TestResolveSerialOriginBatches(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	n.mustCreateHerbBatch("batch2", "Withania somnifera", "Kerala", "2024-08-16", 50)
+	n.mustCreateHerbBatch("batch3", "Withania somnifera", "Kerala", "2024-08-17", 40)
+
+	blend := func(batchID string, sources string) error {
+		return n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+			_, err := n.contract.RecordProcessingStep(ctx, batchID, chaincode.StepBlending, "Kochi Plant", "Operator A", 10, 10, map[string]string{chaincode.BlendSourcesParameter: sources})
+			return err
+		})
+	}
+	requireCode(t, blend("batch1", "batch1"), chaincode.CodeValidation)
+	requireCode(t, blend("batch1", "batch9"), chaincode.CodeNotFound)
+	require.NoError(t, blend("batch2", "batch3"))
+	// batch3 has gone into batch2
+	requireCode(t, blend("batch1", "batch2, batch3"), chaincode.CodeValidation)
+	require.NoError(t, blend("batch1", "batch2"))
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "batch1", chaincode.StatusPackaged)
+	})
+	require.NoError(t, err)
+	require.NoError(t, n.registerSerialRange(testGTIN, 1, 1))
+
+	var provenance *chaincode.SerialProvenance
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		provenance, err = n.contract.ResolveSerial(ctx, testGTIN, "1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"batch1", "batch2", "batch3"}, provenance.OriginBatches)
+}
@@ -0,0 +1,227 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"sort"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// shelfLifeObjectType is the composite key namespace for species shelf life overrides
+const shelfLifeObjectType = "shelflife"
+
+// maxExpiryWindowDays bounds the look-ahead of GetHerbBatchesExpiringWithin
+const maxExpiryWindowDays = 3650
+
+// ShelfLife is how long the material of a species keeps, in days, counted from the
+// harvest date for raw material and from the last processing step once processed.
+// Processing never extends a lot beyond the expiry date it already has.
+type ShelfLife struct {
+	HarvestDays   int    `json:"harvestDays"`
+	ProcessedDays int    `json:"processedDays"`
+	Species       string `json:"species"`
+}
+
+// defaultShelfLife applies to species without an entry in defaultShelfLives or an
+// override set with SetSpeciesShelfLife
+var defaultShelfLife = ShelfLife{HarvestDays: 180, ProcessedDays: 730}
+
+// defaultShelfLives are the built-in shelf lives of common species. Roots and
+// rhizomes keep longer than leaves and aerial parts.
+var defaultShelfLives = map[string]ShelfLife{
+	"Withania somnifera":   {HarvestDays: 365, ProcessedDays: 1095},
+	"Curcuma longa":        {HarvestDays: 365, ProcessedDays: 730},
+	"Ocimum tenuiflorum":   {HarvestDays: 90, ProcessedDays: 365},
+	"Bacopa monnieri":      {HarvestDays: 90, ProcessedDays: 365},
+	"Centella asiatica":    {HarvestDays: 90, ProcessedDays: 365},
+	"Tinospora cordifolia": {HarvestDays: 180, ProcessedDays: 730},
+}
+
+// Statuses that move a herb batch onward and are refused for expired lots
+var distributionStatuses = map[string]bool{
+	StatusInTransit:   true,
+	StatusDistributed: true,
+	StatusDelivered:   true,
+}
+
+// SetSpeciesShelfLife overrides the shelf life of a species for batches created or
+// processed from now on. Existing expiry dates are not changed.
+func (s *SmartContract) SetSpeciesShelfLife(ctx contractapi.TransactionContextInterface, species string, harvestDays int, processedDays int) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	if species == "" {
+		return validationError("a species is required")
+	}
+	if harvestDays <= 0 || processedDays <= 0 {
+		return validationError("shelf lives must be greater than zero days")
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(shelfLifeObjectType, []string{species})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	shelfLifeJSON, err := json.Marshal(ShelfLife{
+		HarvestDays:   harvestDays,
+		ProcessedDays: processedDays,
+		Species:       species,
+	})
+	if err != nil {
+		return err
+	}
+
+	return ctx.GetStub().PutState(key, shelfLifeJSON)
+}
+
+// GetSpeciesShelfLife returns the shelf life applied to a species: its override if
+// one is set, otherwise the built-in default
+func (s *SmartContract) GetSpeciesShelfLife(ctx contractapi.TransactionContextInterface, species string) (*ShelfLife, error) {
+	key, err := ctx.GetStub().CreateCompositeKey(shelfLifeObjectType, []string{species})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+
+	shelfLifeJSON, err := ctx.GetStub().GetState(key)
+	if err != nil {
+		return nil, internalError("failed to read from world state: %v", err)
+	}
+	if shelfLifeJSON != nil {
+		var shelfLife ShelfLife
+		err = json.Unmarshal(shelfLifeJSON, &shelfLife)
+		if err != nil {
+			return nil, err
+		}
+		return &shelfLife, nil
+	}
+
+	shelfLife, ok := defaultShelfLives[species]
+	if !ok {
+		shelfLife = defaultShelfLife
+	}
+	shelfLife.Species = species
+
+	return &shelfLife, nil
+}
+
+// GetHerbBatchesExpiringWithin returns the herb batches whose expiry date falls within
+// the given number of days from the transaction date, soonest first. Lots that have
+// already expired are included; batches without an expiry date are not.
+func (s *SmartContract) GetHerbBatchesExpiringWithin(ctx contractapi.TransactionContextInterface, days int) ([]*HerbBatch, error) {
+	if days < 0 || days > maxExpiryWindowDays {
+		return nil, validationError("the number of days must be between 0 and %d", maxExpiryWindowDays)
+	}
+
+	today, err := transactionDate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	until := today.AddDate(0, 0, days).Format(dateLayout)
+
+	herbBatches, err := s.GetAllHerbBatches(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	expiring := []*HerbBatch{}
+	for _, herbBatch := range herbBatches {
+		if herbBatch.ExpiryDate != "" && herbBatch.ExpiryDate <= until {
+			expiring = append(expiring, herbBatch)
+		}
+	}
+	sort.SliceStable(expiring, func(i, j int) bool {
+		return expiring[i].ExpiryDate < expiring[j].ExpiryDate
+	})
+
+	return expiring, nil
+}
+
+// harvestExpiryDate returns the expiry date of raw material of a species harvested on harvestDate
+func (s *SmartContract) harvestExpiryDate(ctx contractapi.TransactionContextInterface, species string, harvestDate string) (string, error) {
+	harvested, err := time.Parse(dateLayout, harvestDate)
+	if err != nil {
+		return "", validationError("invalid harvest date %s: %v", harvestDate, err)
+	}
+
+	shelfLife, err := s.GetSpeciesShelfLife(ctx, species)
+	if err != nil {
+		return "", err
+	}
+
+	return harvested.AddDate(0, 0, shelfLife.HarvestDays).Format(dateLayout), nil
+}
+
+// processedExpiryDate returns the expiry date of material of a species processed today
+func (s *SmartContract) processedExpiryDate(ctx contractapi.TransactionContextInterface, species string) (string, error) {
+	today, err := transactionDate(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	shelfLife, err := s.GetSpeciesShelfLife(ctx, species)
+	if err != nil {
+		return "", err
+	}
+
+	return today.AddDate(0, 0, shelfLife.ProcessedDays).Format(dateLayout), nil
+}
+
+// earliestDate returns the earlier of two dates, ignoring an empty one
+func earliestDate(a string, b string) string {
+	if a == "" || (b != "" && b < a) {
+		return b
+	}
+	return a
+}
+
+// requireDistributable returns an error when the herb batch has been recalled or is
+// past its expiry date
+func requireDistributable(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) error {
+	err := requireNotRecalled(ctx, herbBatch)
+	if err != nil {
+		return err
+	}
+
+	return requireNotExpired(ctx, herbBatch)
+}
+
+// requireStatusChangeAllowed returns an error unless the herb batch may move to
+// status: a recalled batch keeps its status, and an expired one cannot be distributed
+func requireStatusChangeAllowed(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch, status string) error {
+	if distributionStatuses[status] {
+		return requireDistributable(ctx, herbBatch)
+	}
+
+	return requireNotRecalled(ctx, herbBatch)
+}
+
+// requireNotExpired returns an error when the herb batch is past its expiry date.
+// The expiry date itself is the last day the lot may be moved.
+func requireNotExpired(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch) error {
+	if herbBatch.ExpiryDate == "" {
+		return nil
+	}
+
+	today, err := transactionDate(ctx)
+	if err != nil {
+		return err
+	}
+	if herbBatch.ExpiryDate < today.Format(dateLayout) {
+		return invalidTransitionError("the herb batch %s expired on %s", herbBatch.ID, herbBatch.ExpiryDate)
+	}
+
+	return nil
+}
+
+// transactionDate returns the UTC calendar date of the transaction timestamp
+func transactionDate(ctx contractapi.TransactionContextInterface) (time.Time, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return time.Time{}, internalError("failed to read transaction timestamp: %v", err)
+	}
+
+	return timestamp.AsTime().UTC().Truncate(24 * time.Hour), nil
+}
@@ -0,0 +1,138 @@
+package chaincode_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func (n *testNetwork) herbBatchesExpiringWithin(days int) []*chaincode.HerbBatch {
+	var herbBatches []*chaincode.HerbBatch
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		herbBatches, err = n.contract.GetHerbBatchesExpiringWithin(ctx, days)
+		return err
+	})
+	require.NoError(n.t, err)
+	return herbBatches
+}
+
+func TestHerbBatchExpiryDate(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetSpeciesShelfLife(ctx, "Bacopa monnieri", 30, 120)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetSpeciesShelfLife(ctx, "Bacopa monnieri", 30, 120)
+	})
+	require.NoError(t, err)
+
+	n.mustCreateHerbBatch("batch1", "Bacopa monnieri", "Uttarakhand", "2024-08-15", 60)
+	n.mustCreateHerbBatch("batch2", "Unlisted species", "Kerala", "2024-08-15", 60)
+	require.Equal(t, "2024-09-14", n.readHerbBatch("batch1").ExpiryDate)
+	require.Equal(t, "2025-02-11", n.readHerbBatch("batch2").ExpiryDate)
+
+	requireCode(t, n.createHerbBatch("batch3", "Bacopa monnieri", "Uttarakhand", "15/08/2024", 60), chaincode.CodeValidation)
+
+	n.ledger.SetTime(time.Date(2024, time.September, 1, 8, 0, 0, 0, time.UTC))
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.RecordProcessingStep(ctx, "batch1", chaincode.StepDrying, "Kochi Plant", "Operator A", 60, 20, nil)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2024-09-14", n.readHerbBatch("batch1").ExpiryDate, "processing must not extend the expiry date")
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.SetSpeciesShelfLife(ctx, "Bacopa monnieri", 30, 5)
+	})
+	require.NoError(t, err)
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.RecordProcessingStep(ctx, "batch1", chaincode.StepGrinding, "Kochi Plant", "Operator A", 20, 19, nil)
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2024-09-06", n.readHerbBatch("batch1").ExpiryDate)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatch(ctx, "batch2", "Ocimum tenuiflorum", "Test Farm", "2024-08-15", "Ravi Sharma", chaincode.StatusHarvested)
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2024-11-13", n.readHerbBatch("batch2").ExpiryDate)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatch(ctx, "batch2", "Unlisted species", "Test Farm", "2024-08-15", "Ravi Sharma", chaincode.StatusHarvested)
+	})
+	require.NoError(t, err)
+	require.Equal(t, "2024-11-13", n.readHerbBatch("batch2").ExpiryDate, "a new species must not extend the expiry date")
+}
+
+func TestExpiredHerbBatchesCannotMove(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Ocimum tenuiflorum", "Maharashtra", "2024-08-15", 40)
+	require.Equal(t, "2024-11-13", n.readHerbBatch("batch1").ExpiryDate)
+
+	n.ledger.SetTime(time.Date(2024, time.November, 13, 23, 0, 0, 0, time.UTC))
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.TransferHerbBatch(ctx, "batch1", "Priya Patel", "")
+		return err
+	})
+	require.NoError(t, err, "a lot may still move on its expiry date")
+	_, err = n.recordSupplyChainEvent(n.transporter, chaincode.ActionTransport, "Pune")
+	require.NoError(t, err)
+
+	n.ledger.SetTime(time.Date(2024, time.November, 14, 0, 0, 0, 0, time.UTC))
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.TransferHerbBatch(ctx, "batch1", "Suresh Kumar", "")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "batch1", chaincode.StatusDistributed)
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.RecordProcessingStep(ctx, "batch1", chaincode.StepDrying, "Kochi Plant", "Operator A", 40, 15, nil)
+		return err
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.OfferHerbBatch(ctx, "offer1", "batch1", n.accountID(n.buyer), "Spice Traders", 100)
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	// expired lots can still be quarantined for testing
+	_, err = n.recordSupplyChainEvent(n.lab, chaincode.ActionLabReceive, "Pune Lab")
+	require.NoError(t, err)
+}
+
+func TestGetHerbBatchesExpiringWithin(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	n.mustCreateHerbBatch("batch2", "Ocimum tenuiflorum", "Maharashtra", "2024-08-15", 40)
+	n.mustCreateHerbBatch("batch3", "Centella asiatica", "Karnataka", "2024-06-01", 75)
+
+	n.ledger.SetTime(time.Date(2024, time.September, 15, 0, 0, 0, 0, time.UTC))
+
+	expiring := n.herbBatchesExpiringWithin(60)
+	require.Len(t, expiring, 2)
+	require.Equal(t, "batch3", expiring[0].ID)
+	require.Equal(t, "batch2", expiring[1].ID)
+
+	require.Len(t, n.herbBatchesExpiringWithin(0), 1)
+	require.Len(t, n.herbBatchesExpiringWithin(365), 3)
+
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.GetHerbBatchesExpiringWithin(ctx, -1)
+		return err
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+}
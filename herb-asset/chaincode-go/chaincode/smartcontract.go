@@ -2,11 +2,26 @@ package chaincode
 
 import (
 	"encoding/json"
-	"fmt"
+	"time"
 
 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
 )
 
+// dateLayout is the calendar date format used for harvest and season dates
+const dateLayout = "2006-01-02"
+
+// Supply chain statuses of a herb batch
+const (
+	StatusHarvested   = "Harvested"
+	StatusInTransit   = "In-Transit"
+	StatusLabTesting  = "Lab-Testing"
+	StatusCertified   = "Certified"
+	StatusProcessing  = "Processing"
+	StatusPackaged    = "Packaged"
+	StatusDistributed = "Distributed"
+	StatusDelivered   = "Delivered"
+)
+
 // SmartContract provides functions for managing HerbBatch assets
 type SmartContract struct {
 	contractapi.Contract
@@ -16,26 +31,46 @@ type SmartContract struct {
 // Insert struct field in alphabetic order => to achieve determinism across languages
 // golang keeps the order when marshal to json but doesn't order automatically
 type HerbBatch struct {
-	ID            string `json:"ID"`
-	BotanicalName string `json:"botanicalName"`
-	Farm          string `json:"farm"`
-	HarvestDate   string `json:"harvestDate"`
-	Owner         string `json:"owner"`
-	Status        string `json:"status"` // e.g., "Harvested", "In-Transit", "Certified"
+	ID                string  `json:"ID"`
+	BotanicalName     string  `json:"botanicalName"`
+	ExpiryDate        string  `json:"expiryDate,omitempty" metadata:",optional"` // last day the lot may be moved, from the species shelf life
+	Farm              string  `json:"farm"`
+	HarvestDate       string  `json:"harvestDate"`
+	Owner             string  `json:"owner"`
+	OwnerID           string  `json:"ownerId,omitempty" metadata:",optional"`
+	OwnerOrg          string  `json:"ownerOrg"` // MSP ID of the organisation that must endorse changes
+	Quantity          float64 `json:"quantity"` // harvested weight in kilograms
+	QuotaRegion       string  `json:"quotaRegion,omitempty" metadata:",optional"`
+	QuotaSeason       string  `json:"quotaSeason,omitempty" metadata:",optional"`
+	QuotaSpecies      string  `json:"quotaSpecies,omitempty" metadata:",optional"`
+	Region            string  `json:"region"`
+	RemainingQuantity float64 `json:"remainingQuantity"` // weight left after processing losses
+	Status            string  `json:"status"`            // e.g., "Harvested", "In-Transit", "Certified"
 }
 
 // InitLedger adds a base set of herb batches to the ledger
 func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface) error {
 	herbBatches := []HerbBatch{
-		{ID: "batch1", BotanicalName: "Withania somnifera", Farm: "Kerala Ayurveda Farms", HarvestDate: "2024-08-15", Owner: "Ravi Sharma", Status: "Harvested"},
-		{ID: "batch2", BotanicalName: "Curcuma longa", Farm: "Tamil Nadu Spice Co", HarvestDate: "2024-08-20", Owner: "Priya Patel", Status: "In-Transit"},
-		{ID: "batch3", BotanicalName: "Ocimum tenuiflorum", Farm: "Maharashtra Herbs", HarvestDate: "2024-07-30", Owner: "Suresh Kumar", Status: "Certified"},
-		{ID: "batch4", BotanicalName: "Bacopa monnieri", Farm: "Uttarakhand Organics", HarvestDate: "2024-08-10", Owner: "Anjali Singh", Status: "Harvested"},
-		{ID: "batch5", BotanicalName: "Centella asiatica", Farm: "Karnataka Medicinals", HarvestDate: "2024-08-25", Owner: "Vikram Joshi", Status: "In-Transit"},
-		{ID: "batch6", BotanicalName: "Tinospora cordifolia", Farm: "Rajasthan Herb Gardens", HarvestDate: "2024-08-12", Owner: "Meera Gupta", Status: "Certified"},
+		{ID: "batch1", BotanicalName: "Withania somnifera", Farm: "Kerala Ayurveda Farms", HarvestDate: "2024-08-15", Owner: "Ravi Sharma", Quantity: 120, Region: "Kerala", Status: "Harvested"},
+		{ID: "batch2", BotanicalName: "Curcuma longa", Farm: "Tamil Nadu Spice Co", HarvestDate: "2024-08-20", Owner: "Priya Patel", Quantity: 85.5, Region: "Tamil Nadu", Status: "In-Transit"},
+		{ID: "batch3", BotanicalName: "Ocimum tenuiflorum", Farm: "Maharashtra Herbs", HarvestDate: "2024-07-30", Owner: "Suresh Kumar", Quantity: 40, Region: "Maharashtra", Status: "Certified"},
+		{ID: "batch4", BotanicalName: "Bacopa monnieri", Farm: "Uttarakhand Organics", HarvestDate: "2024-08-10", Owner: "Anjali Singh", Quantity: 62.5, Region: "Uttarakhand", Status: "Harvested"},
+		{ID: "batch5", BotanicalName: "Centella asiatica", Farm: "Karnataka Medicinals", HarvestDate: "2024-08-25", Owner: "Vikram Joshi", Quantity: 75, Region: "Karnataka", Status: "In-Transit"},
+		{ID: "batch6", BotanicalName: "Tinospora cordifolia", Farm: "Rajasthan Herb Gardens", HarvestDate: "2024-08-12", Owner: "Meera Gupta", Quantity: 150, Region: "Rajasthan", Status: "Certified"},
+	}
+
+	ownerOrg, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return internalError("failed to get client MSP ID: %v", err)
 	}
 
 	for _, herbBatch := range herbBatches {
+		herbBatch.OwnerOrg = ownerOrg
+		herbBatch.RemainingQuantity = herbBatch.Quantity
+		herbBatch.ExpiryDate, err = s.harvestExpiryDate(ctx, herbBatch.BotanicalName, herbBatch.HarvestDate)
+		if err != nil {
+			return err
+		}
 		herbBatchJSON, err := json.Marshal(herbBatch)
 		if err != nil {
 			return err
@@ -43,7 +78,22 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 
 		err = ctx.GetStub().PutState(herbBatch.ID, herbBatchJSON)
 		if err != nil {
-			return fmt.Errorf("failed to put to world state. %v", err)
+			return internalError("failed to put to world state. %v", err)
+		}
+
+		err = setHerbBatchEndorsement(ctx, herbBatch.ID, ownerOrg)
+		if err != nil {
+			return err
+		}
+
+		err = putHarvestDateIndex(ctx, &herbBatch)
+		if err != nil {
+			return err
+		}
+
+		err = recordStatsChange(ctx, nil, &herbBatch)
+		if err != nil {
+			return err
 		}
 	}
 
@@ -51,39 +101,104 @@ func (s *SmartContract) InitLedger(ctx contractapi.TransactionContextInterface)
 }
 
 // CreateHerbBatch issues a new herb batch to the world state with given details.
-func (s *SmartContract) CreateHerbBatch(ctx contractapi.TransactionContextInterface, id string, botanicalName string, farm string, harvestDate string, owner string, status string) error {
+// Harvests of a species under a seasonal quota in the batch's region are
+// deducted from that quota, whose key is kept as QuotaSpecies, QuotaRegion and
+// QuotaSeason, and rejected when they would exceed it. Such species need a region.
+// When deviceKeyID is set, signature must be the owner's device signature over the
+// canonical harvest claim; it is verified and stored as the batch's attestation.
+func (s *SmartContract) CreateHerbBatch(ctx contractapi.TransactionContextInterface, id string, botanicalName string, farm string, harvestDate string, owner string, status string, region string, quantity float64, deviceKeyID string, signature string) error {
 	exists, err := s.HerbBatchExists(ctx, id)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return fmt.Errorf("the herb batch %s already exists", id)
+		return alreadyExistsError("the herb batch %s already exists", id)
+	}
+	if quantity <= 0 {
+		return validationError("the quantity of herb batch %s must be greater than zero", id)
+	}
+	expiryDate, err := s.harvestExpiryDate(ctx, botanicalName, harvestDate)
+	if err != nil {
+		return err
+	}
+
+	if deviceKeyID != "" {
+		claim := HarvestClaim{
+			ID:            id,
+			BotanicalName: botanicalName,
+			Farm:          farm,
+			HarvestDate:   harvestDate,
+			Owner:         owner,
+			Quantity:      quantity,
+			Region:        region,
+		}
+		err = s.attestHarvest(ctx, claim, deviceKeyID, signature)
+		if err != nil {
+			return err
+		}
+	} else if signature != "" {
+		return validationError("a device key ID is required to verify the signature")
+	}
+
+	ownerOrg, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return internalError("failed to get client MSP ID: %v", err)
+	}
+	ownerID, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return internalError("failed to get client identity: %v", err)
 	}
 
 	herbBatch := HerbBatch{
-		ID:            id,
-		BotanicalName: botanicalName,
-		Farm:          farm,
-		HarvestDate:   harvestDate,
-		Owner:         owner,
-		Status:        status,
+		ID:                id,
+		BotanicalName:     botanicalName,
+		ExpiryDate:        expiryDate,
+		Farm:              farm,
+		HarvestDate:       harvestDate,
+		Owner:             owner,
+		OwnerID:           ownerID,
+		OwnerOrg:          ownerOrg,
+		Quantity:          quantity,
+		Region:            region,
+		RemainingQuantity: quantity,
+		Status:            status,
 	}
+	err = consumeHarvestQuota(ctx, &herbBatch)
+	if err != nil {
+		return err
+	}
+
 	herbBatchJSON, err := json.Marshal(herbBatch)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, herbBatchJSON)
+	err = ctx.GetStub().PutState(id, herbBatchJSON)
+	if err != nil {
+		return err
+	}
+
+	err = putHarvestDateIndex(ctx, &herbBatch)
+	if err != nil {
+		return err
+	}
+
+	err = recordStatsChange(ctx, nil, &herbBatch)
+	if err != nil {
+		return err
+	}
+
+	return setHerbBatchEndorsement(ctx, id, ownerOrg)
 }
 
 // ReadHerbBatch returns the herb batch stored in the world state with given id.
 func (s *SmartContract) ReadHerbBatch(ctx contractapi.TransactionContextInterface, id string) (*HerbBatch, error) {
 	herbBatchJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read from world state: %v", err)
+		return nil, internalError("failed to read from world state: %v", err)
 	}
 	if herbBatchJSON == nil {
-		return nil, fmt.Errorf("the herb batch %s does not exist", id)
+		return nil, notFoundError("the herb batch %s does not exist", id)
 	}
 
 	var herbBatch HerbBatch
@@ -96,71 +211,180 @@ func (s *SmartContract) ReadHerbBatch(ctx contractapi.TransactionContextInterfac
 }
 
 // UpdateHerbBatch updates an existing herb batch in the world state with provided parameters.
+// Only the owner of the batch, or an admin of its organisation, may update it. The
+// In-Transit, Lab-Testing and Certified statuses are only reached through
+// RecordSupplyChainEvent, which checks the role of the client.
+// The harvest date is fixed when the batch is created, since the expiry date, harvest
+// quota and any device attestation depend on it; harvestDate must repeat it.
 func (s *SmartContract) UpdateHerbBatch(ctx contractapi.TransactionContextInterface, id string, botanicalName string, farm string, harvestDate string, owner string, status string) error {
-	exists, err := s.HerbBatchExists(ctx, id)
+	herbBatch, err := s.ReadHerbBatch(ctx, id)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the herb batch %s does not exist", id)
+	err = requireHerbBatchOwner(ctx, herbBatch)
+	if err != nil {
+		return err
+	}
+	if harvestDate != herbBatch.HarvestDate {
+		return validationError("the harvest date of herb batch %s cannot be changed from %s", id, herbBatch.HarvestDate)
 	}
 
-	// overwriting original herb batch with new herb batch
-	herbBatch := HerbBatch{
-		ID:            id,
-		BotanicalName: botanicalName,
-		Farm:          farm,
-		HarvestDate:   harvestDate,
-		Owner:         owner,
-		Status:        status,
+	before := *herbBatch
+	if status != before.Status {
+		err = requireWorkflowAction(herbBatch, status)
+		if err != nil {
+			return err
+		}
+		err = requireStatusChangeAllowed(ctx, herbBatch, status)
+		if err != nil {
+			return err
+		}
 	}
+
+	// overwriting the descriptive fields; quantity and region stay tied to the
+	// harvest quota they were charged against
+	herbBatch.BotanicalName = botanicalName
+	herbBatch.Farm = farm
+	herbBatch.Owner = owner
+	herbBatch.Status = status
+
+	// a new species moves the quantity onto the quota covering it, and brings the
+	// expiry date forward if the species keeps for less time
+	if before.BotanicalName != botanicalName {
+		err = s.rechargeHarvestQuota(ctx, &before, herbBatch)
+		if err != nil {
+			return err
+		}
+
+		expiryDate, err := s.harvestExpiryDate(ctx, botanicalName, harvestDate)
+		if err != nil {
+			return err
+		}
+		herbBatch.ExpiryDate = earliestDate(herbBatch.ExpiryDate, expiryDate)
+	}
+
 	herbBatchJSON, err := json.Marshal(herbBatch)
 	if err != nil {
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, herbBatchJSON)
+	err = ctx.GetStub().PutState(id, herbBatchJSON)
+	if err != nil {
+		return err
+	}
+
+	return recordStatsChange(ctx, &before, herbBatch)
 }
 
-// DeleteHerbBatch deletes a given herb batch from the world state.
+// DeleteHerbBatch deletes a given herb batch from the world state. Its quantity is
+// returned to the harvest quota it was charged to. Only the owner of the batch, or
+// an admin of its organisation, may delete it.
 func (s *SmartContract) DeleteHerbBatch(ctx contractapi.TransactionContextInterface, id string) error {
-	exists, err := s.HerbBatchExists(ctx, id)
+	herbBatch, err := s.ReadHerbBatch(ctx, id)
 	if err != nil {
 		return err
 	}
-	if !exists {
-		return fmt.Errorf("the herb batch %s does not exist", id)
+	err = requireHerbBatchOwner(ctx, herbBatch)
+	if err != nil {
+		return err
 	}
 
-	return ctx.GetStub().DelState(id)
+	err = ctx.GetStub().DelState(id)
+	if err != nil {
+		return err
+	}
+
+	err = deleteHarvestDateIndex(ctx, herbBatch)
+	if err != nil {
+		return err
+	}
+
+	err = s.releaseHarvestQuota(ctx, herbBatch)
+	if err != nil {
+		return err
+	}
+
+	return recordStatsChange(ctx, herbBatch, nil)
 }
 
 // HerbBatchExists returns true when herb batch with given ID exists in world state
 func (s *SmartContract) HerbBatchExists(ctx contractapi.TransactionContextInterface, id string) (bool, error) {
 	herbBatchJSON, err := ctx.GetStub().GetState(id)
 	if err != nil {
-		return false, fmt.Errorf("failed to read from world state: %v", err)
+		return false, internalError("failed to read from world state: %v", err)
 	}
 
 	return herbBatchJSON != nil, nil
 }
 
 // TransferHerbBatch updates the owner field of herb batch with given id in world state, and returns the old owner.
-func (s *SmartContract) TransferHerbBatch(ctx contractapi.TransactionContextInterface, id string, newOwner string) (string, error) {
+// When newOwnerOrg names a different organisation the key-level endorsement policy is
+// rotated so that the new owning organisation must endorse further changes; an empty
+// newOwnerOrg keeps the batch within its current organisation. Only the owner of the
+// batch, or an admin of its organisation, may transfer it, and only to an
+// organisation that has registered with RegisterOrganisation. A batch with an
+// accepted transfer offer can only be handed over by settling or rejecting the offer.
+func (s *SmartContract) TransferHerbBatch(ctx contractapi.TransactionContextInterface, id string, newOwner string, newOwnerOrg string) (string, error) {
 	herbBatch, err := s.ReadHerbBatch(ctx, id)
 	if err != nil {
 		return "", err
 	}
+	err = requireHerbBatchOwner(ctx, herbBatch)
+	if err != nil {
+		return "", err
+	}
+	err = s.requireNoAcceptedOffer(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if newOwnerOrg != "" && newOwnerOrg != herbBatch.OwnerOrg {
+		err = requireRegisteredOrg(ctx, newOwnerOrg)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// the identity of the new owner is not known, so only an admin of the new
+	// owning organisation may act for the batch until it is sold through escrow
+	return s.transferHerbBatch(ctx, herbBatch, newOwner, newOwnerOrg, "")
+}
+
+// transferHerbBatch hands a herb batch to newOwner, held by the client identity
+// newOwnerID of organisation newOwnerOrg, withdraws its open transfer offers and
+// returns the old owner
+func (s *SmartContract) transferHerbBatch(ctx contractapi.TransactionContextInterface, herbBatch *HerbBatch, newOwner string, newOwnerOrg string, newOwnerID string) (string, error) {
+	err := requireDistributable(ctx, herbBatch)
+	if err != nil {
+		return "", err
+	}
 
 	oldOwner := herbBatch.Owner
 	herbBatch.Owner = newOwner
+	herbBatch.OwnerID = newOwnerID
+	rotate := newOwnerOrg != "" && newOwnerOrg != herbBatch.OwnerOrg
+	if rotate {
+		herbBatch.OwnerOrg = newOwnerOrg
+	}
 
 	herbBatchJSON, err := json.Marshal(herbBatch)
 	if err != nil {
 		return "", err
 	}
 
-	err = ctx.GetStub().PutState(id, herbBatchJSON)
+	err = ctx.GetStub().PutState(herbBatch.ID, herbBatchJSON)
+	if err != nil {
+		return "", err
+	}
+
+	if rotate {
+		err = setHerbBatchEndorsement(ctx, herbBatch.ID, newOwnerOrg)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// offers made by the old owner can no longer be honoured
+	err = s.withdrawOpenOffers(ctx, herbBatch.ID)
 	if err != nil {
 		return "", err
 	}
@@ -196,13 +420,31 @@ func (s *SmartContract) GetAllHerbBatches(ctx contractapi.TransactionContextInte
 	return herbBatches, nil
 }
 
-// UpdateHerbBatchStatus updates only the status field of a herb batch with given id in world state
+// UpdateHerbBatchStatus updates only the status field of a herb batch with given id in world state.
+// Only the owner of the batch, or an admin of its organisation, may change it, and
+// not to a status reached through a workflow action of RecordSupplyChainEvent.
 func (s *SmartContract) UpdateHerbBatchStatus(ctx contractapi.TransactionContextInterface, id string, newStatus string) error {
 	herbBatch, err := s.ReadHerbBatch(ctx, id)
 	if err != nil {
 		return err
 	}
+	err = requireHerbBatchOwner(ctx, herbBatch)
+	if err != nil {
+		return err
+	}
 
+	if newStatus != herbBatch.Status {
+		err = requireWorkflowAction(herbBatch, newStatus)
+		if err != nil {
+			return err
+		}
+		err = requireStatusChangeAllowed(ctx, herbBatch, newStatus)
+		if err != nil {
+			return err
+		}
+	}
+
+	before := *herbBatch
 	herbBatch.Status = newStatus
 
 	herbBatchJSON, err := json.Marshal(herbBatch)
@@ -210,5 +452,21 @@ func (s *SmartContract) UpdateHerbBatchStatus(ctx contractapi.TransactionContext
 		return err
 	}
 
-	return ctx.GetStub().PutState(id, herbBatchJSON)
+	err = ctx.GetStub().PutState(id, herbBatchJSON)
+	if err != nil {
+		return err
+	}
+
+	return recordStatsChange(ctx, &before, herbBatch)
+}
+
+// transactionTime returns the transaction timestamp formatted as RFC 3339 so that
+// every endorsing peer records the same value
+func transactionTime(ctx contractapi.TransactionContextInterface) (string, error) {
+	timestamp, err := ctx.GetStub().GetTxTimestamp()
+	if err != nil {
+		return "", internalError("failed to read transaction timestamp: %v", err)
+	}
+
+	return timestamp.AsTime().UTC().Format(time.RFC3339), nil
 }
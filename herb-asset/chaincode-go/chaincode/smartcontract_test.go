@@ -1,184 +1,334 @@
 package chaincode_test
 
-// import (
-// 	"encoding/json"
-// 	"fmt"
-// 	"testing"
-
-// 	"github.com/hyperledger/fabric-chaincode-go/v2/shim"
-// 	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
-// 	"github.com/hyperledger/fabric-protos-go-apiv2/ledger/queryresult"
-// 	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
-// 	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/mocks"
-// 	"github.com/stretchr/testify/require"
-// )
-
-// //go:generate counterfeiter -o mocks/transaction.go -fake-name TransactionContext . transactionContext
-// type transactionContext interface {
-// 	contractapi.TransactionContextInterface
-// }
-
-// //go:generate counterfeiter -o mocks/chaincodestub.go -fake-name ChaincodeStub . chaincodeStub
-// type chaincodeStub interface {
-// 	shim.ChaincodeStubInterface
-// }
-
-// //go:generate counterfeiter -o mocks/statequeryiterator.go -fake-name StateQueryIterator . stateQueryIterator
-// type stateQueryIterator interface {
-// 	shim.StateQueryIteratorInterface
-// }
-
-// func TestInitLedger(t *testing.T) {
-// 	chaincodeStub := &mocks.ChaincodeStub{}
-// 	transactionContext := &mocks.TransactionContext{}
-// 	transactionContext.GetStubReturns(chaincodeStub)
-
-// 	assetTransfer := chaincode.SmartContract{}
-// 	err := assetTransfer.InitLedger(transactionContext)
-// 	require.NoError(t, err)
-
-// 	chaincodeStub.PutStateReturns(fmt.Errorf("failed inserting key"))
-// 	err = assetTransfer.InitLedger(transactionContext)
-// 	require.EqualError(t, err, "failed to put to world state. failed inserting key")
-// }
-
-// func TestCreateAsset(t *testing.T) {
-// 	chaincodeStub := &mocks.ChaincodeStub{}
-// 	transactionContext := &mocks.TransactionContext{}
-// 	transactionContext.GetStubReturns(chaincodeStub)
-
-// 	assetTransfer := chaincode.SmartContract{}
-// 	err := assetTransfer.CreateAsset(transactionContext, "", "", 0, "", 0)
-// 	require.NoError(t, err)
-
-// 	chaincodeStub.GetStateReturns([]byte{}, nil)
-// 	err = assetTransfer.CreateAsset(transactionContext, "asset1", "", 0, "", 0)
-// 	require.EqualError(t, err, "the asset asset1 already exists")
-
-// 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-// 	err = assetTransfer.CreateAsset(transactionContext, "asset1", "", 0, "", 0)
-// 	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
-// }
-
-// func TestReadAsset(t *testing.T) {
-// 	chaincodeStub := &mocks.ChaincodeStub{}
-// 	transactionContext := &mocks.TransactionContext{}
-// 	transactionContext.GetStubReturns(chaincodeStub)
-
-// 	expectedAsset := &chaincode.Asset{ID: "asset1"}
-// 	bytes, err := json.Marshal(expectedAsset)
-// 	require.NoError(t, err)
-
-// 	chaincodeStub.GetStateReturns(bytes, nil)
-// 	assetTransfer := chaincode.SmartContract{}
-// 	asset, err := assetTransfer.ReadAsset(transactionContext, "")
-// 	require.NoError(t, err)
-// 	require.Equal(t, expectedAsset, asset)
-
-// 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-// 	_, err = assetTransfer.ReadAsset(transactionContext, "")
-// 	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
-
-// 	chaincodeStub.GetStateReturns(nil, nil)
-// 	asset, err = assetTransfer.ReadAsset(transactionContext, "asset1")
-// 	require.EqualError(t, err, "the asset asset1 does not exist")
-// 	require.Nil(t, asset)
-// }
-
-// func TestUpdateAsset(t *testing.T) {
-// 	chaincodeStub := &mocks.ChaincodeStub{}
-// 	transactionContext := &mocks.TransactionContext{}
-// 	transactionContext.GetStubReturns(chaincodeStub)
-
-// 	expectedAsset := &chaincode.Asset{ID: "asset1"}
-// 	bytes, err := json.Marshal(expectedAsset)
-// 	require.NoError(t, err)
-
-// 	chaincodeStub.GetStateReturns(bytes, nil)
-// 	assetTransfer := chaincode.SmartContract{}
-// 	err = assetTransfer.UpdateAsset(transactionContext, "", "", 0, "", 0)
-// 	require.NoError(t, err)
-
-// 	chaincodeStub.GetStateReturns(nil, nil)
-// 	err = assetTransfer.UpdateAsset(transactionContext, "asset1", "", 0, "", 0)
-// 	require.EqualError(t, err, "the asset asset1 does not exist")
-
-// 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-// 	err = assetTransfer.UpdateAsset(transactionContext, "asset1", "", 0, "", 0)
-// 	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
-// }
-
-// func TestDeleteAsset(t *testing.T) {
-// 	chaincodeStub := &mocks.ChaincodeStub{}
-// 	transactionContext := &mocks.TransactionContext{}
-// 	transactionContext.GetStubReturns(chaincodeStub)
-
-// 	asset := &chaincode.Asset{ID: "asset1"}
-// 	bytes, err := json.Marshal(asset)
-// 	require.NoError(t, err)
-
-// 	chaincodeStub.GetStateReturns(bytes, nil)
-// 	chaincodeStub.DelStateReturns(nil)
-// 	assetTransfer := chaincode.SmartContract{}
-// 	err = assetTransfer.DeleteAsset(transactionContext, "")
-// 	require.NoError(t, err)
-
-// 	chaincodeStub.GetStateReturns(nil, nil)
-// 	err = assetTransfer.DeleteAsset(transactionContext, "asset1")
-// 	require.EqualError(t, err, "the asset asset1 does not exist")
-
-// 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-// 	err = assetTransfer.DeleteAsset(transactionContext, "")
-// 	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
-// }
-
-// func TestTransferAsset(t *testing.T) {
-// 	chaincodeStub := &mocks.ChaincodeStub{}
-// 	transactionContext := &mocks.TransactionContext{}
-// 	transactionContext.GetStubReturns(chaincodeStub)
-
-// 	asset := &chaincode.Asset{ID: "asset1"}
-// 	bytes, err := json.Marshal(asset)
-// 	require.NoError(t, err)
-
-// 	chaincodeStub.GetStateReturns(bytes, nil)
-// 	assetTransfer := chaincode.SmartContract{}
-// 	_, err = assetTransfer.TransferAsset(transactionContext, "", "")
-// 	require.NoError(t, err)
-
-// 	chaincodeStub.GetStateReturns(nil, fmt.Errorf("unable to retrieve asset"))
-// 	_, err = assetTransfer.TransferAsset(transactionContext, "", "")
-// 	require.EqualError(t, err, "failed to read from world state: unable to retrieve asset")
-// }
-
-// func TestGetAllAssets(t *testing.T) {
-// 	asset := &chaincode.Asset{ID: "asset1"}
-// 	bytes, err := json.Marshal(asset)
-// 	require.NoError(t, err)
-
-// 	iterator := &mocks.StateQueryIterator{}
-// 	iterator.HasNextReturnsOnCall(0, true)
-// 	iterator.HasNextReturnsOnCall(1, false)
-// 	iterator.NextReturns(&queryresult.KV{Value: bytes}, nil)
-
-// 	chaincodeStub := &mocks.ChaincodeStub{}
-// 	transactionContext := &mocks.TransactionContext{}
-// 	transactionContext.GetStubReturns(chaincodeStub)
-
-// 	chaincodeStub.GetStateByRangeReturns(iterator, nil)
-// 	assetTransfer := &chaincode.SmartContract{}
-// 	assets, err := assetTransfer.GetAllAssets(transactionContext)
-// 	require.NoError(t, err)
-// 	require.Equal(t, []*chaincode.Asset{asset}, assets)
-
-// 	iterator.HasNextReturns(true)
-// 	iterator.NextReturns(nil, fmt.Errorf("failed retrieving next item"))
-// 	assets, err = assetTransfer.GetAllAssets(transactionContext)
-// 	require.EqualError(t, err, "failed retrieving next item")
-// 	require.Nil(t, assets)
-
-// 	chaincodeStub.GetStateByRangeReturns(nil, fmt.Errorf("failed retrieving all assets"))
-// 	assets, err = assetTransfer.GetAllAssets(transactionContext)
-// 	require.EqualError(t, err, "failed retrieving all assets")
-// 	require.Nil(t, assets)
-// }
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/fakestub"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	org1MSP = "Org1MSP"
+	org2MSP = "Org2MSP"
+)
+
+type ctxFunc = func(ctx contractapi.TransactionContextInterface) error
+
+// testNetwork is a ledger with the identities used across the tests: an Org1
+// admin, an Org1 farmer, an Org2 buyer, and an Org2 transporter and lab that carry
+// their supply chain role
+type testNetwork struct {
+	t           *testing.T
+	ledger      *fakestub.Ledger
+	contract    *chaincode.SmartContract
+	admin       *fakestub.Identity
+	farmer      *fakestub.Identity
+	buyer       *fakestub.Identity
+	transporter *fakestub.Identity
+	lab         *fakestub.Identity
+}
+
+func newTestNetwork(t *testing.T) *testNetwork {
+	return &testNetwork{
+		t:           t,
+		ledger:      fakestub.NewLedger(),
+		contract:    &chaincode.SmartContract{},
+		admin:       newIdentity(t, org1MSP, "admin", []string{"admin"}, map[string]string{"hf.Type": "admin"}),
+		farmer:      newIdentity(t, org1MSP, "farmer", []string{"client"}, map[string]string{"hf.Type": "client"}),
+		buyer:       newIdentity(t, org2MSP, "buyer", []string{"client"}, nil),
+		transporter: newIdentity(t, org2MSP, "transporter", []string{"client"}, map[string]string{"hf.Type": "client", "role": "transporter"}),
+		lab:         newIdentity(t, org2MSP, "lab", []string{"client"}, map[string]string{"hf.Type": "client", "role": "lab"}),
+	}
+}
+
+func newIdentity(t *testing.T, mspID string, name string, organizationalUnits []string, attributes map[string]string) *fakestub.Identity {
+	identity, err := fakestub.NewIdentity(mspID, name, organizationalUnits, attributes)
+	require.NoError(t, err)
+	return identity
+}
+
+func (n *testNetwork) submit(identity *fakestub.Identity, fn ctxFunc) error {
+	return n.ledger.Submit(identity, fn)
+}
+
+func (n *testNetwork) evaluate(identity *fakestub.Identity, fn ctxFunc) error {
+	return n.ledger.Evaluate(identity, fn)
+}
+
+func (n *testNetwork) createHerbBatch(id string, botanicalName string, region string, harvestDate string, quantity float64) error {
+	return n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CreateHerbBatch(ctx, id, botanicalName, "Test Farm", harvestDate, "Ravi Sharma", chaincode.StatusHarvested, region, quantity, "", "")
+	})
+}
+
+func (n *testNetwork) mustCreateHerbBatch(id string, botanicalName string, region string, harvestDate string, quantity float64) {
+	require.NoError(n.t, n.createHerbBatch(id, botanicalName, region, harvestDate, quantity))
+}
+
+func (n *testNetwork) readHerbBatch(id string) *chaincode.HerbBatch {
+	var herbBatch *chaincode.HerbBatch
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		herbBatch, err = n.contract.ReadHerbBatch(ctx, id)
+		return err
+	})
+	require.NoError(n.t, err)
+	return herbBatch
+}
+
+func (n *testNetwork) ledgerStats() *chaincode.LedgerStats {
+	var stats *chaincode.LedgerStats
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		stats, err = n.contract.GetLedgerStats(ctx)
+		return err
+	})
+	require.NoError(n.t, err)
+	return stats
+}
+
+func (n *testNetwork) accountID(identity *fakestub.Identity) string {
+	id, err := identity.ID()
+	require.NoError(n.t, err)
+	return id
+}
+
+func requireCode(t *testing.T, err error, code chaincode.ErrorCode) {
+	t.Helper()
+	require.Error(t, err)
+	require.Equal(t, code, chaincode.ErrorCodeOf(err), err.Error())
+}
+
+func TestInitLedger(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.submit(n.admin, n.contract.InitLedger)
+	require.NoError(t, err)
+
+	var herbBatches []*chaincode.HerbBatch
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		herbBatches, err = n.contract.GetAllHerbBatches(ctx)
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, herbBatches, 6)
+	for _, herbBatch := range herbBatches {
+		require.Equal(t, org1MSP, herbBatch.OwnerOrg)
+		require.Equal(t, herbBatch.Quantity, herbBatch.RemainingQuantity)
+	}
+
+	require.Equal(t, 6, n.ledgerStats().TotalBatches)
+}
+
+func TestCreateHerbBatch(t *testing.T) {
+	n := newTestNetwork(t)
+
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	herbBatch := n.readHerbBatch("batch1")
+	require.Equal(t, &chaincode.HerbBatch{
+		ID:                "batch1",
+		BotanicalName:     "Withania somnifera",
+		ExpiryDate:        "2025-08-15",
+		Farm:              "Test Farm",
+		HarvestDate:       "2024-08-15",
+		Owner:             "Ravi Sharma",
+		OwnerID:           n.accountID(n.farmer),
+		OwnerOrg:          org1MSP,
+		Quantity:          120,
+		Region:            "Kerala",
+		RemainingQuantity: 120,
+		Status:            chaincode.StatusHarvested,
+	}, herbBatch)
+
+	err := n.createHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+	requireCode(t, err, chaincode.CodeAlreadyExists)
+
+	err = n.createHerbBatch("batch2", "Withania somnifera", "Kerala", "2024-08-15", 0)
+	requireCode(t, err, chaincode.CodeValidation)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.CreateHerbBatch(ctx, "batch3", "Curcuma longa", "Test Farm", "2024-08-20", "Ravi Sharma", chaincode.StatusHarvested, "Kerala", 10, "", "c2lnbmF0dXJl")
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+}
+
+func TestReadHerbBatch(t *testing.T) {
+	n := newTestNetwork(t)
+
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.ReadHerbBatch(ctx, "missing")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+	require.EqualError(t, err, `{"code":"NOT_FOUND","message":"the herb batch missing does not exist"}`)
+}
+
+func TestUpdateHerbBatch(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	err := n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatch(ctx, "batch1", "Withania somnifera", "Spice Traders Farm", "2024-08-15", "Spice Traders", chaincode.StatusHarvested)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+	require.Equal(t, "Test Farm", n.readHerbBatch("batch1").Farm)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatch(ctx, "batch1", "Withania somnifera", "Kerala Ayurveda Farms", "2024-08-15", "Priya Patel", chaincode.StatusPackaged)
+	})
+	require.NoError(t, err)
+
+	herbBatch := n.readHerbBatch("batch1")
+	require.Equal(t, "Kerala Ayurveda Farms", herbBatch.Farm)
+	require.Equal(t, "Priya Patel", herbBatch.Owner)
+	require.Equal(t, 120.0, herbBatch.Quantity)
+
+	stats := n.ledgerStats()
+	require.Equal(t, map[string]int{chaincode.StatusPackaged: 1}, stats.ByStatus)
+	require.Equal(t, map[string]int{"Kerala Ayurveda Farms": 1}, stats.ByFarm)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatch(ctx, "batch1", "Withania somnifera", "Kerala Ayurveda Farms", "2024-09-01", "Priya Patel", chaincode.StatusPackaged)
+	})
+	requireCode(t, err, chaincode.CodeValidation)
+	require.Equal(t, "2024-08-15", n.readHerbBatch("batch1").HarvestDate)
+
+	err = n.submit(n.admin, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatch(ctx, "batch1", "Withania somnifera", "Kerala Ayurveda Farms", "2024-08-15", "Priya Patel", chaincode.StatusCertified)
+	})
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+	require.Equal(t, chaincode.StatusPackaged, n.readHerbBatch("batch1").Status)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatch(ctx, "missing", "", "", "2024-09-01", "", "")
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+}
+
+func TestDeleteHerbBatch(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	err := n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DeleteHerbBatch(ctx, "batch1")
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+	require.Equal(t, 1, n.ledgerStats().TotalBatches)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DeleteHerbBatch(ctx, "batch1")
+	})
+	require.NoError(t, err)
+
+	var exists bool
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		exists, err = n.contract.HerbBatchExists(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.False(t, exists)
+	require.Equal(t, 0, n.ledgerStats().TotalBatches)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DeleteHerbBatch(ctx, "batch1")
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+}
+
+func TestTransferHerbBatch(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	var oldOwner string
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		oldOwner, err = n.contract.TransferHerbBatch(ctx, "batch1", "Priya Patel", "")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, "Ravi Sharma", oldOwner)
+	require.Equal(t, org1MSP, n.readHerbBatch("batch1").OwnerOrg)
+
+	transferToOrg2 := func(identity *fakestub.Identity) error {
+		return n.submit(identity, func(ctx contractapi.TransactionContextInterface) error {
+			_, err := n.contract.TransferHerbBatch(ctx, "batch1", "Spice Traders", org2MSP)
+			return err
+		})
+	}
+	// the farmer no longer holds the batch, and Org2 has not registered yet
+	requireCode(t, transferToOrg2(n.farmer), chaincode.CodeForbidden)
+	requireCode(t, transferToOrg2(n.buyer), chaincode.CodeForbidden)
+	requireCode(t, transferToOrg2(n.admin), chaincode.CodeValidation)
+
+	n.registerOrg2()
+	require.NoError(t, transferToOrg2(n.admin))
+
+	herbBatch := n.readHerbBatch("batch1")
+	require.Equal(t, "Spice Traders", herbBatch.Owner)
+	require.Equal(t, org2MSP, herbBatch.OwnerOrg)
+
+	var orgs []string
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		orgs, err = n.contract.GetHerbBatchEndorsingOrgs(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{org2MSP}, orgs)
+}
+
+func TestUpdateHerbBatchStatus(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	err := n.submit(n.buyer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "batch1", chaincode.StatusPackaged)
+	})
+	requireCode(t, err, chaincode.CodeForbidden)
+	require.Equal(t, chaincode.StatusHarvested, n.readHerbBatch("batch1").Status)
+
+	// statuses of the workflow are only reached through its actions and roles
+	for _, identity := range []*fakestub.Identity{n.farmer, n.admin} {
+		for _, status := range []string{chaincode.StatusInTransit, chaincode.StatusLabTesting, chaincode.StatusCertified} {
+			err = n.submit(identity, func(ctx contractapi.TransactionContextInterface) error {
+				return n.contract.UpdateHerbBatchStatus(ctx, "batch1", status)
+			})
+			requireCode(t, err, chaincode.CodeInvalidTransition)
+		}
+	}
+	require.Equal(t, chaincode.StatusHarvested, n.readHerbBatch("batch1").Status)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "batch1", chaincode.StatusPackaged)
+	})
+	require.NoError(t, err)
+	require.Equal(t, chaincode.StatusPackaged, n.readHerbBatch("batch1").Status)
+	require.Equal(t, map[string]int{chaincode.StatusPackaged: 1}, n.ledgerStats().ByStatus)
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "missing", chaincode.StatusPackaged)
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+}
+
+func TestGetHerbBatchEndorsingOrgs(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	var orgs []string
+	err := n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		orgs, err = n.contract.GetHerbBatchEndorsingOrgs(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{org1MSP}, orgs)
+
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		_, err := n.contract.GetHerbBatchEndorsingOrgs(ctx, "missing")
+		return err
+	})
+	requireCode(t, err, chaincode.CodeNotFound)
+}
@@ -0,0 +1,206 @@
+package chaincode
+
+import (
+	"strconv"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+// statObjectType is the composite key namespace for statistics deltas. Each change
+// writes its own delta key, keyed by transaction and batch, instead of incrementing a
+// shared counter so that concurrent transactions never conflict on a hot key.
+const statObjectType = "stat"
+
+// Statistics dimensions
+const (
+	statTotal   = "total"
+	statStatus  = "status"
+	statFarm    = "farm"
+	statSpecies = "species"
+	statMonth   = "month"
+)
+
+// statTotalValue is the single value counted under the total dimension
+const statTotalValue = "all"
+
+// LedgerStats summarises the herb batches currently in the world state
+type LedgerStats struct {
+	ByFarm       map[string]int `json:"byFarm"`
+	ByMonth      map[string]int `json:"byMonth"`
+	BySpecies    map[string]int `json:"bySpecies"`
+	ByStatus     map[string]int `json:"byStatus"`
+	TotalBatches int            `json:"totalBatches"`
+}
+
+// GetLedgerStats sums the statistics deltas into batch counts per status, farm,
+// species and harvest month
+func (s *SmartContract) GetLedgerStats(ctx contractapi.TransactionContextInterface) (*LedgerStats, error) {
+	stats := LedgerStats{
+		ByFarm:    map[string]int{},
+		ByMonth:   map[string]int{},
+		BySpecies: map[string]int{},
+		ByStatus:  map[string]int{},
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(statObjectType, []string{})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		_, keyParts, err := ctx.GetStub().SplitCompositeKey(queryResponse.Key)
+		if err != nil {
+			return nil, err
+		}
+		delta, err := strconv.Atoi(string(queryResponse.Value))
+		if err != nil {
+			return nil, internalError("invalid statistics delta %s: %v", queryResponse.Key, err)
+		}
+
+		dimension, value := keyParts[0], keyParts[1]
+		switch dimension {
+		case statTotal:
+			stats.TotalBatches += delta
+		case statStatus:
+			stats.ByStatus[value] += delta
+		case statFarm:
+			stats.ByFarm[value] += delta
+		case statSpecies:
+			stats.BySpecies[value] += delta
+		case statMonth:
+			stats.ByMonth[value] += delta
+		}
+	}
+
+	for _, counts := range []map[string]int{stats.ByFarm, stats.ByMonth, stats.BySpecies, stats.ByStatus} {
+		for value, count := range counts {
+			if count == 0 {
+				delete(counts, value)
+			}
+		}
+	}
+
+	return &stats, nil
+}
+
+// RebuildLedgerStats replaces all statistics deltas with one delta per herb batch
+// recounted from the world state. It backfills batches written before statistics
+// were kept and compacts the accumulated deltas.
+func (s *SmartContract) RebuildLedgerStats(ctx contractapi.TransactionContextInterface) error {
+	err := requireAdmin(ctx)
+	if err != nil {
+		return err
+	}
+
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(statObjectType, []string{})
+	if err != nil {
+		return err
+	}
+	var deltaKeys []string
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			resultsIterator.Close()
+			return err
+		}
+		deltaKeys = append(deltaKeys, queryResponse.Key)
+	}
+	resultsIterator.Close()
+
+	for _, key := range deltaKeys {
+		err = ctx.GetStub().DelState(key)
+		if err != nil {
+			return internalError("failed to delete statistics delta: %v", err)
+		}
+	}
+
+	herbBatches, err := s.GetAllHerbBatches(ctx)
+	if err != nil {
+		return err
+	}
+	for _, herbBatch := range herbBatches {
+		err = recordStatsChange(ctx, nil, herbBatch)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// recordStatsChange writes the statistics deltas for a herb batch changing from
+// before to after. A nil before records a creation and a nil after a deletion.
+func recordStatsChange(ctx contractapi.TransactionContextInterface, before *HerbBatch, after *HerbBatch) error {
+	batchID := ""
+	oldValues := map[string]string{}
+	newValues := map[string]string{}
+	if before != nil {
+		batchID = before.ID
+		oldValues = statValues(before)
+	}
+	if after != nil {
+		batchID = after.ID
+		newValues = statValues(after)
+	}
+
+	for _, dimension := range []string{statTotal, statStatus, statFarm, statSpecies, statMonth} {
+		oldValue, hadOld := oldValues[dimension]
+		newValue, hasNew := newValues[dimension]
+		if hadOld && hasNew && oldValue == newValue {
+			continue
+		}
+
+		if hadOld {
+			err := putStatDelta(ctx, dimension, oldValue, batchID, -1)
+			if err != nil {
+				return err
+			}
+		}
+		if hasNew {
+			err := putStatDelta(ctx, dimension, newValue, batchID, 1)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// statValues returns the value a herb batch is counted under in each dimension
+func statValues(herbBatch *HerbBatch) map[string]string {
+	month := herbBatch.HarvestDate
+	if len(month) >= 7 {
+		month = month[:7]
+	}
+
+	return map[string]string{
+		statTotal:   statTotalValue,
+		statStatus:  herbBatch.Status,
+		statFarm:    herbBatch.Farm,
+		statSpecies: herbBatch.BotanicalName,
+		statMonth:   month,
+	}
+}
+
+func putStatDelta(ctx contractapi.TransactionContextInterface, dimension string, value string, batchID string, delta int) error {
+	// the sign is part of the key so that a batch leaving and re-entering the same
+	// value within one transaction writes two distinct deltas
+	sign := "+"
+	if delta < 0 {
+		sign = "-"
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(statObjectType, []string{dimension, value, ctx.GetStub().GetTxID(), batchID, sign})
+	if err != nil {
+		return internalError("failed to create composite key: %v", err)
+	}
+
+	return ctx.GetStub().PutState(key, []byte(strconv.Itoa(delta)))
+}
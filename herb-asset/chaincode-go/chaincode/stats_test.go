@@ -0,0 +1,52 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetLedgerStats(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 10)
+	n.mustCreateHerbBatch("batch2", "Withania somnifera", "Kerala", "2024-09-01", 10)
+	n.mustCreateHerbBatch("batch3", "Curcuma longa", "Kerala", "2024-09-02", 10)
+
+	err := n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.UpdateHerbBatchStatus(ctx, "batch3", chaincode.StatusPackaged)
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, &chaincode.LedgerStats{
+		ByFarm:       map[string]int{"Test Farm": 3},
+		ByMonth:      map[string]int{"2024-08": 1, "2024-09": 2},
+		BySpecies:    map[string]int{"Withania somnifera": 2, "Curcuma longa": 1},
+		ByStatus:     map[string]int{chaincode.StatusHarvested: 2, chaincode.StatusPackaged: 1},
+		TotalBatches: 3,
+	}, n.ledgerStats())
+
+	err = n.submit(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		return n.contract.DeleteHerbBatch(ctx, "batch1")
+	})
+	require.NoError(t, err)
+
+	stats := n.ledgerStats()
+	require.Equal(t, 2, stats.TotalBatches)
+	require.Equal(t, map[string]int{"2024-09": 2}, stats.ByMonth)
+}
+
+func TestRebuildLedgerStats(t *testing.T) {
+	n := newTestNetwork(t)
+	require.NoError(t, n.submit(n.admin, n.contract.InitLedger))
+	n.mustCreateHerbBatch("batch7", "Curcuma longa", "Kerala", "2024-09-02", 10)
+	expected := n.ledgerStats()
+
+	err := n.submit(n.farmer, n.contract.RebuildLedgerStats)
+	requireCode(t, err, chaincode.CodeForbidden)
+
+	err = n.submit(n.admin, n.contract.RebuildLedgerStats)
+	require.NoError(t, err)
+	require.Equal(t, expected, n.ledgerStats())
+}
@@ -0,0 +1,179 @@
+package chaincode
+
+import (
+	"encoding/json"
+	"sort"
+	"strings"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+)
+
+const supplyChainEventObjectType = "supplyChainEvent"
+
+// Supply chain workflow actions
+const (
+	ActionTransport  = "transport"   // a transporter picks up a harvested batch
+	ActionLabReceive = "lab-receive" // a lab receives a batch in transit for testing
+	ActionCertify    = "certify"     // the lab certifies a tested batch
+)
+
+// workflowTransition is the status a workflow action requires, the one it leads to
+// and the role allowed to perform it
+type workflowTransition struct {
+	from string
+	to   string
+	role string
+}
+
+var workflowTransitions = map[string]workflowTransition{
+	ActionTransport:  {StatusHarvested, StatusInTransit, transporterRole},
+	ActionLabReceive: {StatusInTransit, StatusLabTesting, labRole},
+	ActionCertify:    {StatusLabTesting, StatusCertified, labRole},
+}
+
+// requireWorkflowAction returns an error when status can only be reached through a
+// workflow action, whose starting status and role RecordSupplyChainEvent checks
+func requireWorkflowAction(herbBatch *HerbBatch, status string) error {
+	for action, transition := range workflowTransitions {
+		if transition.to == status {
+			return invalidTransitionError("the herb batch %s can only become %s through the %s action", herbBatch.ID, status, action)
+		}
+	}
+
+	return nil
+}
+
+// SupplyChainEvent records who moved a herb batch along the supply chain, where and
+// why. Its ID is the ID of the transaction that recorded it.
+type SupplyChainEvent struct {
+	ID         string `json:"ID"`
+	Action     string `json:"action"`
+	Actor      string `json:"actor"`    // Fabric ID of the submitting client
+	ActorOrg   string `json:"actorOrg"` // MSP ID of the submitting client
+	BatchID    string `json:"batchId"`
+	FromStatus string `json:"fromStatus"`
+	Location   string `json:"location"`
+	Notes      string `json:"notes"`
+	Timestamp  string `json:"timestamp"`
+	ToStatus   string `json:"toStatus"`
+}
+
+// RecordSupplyChainEvent performs a workflow action on a herb batch, moving it to
+// the action's status, and returns the recorded event. The batch must be in the
+// status the action starts from, and the submitting client must carry the action's
+// role (transporter for transport, lab for lab-receive and certify) in its "role"
+// attribute or be an organisation admin. The client is recorded as the actor.
+func (s *SmartContract) RecordSupplyChainEvent(ctx contractapi.TransactionContextInterface, batchID string, action string, location string, notes string) (*SupplyChainEvent, error) {
+	transition, ok := workflowTransitions[action]
+	if !ok {
+		return nil, validationError("invalid supply chain action %s", action)
+	}
+	err := requireRole(ctx, transition.role)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(location) == "" {
+		return nil, validationError("the location is required")
+	}
+
+	herbBatch, err := s.ReadHerbBatch(ctx, batchID)
+	if err != nil {
+		return nil, err
+	}
+	if herbBatch.Status != transition.from {
+		return nil, invalidTransitionError("the herb batch %s is %s; %s requires %s", batchID, herbBatch.Status, action, transition.from)
+	}
+	err = requireStatusChangeAllowed(ctx, herbBatch, transition.to)
+	if err != nil {
+		return nil, err
+	}
+
+	now, err := transactionTime(ctx)
+	if err != nil {
+		return nil, err
+	}
+	actor, err := ctx.GetClientIdentity().GetID()
+	if err != nil {
+		return nil, internalError("failed to get client identity: %v", err)
+	}
+	actorOrg, err := ctx.GetClientIdentity().GetMSPID()
+	if err != nil {
+		return nil, internalError("failed to read client MSP ID: %v", err)
+	}
+
+	event := SupplyChainEvent{
+		ID:         ctx.GetStub().GetTxID(),
+		Action:     action,
+		Actor:      actor,
+		ActorOrg:   actorOrg,
+		BatchID:    batchID,
+		FromStatus: transition.from,
+		Location:   location,
+		Notes:      notes,
+		Timestamp:  now,
+		ToStatus:   transition.to,
+	}
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ctx.GetStub().CreateCompositeKey(supplyChainEventObjectType, []string{batchID, event.ID})
+	if err != nil {
+		return nil, internalError("failed to create composite key: %v", err)
+	}
+	err = ctx.GetStub().PutState(key, eventJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	before := *herbBatch
+	herbBatch.Status = transition.to
+	herbBatchJSON, err := json.Marshal(herbBatch)
+	if err != nil {
+		return nil, err
+	}
+	err = ctx.GetStub().PutState(batchID, herbBatchJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	err = recordStatsChange(ctx, &before, herbBatch)
+	if err != nil {
+		return nil, err
+	}
+
+	return &event, nil
+}
+
+// GetSupplyChainEvents returns the workflow events recorded for a herb batch in the
+// order they happened
+func (s *SmartContract) GetSupplyChainEvents(ctx contractapi.TransactionContextInterface, batchID string) ([]*SupplyChainEvent, error) {
+	resultsIterator, err := ctx.GetStub().GetStateByPartialCompositeKey(supplyChainEventObjectType, []string{batchID})
+	if err != nil {
+		return nil, err
+	}
+	defer resultsIterator.Close()
+
+	events := []*SupplyChainEvent{}
+	for resultsIterator.HasNext() {
+		queryResponse, err := resultsIterator.Next()
+		if err != nil {
+			return nil, err
+		}
+
+		var event SupplyChainEvent
+		err = json.Unmarshal(queryResponse.Value, &event)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, &event)
+	}
+
+	// keys are ordered by transaction ID, so restore the order from the timestamps
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Timestamp < events[j].Timestamp
+	})
+
+	return events, nil
+}
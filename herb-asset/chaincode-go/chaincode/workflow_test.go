@@ -0,0 +1,94 @@
+package chaincode_test
+
+import (
+	"testing"
+
+	"github.com/hyperledger/fabric-contract-api-go/v2/contractapi"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode"
+	"github.com/hyperledger/fabric-samples/asset-transfer-basic/chaincode-go/chaincode/fakestub"
+	"github.com/stretchr/testify/require"
+)
+
+func (n *testNetwork) recordSupplyChainEvent(identity *fakestub.Identity, action string, location string) (*chaincode.SupplyChainEvent, error) {
+	var event *chaincode.SupplyChainEvent
+	err := n.submit(identity, func(ctx contractapi.TransactionContextInterface) error {
+		var err error
+		event, err = n.contract.RecordSupplyChainEvent(ctx, "batch1", action, location, "Sealed in crates")
+		return err
+	})
+	return event, err
+}
+
+func TestRecordSupplyChainEvent(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	_, err := n.recordSupplyChainEvent(n.lab, chaincode.ActionCertify, "Kochi Lab")
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	event, err := n.recordSupplyChainEvent(n.transporter, chaincode.ActionTransport, "Kochi Depot")
+	require.NoError(t, err)
+	require.NotEmpty(t, event.ID)
+	require.Equal(t, n.accountID(n.transporter), event.Actor)
+	require.Equal(t, org2MSP, event.ActorOrg)
+	require.Equal(t, chaincode.StatusHarvested, event.FromStatus)
+	require.Equal(t, chaincode.StatusInTransit, event.ToStatus)
+	require.Equal(t, "Sealed in crates", event.Notes)
+	require.Equal(t, chaincode.StatusInTransit, n.readHerbBatch("batch1").Status)
+	require.Equal(t, map[string]int{chaincode.StatusInTransit: 1}, n.ledgerStats().ByStatus)
+
+	_, err = n.recordSupplyChainEvent(n.transporter, chaincode.ActionTransport, "Kochi Depot")
+	requireCode(t, err, chaincode.CodeInvalidTransition)
+
+	_, err = n.recordSupplyChainEvent(n.lab, chaincode.ActionLabReceive, " ")
+	requireCode(t, err, chaincode.CodeValidation)
+
+	_, err = n.recordSupplyChainEvent(n.lab, "ship", "Kochi Depot")
+	requireCode(t, err, chaincode.CodeValidation)
+
+	_, err = n.recordSupplyChainEvent(n.lab, chaincode.ActionLabReceive, "Kochi Lab")
+	require.NoError(t, err)
+	_, err = n.recordSupplyChainEvent(n.admin, chaincode.ActionCertify, "Kochi Lab")
+	require.NoError(t, err, "an organisation admin may perform any action")
+	require.Equal(t, chaincode.StatusCertified, n.readHerbBatch("batch1").Status)
+
+	var events []*chaincode.SupplyChainEvent
+	err = n.evaluate(n.farmer, func(ctx contractapi.TransactionContextInterface) error {
+		events, err = n.contract.GetSupplyChainEvents(ctx, "batch1")
+		return err
+	})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, chaincode.ActionTransport, events[0].Action)
+	require.Equal(t, chaincode.ActionLabReceive, events[1].Action)
+	require.Equal(t, chaincode.ActionCertify, events[2].Action)
+
+	document, err := n.herbBatchEPCIS("batch1")
+	require.NoError(t, err)
+	eventList := document.EPCISBody.EventList
+	require.Len(t, eventList, 4)
+	require.Equal(t, "shipping", eventList[1].BizStep)
+	require.Equal(t, "urn:herbtrace:location:Kochi%20Depot", eventList[1].ReadPoint.ID)
+	require.Equal(t, "conformant", eventList[3].Disposition)
+	require.Equal(t, "urn:herbtrace:location:Kochi%20Lab", eventList[3].ReadPoint.ID)
+}
+
+func TestRecordSupplyChainEventRequiresTheActionsRole(t *testing.T) {
+	n := newTestNetwork(t)
+	n.mustCreateHerbBatch("batch1", "Withania somnifera", "Kerala", "2024-08-15", 120)
+
+	for _, identity := range []*fakestub.Identity{n.farmer, n.buyer, n.lab} {
+		_, err := n.recordSupplyChainEvent(identity, chaincode.ActionTransport, "Kochi Depot")
+		requireCode(t, err, chaincode.CodeForbidden)
+	}
+	_, err := n.recordSupplyChainEvent(n.transporter, chaincode.ActionTransport, "Kochi Depot")
+	require.NoError(t, err)
+
+	_, err = n.recordSupplyChainEvent(n.transporter, chaincode.ActionLabReceive, "Kochi Lab")
+	requireCode(t, err, chaincode.CodeForbidden)
+	_, err = n.recordSupplyChainEvent(n.lab, chaincode.ActionLabReceive, "Kochi Lab")
+	require.NoError(t, err)
+	_, err = n.recordSupplyChainEvent(n.transporter, chaincode.ActionCertify, "Kochi Lab")
+	requireCode(t, err, chaincode.CodeForbidden)
+	require.Equal(t, chaincode.StatusLabTesting, n.readHerbBatch("batch1").Status)
+}